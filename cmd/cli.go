@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/services/archive"
+	"housematee-tgbot/services/household"
+	"housematee-tgbot/services/telemetry"
+	"housematee-tgbot/utilities"
+)
+
+const cliUsage = `Usage:
+  housematee                  run the bot
+  housematee validate-config
+  housematee sheets check-layout -chat <chat ID>
+  housematee month create -chat <chat ID> [-month YYYY_MM]
+  housematee report -chat <chat ID> [-month YYYY_MM]
+  housematee recompute-balances -chat <chat ID> [-month YYYY_MM]
+  housematee replay-audit -chat <chat ID> [-period YYYY_MM|YYYY|all]
+  housematee export -chat <chat ID> [-period YYYY_MM|YYYY|all] [-o file.zip]
+  housematee import -chat <chat ID> [-spreadsheet <ID>] [-apply] <file.zip>
+  housematee migrate -chat <chat ID> -to <spreadsheet ID> [-apply] [-link]
+
+The household of a chat is the one of /setup, settings.households or google_sheets.spreadsheet_id.
+Months default to the current sheet. Commands that write only print the changes unless -apply is given,
+except month create.
+`
+
+// runCLI runs a subcommand instead of the bot and returns the exit code
+func runCLI(args []string) int {
+	var run func(ctx context.Context, args []string) error
+	name, rest := args[0], args[1:]
+	if (name == "sheets" || name == "month") && len(rest) > 0 {
+		name, rest = name+" "+rest[0], rest[1:]
+	}
+	switch name {
+	case "validate-config":
+		run = runValidateConfig
+	case "sheets check-layout":
+		run = runCheckLayout
+	case "month create":
+		run = runMonthCreate
+	case "report":
+		run = runReport
+	case "recompute-balances":
+		run = runRecomputeBalances
+	case "replay-audit":
+		run = runReplayAudit
+	case "export":
+		run = runExport
+	case "import":
+		run = runImport
+	case "migrate":
+		run = runMigrate
+	case "help", "-h", "-help", "--help":
+		fmt.Print(cliUsage)
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+	// validate-config loads the configuration itself to report its problems
+	if name != "validate-config" {
+		if err := config.Load(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err.Error())
+			return 1
+		}
+		if err := initServices(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err.Error())
+			return 1
+		}
+	}
+
+	// The correlation ID of the run tags its log lines and Sheets calls
+	err := run(telemetry.WithCorrelationID(context.Background(), telemetry.NewCorrelationID()), rest)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err.Error())
+		return 1
+	}
+	return 0
+}
+
+// runValidateConfig loads and checks the configuration, the timezones and the household registry without
+// connecting to Telegram or Google Sheets
+func runValidateConfig(_ context.Context, args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := config.Load(); err != nil {
+		return err
+	}
+	appConfig := config.GetAppConfig()
+	if err := utilities.SetTimezone(appConfig.Settings.Timezone); err != nil {
+		return fmt.Errorf("settings.timezone: %w", err)
+	}
+	for _, c := range appConfig.Settings.Households.Chats {
+		if c.Timezone == "" {
+			continue
+		}
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("timezone of household %d: %w", c.ChatID, err)
+		}
+	}
+	registry, err := household.Open(appConfig.Settings.Households.Path)
+	if err != nil {
+		return fmt.Errorf("household registry: %w", err)
+	}
+
+	fmt.Printf("config ok: %s mode, %d configured households, %d linked with /setup, layout versions %s\n",
+		appConfig.Telegram.Mode, len(appConfig.Settings.Households.Chats), len(registry.All()), layoutVersions())
+	return nil
+}
+
+func layoutVersions() string {
+	versions := make([]string, 0)
+	for _, layout := range config.GetLayouts() {
+		if layout.From == "" {
+			versions = append(versions, strconv.Itoa(layout.Version))
+		} else {
+			versions = append(versions, fmt.Sprintf("%d from %s", layout.Version, layout.From))
+		}
+	}
+	return strings.Join(versions, ", ")
+}
+
+// runCheckLayout runs the checks of /diag and fails when one of them failed
+func runCheckLayout(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sheets check-layout", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	household, err := cliHousehold(*chatId, "")
+	if err != nil {
+		return err
+	}
+	checks, err := handlers.RunDiagnostics(ctx, household)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, check := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Result, check.Name, check.Detail)
+		if check.Result == handlers.DiagnosticFailed {
+			failed++
+		}
+	}
+	w.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// runMonthCreate copies the Template to a monthly sheet and makes it the current sheet, as /gsheets create
+func runMonthCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("month create", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	month := fs.String("month", "", "month of the sheet (YYYY_MM), this month by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	household, err := cliHousehold(*chatId, "")
+	if err != nil {
+		return err
+	}
+	sheetName := utilities.GetCurrentMonthSheetName(household.Location())
+	if *month != "" {
+		if sheetName, err = parseMonth(*month); err != nil {
+			return err
+		}
+	}
+
+	sheetInfo, err := handlers.CreateNewMonthSheet(ctx, household, sheetName, handlers.MonthDisplayName(sheetName))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %s (sheet ID %d), now the current sheet\n", sheetInfo.SheetName, sheetInfo.SheetId)
+	return nil
+}
+
+// runReport prints the report and the balances of a month, as /splitbill report
+func runReport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	month := fs.String("month", "", "month of the sheet (YYYY_MM), the current sheet by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	household, sheetName, err := cliMonth(ctx, *chatId, *month)
+	if err != nil {
+		return err
+	}
+	report, balances, err := handlers.GetMonthReport(ctx, household, sheetName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Report %s\n\n", sheetName)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Expenses\t%s\n", report.Expenses.Amount)
+	if report.Rent.Amount == "" || report.Rent.Amount == "0" {
+		fmt.Fprintf(w, "Rent\tnot paid\n")
+	} else {
+		fmt.Fprintf(w, "Rent\t%s\tpaid by %s\n", report.Rent.Amount, report.Rent.Note)
+	}
+	fmt.Fprintf(w, "Total\t%s\n", report.Total.Amount)
+	fmt.Fprintf(w, "\nMember\tTotal paid\tExpense balance\tRent balance\tFinal balance\n")
+	for _, username := range slices.Sorted(maps.Keys(balances.Users)) {
+		balance := balances.Users[username]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", username, balance.TotalPaid, balance.HaveToPay, balance.Balance, balance.FinalBalance)
+	}
+	return w.Flush()
+}
+
+// runRecomputeBalances computes the balances of a month from its records and compares them with the sheet
+func runRecomputeBalances(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("recompute-balances", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	month := fs.String("month", "", "month of the sheet (YYYY_MM), the current sheet by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	household, sheetName, err := cliMonth(ctx, *chatId, *month)
+	if err != nil {
+		return err
+	}
+	checks, skipped, err := handlers.RecomputeBalances(ctx, household, sheetName)
+	if err != nil {
+		return err
+	}
+
+	differ := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Member\tTotal paid\tHave to pay\tBalance\tFinal balance\tSheet\n")
+	for _, check := range checks {
+		b := check.Computed
+		status := "ok"
+		if !check.InSheet {
+			status = "missing from the Balances section"
+			differ++
+		} else if len(check.Mismatches) > 0 {
+			status = strings.Join(check.Mismatches, ", ")
+			differ++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", b.Username, b.TotalPaid, b.HaveToPay, b.Balance, b.FinalBalance, status)
+	}
+	w.Flush()
+	if len(skipped) > 0 {
+		fmt.Printf("left out expenses %v: the payer or a participant is not a member\n", skipped)
+	}
+	if differ > 0 {
+		return fmt.Errorf("the balances of %d members differ from the sheet, check the formulas of the Balances section", differ)
+	}
+	return nil
+}
+
+// runReplayAudit replays the audit trail of the expenses of a period and lists the rows that do not match it
+func runReplayAudit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay-audit", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	periodArg := fs.String("period", "", "month (YYYY_MM), year (YYYY) or all, the current sheet by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	household, err := cliHousehold(*chatId, "")
+	if err != nil {
+		return err
+	}
+	period, err := cliPeriod(ctx, household, *periodArg)
+	if err != nil {
+		return err
+	}
+	data, err := handlers.ExportHousehold(ctx, household, period)
+	if err != nil {
+		return err
+	}
+
+	findings := models.ReplayAudit(data.Months)
+	for _, finding := range findings {
+		fmt.Printf("%s expense %d: %s\n", finding.Sheet, finding.ExpenseID, finding.Problem)
+	}
+	expenses := 0
+	for _, month := range data.Months {
+		expenses += len(month.Expenses)
+	}
+	fmt.Printf("replayed %d expenses of %d month sheets\n", expenses, len(data.Months))
+	if len(findings) > 0 {
+		return fmt.Errorf("%d expenses do not match their audit trail", len(findings))
+	}
+	return nil
+}
+
+// runExport writes the archive of /export to a file, or to stdout with -o -
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	periodArg := fs.String("period", "", "month (YYYY_MM), year (YYYY) or all, the current sheet by default")
+	output := fs.String("o", "", "output file, - for stdout (default housematee_<chat>_<period>.zip)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	household, err := cliHousehold(*chatId, "")
+	if err != nil {
+		return err
+	}
+	period, err := cliPeriod(ctx, household, *periodArg)
+	if err != nil {
+		return err
+	}
+
+	data, err := handlers.ExportHousehold(ctx, household, period)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := archive.Write(&buf, data); err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err = io.Copy(os.Stdout, &buf)
+		return err
+	}
+	if *output == "" {
+		*output = archive.FileName(household.ChatID, period)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d month sheets of %s to %s\n", len(data.Months), period, *output)
+	return nil
+}
+
+// runImport prints the dry run of an import and applies it with -apply
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	spreadsheetId := fs.String("spreadsheet", "", "spreadsheet to import into instead of the one of the chat")
+	apply := fs.Bool("apply", false, "write the changes instead of only printing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one file to import")
+	}
+
+	household, err := cliHousehold(*chatId, *spreadsheetId)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	incoming, err := archive.Read(data)
+	if err != nil {
+		return err
+	}
+	return planAndApply(ctx, household, incoming, *apply)
+}
+
+// runMigrate copies every monthly sheet, the tasks and the task history of a household to another spreadsheet,
+// and with -link makes it the spreadsheet of the chat
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	chatId := fs.Int64("chat", 0, "chat ID of the household")
+	to := fs.String("to", "", "spreadsheet to copy the data to, with the Database, Template and Tasks sheets")
+	apply := fs.Bool("apply", false, "write the changes instead of only printing them")
+	link := fs.Bool("link", false, "with -apply, link the chat to the new spreadsheet once the data is copied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("-to is required")
+	}
+
+	source, err := cliHousehold(*chatId, "")
+	if err != nil {
+		return err
+	}
+	if source.SpreadsheetID == *to {
+		return fmt.Errorf("chat %d already uses spreadsheet %s", source.ChatID, *to)
+	}
+	currentSheet, err := handlers.GetCurrentSheetName(ctx, source)
+	if err != nil {
+		return err
+	}
+	data, err := handlers.ExportHousehold(ctx, source, models.ExportAll)
+	if err != nil {
+		return err
+	}
+
+	target := source
+	target.SpreadsheetID = *to
+	if err := planAndApply(ctx, target, data, *apply); err != nil || !*apply {
+		return err
+	}
+	// The current sheet of the source, so the bot carries on with the same month
+	if err := handlers.SetCurrentSheet(ctx, target, currentSheet); err != nil {
+		return err
+	}
+	fmt.Printf("current sheet set to %s\n", currentSheet)
+	if *link {
+		if err := handlers.LinkHousehold(target); err != nil {
+			return err
+		}
+		fmt.Printf("chat %d now uses spreadsheet %s\n", target.ChatID, target.SpreadsheetID)
+	}
+	return nil
+}
+
+// planAndApply prints the changes an import would make and writes them when apply is set
+func planAndApply(ctx context.Context, household models.Household, incoming models.Export, apply bool) error {
+	plan, err := handlers.PlanImport(ctx, household, incoming)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range plan.Changes {
+		line := fmt.Sprintf("%-7s %s", change.Action, change.Target)
+		if change.Detail != "" {
+			line += ": " + change.Detail
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("%d changes, %d records unchanged\n", len(plan.Changes), plan.Unchanged)
+	if plan.IsEmpty() || !apply {
+		if !plan.IsEmpty() {
+			fmt.Println("dry run, run again with -apply to write the changes")
+		}
+		return nil
+	}
+	if err := handlers.ApplyImport(ctx, household, plan); err != nil {
+		return err
+	}
+	fmt.Println("changes written")
+	return nil
+}
+
+// cliHousehold returns the household of a chat, with another spreadsheet when one is given
+func cliHousehold(chatId int64, spreadsheetId string) (models.Household, error) {
+	household, ok := handlers.GetHousehold(chatId)
+	if spreadsheetId != "" {
+		household.ChatID, household.SpreadsheetID = chatId, spreadsheetId
+		return household, nil
+	}
+	if !ok || !household.IsLinked() {
+		return models.Household{}, fmt.Errorf("chat %d has no spreadsheet, pass -chat or -spreadsheet", chatId)
+	}
+	return household, nil
+}
+
+// cliMonth returns the household of a chat and the monthly sheet of -month, the current sheet when it is empty
+func cliMonth(ctx context.Context, chatId int64, month string) (models.Household, string, error) {
+	household, err := cliHousehold(chatId, "")
+	if err != nil {
+		return models.Household{}, "", err
+	}
+	if month != "" {
+		sheetName, err := parseMonth(month)
+		return household, sheetName, err
+	}
+	sheetName, err := handlers.GetCurrentSheetName(ctx, household)
+	return household, sheetName, err
+}
+
+// cliPeriod parses -period, the current sheet by default as /export, this month when it is not a monthly sheet
+func cliPeriod(ctx context.Context, household models.Household, periodArg string) (models.ExportPeriod, error) {
+	if periodArg != "" {
+		return models.ParseExportPeriod(periodArg)
+	}
+	if current, err := handlers.GetCurrentSheetName(ctx, household); err == nil && models.ExportPeriod(current).IncludesSheet(current) {
+		return models.ExportPeriod(current), nil
+	}
+	return models.ExportPeriod(utilities.GetCurrentMonthSheetName(household.Location())), nil
+}
+
+// parseMonth checks that a month is a YYYY_MM sheet name
+func parseMonth(month string) (string, error) {
+	period, err := models.ParseExportPeriod(month)
+	if err != nil || !period.IncludesSheet(string(period)) {
+		return "", fmt.Errorf("%q is not a month (YYYY_MM)", month)
+	}
+	return string(period), nil
+}
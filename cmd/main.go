@@ -3,15 +3,26 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"housematee-tgbot/commands"
 	"housematee-tgbot/config"
 	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
 	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/services/household"
+	"housematee-tgbot/services/state"
+	"housematee-tgbot/services/telemetry"
+	"housematee-tgbot/utilities"
 
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 
@@ -20,32 +31,172 @@ import (
 	botHandlers "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 )
 
+// shutdownTimeout bounds the wait for the running handlers and jobs, a Sheets request and its retries fit in it
+const shutdownTimeout = services.RequestTimeout + 5*time.Second
+
 func main() {
-	// Load configuration
-	config.Load()
+	// Subcommands such as validate-config and export run instead of the bot
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+	// Report every problem of the configuration at once instead of panicking on the first
+	if err := config.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := initServices(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// open the store of the unfinished conversations
+	store, err := state.InitStore(config.GetAppConfig().Settings.Drafts.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open the drafts store: %s\n", err.Error())
+		os.Exit(1)
+	}
+	telemetry.RegisterActiveConversations(store.CountConversations)
+
+	// scheduler runs every periodic job, so shutdown can wait for the running ones
+	cronLogger := cron.PrintfLogger(logrus.StandardLogger())
+	scheduler := cron.New(
+		cron.WithLocation(utilities.Location()),
+		cron.WithChain(cron.Recover(cronLogger), cron.SkipIfStillRunning(cronLogger)),
+	)
+	enableSheetsCache(config.GetAppConfig().Settings.Cache, scheduler)
+
+	serverFailed := make(chan error, 1)
+	updater, server, err := initTelegramBot(scheduler, serverFailed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	scheduler.Start()
+
+	// Run until a deploy or Ctrl+C asks the bot to stop, or the HTTP server fails
+	exitCode := 0
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-ctx.Done():
+	case err := <-serverFailed:
+		logrus.Errorf("%s, shutting down", err.Error())
+		exitCode = 1
+	}
+	stop()
+
+	if !shutdown(updater, scheduler, server) {
+		exitCode = 1
+	}
+	// Exit through logrus so its exit handlers run and hooks can flush their entries
+	logrus.Exit(exitCode)
+}
+
+// initServices opens Google Sheets and the household registry with the loaded configuration, for the bot and the subcommands.
+// Its errors are reported like those of config.Load.
+func initServices() error {
+	// Add the correlation ID of the update or job being handled to every log line
+	logrus.AddHook(telemetry.LogHook{})
+	// Use the house timezone for every date helper, audit entry and cron job
+	if err := utilities.SetTimezone(config.GetAppConfig().Settings.Timezone); err != nil {
+		return fmt.Errorf("failed to load timezone: %w", err)
+	}
 	// init service
+	credentials := config.GetAppConfig().GoogleApis.Credentials
 	_, err := services.InitGSheetsSvc(
-		context.TODO(),
-		config.GetAppConfig().GoogleApis.Credentials,
+		context.Background(), // the token source lives as long as the bot
+		services.ServiceAccount{
+			ClientEmail: credentials.ClientEmail,
+			PrivateKey:  credentials.PrivateKey,
+			TokenURI:    credentials.TokenURI,
+		},
 	)
 	if err != nil {
-		panic("failed to init google sheets service: " + err.Error())
+		return fmt.Errorf("failed to init google sheets service: %w", err)
+	}
+	// open the registry of the chats linked to a spreadsheet with /setup
+	if _, err := household.InitRegistry(config.GetAppConfig().Settings.Households.Path); err != nil {
+		return fmt.Errorf("failed to open the household registry: %w", err)
+	}
+	return nil
+}
+
+// shutdown stops receiving updates, waits for the running handlers and scheduled jobs, then stops the HTTP server.
+// It returns false when they did not finish within shutdownTimeout.
+func shutdown(updater *ext.Updater, scheduler *cron.Cron, server *http.Server) bool {
+	logrus.Info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	clean := true
+
+	jobsDone := scheduler.Stop()
+	handlersDone := make(chan struct{})
+	go func() {
+		// Stops polling (or the webhook intake) and waits for the updates being handled
+		if err := updater.Stop(); err != nil {
+			logrus.Warnf("failed to stop the updater: %s", err.Error())
+		}
+		close(handlersDone)
+	}()
+
+	select {
+	case <-handlersDone:
+	case <-ctx.Done():
+		logrus.Warn("timed out waiting for the running handlers")
+		clean = false
+	}
+	select {
+	case <-jobsDone.Done():
+	case <-ctx.Done():
+		logrus.Warn("timed out waiting for the running scheduled jobs")
+		clean = false
+	}
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			logrus.Warnf("failed to stop the http server: %s", err.Error())
+			clean = false
+		}
 	}
 
-	initTelegramBot()
+	logrus.Info("bot stopped")
+	return clean
 }
 
-func initTelegramBot() {
-	// Get token from the environment variable
-	token := config.GetAppConfig().Telegram.ApiToken
-	if token == "" {
-		panic("TOKEN environment variable is empty")
+// enableSheetsCache puts the read-through cache in front of Google Sheets when it is enabled
+func enableSheetsCache(cacheConfig config.Cache, scheduler *cron.Cron) {
+	if !cacheConfig.Enabled {
+		return
+	}
+	rules := make([]services.CacheRule, 0, len(cacheConfig.Rules))
+	for _, rule := range cacheConfig.Rules {
+		rules = append(rules, services.CacheRule{Prefix: rule.Prefix, TTL: rule.TTL})
+	}
+	cache := services.EnableCache(services.CacheOptions{
+		DefaultTTL:  cacheConfig.DefaultTTL,
+		Rules:       rules,
+		MetadataTTL: cacheConfig.MetadataTTL,
+	})
+	if cacheConfig.ChangeCheckInterval > 0 {
+		scheduler.Schedule(cron.Every(cacheConfig.ChangeCheckInterval), scheduledJob("sheets_cache_check", func(ctx context.Context) error {
+			ctx, cancel := services.NewRequestContext(ctx)
+			defer cancel()
+			defer cache.LogStats()
+			return cache.CheckForChanges(ctx)
+		}))
 	}
+	logrus.WithFields(logrus.Fields{
+		"default_ttl":           cacheConfig.DefaultTTL,
+		"metadata_ttl":          cacheConfig.MetadataTTL,
+		"change_check_interval": cacheConfig.ChangeCheckInterval,
+	}).Info("google sheets cache enabled")
+}
 
-	// Create bot from environment value.
-	bot, err := gotgbot.NewBot(token, nil)
+// initTelegramBot starts receiving updates and registers the scheduled jobs of the bot.
+// It returns the HTTP server too, nil when it is disabled; its failures after the start are sent to serverFailed.
+func initTelegramBot(scheduler *cron.Cron, serverFailed chan<- error) (*ext.Updater, *http.Server, error) {
+	bot, err := gotgbot.NewBot(config.GetAppConfig().Telegram.ApiToken, nil)
 	if err != nil {
-		panic("failed to create new bot: " + err.Error())
+		return nil, nil, fmt.Errorf("failed to create new bot: %w", err)
 	}
 
 	// Create dispatcher first.
@@ -56,7 +207,10 @@ func initTelegramBot() {
 			ctx *ext.Context,
 			err error,
 		) ext.DispatcherAction {
-			logrus.WithFields(logrus.Fields{
+			if ctx.Data != nil {
+				ctx.Data[handlerErrorKey] = true
+			}
+			logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
 				"user_id":   ctx.EffectiveUser.Id,
 				"username":  ctx.EffectiveUser.Username,
 				"chat_id":   ctx.EffectiveChat.Id,
@@ -65,6 +219,7 @@ func initTelegramBot() {
 			return ext.DispatcherActionNoop
 		},
 		MaxRoutines: ext.DefaultMaxRoutines,
+		Processor:   instrumentedProcessor{labels: newUpdateLabels()},
 	})
 
 	// Create updater with dispatcher.
@@ -73,31 +228,88 @@ func initTelegramBot() {
 	// handle commands
 	registerCommandHandlers(dispatcher)
 
+	// register cron job to notify due tasks, rescheduled when the configuration is reloaded; before the updates start,
+	// so a bad schedule stops the bot with nothing to shut down
+	reloader, err := newConfigReloader(scheduler, bot)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Start receiving updates.
-	err = updater.StartPolling(
-		bot, &ext.PollingOpts{
-			DropPendingUpdates: true,
-			GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
-				Timeout: 19,
-				RequestOpts: &gotgbot.RequestOpts{
-					Timeout: time.Second * 20,
-				},
-			},
-		},
-	)
+	server, err := startReceivingUpdates(bot, updater, serverFailed)
 	if err != nil {
-		panic("failed to start polling: " + err.Error())
+		return nil, nil, err
 	}
 	logrus.WithFields(logrus.Fields{
 		"bot_username": bot.User.Username,
 		"bot_id":       bot.User.Id,
 	}).Info("bot has been started")
 
-	// register cron job to notify due tasks
-	go registerNotifyDueTasks(bot)
+	reloader.watch()
+	// discard the conversations nobody finished, with the idle timeout of the reloaded configuration
+	scheduler.Schedule(cron.Every(time.Minute), scheduledJob("expire_drafts", func(context.Context) error {
+		return commands.ExpireDrafts(bot, config.GetAppConfig().Settings.Drafts.IdleTimeout)
+	}))
+
+	return updater, server, nil
+}
+
+// startReceivingUpdates receives the updates with long polling or a webhook, as set by telegram.mode.
+// The HTTP server serves the health endpoints in both modes and the webhook in webhook mode. When the updates
+// cannot start, the server is closed and the error returned.
+func startReceivingUpdates(bot *gotgbot.Bot, updater *ext.Updater, serverFailed chan<- error) (*http.Server, error) {
+	telegramConfig := config.GetAppConfig().Telegram
+	port := config.GetAppConfig().Server.Port
+
+	if telegramConfig.Mode != config.TelegramModeWebhook {
+		var server *http.Server
+		if port > 0 {
+			server = newHTTPServer(port, "", nil)
+			startHTTPServer(server, serverFailed)
+		}
+		err := updater.StartPolling(
+			bot, &ext.PollingOpts{
+				DropPendingUpdates: true,
+				GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
+					Timeout: 19,
+					RequestOpts: &gotgbot.RequestOpts{
+						Timeout: time.Second * 20,
+					},
+				},
+			},
+		)
+		if err != nil {
+			if server != nil {
+				_ = server.Close()
+			}
+			return nil, fmt.Errorf("failed to start polling: %w", err)
+		}
+		logrus.Info("receiving updates with long polling")
+		return server, nil
+	}
+
+	webhook := telegramConfig.Webhook
+	// gotgbot checks the secret token header before dispatching the update
+	err := updater.AddWebhook(bot, webhook.Path, &ext.AddWebhookOpts{SecretToken: webhook.SecretToken})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add webhook: %w", err)
+	}
+	server := newHTTPServer(port, webhook.Path, updater.GetHandlerFunc("/"))
+	startHTTPServer(server, serverFailed)
 
-	// Idle, to keep updates coming in, and avoid bot stopping.
-	updater.Idle()
+	err = updater.SetAllBotWebhooks(webhook.URL, &gotgbot.SetWebhookOpts{
+		DropPendingUpdates: true,
+		SecretToken:        webhook.SecretToken,
+	})
+	if err != nil {
+		_ = server.Close()
+		return nil, fmt.Errorf("failed to set webhook: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"url":  strings.TrimSuffix(webhook.URL, "/") + webhook.Path,
+		"port": port,
+	}).Info("receiving updates with a webhook")
+	return server, nil
 }
 
 // registerCommandHandlers registers all the command handlers for the bot.
@@ -106,10 +318,24 @@ func initTelegramBot() {
 //   - /gsheets - Manage and interact with your Google Sheets data directly from the bot.
 //   - /splitbill - Easily split expenses with your housemates and keep track of who owes what.
 //   - /housework - Organize and delegate house chores among housemates with reminders and schedules.
+//   - /shop - Keep a shared shopping list and turn the checked items into an expense.
+//   - /members - Add, remove and configure housemates.
+//   - /roles - List and change the roles of the users of the chat.
+//   - /meter - Record electricity and water meter readings.
 //   - /settings - Adjust bot settings, such as language, notification preferences, and more.
 //   - /feedback - Provide feedback about the bot or report issues for continuous improvement.
 //   - /help - Get a list of available commands and learn how to use the bot effectively.
+//   - /status - Admin only: uptime, version, error counts and the last scheduled job runs.
+//   - /diag - Admin only: check the sheets and the cell layout of the spreadsheet.
+//   - /setup - Admin only: link the chat to its own spreadsheet and timezone.
+//   - /export - Download the expenses, rent, members, tasks and audit entries of a month or a year as a ZIP file.
+//   - /import - Admins: load a file of /export into the spreadsheet after a dry run.
 func registerCommandHandlers(dispatcher *ext.Dispatcher) {
+	// Conversation states are kept with the drafts, so a restart does not lose a flow halfway
+	store := state.GetStore()
+
+	// Check the chat and the role of the user before any other handler sees a command or a callback
+	dispatcher.AddHandlerToGroup(commands.NewPermissionMiddleware(), -1)
 
 	// Register commands handlers
 	dispatcher.AddHandler(
@@ -136,6 +362,30 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 			commands.HandleCommands,
 		),
 	)
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.ShopCommand,
+			commands.HandleCommands,
+		),
+	)
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.MembersCommand,
+			commands.HandleCommands,
+		),
+	)
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.RolesCommand,
+			commands.HandleCommands,
+		),
+	)
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.MeterCommand,
+			commands.HandleCommands,
+		),
+	)
 	dispatcher.AddHandler(
 		botHandlers.NewCommand(
 			enum.HelpCommand,
@@ -160,6 +410,18 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 			commands.HandleCommands,
 		),
 	)
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.StatusCommand,
+			commands.HandleCommands,
+		),
+	)
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.DiagCommand,
+			commands.HandleCommands,
+		),
+	)
 	// Note: RentCommand is handled by the conversation handler below, not here
 
 	// hot commands for housework
@@ -209,7 +471,7 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 						commands.Cancel,
 					),
 				},
-				StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategySenderAndChat),
+				StateStorage: store.ConversationStorage(enum.FlowAddExpense, conversation.KeyStrategySenderAndChat),
 				AllowReEntry: true,
 			},
 		),
@@ -239,7 +501,7 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 						commands.Cancel,
 					),
 				},
-				StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategySenderAndChat),
+				StateStorage: store.ConversationStorage(enum.FlowUpdateExpense, conversation.KeyStrategySenderAndChat),
 				AllowReEntry: true,
 			},
 		),
@@ -273,6 +535,30 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 						commands.HandleRentWaterInput,
 					),
 				},
+				enum.RentStatePayer: {
+					botHandlers.NewCallback(
+						callbackquery.Prefix(enum.RentPayerPrefix),
+						commands.HandleRentPayerCallback,
+					),
+				},
+				enum.RentStateReview: {
+					botHandlers.NewCallback(
+						callbackquery.Prefix(enum.RentReviewPrefix),
+						commands.HandleRentReviewCallback,
+					),
+				},
+				enum.RentStatePolicy: {
+					botHandlers.NewCallback(
+						callbackquery.Prefix(enum.RentPolicyPrefix),
+						commands.HandleRentPolicyCallback,
+					),
+				},
+				enum.RentStatePolicyValues: {
+					botHandlers.NewMessage(
+						commands.NoCommands,
+						commands.HandleRentPolicyValuesInput,
+					),
+				},
 			},
 			&botHandlers.ConversationOpts{
 				Exits: []ext.Handler{
@@ -281,12 +567,139 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 						commands.Cancel,
 					),
 				},
-				StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategySenderAndChat),
+				StateStorage: store.ConversationStorage(enum.FlowRent, conversation.KeyStrategySenderAndChat),
 				AllowReEntry: true,
 			},
 		),
 	)
 
+	// Register conversation handlers for the shopping list (add items, checkout)
+	dispatcher.AddHandler(
+		botHandlers.NewConversation(
+			[]ext.Handler{
+				botHandlers.NewCallback(
+					callbackquery.Equal(commands.ShopAddCommand),
+					commands.StartAddShoppingItem,
+				),
+				botHandlers.NewCallback(
+					callbackquery.Equal(commands.ShopCheckoutCommand),
+					commands.StartShopCheckout,
+				),
+			},
+			map[string][]ext.Handler{
+				enum.ShopStateAddItem: {
+					botHandlers.NewMessage(
+						commands.NoCommands,
+						commands.HandleShopAddItemInput,
+					),
+				},
+				enum.ShopStateCheckout: {
+					botHandlers.NewMessage(
+						commands.NoCommands,
+						commands.HandleShopCheckoutInput,
+					),
+				},
+			},
+			&botHandlers.ConversationOpts{
+				Exits: []ext.Handler{
+					botHandlers.NewCommand(
+						enum.CancelCommand,
+						commands.Cancel,
+					),
+				},
+				StateStorage: store.ConversationStorage(enum.FlowShop, conversation.KeyStrategySenderAndChat),
+				AllowReEntry: true,
+			},
+		),
+	)
+
+	// Register conversation handlers for linking a chat to a spreadsheet
+	dispatcher.AddHandler(
+		botHandlers.NewConversation(
+			[]ext.Handler{
+				botHandlers.NewCommand(
+					enum.SetupCommand,
+					commands.StartSetupConversation,
+				),
+			},
+			map[string][]ext.Handler{
+				enum.SetupStateSpreadsheet: {
+					botHandlers.NewMessage(
+						commands.NoCommands,
+						commands.HandleSetupSpreadsheetInput,
+					),
+				},
+				enum.SetupStateTimezone: {
+					botHandlers.NewMessage(
+						commands.NoCommands,
+						commands.HandleSetupTimezoneInput,
+					),
+				},
+			},
+			&botHandlers.ConversationOpts{
+				Exits: []ext.Handler{
+					botHandlers.NewCommand(
+						enum.CancelCommand,
+						commands.Cancel,
+					),
+				},
+				StateStorage: store.ConversationStorage(enum.FlowSetup, conversation.KeyStrategySenderAndChat),
+				AllowReEntry: true,
+			},
+		),
+	)
+
+	dispatcher.AddHandler(
+		botHandlers.NewCommand(
+			enum.ExportCommand,
+			commands.Export,
+		),
+	)
+
+	// Register conversation handlers for importing the file of an export
+	dispatcher.AddHandler(
+		botHandlers.NewConversation(
+			[]ext.Handler{
+				botHandlers.NewCommand(
+					enum.ImportCommand,
+					commands.StartImportConversation,
+				),
+			},
+			map[string][]ext.Handler{
+				enum.ImportStateFile: {
+					botHandlers.NewMessage(
+						commands.ImportFileMessages,
+						commands.HandleImportFile,
+					),
+				},
+				enum.ImportStateConfirm: {
+					botHandlers.NewCallback(
+						callbackquery.Prefix(enum.ImportActionPrefix),
+						commands.HandleImportCallback,
+					),
+				},
+			},
+			&botHandlers.ConversationOpts{
+				Exits: []ext.Handler{
+					botHandlers.NewCommand(
+						enum.CancelCommand,
+						commands.Cancel,
+					),
+				},
+				StateStorage: store.ConversationStorage(enum.FlowImport, conversation.KeyStrategySenderAndChat),
+				AllowReEntry: true,
+			},
+		),
+	)
+
+	// Register photo handler for housework proofs
+	dispatcher.AddHandler(
+		botHandlers.NewMessage(
+			message.Photo,
+			commands.HandleHouseworkProofPhoto,
+		),
+	)
+
 	// Register callback query handlers
 	dispatcher.AddHandler(
 		botHandlers.NewCallback(
@@ -312,6 +725,12 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 			commands.HandleGSheetsActionCallback,
 		),
 	)
+	dispatcher.AddHandler(
+		botHandlers.NewCallback(
+			callbackquery.Prefix(enum.ShopActionPrefix),
+			commands.HandleShopActionCallback,
+		),
+	)
 	dispatcher.AddHandler(
 		botHandlers.NewCallback(
 			callbackquery.Prefix("settings."),
@@ -320,24 +739,3 @@ func registerCommandHandlers(dispatcher *ext.Dispatcher) {
 	)
 
 }
-
-// register notifyDueTasks sends a notification to the channel when there are tasks due today
-func registerNotifyDueTasks(bot *gotgbot.Bot) {
-	// Create a new cron job
-	c := cron.New()
-
-	// Schedule the cron job to run every day at a specific time (e.g., midnight)
-	//cronExpression := "*/1 * * * *"
-	cronExpression := "30 18 * * *" // TODO: Read from config
-	_, _ = c.AddFunc(
-		cronExpression, func() {
-			commands.NotifyDueTasks(bot)
-		},
-	)
-
-	// Start the cron job scheduler
-	c.Start()
-
-	// Keep the program running (you can add other logic here if needed)
-	select {}
-}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/commands"
+	"housematee-tgbot/config"
+	"housematee-tgbot/utilities"
+)
+
+// configWatchInterval is how often the configuration file is checked for changes
+const configWatchInterval = 10 * time.Second
+
+// configReloader reloads the configuration on SIGHUP or when its file changes. Most reloadable keys are read at
+// each use; the default timezone and the schedule of the due tasks notification are applied here.
+type configReloader struct {
+	scheduler *cron.Cron
+	bot       *gotgbot.Bot
+
+	mu       sync.Mutex
+	dueTasks cron.EntryID
+	modTime  time.Time
+}
+
+// newConfigReloader schedules the due tasks notification of the loaded configuration
+func newConfigReloader(scheduler *cron.Cron, bot *gotgbot.Bot) (*configReloader, error) {
+	r := &configReloader{scheduler: scheduler, bot: bot}
+	if file := config.File(); file != "" {
+		if info, err := os.Stat(file); err == nil {
+			r.modTime = info.ModTime()
+		}
+	}
+	return r, r.scheduleDueTasks()
+}
+
+// watch reloads on SIGHUP, and in file mode when the modification time of the file changes
+func (r *configReloader) watch() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			r.reload("SIGHUP")
+		}
+	}()
+
+	file := config.File()
+	if file == "" {
+		return
+	}
+	r.scheduler.Schedule(cron.Every(configWatchInterval), scheduledJob("config_watch", func(context.Context) error {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		changed := !info.ModTime().Equal(r.modTime)
+		r.modTime = info.ModTime()
+		r.mu.Unlock()
+		if changed {
+			r.reload("file change")
+		}
+		return nil
+	}))
+}
+
+// reload applies a valid configuration and keeps the loaded one otherwise
+func (r *configReloader) reload(trigger string) {
+	result, err := config.Reload()
+	if err != nil {
+		logrus.WithField("trigger", trigger).Errorf("configuration not reloaded, keeping the loaded one: %s", err.Error())
+		return
+	}
+
+	if result.Changed("settings.timezone") {
+		if err := utilities.SetTimezone(config.GetAppConfig().Settings.Timezone); err != nil {
+			logrus.Errorf("failed to apply the reloaded timezone: %s", err.Error())
+		}
+	}
+	if result.Changed("settings.reminders") {
+		if err := r.scheduleDueTasks(); err != nil {
+			logrus.Errorf("failed to reschedule the due tasks notification: %s", err.Error())
+		}
+	}
+	if len(result.Ignored) > 0 {
+		logrus.Warnf("restart the bot to apply the changes of %s", strings.Join(result.Ignored, ", "))
+	}
+	logrus.WithFields(logrus.Fields{
+		"trigger": trigger,
+		"applied": strings.Join(result.Applied, ","),
+	}).Info("configuration reloaded")
+}
+
+// scheduleDueTasks schedules the due tasks notification at settings.reminders.due_tasks, replacing the previous schedule.
+// The job runs every minute and notifies the households for which the expression fires at that minute in their timezone.
+func (r *configReloader) scheduleDueTasks() error {
+	settings := config.GetAppConfig().Settings
+	reminder, err := cron.ParseStandard(settings.Reminders.DueTasks)
+	if err != nil {
+		return fmt.Errorf("failed to schedule the due tasks notification: %w", err)
+	}
+	id, err := r.scheduler.AddJob("* * * * *", scheduledJob("notify_due_tasks", func(ctx context.Context) error {
+		return commands.NotifyDueTasks(ctx, r.bot, reminderTime(reminder))
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to schedule the due tasks notification: %w", err)
+	}
+
+	r.mu.Lock()
+	previous := r.dueTasks
+	r.dueTasks = id
+	r.mu.Unlock()
+	if previous != 0 {
+		r.scheduler.Remove(previous)
+	}
+	return nil
+}
+
+// reminderTime reports whether the schedule fires, in the timezone of a household, at the current minute of the
+// utilities clock; without CRON_TZ the schedule is read in that timezone. The minute is read once, so a household
+// that takes long to notify does not make the next one miss it.
+func reminderTime(schedule cron.Schedule) func(loc *time.Location) bool {
+	now := utilities.Now().Truncate(time.Minute)
+	return func(loc *time.Location) bool {
+		t := now.In(loc)
+		return schedule.Next(t.Add(-time.Second)).Equal(t)
+	}
+}
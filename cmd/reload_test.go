@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"housematee-tgbot/utilities"
+)
+
+func TestReminderTimeInHouseholdTimezone(t *testing.T) {
+	defer utilities.SetClock(nil)
+	schedule, err := cron.ParseStandard("30 18 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saigon, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The job runs every minute of the day, a few seconds after the minute starts
+	var saigonFires, utcFires []time.Time
+	start := time.Date(2026, 10, 19, 0, 0, 3, 0, time.UTC)
+	for minute := start; minute.Before(start.Add(24 * time.Hour)); minute = minute.Add(time.Minute) {
+		utilities.SetClock(utilities.FixedClock{Time: minute})
+		isReminderTime := reminderTime(schedule)
+		if isReminderTime(saigon) {
+			saigonFires = append(saigonFires, minute)
+		}
+		if isReminderTime(time.UTC) {
+			utcFires = append(utcFires, minute)
+		}
+	}
+
+	// 18:30 in Saigon (UTC+7) is 11:30 UTC
+	if len(saigonFires) != 1 || saigonFires[0].Hour() != 11 || saigonFires[0].Minute() != 30 {
+		t.Errorf("Saigon reminders at %v, want once at 11:30 UTC", saigonFires)
+	}
+	if len(utcFires) != 1 || utcFires[0].Hour() != 18 || utcFires[0].Minute() != 30 {
+		t.Errorf("UTC reminders at %v, want once at 18:30 UTC", utcFires)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/services/telemetry"
+)
+
+const (
+	// readinessTTL is how long a Sheets check answers /readyz, so probes do not use up the API quota
+	readinessTTL     = 15 * time.Second
+	readinessTimeout = 5 * time.Second
+)
+
+// readiness remembers the result of the last Sheets connection check
+type readiness struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func (r *readiness) check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.checkedAt.IsZero() && time.Since(r.checkedAt) < readinessTTL {
+		return r.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	r.err = handlers.CheckSheetsConnection(ctx)
+	r.checkedAt = time.Now()
+	if r.err != nil {
+		logrus.WithContext(ctx).Warnf("readiness check failed: %s", r.err.Error())
+	}
+	return r.err
+}
+
+// newHTTPServer returns the server of /healthz, /readyz and /metrics.
+// The webhook handler is served on webhookPath when it is not nil.
+func newHTTPServer(port int, webhookPath string, webhookHandler http.Handler) *http.Server {
+	ready := &readiness{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready.check(r.Context()); err != nil {
+			http.Error(w, "google sheets unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /metrics", telemetry.Handler())
+	if webhookHandler != nil {
+		mux.Handle("POST "+webhookPath, webhookHandler)
+	}
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+}
+
+// startHTTPServer serves in the background and sends the error of a failed server to failed, so main stops the bot
+// with the graceful shutdown
+func startHTTPServer(server *http.Server, failed chan<- error) {
+	go func() {
+		logrus.Infof("http server listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("http server failed: %w", err)
+		}
+	}()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/commands"
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/services/telemetry"
+)
+
+// handlerErrorKey is set in ctx.Data by the dispatcher error hook when a handler failed
+const handlerErrorKey = "handler_error"
+
+// newUpdateLabels returns the handler labels of the registered commands and callbacks
+func newUpdateLabels() telemetry.UpdateLabels {
+	knownCommands := []string{
+		enum.StartCommand,
+		enum.HelloCommand,
+		enum.GSheetsCommand,
+		enum.SplitBillCommand,
+		enum.SplitBillAddActionCommand,
+		enum.RentCommand,
+		enum.HouseworkCommand,
+		enum.ShopCommand,
+		enum.MembersCommand,
+		enum.RolesCommand,
+		enum.MeterCommand,
+		enum.SettingsCommand,
+		enum.FeedbackCommand,
+		enum.HelpCommand,
+		enum.CancelCommand,
+		enum.StatusCommand,
+		enum.DiagCommand,
+		enum.SetupCommand,
+		enum.ExportCommand,
+		enum.ImportCommand,
+	}
+	for i := 1; i < 5; i++ {
+		knownCommands = append(knownCommands, fmt.Sprintf("%s%d", enum.HouseworkPrefix, i))
+	}
+	return telemetry.NewUpdateLabels(knownCommands, []string{
+		"help.",
+		"rent.",
+		enum.SplitBillActionPrefix,
+		commands.HouseworkActionPrefix,
+		enum.GSheetsActionPrefix,
+		enum.ShopActionPrefix,
+		commands.SettingsActionPrefix,
+		enum.ImportActionPrefix,
+	})
+}
+
+// instrumentedProcessor gives each update a context with its own correlation ID and records its handler, outcome and
+// latency. The handlers pass the context to their reads and writes, and their log lines with logrus.WithContext.
+type instrumentedProcessor struct {
+	labels telemetry.UpdateLabels
+}
+
+func (p instrumentedProcessor) ProcessUpdate(d *ext.Dispatcher, b *gotgbot.Bot, ctx *ext.Context) (err error) {
+	updateCtx := telemetry.WithCorrelationID(context.Background(), telemetry.NewCorrelationID())
+	handlers.SetContext(ctx, updateCtx)
+
+	handler := p.labels.Of(ctx.Update)
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			telemetry.ObserveUpdate(handler, telemetry.OutcomePanic, time.Since(start))
+			// The dispatcher recovers it and reports the stack
+			panic(r)
+		}
+		outcome := telemetry.OutcomeOK
+		if err != nil || ctx.Data[handlerErrorKey] == true {
+			outcome = telemetry.OutcomeError
+		}
+		duration := time.Since(start)
+		telemetry.ObserveUpdate(handler, outcome, duration)
+		logrus.WithContext(updateCtx).WithFields(logrus.Fields{
+			"handler":     handler,
+			"outcome":     outcome,
+			"duration_ms": duration.Milliseconds(),
+		}).Debug("update handled")
+	}()
+
+	return ext.BaseProcessor{}.ProcessUpdate(d, b, ctx)
+}
+
+// scheduledJob runs job with a context carrying its own correlation ID and records its outcome and duration
+func scheduledJob(name string, job func(ctx context.Context) error) cron.FuncJob {
+	return func() {
+		ctx := telemetry.WithCorrelationID(context.Background(), telemetry.NewCorrelationID())
+
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				telemetry.ObserveCronJob(name, telemetry.OutcomePanic, fmt.Errorf("panic: %v", r), start)
+				// cron.Recover logs it
+				panic(r)
+			}
+		}()
+
+		err := job(ctx)
+		outcome := telemetry.OutcomeOK
+		if err != nil {
+			outcome = telemetry.OutcomeError
+			logrus.WithContext(ctx).WithField("job", name).Errorf("scheduled job failed: %s", err.Error())
+		}
+		telemetry.ObserveCronJob(name, outcome, err, start)
+	}
+}
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/services/telemetry"
+	"housematee-tgbot/utilities"
+)
+
+// Status handles the /status command: what the bot did since it started, for the admins
+func Status(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "status", "command called")
+
+	status := telemetry.CurrentStatus()
+	currentSheet, err := handlers.GetCurrentSheetName(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		currentSheet = "unable to fetch: " + err.Error()
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Bot Status</b>\n\n")
+	sb.WriteString(fmt.Sprintf("<b>Version:</b> %s\n", escapeHTML(status.Version)))
+	sb.WriteString(fmt.Sprintf(
+		"<b>Uptime:</b> %s (since %s)\n",
+		formatUptime(time.Since(status.StartedAt)),
+		status.StartedAt.In(utilities.Location()).Format(utilities.TimestampLayout),
+	))
+	sb.WriteString(fmt.Sprintf("<b>Updates:</b> %s\n", escapeHTML(config.GetAppConfig().Telegram.Mode)))
+	sb.WriteString(fmt.Sprintf("<b>Current sheet:</b> %s\n", escapeHTML(currentSheet)))
+	sb.WriteString(fmt.Sprintf(
+		"<b>Handled:</b> %d updates, %d errors, %d panics\n",
+		status.Updates, status.UpdateErrors, status.UpdatePanics,
+	))
+	sb.WriteString(fmt.Sprintf("<b>Google Sheets:</b> %d calls, %d errors", status.SheetsCalls, status.SheetsErrors))
+	if status.SheetsCalls > 0 {
+		sb.WriteString(fmt.Sprintf(
+			", latency p50 %s, p95 %s",
+			status.SheetsLatencyP50.Round(time.Millisecond),
+			status.SheetsLatencyP95.Round(time.Millisecond),
+		))
+	}
+	sb.WriteString("\n\n<b>Scheduled jobs</b>\n")
+	if len(status.Jobs) == 0 {
+		sb.WriteString("No job has run yet.\n")
+	}
+	for _, run := range status.Jobs {
+		sb.WriteString(fmt.Sprintf(
+			"%s: <b>%s</b> at %s in %s",
+			escapeHTML(run.Job),
+			run.Outcome,
+			run.At.In(utilities.Location()).Format(utilities.TimestampLayout),
+			run.Duration.Round(time.Millisecond),
+		))
+		if run.Err != "" {
+			sb.WriteString(" - " + escapeHTML(run.Err))
+		}
+		sb.WriteString("\n")
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, sb.String(), &gotgbot.SendMessageOpts{ParseMode: "html"})
+	if err != nil {
+		return fmt.Errorf("failed to send /status response: %w", err)
+	}
+	return nil
+}
+
+// Diag handles the /diag command: checks the sheets and the cell layout of the spreadsheet, for the admins
+func Diag(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "diag", "command called")
+
+	var text string
+	checks, err := handlers.RunDiagnostics(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		text = fmt.Sprintf("<b>Diagnostics</b>\n\n<b>Status:</b> Failed\n\n<b>Error:</b> %s", escapeHTML(err.Error()))
+	} else {
+		text = formatDiagnostics(checks)
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(bot, text, &gotgbot.SendMessageOpts{ParseMode: "html"})
+	if err != nil {
+		return fmt.Errorf("failed to send /diag response: %w", err)
+	}
+	return nil
+}
+
+// formatDiagnostics lists the failed checks and the warnings first, then how many checks passed
+func formatDiagnostics(checks []handlers.DiagnosticCheck) string {
+	var failed, warnings []string
+	passed := 0
+	for _, check := range checks {
+		line := escapeHTML(check.Name)
+		if check.Detail != "" {
+			line += ": " + escapeHTML(check.Detail)
+		}
+		switch check.Result {
+		case handlers.DiagnosticFailed:
+			failed = append(failed, line)
+		case handlers.DiagnosticWarning:
+			warnings = append(warnings, line)
+		default:
+			passed++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Diagnostics</b>\n\n")
+	if len(failed) == 0 {
+		sb.WriteString("<b>Status:</b> OK\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("<b>Status:</b> %d check(s) failed\n\n<b>Failed</b>\n", len(failed)))
+		for _, line := range failed {
+			sb.WriteString("- " + line + "\n")
+		}
+	}
+	if len(warnings) > 0 {
+		sb.WriteString("\n<b>Warnings</b>\n")
+		for _, line := range warnings {
+			sb.WriteString("- " + line + "\n")
+		}
+	}
+	sb.WriteString(fmt.Sprintf("\n%d of %d checks passed.", passed, len(checks)))
+	return sb.String()
+}
+
+// formatUptime formats a duration in days, hours and minutes, e.g., "2d 3h 5m"
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
@@ -7,19 +7,20 @@ import (
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	tgBotHandler "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
 	"github.com/sirupsen/logrus"
 
 	"housematee-tgbot/config"
 	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
 )
 
 // logUserAction logs user actions with context (user_id, username, chat_id, chat_type, action)
 func logUserAction(ctx *ext.Context, action string, details string) {
 	user := ctx.EffectiveUser
 	chat := ctx.EffectiveChat
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
 		"user_id":   user.Id,
 		"username":  user.Username,
 		"chat_id":   chat.Id,
@@ -28,6 +29,15 @@ func logUserAction(ctx *ext.Context, action string, details string) {
 	}).Info(details)
 }
 
+// getActorUsername returns the @username of the user who triggered the update,
+// falling back to the first name when the user has no username
+func getActorUsername(ctx *ext.Context) string {
+	if ctx.EffectiveUser.Username == "" {
+		return ctx.EffectiveUser.FirstName
+	}
+	return "@" + ctx.EffectiveUser.Username
+}
+
 // Cancel cancels the conversation.
 func Cancel(b *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "cancel", "conversation cancelled")
@@ -39,7 +49,7 @@ func Cancel(b *gotgbot.Bot, ctx *ext.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to send cancel message: %w", err)
 	}
-	return handlers.EndConversation()
+	return tgBotHandler.EndConversation()
 }
 
 // Todo is a simple command that replies to the user with a not implemented message.
@@ -63,97 +73,66 @@ func NoCommands(msg *gotgbot.Message) bool {
 	return message.Text(msg) && !message.Command(msg)
 }
 
-func ResponseNotHasPermission(bot *gotgbot.Bot, ctx *ext.Context) error {
-	_, err := ctx.EffectiveMessage.Reply(
-		bot,
-		"*Access Denied*\n\nThis chat is not authorized to use this command.",
-		&gotgbot.SendMessageOpts{
-			ParseMode: "markdown",
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to send permission denied message: %w", err)
-	}
-	return nil
-}
-
-// HandleCommands add middleware to check if a user has permission to use the command
+// HandleCommands dispatches the commands; the permission middleware has already checked them
 func HandleCommands(bot *gotgbot.Bot, ctx *ext.Context) error {
 	// get command from the context
 	command := getCommandFromMessage(bot, ctx.Message)
+
+	// link the user to their member row so renamed accounts still match
+	if isChatAllowed(ctx.EffectiveChat.Id) {
+		syncMemberIdentity(ctx)
+	}
+
 	switch command {
 	case enum.HelloCommand, enum.StartCommand:
 		return Hello(bot, ctx)
 	case enum.GSheetsCommand:
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return GSheets(bot, ctx)
 	case enum.SplitBillCommand:
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return SplitBill(bot, ctx)
 	case enum.SplitBillAddActionCommand:
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return StartAddSplitBill(bot, ctx)
 	// Note: RentCommand is handled by the conversation handler in main.go, not here
 	case enum.HouseworkCommand:
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return Housework(bot, ctx)
+	case enum.ShopCommand:
+		return Shop(bot, ctx)
+	case enum.MembersCommand:
+		return Members(bot, ctx)
+	case enum.RolesCommand:
+		return Roles(bot, ctx)
+	case enum.MeterCommand:
+		return Meter(bot, ctx)
 	case enum.SettingsCommand:
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return Settings(bot, ctx)
 	case enum.FeedbackCommand:
 		return Feedback(bot, ctx)
 	case enum.HelpCommand:
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return Help(bot, ctx)
 	case enum.CancelCommand:
 		return Cancel(bot, ctx)
+	case enum.StatusCommand:
+		return Status(bot, ctx)
+	case enum.DiagCommand:
+		return Diag(bot, ctx)
 	}
 
 	// check some shortcut commands
 	if strings.HasPrefix(command, enum.HouseworkPrefix) {
-		if !CheckPermission(bot, ctx) {
-			return nil
-		}
 		return MarkAsDoneHouseworkByShortcut(bot, ctx)
 	}
 
 	return nil
 }
 
-func CheckPermission(bot *gotgbot.Bot, ctx *ext.Context) bool {
-	var hasPermission bool
-	// get channel id from ctx
-	channelId := ctx.EffectiveChat.Id
-	// check is channel id in the list of allowed channels
-	for _, id := range config.GetAppConfig().Telegram.AllowedChannels {
-		if id == channelId {
-			hasPermission = true
-			break
+// isAdmin checks if the user id is in the list of admins
+func isAdmin(userId int64) bool {
+	for _, id := range config.GetAppConfig().Telegram.AdminUserIDs {
+		if id == userId {
+			return true
 		}
 	}
-
-	if !hasPermission {
-		logrus.WithFields(logrus.Fields{
-			"user_id":   ctx.EffectiveUser.Id,
-			"username":  ctx.EffectiveUser.Username,
-			"chat_id":   channelId,
-			"chat_type": ctx.EffectiveChat.Type,
-		}).Warn("permission denied - chat not in allowed list")
-		_ = ResponseNotHasPermission(bot, ctx)
-	}
-	return hasPermission
+	return false
 }
 
 func getCommandFromMessage(b *gotgbot.Bot, msg *gotgbot.Message) string {
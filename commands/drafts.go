@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/services/state"
+)
+
+// draftFlows describes each flow in the message sent when its draft expires
+var draftFlows = map[string]struct {
+	Name    string
+	Command string
+}{
+	enum.FlowAddExpense:    {"expense", enum.GetCommandAsText(enum.SplitBillCommand)},
+	enum.FlowUpdateExpense: {"expense update", enum.GetCommandAsText(enum.SplitBillCommand)},
+	enum.FlowRent:          {"rent", enum.GetCommandAsText(enum.RentCommand)},
+	enum.FlowShop:          {"shopping list change", enum.GetCommandAsText(enum.ShopCommand)},
+	enum.FlowSetup:         {"setup", enum.GetCommandAsText(enum.SetupCommand)},
+	enum.FlowImport:        {"import", enum.GetCommandAsText(enum.ImportCommand)},
+}
+
+// draftKey returns the store key of a draft value of a flow in a chat
+func draftKey(flow string, chatID int64, name string) string {
+	return fmt.Sprintf("draft:%s:%d:%s", flow, chatID, name)
+}
+
+// putDraft stores a draft value; the flow goes on in memory when it cannot be written
+func putDraft(owner state.Owner, name string, value any) {
+	if err := state.GetStore().Put(draftKey(owner.Flow, owner.ChatID, name), owner, value); err != nil {
+		logrus.Errorf("failed to save %s draft %s: %s", owner.Flow, name, err.Error())
+	}
+}
+
+// getDraft decodes a draft value into out and reports whether it was found
+func getDraft(flow string, chatID int64, name string, out any) bool {
+	found, err := state.GetStore().Get(draftKey(flow, chatID, name), out)
+	if err != nil {
+		logrus.Errorf("failed to read %s draft %s: %s", flow, name, err.Error())
+		return false
+	}
+	return found
+}
+
+// deleteDrafts removes draft values of a flow in a chat
+func deleteDrafts(flow string, chatID int64, names ...string) {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, draftKey(flow, chatID, name))
+	}
+	if err := state.GetStore().Delete(keys...); err != nil {
+		logrus.Errorf("failed to delete %s drafts: %s", flow, err.Error())
+	}
+}
+
+// ExpireDrafts drops the conversations and drafts idle for longer than idle and tells their chats
+func ExpireDrafts(bot *gotgbot.Bot, idle time.Duration) error {
+	// The expired drafts are removed from memory even when saving the file fails, so the users are still told
+	expired, err := state.GetStore().Expire(idle)
+	if err != nil {
+		err = fmt.Errorf("failed to expire drafts: %w", err)
+	}
+
+	notified := make(map[string]bool)
+	for _, e := range expired {
+		// One message per flow and chat, even when several members were in it
+		key := fmt.Sprintf("%s:%d", e.Flow, e.ChatID)
+		if notified[key] {
+			continue
+		}
+		notified[key] = true
+
+		flow, ok := draftFlows[e.Flow]
+		if !ok {
+			flow.Name, flow.Command = e.Flow, "the command"
+		}
+		logrus.WithFields(logrus.Fields{
+			"flow":    e.Flow,
+			"chat_id": e.ChatID,
+			"user_id": e.UserID,
+		}).Info("draft expired")
+
+		message := fmt.Sprintf(
+			"\u231b Your unfinished %s was discarded after %s without activity. Send %s to start again.",
+			flow.Name, formatIdleTime(idle), flow.Command,
+		)
+		if _, err := bot.SendMessage(e.ChatID, message, nil); err != nil {
+			logrus.Warnf("failed to send draft expiry message to chat %d: %s", e.ChatID, err.Error())
+		}
+	}
+	return err
+}
+
+// formatIdleTime formats an idle time in minutes or hours, e.g., "30 minutes"
+func formatIdleTime(idle time.Duration) string {
+	if idle >= time.Hour && idle%time.Hour == 0 {
+		hours := int(idle / time.Hour)
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
+	}
+	minutes := int(idle.Round(time.Minute) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	tgBotHandler "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/services/archive"
+	"housematee-tgbot/services/state"
+	"housematee-tgbot/utilities"
+)
+
+const (
+	ImportApplyCommand  = enum.ImportActionPrefix + "apply"
+	ImportCancelCommand = enum.ImportActionPrefix + "cancel"
+)
+
+// importDraftFile is the draft holding the file of the import waiting for confirmation
+const importDraftFile = "file"
+
+// importDraft is the file sent to /import and the hash of the plan shown in its dry run
+type importDraft struct {
+	FileID   string
+	PlanHash string
+}
+
+// maxDryRunLines bounds the changes listed in the dry run message
+const maxDryRunLines = 30
+
+// downloadTimeout bounds the download of a file sent to the bot
+const downloadTimeout = 30 * time.Second
+
+// Export handles the /export command: it sends a ZIP file with the data of a month or a year
+func Export(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "export", "command called")
+
+	household := handlers.HouseholdOf(ctx)
+	args := ctx.Args()[1:]
+	var period models.ExportPeriod
+	var err error
+	if len(args) > 0 {
+		if period, err = models.ParseExportPeriod(args[0]); err != nil {
+			return replyHTML(bot, ctx, fmt.Sprintf(
+				"<b>Invalid Period</b>\n\n%s\n\nUse <code>/export</code> for this month, <code>/export 2026_10</code> for a month or <code>/export 2026</code> for a year, <code>/export all</code> for every month.",
+				escapeHTML(err.Error())))
+		}
+	} else {
+		// The current sheet, this month when it is not a monthly sheet
+		period = models.ExportPeriod(utilities.GetCurrentMonthSheetName(household.Location()))
+		if current, err := handlers.GetCurrentSheetName(handlers.ContextOf(ctx), household); err == nil && models.ExportPeriod(current).IncludesSheet(current) {
+			period = models.ExportPeriod(current)
+		}
+	}
+
+	data, err := handlers.ExportHousehold(handlers.ContextOf(ctx), household, period)
+	if err != nil {
+		logUserAction(ctx, "export", fmt.Sprintf("failed to export %s: %s", period, err.Error()))
+		return replyHTML(bot, ctx, fmt.Sprintf("<b>Export Failed</b>\n\n%s", escapeHTML(err.Error())))
+	}
+	var buf bytes.Buffer
+	if err := archive.Write(&buf, data); err != nil {
+		return fmt.Errorf("failed to write the export archive: %w", err)
+	}
+
+	expenses := 0
+	for _, month := range data.Months {
+		expenses += len(month.Expenses)
+	}
+	caption := fmt.Sprintf(
+		"<b>Export %s</b>\n%d month sheets, %d expenses, %d tasks, %d task history entries, %d audit entries.\n\nSend it to /import to load it into another household.",
+		escapeHTML(period.String()), len(data.Months), expenses, len(data.Tasks), len(data.TaskHistory), len(data.Audit),
+	)
+	_, err = bot.SendDocument(
+		ctx.EffectiveChat.Id,
+		gotgbot.InputFileByReader(archive.FileName(ctx.EffectiveChat.Id, period), &buf),
+		&gotgbot.SendDocumentOpts{Caption: caption, ParseMode: "HTML"},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to send the export: %w", err)
+	}
+	logUserAction(ctx, "export", fmt.Sprintf("exported %s: %d months, %d expenses", period, len(data.Months), expenses))
+	return nil
+}
+
+// StartImportConversation asks for the file of an export
+func StartImportConversation(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "import_start", "starting import flow")
+	deleteDrafts(enum.FlowImport, ctx.EffectiveChat.Id, importDraftFile)
+
+	text := "<b>Import</b>\n\nSend the ZIP file made by /export, or its <code>export.json</code>, as a document. " +
+		"Nothing is written before you see what changes and apply it.\n\nSend /cancel to stop."
+	if err := replyHTML(bot, ctx, text); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.ImportStateFile)
+}
+
+// ImportFileMessages matches the documents sent to /import, and the text messages answered with a reminder to send one
+func ImportFileMessages(msg *gotgbot.Message) bool {
+	return msg.Document != nil || NoCommands(msg)
+}
+
+// HandleImportFile reads the file sent and shows the dry run of its import
+func HandleImportFile(bot *gotgbot.Bot, ctx *ext.Context) error {
+	doc := ctx.EffectiveMessage.Document
+	if doc == nil {
+		if err := replyHTML(bot, ctx, "<b>No File</b>\n\nSend the export as a document, or /cancel."); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.ImportStateFile)
+	}
+
+	plan, err := planImportFile(bot, ctx, doc.FileId, doc.FileSize)
+	if err != nil {
+		logUserAction(ctx, "import_file", fmt.Sprintf("file %s refused: %s", doc.FileName, err.Error()))
+		if err := replyHTML(bot, ctx, fmt.Sprintf("<b>Cannot Import</b>\n\n%s\n\nSend another file, or /cancel.", escapeHTML(err.Error()))); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.ImportStateFile)
+	}
+	logUserAction(ctx, "import_file", fmt.Sprintf("dry run of %s: %d changes, %d unchanged", doc.FileName, len(plan.Changes), plan.Unchanged))
+
+	if plan.IsEmpty() {
+		if err := replyHTML(bot, ctx, fmt.Sprintf("<b>Nothing to Import</b>\n\nThe spreadsheet already has the %d records of this file.", plan.Unchanged)); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	putDraft(
+		state.Owner{Flow: enum.FlowImport, ChatID: ctx.EffectiveChat.Id, UserID: ctx.EffectiveUser.Id},
+		importDraftFile, importDraft{FileID: doc.FileId, PlanHash: plan.Hash()},
+	)
+	_, err = ctx.EffectiveMessage.Reply(bot, formatImportPlan(plan), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+				{Text: "Apply", CallbackData: ImportApplyCommand},
+				{Text: "Cancel", CallbackData: ImportCancelCommand},
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send the import dry run: %w", err)
+	}
+	return tgBotHandler.NextConversationState(enum.ImportStateConfirm)
+}
+
+// HandleImportCallback applies or cancels the import shown in the dry run
+func HandleImportCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	logUserAction(ctx, "import_callback", fmt.Sprintf("callback: %s", cb.Data))
+
+	var draft importDraft
+	if !getDraft(enum.FlowImport, ctx.EffectiveChat.Id, importDraftFile, &draft) {
+		_, _ = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "This import was already applied or cancelled"})
+		return tgBotHandler.EndConversation()
+	}
+	if _, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{}); err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+	if _, _, err := cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{}); err != nil {
+		logUserAction(ctx, "import_callback", fmt.Sprintf("failed to remove buttons: %s", err.Error()))
+	}
+	deleteDrafts(enum.FlowImport, ctx.EffectiveChat.Id, importDraftFile)
+
+	if cb.Data != ImportApplyCommand {
+		if err := replyHTML(bot, ctx, "Import cancelled, nothing was written."); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	// Plan again: the spreadsheet may have changed since the dry run
+	plan, err := planImportFile(bot, ctx, draft.FileID, 0)
+	if err != nil {
+		if err := replyHTML(bot, ctx, fmt.Sprintf("<b>Cannot Import</b>\n\n%s", escapeHTML(err.Error()))); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+	if plan.Hash() != draft.PlanHash {
+		if err := replyHTML(bot, ctx, "<b>Spreadsheet Changed</b>\n\nThe spreadsheet changed since the dry run, nothing was written. Send /import again to see the new changes."); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	if err := handlers.ApplyImport(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), plan); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Errorf("failed to import into chat %d: %s", ctx.EffectiveChat.Id, err.Error())
+		if err := replyHTML(bot, ctx, fmt.Sprintf("<b>Import Failed</b>\n\n%s\n\nThe changes before the error were written, run /import again with the same file to finish.", escapeHTML(err.Error()))); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	logUserAction(ctx, "import_apply", fmt.Sprintf("%d changes applied", len(plan.Changes)))
+	if err := replyHTML(bot, ctx, fmt.Sprintf("<b>Imported</b>\n\n%d changes written.", len(plan.Changes))); err != nil {
+		return err
+	}
+	return tgBotHandler.EndConversation()
+}
+
+// planImportFile downloads an export sent to the bot and plans its import into the household of the chat
+func planImportFile(bot *gotgbot.Bot, ctx *ext.Context, fileId string, fileSize int64) (models.ImportPlan, error) {
+	if fileSize > archive.MaxArchiveSize {
+		return models.ImportPlan{}, fmt.Errorf("the file is larger than %d MB", archive.MaxArchiveSize>>20)
+	}
+	data, err := downloadFile(bot, fileId)
+	if err != nil {
+		return models.ImportPlan{}, err
+	}
+	incoming, err := archive.Read(data)
+	if err != nil {
+		return models.ImportPlan{}, err
+	}
+	return handlers.PlanImport(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), incoming)
+}
+
+// downloadFile downloads a file sent to the bot, up to archive.MaxArchiveSize bytes
+func downloadFile(bot *gotgbot.Bot, fileId string) ([]byte, error) {
+	file, err := bot.GetFile(fileId, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the file: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, file.URL(bot, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the file: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, archive.MaxArchiveSize+1))
+}
+
+// formatImportPlan lists the changes of an import as an HTML message
+func formatImportPlan(plan models.ImportPlan) string {
+	var sb strings.Builder
+	sb.WriteString("<b>Import Dry Run</b>\n\nNothing is written until you apply it. Imports add and update, they never remove.\n\n")
+	sb.WriteString(fmt.Sprintf("<b>%d changes</b>, %d records unchanged:\n", len(plan.Changes), plan.Unchanged))
+	for i, change := range plan.Changes {
+		if i == maxDryRunLines {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", len(plan.Changes)-maxDryRunLines))
+			break
+		}
+		line := fmt.Sprintf("- %s <code>%s</code>", change.Action, escapeHTML(change.Target))
+		if change.Detail != "" {
+			line += ": " + escapeHTML(change.Detail)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
@@ -29,7 +29,7 @@ func GSheets(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "gsheets", "command called")
 
 	// Get current sheet name from Database
-	currentSheet, err := handlers.GetCurrentSheetName()
+	currentSheet, err := handlers.GetCurrentSheetName(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
 	if err != nil {
 		currentSheet = "Unable to fetch"
 	}
@@ -48,9 +48,11 @@ func GSheets(bot *gotgbot.Bot, ctx *ext.Context) error {
 		bot,
 		fmt.Sprintf(
 			"*Google Sheets Management*\n\n"+
-				"*Current Sheet:* `%s`\n\n"+
+				"*Current Sheet:* `%s`\n"+
+				"%s\n"+
 				"Select an action:",
 			currentSheet,
+			formatCacheStats(),
 		),
 		&gotgbot.SendMessageOpts{
 			ReplyMarkup: inlineKeyboard,
@@ -63,6 +65,22 @@ func GSheets(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
+// formatCacheStats formats the sheets cache counters as a message line, empty when the cache is disabled
+func formatCacheStats() string {
+	stats, ok := handlers.GetCacheStats()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(
+		"*Cache:* %.0f%% hits (%d/%d), %d invalidated by writes, %d changed in the sheet\n",
+		stats.HitRate()*100,
+		stats.Hits,
+		stats.Hits+stats.Misses,
+		stats.Invalidations,
+		stats.ExternalChanges,
+	)
+}
+
 // HandleGSheetsActionCallback handles all gsheets.* callback queries
 func HandleGSheetsActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.Update.CallbackQuery
@@ -112,7 +130,7 @@ func HandleGSheetsActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 // handleGSheetsCreateAction shows confirmation dialog for creating a new sheet
 func handleGSheetsCreateAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 	// Get the current month sheet name (YYYY_MM format)
-	newSheetName := utilities.GetCurrentMonthSheetName()
+	newSheetName := utilities.GetCurrentMonthSheetName(handlers.HouseholdOf(ctx).Location())
 
 	// Create confirmation buttons
 	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
@@ -147,13 +165,14 @@ func handleGSheetsCreateAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 // handleGSheetsConfirmCreateAction executes the sheet creation
 func handleGSheetsConfirmCreateAction(bot *gotgbot.Bot, ctx *ext.Context) error {
+	household := handlers.HouseholdOf(ctx)
 	// Get the current month sheet name (YYYY_MM for sheet name)
-	newSheetName := utilities.GetCurrentMonthSheetName()
+	newSheetName := utilities.GetCurrentMonthSheetName(household.Location())
 	// Get the display name (MM/YYYY for cell A1)
-	displayName := utilities.GetCurrentMonthDisplayName()
+	displayName := utilities.GetCurrentMonthDisplayName(household.Location())
 
 	// Create the new sheet
-	sheetInfo, err := handlers.CreateNewMonthSheet(newSheetName, displayName)
+	sheetInfo, err := handlers.CreateNewMonthSheet(handlers.ContextOf(ctx), household, newSheetName, displayName)
 	if err != nil {
 		// Send error message to user (use HTML to avoid markdown parsing issues with special chars)
 		_, sendErr := ctx.EffectiveMessage.Reply(
@@ -22,6 +22,10 @@ func Help(bot *gotgbot.Bot, ctx *ext.Context) error {
 				{Text: enum.GetCommandAsText(enum.HouseworkCommand), CallbackData: "help.housework"},
 				{Text: enum.GetCommandAsText(enum.GSheetsCommand), CallbackData: "help.gsheets"},
 			},
+			{
+				{Text: enum.GetCommandAsText(enum.ShopCommand), CallbackData: "help.shop"},
+				{Text: enum.GetCommandAsText(enum.MembersCommand), CallbackData: "help.members"},
+			},
 		},
 	}
 
@@ -51,7 +55,7 @@ func HandleHelpActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 		// Rent uses conversation handler, show instructions instead
 		_, err := ctx.EffectiveMessage.Reply(
 			bot,
-			"*Rent*\n\nTo add monthly rent with breakdown, use the /rent command directly.",
+			"*Rent*\n\nTo add monthly rent with breakdown, use the /rent command directly. When the rent of the month is already saved, /rent shows it so you can edit it.",
 			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
 		)
 		if err != nil {
@@ -62,6 +66,16 @@ func HandleHelpActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 		if err != nil {
 			return err
 		}
+	case "help.shop":
+		err := Shop(bot, ctx)
+		if err != nil {
+			return err
+		}
+	case "help.members":
+		err := showMembers(bot, ctx)
+		if err != nil {
+			return err
+		}
 	case "help.gsheets":
 		err := GSheets(bot, ctx)
 		if err != nil {
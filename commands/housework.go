@@ -1,8 +1,12 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"housematee-tgbot/enum"
 	"housematee-tgbot/handlers"
@@ -20,6 +24,9 @@ const (
 	HouseworkAddCommand    = "housework.add"
 	HouseworkUpdateCommand = "housework.update"
 	HouseworkDeleteCommand = "housework.delete"
+	HouseworkStatsCommand  = "housework.stats"
+
+	HouseworkStatsArg = "stats"
 
 	HouseworkActionPrefix   = "housework."
 	HouseworkViewAction     = "view"
@@ -27,11 +34,27 @@ const (
 	HouseworkAssignAction   = "assign"
 	HouseworkUpdateAction   = "update"
 	HouseworkDeleteAction   = "delete"
+	HouseworkProofAction    = "proof"
+	HouseworkApproveAction  = "approve"
+	HouseworkRejectAction   = "reject"
+	HouseworkSwapAction     = "swap"
+	HouseworkSwapToAction   = "swapto"
+	HouseworkSwapTakeAction = "swaptake"
+	HouseworkSwapPickAction = "swappick"
+	HouseworkSwapWithAction = "swapwith"
+	HouseworkSwapDecline    = "swapdecline"
 )
 
 // Housework handles the /housework command.
 func Housework(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "housework", "command called")
+
+	// /housework stats shows the fairness leaderboard
+	args := ctx.Args()
+	if len(args) > 1 && strings.ToLower(args[1]) == HouseworkStatsArg {
+		return HandleHouseworkStatsActionCallback(bot, ctx)
+	}
+
 	// show buttons for these commands
 	// - Supported commands:
 	// - /list - List all housework.
@@ -95,6 +118,11 @@ func HandleHouseworkActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 		if err != nil {
 			return err
 		}
+	case HouseworkStatsCommand:
+		err := HandleHouseworkStatsActionCallback(bot, ctx)
+		if err != nil {
+			return err
+		}
 	default:
 		// Handle other button clicks (if any)
 		// Get prefix from CallbackData
@@ -123,7 +151,7 @@ func HandleHouseworkActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 func HandleHouseworkListActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "housework_list", "listing housework tasks")
 	// get the list of housework
-	houseworkList, err := handlers.GetHouseworkMap()
+	houseworkList, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
 	if err != nil {
 		return err
 	}
@@ -133,7 +161,7 @@ func HandleHouseworkListActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error
 	keyboard := make([][]gotgbot.InlineKeyboardButton, 0, len(houseworkList))
 	for _, housework := range houseworkList {
 		name := housework.Name
-		isDateDueOrOverdue, _ := utilities.IsDateDueOrOverdue(housework.NextDue)
+		isDateDueOrOverdue, _ := utilities.IsDateDueOrOverdue(housework.NextDue, handlers.HouseholdOf(ctx).Location())
 		if isDateDueOrOverdue {
 			name += " » 📢"
 		}
@@ -146,6 +174,7 @@ func HandleHouseworkListActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error
 	keyboard = append(
 		keyboard, []gotgbot.InlineKeyboardButton{
 			{Text: "➕ Add new housework", CallbackData: "housework.add"},
+			{Text: "Stats", CallbackData: HouseworkStatsCommand},
 		},
 	)
 
@@ -178,7 +207,7 @@ func HandleHouseworkSelectActionCallback(bot *gotgbot.Bot, ctx *ext.Context) err
 	logUserAction(ctx, "housework_select", fmt.Sprintf("task_id=%d action=%s", houseworkId, selectedAction))
 
 	// get the list of housework
-	houseworkMap, err := handlers.GetHouseworkMap()
+	houseworkMap, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
 	if err != nil {
 		return err
 	}
@@ -189,18 +218,51 @@ func HandleHouseworkSelectActionCallback(bot *gotgbot.Bot, ctx *ext.Context) err
 		return fmt.Errorf("housework with id %d not found", houseworkId)
 	}
 
-	numberOfHousework := len(houseworkMap)
-
 	switch selectedAction {
 	case HouseworkViewAction:
 		// show the housework
 		err = handleHouseworkViewAction(bot, ctx, housework, "Housework info")
 	case HouseworkMarkDoneAction:
 		// mark the housework as done
-		err = handleHouseworkMarkDoneAction(bot, ctx, housework, numberOfHousework)
+		err = handleHouseworkMarkDoneAction(bot, ctx, housework)
 	case HouseworkAssignAction:
 		// assign the housework to other
-		err = handleHouseworkAssignToOtherAction(bot, ctx, housework, numberOfHousework)
+		err = handleHouseworkAssignToOtherAction(bot, ctx, housework)
+	case HouseworkProofAction:
+		// toggle the requires proof flag
+		err = handleHouseworkToggleProofAction(bot, ctx, housework)
+	case HouseworkApproveAction, HouseworkRejectAction:
+		// example: housework.1.approve.3 - approve verification 3 of task 1
+		if len(commandElements) < 4 {
+			return fmt.Errorf("invalid callback data: %s", ctx.Update.CallbackQuery.Data)
+		}
+		verificationId := cast.ToInt64(commandElements[3])
+		err = handleHouseworkReviewProofAction(bot, ctx, housework, verificationId, selectedAction == HouseworkApproveAction)
+	case HouseworkSwapAction:
+		// offer the task to another member
+		err = handleHouseworkSwapAction(bot, ctx, housework)
+	case HouseworkSwapToAction, HouseworkSwapTakeAction, HouseworkSwapPickAction, HouseworkSwapDecline:
+		// example: housework.1.swapto.2 - offer task 1 to member 2 (0 = anyone)
+		// example: housework.1.swaptake.5 - accept offer 5 of task 1
+		if len(commandElements) < 4 {
+			return fmt.Errorf("invalid callback data: %s", ctx.Update.CallbackQuery.Data)
+		}
+		switch selectedAction {
+		case HouseworkSwapToAction:
+			err = handleHouseworkSwapToAction(bot, ctx, housework, cast.ToInt(commandElements[3]))
+		case HouseworkSwapTakeAction:
+			err = handleHouseworkSwapTakeAction(bot, ctx, housework, cast.ToInt64(commandElements[3]))
+		case HouseworkSwapPickAction:
+			err = handleHouseworkSwapPickAction(bot, ctx, housework, cast.ToInt64(commandElements[3]))
+		case HouseworkSwapDecline:
+			err = handleHouseworkSwapDeclineAction(bot, ctx, housework, cast.ToInt64(commandElements[3]))
+		}
+	case HouseworkSwapWithAction:
+		// example: housework.1.swapwith.5.3 - accept offer 5 by swapping task 1 with task 3
+		if len(commandElements) < 5 {
+			return fmt.Errorf("invalid callback data: %s", ctx.Update.CallbackQuery.Data)
+		}
+		err = handleHouseworkSwapWithAction(bot, ctx, housework, cast.ToInt64(commandElements[3]), cast.ToInt(commandElements[4]))
 	}
 
 	if err != nil {
@@ -224,7 +286,7 @@ func MarkAsDoneHouseworkByShortcut(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "housework_shortcut", fmt.Sprintf("mark_done task_id=%d", houseworkId))
 
 	// get the list of housework
-	houseworkMap, err := handlers.GetHouseworkMap()
+	houseworkMap, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
 	if err != nil {
 		return err
 	}
@@ -235,8 +297,7 @@ func MarkAsDoneHouseworkByShortcut(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return fmt.Errorf("housework with id %d not found", houseworkId)
 	}
 
-	numberOfHousework := len(houseworkMap)
-	err = handleHouseworkMarkDoneAction(bot, ctx, housework, numberOfHousework)
+	err = handleHouseworkMarkDoneAction(bot, ctx, housework)
 	if err != nil {
 		return fmt.Errorf("failed to send /housework response: %w", err)
 	}
@@ -248,52 +309,35 @@ func handleHouseworkAssignToOtherAction(
 	bot *gotgbot.Bot,
 	ctx *ext.Context,
 	housework models.Task,
-	numberOfHousework int,
 ) error {
 	logUserAction(ctx, "housework_assign", fmt.Sprintf("task_id=%d task_name=%s current_assignee=%s", housework.ID, housework.Name, housework.Assignee))
 
-	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo()
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
 	if err != nil {
 		return err
 	}
 
 	// Round-robin rotation using Members list
-	members, err := handlers.GetMembers(svc, spreadsheetId, currentSheetName)
+	members, err := handlers.GetMembers(handlers.ContextOf(ctx), svc, spreadsheetId, currentSheetName)
 	if err != nil {
 		return err
 	}
 
-	var nextAssignee string
-	currentAssignee := housework.Assignee
-	numOfMembers := len(members)
-	for i, member := range members {
-		if member.Username == currentAssignee {
-			if i == numOfMembers-1 {
-				nextAssignee = members[0].Username
-			} else {
-				nextAssignee = members[i+1].Username
-			}
-			break
-		}
-	}
+	nextAssignee := handlers.NextAssignee(members, housework.Assignee)
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
 		"user_id":       ctx.EffectiveUser.Id,
 		"task_id":       housework.ID,
 		"prev_assignee": housework.Assignee,
 		"next_assignee": nextAssignee,
 	}).Info("assigned to other member")
 
+	// Skipping the assignee moves the rotation on, a pending handover is dropped
 	housework.Assignee = nextAssignee
+	housework.HandoverFrom = ""
 
 	// upsert the housework
-	err = handlers.UpdateHousework(
-		svc,
-		spreadsheetId,
-		currentSheetName,
-		housework,
-		numberOfHousework,
-	)
+	err = handlers.UpdateHouseworks(handlers.ContextOf(ctx), svc, spreadsheetId, housework)
 	if err != nil {
 		return err
 	}
@@ -311,71 +355,130 @@ func handleHouseworkMarkDoneAction(
 	bot *gotgbot.Bot,
 	ctx *ext.Context,
 	housework models.Task,
-	numberOfHousework int,
 ) error {
 	logUserAction(ctx, "housework_mark_done", fmt.Sprintf("task_id=%d task_name=%s assignee=%s", housework.ID, housework.Name, housework.Assignee))
 
-	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo()
+	doer, err := getActorRef(ctx)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+
+	// Tasks that require proof only move forward after another member approves the photo
+	if housework.RequiresProof {
+		return requestHouseworkProof(bot, ctx, housework)
+	}
+
+	doneEntry := models.TaskHistory{
+		TaskID:   housework.ID,
+		TaskName: housework.Name,
+		Event:    models.TaskEventDone,
+		Doer:     doer,
+		Assignee: housework.Assignee,
+		DueDate:  housework.NextDue,
+	}
+	housework, err = completeHousework(ctx, housework, doneEntry)
 	if err != nil {
 		return err
 	}
 
-	// Round-robin rotation using Members list
-	members, err := handlers.GetMembers(svc, spreadsheetId, currentSheetName)
+	// show the housework
+	err = handleHouseworkViewAction(bot, ctx, housework, "Housework is updated")
 	if err != nil {
 		return err
 	}
 
-	var nextAssignee string
-	currentAssignee := housework.Assignee
-	numOfMembers := len(members)
-	for i, member := range members {
-		if member.Username == currentAssignee {
-			if i == numOfMembers-1 {
-				nextAssignee = members[0].Username
-			} else {
-				nextAssignee = members[i+1].Username
-			}
-			break
-		}
+	return nil
+}
+
+// completeHousework rotates the assignee, moves the due date forward and records the completion.
+// It returns the updated task.
+func completeHousework(
+	ctx *ext.Context,
+	housework models.Task,
+	doneEntry models.TaskHistory,
+) (models.Task, error) {
+	household := handlers.HouseholdOf(ctx)
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), household)
+	if err != nil {
+		return housework, err
+	}
+
+	// Round-robin rotation using Members list
+	members, err := handlers.GetMembers(handlers.ContextOf(ctx), svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return housework, err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	// A turn taken over from another member goes back to the rotation order after it
+	nextAssignee := handlers.NextAssignee(members, housework.RotationAssignee())
+
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
 		"user_id":       ctx.EffectiveUser.Id,
 		"task_id":       housework.ID,
 		"prev_assignee": housework.Assignee,
+		"handover_from": housework.HandoverFrom,
 		"next_assignee": nextAssignee,
 	}).Info("rotated to next assignee")
 
 	housework.Assignee = nextAssignee
+	housework.HandoverFrom = ""
 
 	// Update LastDone and NextDue
-	housework.LastDone = utilities.GetCurrentDate()
+	housework.LastDone = utilities.GetCurrentDate(household.Location())
 	nextDue, err := utilities.AddDay(housework.LastDone, housework.Frequency)
 	if err != nil {
-		logrus.Errorf("failed to add day: %s", err.Error())
-		return err
+		logrus.WithContext(handlers.ContextOf(ctx)).Errorf("failed to add day: %s", err.Error())
+		return housework, err
 	}
 	housework.NextDue = nextDue
 
 	// upsert the housework
-	err = handlers.UpdateHousework(
-		svc,
-		spreadsheetId,
-		currentSheetName,
-		housework,
-		numberOfHousework,
-	)
+	err = handlers.UpdateHouseworks(handlers.ContextOf(ctx), svc, spreadsheetId, housework)
+	if err != nil {
+		return housework, err
+	}
+
+	// A failed history write must not undo the completion
+	doneEntry.Timestamp = utilities.GetCurrentTimestamp(household.Location())
+	if err := handlers.AppendTaskHistory(handlers.ContextOf(ctx), svc, spreadsheetId, doneEntry); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to record task history for task %d: %s", housework.ID, err.Error())
+	}
+
+	return housework, nil
+}
+
+// HandleHouseworkStatsActionCallback shows completions per member, streaks, overdue counts and coverage
+func HandleHouseworkStatsActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "housework_stats", "showing housework stats")
+
+	household := handlers.HouseholdOf(ctx)
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), household)
 	if err != nil {
 		return err
 	}
 
-	// show the housework
-	err = handleHouseworkViewAction(bot, ctx, housework, "Housework is updated")
+	members, err := handlers.GetMembers(handlers.ContextOf(ctx), svc, spreadsheetId, currentSheetName)
 	if err != nil {
 		return err
 	}
 
+	houseworkMap, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), household)
+	if err != nil {
+		return err
+	}
+
+	history, err := handlers.GetTaskHistory(handlers.ContextOf(ctx), svc, spreadsheetId)
+	if err != nil {
+		return err
+	}
+
+	stats := handlers.CalculateHouseworkStats(history, members, houseworkMap, utilities.NowIn(household.Location()))
+	_, err = ctx.EffectiveMessage.Reply(bot, handlers.FormatHouseworkStats(stats), &gotgbot.SendMessageOpts{
+		ParseMode: "markdown",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send housework stats: %w", err)
+	}
 	return nil
 }
 
@@ -385,6 +488,11 @@ func handleHouseworkViewAction(
 	housework models.Task,
 	title string,
 ) error {
+	proofButtonText := "Require photo proof"
+	if housework.RequiresProof {
+		proofButtonText = "Stop requiring proof"
+	}
+
 	// Creates an inline keyboard with buttons for each command
 	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
 		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
@@ -402,6 +510,10 @@ func handleHouseworkViewAction(
 				{Text: "Update", CallbackData: fmt.Sprintf("housework.%d.update", housework.ID)},
 				{Text: "Delete", CallbackData: fmt.Sprintf("housework.%d.delete", housework.ID)},
 			},
+			{
+				{Text: "Request swap", CallbackData: fmt.Sprintf("housework.%d.swap", housework.ID)},
+				{Text: proofButtonText, CallbackData: fmt.Sprintf("housework.%d.proof", housework.ID)},
+			},
 		},
 	}
 
@@ -412,7 +524,7 @@ func handleHouseworkViewAction(
 		fmt.Sprintf(
 			"%s:\n---\n%s",
 			title,
-			handlers.ConvertHouseworkToMarkdownFormat(housework),
+			handlers.ConvertHouseworkToMarkdownFormat(housework, getCurrentMembers(ctx), handlers.HouseholdOf(ctx).Location()),
 		),
 		&gotgbot.SendMessageOpts{
 			ReplyMarkup: inlineKeyboard,
@@ -422,38 +534,66 @@ func handleHouseworkViewAction(
 	return err
 }
 
-// NotifyDueTasks sends a notification to the channel when there are tasks due today or overdue.
-func NotifyDueTasks(bot *gotgbot.Bot) {
-	// Check if reminders are enabled
-	if !IsReminderEnabled() {
-		logrus.Debug("housework reminders are disabled, skipping notification")
-		return
-	}
-
-	// get all tasks
-	houseworkMap, err := handlers.GetHouseworkMap()
-	if err != nil {
-		logrus.Errorf("failed to get housework map: %s", err.Error())
-		return
+// NotifyDueTasks sends a notification to the channel when there are tasks due today or overdue,
+// for every household whose reminder time it is in its timezone and that has not turned the reminders off.
+func NotifyDueTasks(ctx context.Context, bot *gotgbot.Bot, isReminderTime func(loc *time.Location) bool) error {
+	var errs []error
+	for _, household := range handlers.GetHouseholds() {
+		if !household.IsLinked() || !isReminderTime(household.Location()) {
+			continue
+		}
+		if !IsReminderEnabled(household.ChatID) {
+			logrus.WithContext(ctx).WithField("chat_id", household.ChatID).Debug("housework reminders are disabled, skipping notification")
+			continue
+		}
+		if err := notifyHouseholdDueTasks(ctx, bot, household); err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", household.ChatID, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	// get the list of tasks due today or overdue.
+// dueTasksOf returns the tasks of the channel of the household due today or overdue, by ID. The chats of
+// telegram.allowed_channels share the spreadsheet of the config, so each chat only sends the tasks of its own
+// channel and a task is notified once.
+func dueTasksOf(household models.Household, houseworkMap map[int]models.Task) []models.Task {
 	tasksDueToday := make([]models.Task, 0)
 	for _, housework := range houseworkMap {
-		isDateDueOrOverdue, _ := utilities.IsDateDueOrOverdue(housework.NextDue)
+		if housework.ChannelId != household.ChatID {
+			continue
+		}
+		isDateDueOrOverdue, _ := utilities.IsDateDueOrOverdue(housework.NextDue, household.Location())
 		if isDateDueOrOverdue {
 			tasksDueToday = append(tasksDueToday, housework)
 		}
 	}
+	slices.SortFunc(tasksDueToday, func(a, b models.Task) int {
+		return a.ID - b.ID
+	})
+	return tasksDueToday
+}
+
+// notifyHouseholdDueTasks sends the notifications of the tasks of a household due today or overdue
+func notifyHouseholdDueTasks(ctx context.Context, bot *gotgbot.Bot, household models.Household) error {
+	// get all tasks
+	houseworkMap, err := handlers.GetHouseworkMap(ctx, household)
+	if err != nil {
+		return fmt.Errorf("failed to get housework map: %w", err)
+	}
+
+	tasksDueToday := dueTasksOf(household, houseworkMap)
 
 	// if there is no task due today, return
 	if len(tasksDueToday) == 0 {
-		return
+		return nil
 	}
 	// send notification to the channel
-
+	members, err := handlers.GetCurrentMembers(ctx, household)
+	if err != nil {
+		logrus.WithContext(ctx).Warnf("failed to get members: %s", err.Error())
+	}
+	failed := 0
 	for _, task := range tasksDueToday {
-		// get the channel id from the task
 		channelId := task.ChannelId
 
 		// Build notification message with details
@@ -462,7 +602,7 @@ func NotifyDueTasks(bot *gotgbot.Bot) {
 				"*Assignee:* %s\n"+
 				"*Due date:* %s",
 			task.Name,
-			task.Assignee,
+			models.DisplayRef(members, task.Assignee),
 			task.NextDue,
 		)
 
@@ -489,13 +629,14 @@ func NotifyDueTasks(bot *gotgbot.Bot) {
 			},
 		)
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
+			failed++
+			logrus.WithContext(ctx).WithFields(logrus.Fields{
 				"channel_id": channelId,
 				"task_id":    task.ID,
 				"task_name":  task.Name,
 			}).Errorf("failed to send notification: %s", err.Error())
 		} else {
-			logrus.WithFields(logrus.Fields{
+			logrus.WithContext(ctx).WithFields(logrus.Fields{
 				"channel_id": channelId,
 				"task_id":    task.ID,
 				"task_name":  task.Name,
@@ -503,4 +644,8 @@ func NotifyDueTasks(bot *gotgbot.Bot) {
 			}).Info("sent due task notification")
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d of %d due task notifications", failed, len(tasksDueToday))
+	}
+	return nil
 }
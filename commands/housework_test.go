@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"housematee-tgbot/models"
+	"housematee-tgbot/utilities"
+)
+
+func TestDueTasksOfAllowedChannels(t *testing.T) {
+	utilities.SetClock(utilities.FixedClock{Time: time.Date(2026, 10, 19, 11, 30, 0, 0, time.UTC)})
+	defer utilities.SetClock(nil)
+
+	// Two chats of telegram.allowed_channels read the same spreadsheet
+	households := []models.Household{
+		{ChatID: -1001, SpreadsheetID: "sheet"},
+		{ChatID: -1002, SpreadsheetID: "sheet"},
+	}
+	tasks := map[int]models.Task{
+		1: {ID: 1, Name: "Trash", NextDue: "19/10/2026", ChannelId: -1001},
+		2: {ID: 2, Name: "Dishes", NextDue: "18/10/2026", ChannelId: -1002},
+		3: {ID: 3, Name: "Floor", NextDue: "25/10/2026", ChannelId: -1001},
+		4: {ID: 4, Name: "Plants", NextDue: "19/10/2026", ChannelId: -1001},
+	}
+
+	sent := make(map[int]int)
+	for _, household := range households {
+		for _, task := range dueTasksOf(household, tasks) {
+			if task.ChannelId != household.ChatID {
+				t.Errorf("chat %d would send task %d of channel %d", household.ChatID, task.ID, task.ChannelId)
+			}
+			sent[task.ID]++
+		}
+	}
+	want := map[int]int{1: 1, 2: 1, 4: 1}
+	if len(sent) != len(want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	for id, n := range want {
+		if sent[id] != n {
+			t.Errorf("task %d sent %d times, want %d", id, sent[id], n)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/services/state"
+)
+
+// pendingProof is a completion waiting for the doer to send a photo
+type pendingProof struct {
+	TaskID   int
+	Assignee string
+	DueDate  string
+}
+
+// houseworkVerification is a posted photo waiting for another member to approve or reject it
+type houseworkVerification struct {
+	ID       int64
+	TaskID   int
+	DoerID   int64
+	DoerRef  string // member reference stored in the task history
+	Doer     string // display handle
+	Assignee string
+	DueDate  string
+	ChatID   int64
+	PhotoId  string
+}
+
+// The proof requests and the photos waiting for review are drafts of enum.FlowHouseworkProof, so they survive
+// restarts and expire with the other drafts after settings.drafts.idle_timeout. proofMux makes reading and
+// deleting one of them a single step, so a photo or a review is only handled once.
+var proofMux sync.Mutex
+
+// pendingProofDraft is the draft name of the proof request of a user
+func pendingProofDraft(userId int64) string {
+	return fmt.Sprintf("proof:%d", userId)
+}
+
+// verificationDraft is the draft name of a photo waiting for review
+func verificationDraft(verificationId int64) string {
+	return fmt.Sprintf("verification:%d", verificationId)
+}
+
+// takeProofDraft reads and deletes a draft of enum.FlowHouseworkProof, reporting whether it was found
+func takeProofDraft(chatId int64, name string, out any) bool {
+	proofMux.Lock()
+	defer proofMux.Unlock()
+	if !getDraft(enum.FlowHouseworkProof, chatId, name, out) {
+		return false
+	}
+	deleteDrafts(enum.FlowHouseworkProof, chatId, name)
+	return true
+}
+
+// requestHouseworkProof asks the doer to send a photo before the task can be marked as done
+func requestHouseworkProof(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task) error {
+	owner := state.Owner{Flow: enum.FlowHouseworkProof, ChatID: ctx.EffectiveChat.Id, UserID: ctx.EffectiveUser.Id}
+	putDraft(owner, pendingProofDraft(ctx.EffectiveUser.Id), pendingProof{
+		TaskID:   housework.ID,
+		Assignee: housework.Assignee,
+		DueDate:  housework.NextDue,
+	})
+
+	logUserAction(ctx, "housework_proof_request", fmt.Sprintf("task_id=%d", housework.ID))
+
+	_, err := ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*Photo Proof Required*\n\n%s, please send a photo showing *%s* is done. Another member will approve it.", getActorUsername(ctx), housework.Name),
+		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+	)
+	return err
+}
+
+// HandleHouseworkProofPhoto posts a proof photo to the group with Approve/Reject buttons.
+// Photos from users without a pending proof request are ignored.
+func HandleHouseworkProofPhoto(bot *gotgbot.Bot, ctx *ext.Context) error {
+	var pending pendingProof
+	if !takeProofDraft(ctx.EffectiveChat.Id, pendingProofDraft(ctx.EffectiveUser.Id), &pending) {
+		return nil
+	}
+
+	doerRef, err := getActorRef(ctx)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+
+	photos := ctx.EffectiveMessage.Photo
+	verification := houseworkVerification{
+		// The message of the photo is unique in the chat, and stays unique after a restart
+		ID:       ctx.EffectiveMessage.MessageId,
+		TaskID:   pending.TaskID,
+		DoerID:   ctx.EffectiveUser.Id,
+		DoerRef:  doerRef,
+		Doer:     getActorUsername(ctx),
+		Assignee: pending.Assignee,
+		DueDate:  pending.DueDate,
+		ChatID:   ctx.EffectiveChat.Id,
+		// The last size is the largest one
+		PhotoId: photos[len(photos)-1].FileId,
+	}
+	putDraft(state.Owner{Flow: enum.FlowHouseworkProof, ChatID: verification.ChatID}, verificationDraft(verification.ID), verification)
+
+	logUserAction(ctx, "housework_proof_photo", fmt.Sprintf("task_id=%d verification_id=%d", verification.TaskID, verification.ID))
+
+	houseworkMap, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+	taskName := houseworkMap[verification.TaskID].Name
+
+	_, err = bot.SendPhoto(
+		verification.ChatID,
+		gotgbot.InputFileByID(verification.PhotoId),
+		&gotgbot.SendPhotoOpts{
+			Caption:   fmt.Sprintf("*%s* marked *%s* as done.\n\nCan another member confirm?", verification.Doer, taskName),
+			ParseMode: "markdown",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+					{
+						{Text: "Approve", CallbackData: fmt.Sprintf("housework.%d.approve.%d", verification.TaskID, verification.ID)},
+						{Text: "Reject", CallbackData: fmt.Sprintf("housework.%d.reject.%d", verification.TaskID, verification.ID)},
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to post proof photo: %w", err)
+	}
+	return nil
+}
+
+// handleHouseworkReviewProofAction approves or rejects a posted proof photo.
+// The doer cannot review their own proof; the rotation only moves forward after approval.
+func handleHouseworkReviewProofAction(
+	bot *gotgbot.Bot,
+	ctx *ext.Context,
+	housework models.Task,
+	verificationId int64,
+	approved bool,
+) error {
+	chatId := ctx.EffectiveChat.Id
+	var verification houseworkVerification
+	proofMux.Lock()
+	ok := getDraft(enum.FlowHouseworkProof, chatId, verificationDraft(verificationId), &verification)
+	if ok && verification.DoerID == ctx.EffectiveUser.Id {
+		proofMux.Unlock()
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Not Allowed*\n\nYou cannot review your own proof. Please ask another member.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+	if ok {
+		// Claim the verification so a second tap cannot complete the task twice
+		deleteDrafts(enum.FlowHouseworkProof, chatId, verificationDraft(verificationId))
+	}
+	proofMux.Unlock()
+
+	if !ok || verification.TaskID != housework.ID {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Proof Expired*\n\nThis proof was already reviewed or is no longer valid.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+	// The task was completed or reassigned another way since the photo was posted
+	if housework.NextDue != verification.DueDate || housework.Assignee != verification.Assignee {
+		if _, _, err := ctx.Update.CallbackQuery.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{}); err != nil {
+			logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to remove review buttons: %s", err.Error())
+		}
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			fmt.Sprintf("*Proof Expired*\n\n*%s* changed since this proof was posted: it is now due %s with %s.", housework.Name, housework.NextDue, models.DisplayRef(getCurrentMembers(ctx), housework.Assignee)),
+			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+		)
+		return err
+	}
+
+	reviewer := getActorUsername(ctx)
+	logUserAction(ctx, "housework_proof_review", fmt.Sprintf("task_id=%d verification_id=%d approved=%t", housework.ID, verificationId, approved))
+
+	// Remove the Approve/Reject buttons from the photo
+	if _, _, err := ctx.Update.CallbackQuery.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{}); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to remove review buttons: %s", err.Error())
+	}
+
+	if !approved {
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			fmt.Sprintf("*Proof Rejected*\n\n%s rejected the proof for *%s* by %s. The task stays with %s.", reviewer, housework.Name, verification.Doer, models.DisplayRef(getCurrentMembers(ctx), housework.Assignee)),
+			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+		)
+		return err
+	}
+
+	doneEntry := models.TaskHistory{
+		TaskID:   housework.ID,
+		TaskName: housework.Name,
+		Event:    models.TaskEventDone,
+		Doer:     verification.DoerRef,
+		Assignee: verification.Assignee,
+		DueDate:  verification.DueDate,
+		Note:     "approved by " + reviewer,
+	}
+	housework, err := completeHousework(ctx, housework, doneEntry)
+	if err != nil {
+		return err
+	}
+
+	return handleHouseworkViewAction(bot, ctx, housework, fmt.Sprintf("Proof approved by %s", reviewer))
+}
+
+// handleHouseworkToggleProofAction turns the requires proof flag of a task on or off
+func handleHouseworkToggleProofAction(
+	bot *gotgbot.Bot,
+	ctx *ext.Context,
+	housework models.Task,
+) error {
+	svc, spreadsheetId, _, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+
+	housework.RequiresProof = !housework.RequiresProof
+	logUserAction(ctx, "housework_proof_toggle", fmt.Sprintf("task_id=%d requires_proof=%t", housework.ID, housework.RequiresProof))
+
+	err = handlers.UpdateHouseworks(handlers.ContextOf(ctx), svc, spreadsheetId, housework)
+	if err != nil {
+		return err
+	}
+
+	title := "Photo proof is no longer required"
+	if housework.RequiresProof {
+		title = "Photo proof is now required"
+	}
+	return handleHouseworkViewAction(bot, ctx, housework, title)
+}
@@ -0,0 +1,433 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/services/state"
+	"housematee-tgbot/utilities"
+)
+
+// houseworkSwapOffer is a task offered by its assignee to another member (or anyone)
+type houseworkSwapOffer struct {
+	ID         int64
+	TaskID     int
+	FromUserID int64
+	FromRef    string // member reference of the requester, the assignee of the task when offered
+	From       string // display handle of the requester
+	To         string // display handle of the target, empty means anyone can accept
+	ToRef      string // member reference of the target
+}
+
+// The open swap offers are drafts of enum.FlowHouseworkSwap, so they survive restarts and expire with the other
+// drafts after settings.drafts.idle_timeout. swapOfferMux makes allocating an offer ID, and reading then deleting
+// an offer, single steps.
+var swapOfferMux sync.Mutex
+
+// swapOfferCounterDraft is the draft name of the next offer ID of a chat; it expires with the offers of the chat
+const swapOfferCounterDraft = "next_offer_id"
+
+// swapOfferDraft is the draft name of an open offer
+func swapOfferDraft(offerId int64) string {
+	return fmt.Sprintf("offer:%d", offerId)
+}
+
+// putSwapOffer gives the offer the next ID of the chat and stores it
+func putSwapOffer(chatId int64, offer *houseworkSwapOffer) {
+	owner := state.Owner{Flow: enum.FlowHouseworkSwap, ChatID: chatId}
+
+	swapOfferMux.Lock()
+	defer swapOfferMux.Unlock()
+	var nextId int64
+	if !getDraft(enum.FlowHouseworkSwap, chatId, swapOfferCounterDraft, &nextId) || nextId < 1 {
+		nextId = 1
+	}
+	offer.ID = nextId
+	putDraft(owner, swapOfferCounterDraft, nextId+1)
+	putDraft(owner, swapOfferDraft(offer.ID), offer)
+}
+
+// getSwapOffer returns an open offer of the chat
+func getSwapOffer(chatId int64, offerId int64) (*houseworkSwapOffer, bool) {
+	swapOfferMux.Lock()
+	defer swapOfferMux.Unlock()
+	var offer houseworkSwapOffer
+	if !getDraft(enum.FlowHouseworkSwap, chatId, swapOfferDraft(offerId), &offer) {
+		return nil, false
+	}
+	return &offer, true
+}
+
+// replyNotAssignee tells the actor that only the assignee of the task can offer it
+func replyNotAssignee(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, members []models.Member) error {
+	_, err := ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*Not Allowed*\n\nOnly %s, the assignee of *%s*, can request a swap.", models.DisplayRef(members, housework.Assignee), housework.Name),
+		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+	)
+	return err
+}
+
+// handleHouseworkSwapAction shows the members the task can be offered to; only the assignee can offer it
+func handleHouseworkSwapAction(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task) error {
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+
+	members, err := handlers.GetMembers(handlers.ContextOf(ctx), svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return err
+	}
+
+	requester, err := handlers.GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+	if !models.SameMember(members, housework.Assignee, requester) {
+		return replyNotAssignee(bot, ctx, housework, members)
+	}
+	keyboard := make([][]gotgbot.InlineKeyboardButton, 0, len(members)+1)
+	for _, member := range members {
+		if member.Ref() == requester {
+			continue
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: member.Username, CallbackData: fmt.Sprintf("housework.%d.swapto.%d", housework.ID, member.ID)},
+		})
+	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+		{Text: "Anyone", CallbackData: fmt.Sprintf("housework.%d.swapto.0", housework.ID)},
+	})
+
+	_, err = ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*Request Swap*\n\nWho should take over *%s*?", housework.Name),
+		&gotgbot.SendMessageOpts{
+			ParseMode:   "markdown",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+		},
+	)
+	return err
+}
+
+// handleHouseworkSwapToAction posts a swap offer with Accept/Decline buttons.
+// memberId 0 offers the task to anyone.
+func handleHouseworkSwapToAction(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, memberId int) error {
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+	members, err := handlers.GetMembers(handlers.ContextOf(ctx), svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return err
+	}
+	requester, err := handlers.GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+	if !models.SameMember(members, housework.Assignee, requester) {
+		return replyNotAssignee(bot, ctx, housework, members)
+	}
+
+	target, targetRef := "", ""
+	if memberId != 0 {
+		for _, member := range members {
+			if member.ID == memberId {
+				target, targetRef = member.Username, member.Ref()
+				break
+			}
+		}
+		if target == "" {
+			return fmt.Errorf("member with id %d not found", memberId)
+		}
+	}
+
+	offer := &houseworkSwapOffer{
+		TaskID:     housework.ID,
+		FromUserID: ctx.EffectiveUser.Id,
+		FromRef:    requester,
+		From:       getActorUsername(ctx),
+		To:         target,
+		ToRef:      targetRef,
+	}
+	putSwapOffer(ctx.EffectiveChat.Id, offer)
+
+	logUserAction(ctx, "housework_swap_request", fmt.Sprintf("task_id=%d offer_id=%d to=%s", housework.ID, offer.ID, target))
+
+	audience := "anyone"
+	if target != "" {
+		audience = target
+	}
+	_, err = ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*Swap Request*\n\n%s asks %s to take over *%s* (due %s).\n\n"+
+			"_Take this turn_ hands over one turn. _Swap with my task_ exchanges it with one of your tasks.",
+			offer.From, audience, housework.Name, housework.NextDue),
+		&gotgbot.SendMessageOpts{
+			ParseMode: "markdown",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+					{
+						{Text: "Take this turn", CallbackData: fmt.Sprintf("housework.%d.swaptake.%d", housework.ID, offer.ID)},
+						{Text: "Swap with my task", CallbackData: fmt.Sprintf("housework.%d.swappick.%d", housework.ID, offer.ID)},
+					},
+					{
+						{Text: "Decline", CallbackData: fmt.Sprintf("housework.%d.swapdecline.%d", housework.ID, offer.ID)},
+					},
+				},
+			},
+		},
+	)
+	return err
+}
+
+// getSwapOfferFor returns the open offer if the actor is allowed to accept it.
+// It replies to the user and returns nil otherwise.
+func getSwapOfferFor(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, offerId int64) (*houseworkSwapOffer, error) {
+	offer, ok := getSwapOffer(ctx.EffectiveChat.Id, offerId)
+	if !ok || offer.TaskID != housework.ID {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Swap Expired*\n\nThis swap request was already answered or is no longer valid.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return nil, err
+	}
+
+	// The task moved on since the offer, e.g., it was done or reassigned: the requester no longer has it to give
+	if !models.SameMember(getCurrentMembers(ctx), housework.Assignee, offer.FromRef) {
+		claimSwapOffer(ctx.EffectiveChat.Id, offerId)
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Swap Expired*\n\n*%s* is no longer assigned to %s.", housework.Name, offer.From), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return nil, err
+	}
+
+	accepter, err := getActorRef(ctx)
+	if err != nil {
+		return nil, replyActorError(bot, ctx, err)
+	}
+	if offer.FromUserID == ctx.EffectiveUser.Id || (offer.ToRef != "" && offer.ToRef != accepter) {
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Not Allowed*\n\nThis swap request is for %s.", offer.To), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return nil, err
+	}
+	return offer, nil
+}
+
+// claimSwapOffer removes the offer so it can only be answered once
+func claimSwapOffer(chatId int64, offerId int64) bool {
+	swapOfferMux.Lock()
+	defer swapOfferMux.Unlock()
+	var offer houseworkSwapOffer
+	if !getDraft(enum.FlowHouseworkSwap, chatId, swapOfferDraft(offerId), &offer) {
+		return false
+	}
+	deleteDrafts(enum.FlowHouseworkSwap, chatId, swapOfferDraft(offerId))
+	return true
+}
+
+// handleHouseworkSwapTakeAction hands the current turn of the task over to the accepter. The task keeps the member
+// whose turn it was in HandoverFrom, so the rotation goes on from them once the turn is done.
+func handleHouseworkSwapTakeAction(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, offerId int64) error {
+	offer, err := getSwapOfferFor(bot, ctx, housework, offerId)
+	if offer == nil || err != nil {
+		return err
+	}
+	if !claimSwapOffer(ctx.EffectiveChat.Id, offerId) {
+		return nil
+	}
+
+	svc, spreadsheetId, _, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+
+	members := getCurrentMembers(ctx)
+	accepter, err := handlers.GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+	previousAssignee := housework.Assignee
+	if housework.HandoverFrom == "" {
+		housework.HandoverFrom = previousAssignee
+	}
+	housework.Assignee = accepter
+	if models.SameMember(members, housework.HandoverFrom, accepter) {
+		// The turn went back to the member it was handed over from
+		housework.HandoverFrom = ""
+	}
+	err = handlers.UpdateHouseworks(handlers.ContextOf(ctx), svc, spreadsheetId, housework)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
+		"user_id":       ctx.EffectiveUser.Id,
+		"task_id":       housework.ID,
+		"offer_id":      offerId,
+		"prev_assignee": previousAssignee,
+		"next_assignee": accepter,
+		"handover_from": housework.HandoverFrom,
+	}).Info("housework turn handed over")
+
+	if err := handlers.AppendTaskHistory(handlers.ContextOf(ctx), svc, spreadsheetId, models.TaskHistory{
+		Timestamp: utilities.GetCurrentTimestamp(handlers.HouseholdOf(ctx).Location()),
+		TaskID:    housework.ID,
+		TaskName:  housework.Name,
+		Event:     models.TaskEventHandover,
+		Doer:      accepter,
+		Assignee:  previousAssignee,
+		DueDate:   housework.NextDue,
+		Note:      "requested by " + offer.From,
+	}); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to record task history for task %d: %s", housework.ID, err.Error())
+	}
+
+	return handleHouseworkViewAction(bot, ctx, housework, fmt.Sprintf("%s took over from %s", getActorUsername(ctx), models.DisplayRef(members, previousAssignee)))
+}
+
+// handleHouseworkSwapPickAction shows the accepter's own tasks to swap with
+func handleHouseworkSwapPickAction(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, offerId int64) error {
+	offer, err := getSwapOfferFor(bot, ctx, housework, offerId)
+	if offer == nil || err != nil {
+		return err
+	}
+
+	houseworkMap, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+
+	members := getCurrentMembers(ctx)
+	accepter, err := handlers.GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+	ownTasks := make([]models.Task, 0)
+	for _, task := range houseworkMap {
+		if models.SameMember(members, task.Assignee, accepter) && task.ID != housework.ID {
+			ownTasks = append(ownTasks, task)
+		}
+	}
+	sort.Slice(ownTasks, func(i, j int) bool { return ownTasks[i].ID < ownTasks[j].ID })
+
+	if len(ownTasks) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*No Tasks to Swap*\n\nYou have no tasks assigned. Use _Take this turn_ instead.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+
+	keyboard := make([][]gotgbot.InlineKeyboardButton, 0, len(ownTasks))
+	for _, task := range ownTasks {
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("%s (due %s)", task.Name, task.NextDue), CallbackData: fmt.Sprintf("housework.%d.swapwith.%d.%d", housework.ID, offerId, task.ID)},
+		})
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*Swap Tasks*\n\nWhich of your tasks should %s take in exchange for *%s*?", offer.From, housework.Name),
+		&gotgbot.SendMessageOpts{
+			ParseMode:   "markdown",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+		},
+	)
+	return err
+}
+
+// handleHouseworkSwapWithAction swaps the assignees of the offered task and one of the accepter's tasks
+func handleHouseworkSwapWithAction(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, offerId int64, otherTaskId int) error {
+	offer, err := getSwapOfferFor(bot, ctx, housework, offerId)
+	if offer == nil || err != nil {
+		return err
+	}
+
+	houseworkMap, err := handlers.GetHouseworkMap(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+	members := getCurrentMembers(ctx)
+	accepter, err := handlers.GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+	otherTask, ok := houseworkMap[otherTaskId]
+	if !ok || !models.SameMember(members, otherTask.Assignee, accepter) {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Swap Failed*\n\nThat task is no longer assigned to you.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+	if !claimSwapOffer(ctx.EffectiveChat.Id, offerId) {
+		return nil
+	}
+
+	svc, spreadsheetId, _, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+
+	// Both rows are written in one request, so a failure cannot leave both tasks with the same assignee
+	housework.Assignee, otherTask.Assignee = otherTask.Assignee, housework.Assignee
+	if err := handlers.UpdateHouseworks(handlers.ContextOf(ctx), svc, spreadsheetId, housework, otherTask); err != nil {
+		return err
+	}
+
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
+		"user_id":       ctx.EffectiveUser.Id,
+		"task_id":       housework.ID,
+		"other_task_id": otherTask.ID,
+		"offer_id":      offerId,
+		"requester":     offer.From,
+		"accepter":      accepter,
+	}).Info("housework tasks swapped")
+
+	entries := []models.TaskHistory{
+		{TaskID: housework.ID, TaskName: housework.Name, Event: models.TaskEventSwap, Doer: accepter, Assignee: otherTask.Assignee, DueDate: housework.NextDue, Note: "swapped with " + otherTask.Name},
+		{TaskID: otherTask.ID, TaskName: otherTask.Name, Event: models.TaskEventSwap, Doer: otherTask.Assignee, Assignee: accepter, DueDate: otherTask.NextDue, Note: "swapped with " + housework.Name},
+	}
+	for _, entry := range entries {
+		entry.Timestamp = utilities.GetCurrentTimestamp(handlers.HouseholdOf(ctx).Location())
+		if err := handlers.AppendTaskHistory(handlers.ContextOf(ctx), svc, spreadsheetId, entry); err != nil {
+			logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to record task history for task %d: %s", entry.TaskID, err.Error())
+		}
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*Tasks Swapped*\n\n*%s* is now assigned to %s.\n*%s* is now assigned to %s.",
+			housework.Name, models.DisplayRef(members, housework.Assignee), otherTask.Name, models.DisplayRef(members, otherTask.Assignee)),
+		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+	)
+	return err
+}
+
+// handleHouseworkSwapDeclineAction closes the offer when the target declines or the requester withdraws it
+func handleHouseworkSwapDeclineAction(bot *gotgbot.Bot, ctx *ext.Context, housework models.Task, offerId int64) error {
+	offer, ok := getSwapOffer(ctx.EffectiveChat.Id, offerId)
+	if !ok {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Swap Expired*\n\nThis swap request was already answered or is no longer valid.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+
+	actor := getActorUsername(ctx)
+	isRequester := offer.FromUserID == ctx.EffectiveUser.Id
+	// A user who is not a member has no reference and cannot be the requested member
+	actorRef, _ := getActorRef(ctx)
+	if !isRequester && (offer.ToRef == "" || offer.ToRef != actorRef) {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Not Allowed*\n\nOnly the requested member can decline, or the requester can withdraw.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+	if !claimSwapOffer(ctx.EffectiveChat.Id, offerId) {
+		return nil
+	}
+
+	logUserAction(ctx, "housework_swap_decline", fmt.Sprintf("task_id=%d offer_id=%d", housework.ID, offerId))
+
+	text := fmt.Sprintf("*Swap Declined*\n\n%s declined to take over *%s*. It stays with %s.", actor, housework.Name, models.DisplayRef(getCurrentMembers(ctx), housework.Assignee))
+	if isRequester {
+		text = fmt.Sprintf("*Swap Withdrawn*\n\n%s withdrew the swap request for *%s*.", actor, housework.Name)
+	}
+	_, err := ctx.EffectiveMessage.Reply(bot, text, &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+	return err
+}
@@ -0,0 +1,269 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+)
+
+const (
+	MembersAddArg      = "add"
+	MembersRemoveArg   = "remove"
+	MembersWeightArg   = "weight"
+	MembersNameArg     = "name"
+	MembersLinkArg     = "link"
+	MembersMigrateArg  = "migrate"
+	MembersTemplateArg = "--template"
+
+	membersUsage = "*Members*\n\n" +
+		"`/members` - list members\n" +
+		"`/members add @username [weight]` - add a member (reply to their message to link their account)\n" +
+		"`/members remove @username`\n" +
+		"`/members weight @username 2`\n" +
+		"`/members name @username Display Name`\n" +
+		"`/members link @username` - reply to their message to link their Telegram account\n" +
+		"`/members migrate` - once every member is linked, reference members by Telegram user ID and rewrite the Balances formulas\n\n" +
+		"Add `--template` to also apply the change to the Template sheet."
+)
+
+// syncedIdentities remembers the users whose member row is already linked (keyed by user ID)
+var (
+	syncedIdentities = make(map[int64]string)
+	syncedMux        sync.Mutex
+)
+
+// Members handles the /members command.
+func Members(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "members", "command called")
+
+	args := ctx.Args()[1:]
+	applyToTemplate := false
+	filtered := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.EqualFold(arg, MembersTemplateArg) {
+			applyToTemplate = true
+			continue
+		}
+		filtered = append(filtered, arg)
+	}
+	args = filtered
+
+	if len(args) == 0 {
+		return showMembers(bot, ctx)
+	}
+
+	action := strings.ToLower(args[0])
+	if action == MembersMigrateArg {
+		return migrateMemberRefs(bot, ctx)
+	}
+	if len(args) < 2 {
+		return replyMarkdown(bot, ctx, membersUsage)
+	}
+	username := normalizeUsername(args[1])
+
+	sheetNames, err := getMemberSheetNames(ctx, applyToTemplate)
+	if err != nil {
+		return err
+	}
+
+	household := handlers.HouseholdOf(ctx)
+	var result string
+	// The rent shares saved by /rent were split between the previous members and weights
+	resplitRent := action == MembersAddArg || action == MembersRemoveArg || action == MembersWeightArg
+	switch action {
+	case MembersAddArg:
+		member := models.Member{Username: username, Weight: 1}
+		if len(args) > 2 {
+			member.Weight = cast.ToInt(args[2])
+		}
+		if reply := ctx.EffectiveMessage.ReplyToMessage; reply != nil && reply.From != nil {
+			member.UserID = reply.From.Id
+		}
+		_, err = handlers.AddMember(handlers.ContextOf(ctx), household, sheetNames, member)
+		result = fmt.Sprintf("%s added with weight %d", username, member.Weight)
+	case MembersRemoveArg:
+		err = handlers.RemoveMember(handlers.ContextOf(ctx), household, sheetNames, username)
+		result = fmt.Sprintf("%s removed", username)
+	case MembersWeightArg:
+		if len(args) < 3 {
+			return replyMarkdown(bot, ctx, membersUsage)
+		}
+		weight := cast.ToInt(args[2])
+		_, err = handlers.UpdateMember(handlers.ContextOf(ctx), household, sheetNames, username, func(member *models.Member) error {
+			member.Weight = weight
+			return nil
+		})
+		result = fmt.Sprintf("%s now has weight %d", username, weight)
+	case MembersNameArg:
+		displayName := strings.Join(args[2:], " ")
+		_, err = handlers.UpdateMember(handlers.ContextOf(ctx), household, sheetNames, username, func(member *models.Member) error {
+			member.DisplayName = displayName
+			return nil
+		})
+		result = fmt.Sprintf("%s is now shown as %s", username, displayName)
+		if displayName == "" {
+			result = fmt.Sprintf("%s display name cleared", username)
+		}
+	case MembersLinkArg:
+		reply := ctx.EffectiveMessage.ReplyToMessage
+		if reply == nil || reply.From == nil {
+			return replyMarkdown(bot, ctx, "*Link Member*\n\nReply to a message of the member with `/members link @username`.")
+		}
+		_, err = handlers.UpdateMember(handlers.ContextOf(ctx), household, sheetNames, username, func(member *models.Member) error {
+			member.UserID = reply.From.Id
+			return nil
+		})
+		result = fmt.Sprintf("%s linked to Telegram user %d", username, reply.From.Id)
+	default:
+		return replyMarkdown(bot, ctx, membersUsage)
+	}
+	if err != nil {
+		// The sheets are written together, a refused change leaves all of them unchanged
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s\n\nNothing was changed in %s.", err.Error(), strings.Join(sheetNames, " and ")))
+	}
+
+	logUserAction(ctx, "members_"+action, result)
+	message := fmt.Sprintf("*Members Updated*\n\n%s in %s.", result, strings.Join(sheetNames, " and "))
+	if resplitRent {
+		message += "\n\nIf this month's rent is saved, save it again with /rent to split it with the new members and weights."
+	}
+	return replyMarkdown(bot, ctx, message)
+}
+
+// migrateMemberRefs rewrites the @usernames stored in the expense and task sheets to member references
+func migrateMemberRefs(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "members_migrate", "migrating member references")
+
+	result, err := handlers.MigrateMemberRefs(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Migration Failed*\n\n%s", err.Error()))
+	}
+
+	message := fmt.Sprintf(
+		"*Members Migrated*\n\nRecords now reference members by Telegram user ID and the Balances formulas of `%s` match them.\n\n%d value(s) updated:\n- Expenses: %d\n- Rent payers: %d\n- Tasks: %d\n- Task history: %d\n- Member rows linked: %d",
+		strings.Join(result.Sheets, "`, `"), result.Total(), result.Expenses, result.RentPayers, result.Tasks, result.TaskHistory, result.Linked,
+	)
+	if len(result.Skipped) > 0 {
+		message += fmt.Sprintf("\n\n`%s` keep their @usernames and formulas, some of their members are not in the current sheet.", strings.Join(result.Skipped, "`, `"))
+	}
+	return replyMarkdown(bot, ctx, message)
+}
+
+func showMembers(bot *gotgbot.Bot, ctx *ext.Context) error {
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return err
+	}
+	members, err := handlers.GetMembers(handlers.ContextOf(ctx), svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*Members* (`%s`)\n\n", currentSheetName))
+	for _, m := range members {
+		linked := "not linked"
+		if m.UserID != 0 {
+			linked = "linked"
+		}
+		sb.WriteString(fmt.Sprintf("%d. *%s* (%s) - weight %d, %s\n", m.ID, m.Name(), m.Username, m.Weight, linked))
+	}
+	if len(members) == 0 {
+		sb.WriteString("_No members yet._\n")
+	}
+	sb.WriteString("\nSend `/members help` to see how to manage members.")
+	return replyMarkdown(bot, ctx, sb.String())
+}
+
+// getMemberSheetNames returns the current sheet, and the Template sheet if requested
+func getMemberSheetNames(ctx *ext.Context, applyToTemplate bool) ([]string, error) {
+	currentSheetName, err := handlers.GetCurrentSheetName(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	sheetNames := []string{currentSheetName}
+	if applyToTemplate && currentSheetName != config.TemplateSheetName {
+		sheetNames = append(sheetNames, config.TemplateSheetName)
+	}
+	return sheetNames, nil
+}
+
+// syncMemberIdentity links the user to their member row the first time they use the bot,
+// and follows username changes of linked users
+func syncMemberIdentity(ctx *ext.Context) {
+	user := ctx.EffectiveUser
+	if user == nil || user.Username == "" {
+		return
+	}
+	username := "@" + user.Username
+
+	syncedMux.Lock()
+	known := syncedIdentities[user.Id] == username
+	syncedMux.Unlock()
+	if known {
+		return
+	}
+
+	if err := handlers.SyncMemberIdentity(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), user.Id, username); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to sync member identity of %s: %s", username, err.Error())
+		return
+	}
+
+	syncedMux.Lock()
+	syncedIdentities[user.Id] = username
+	syncedMux.Unlock()
+}
+
+// getActorRef returns the member reference of the user who triggered the update, which is what payer, assignee and
+// doer columns store, or handlers.ErrNotMember when the user has no member row
+func getActorRef(ctx *ext.Context) (string, error) {
+	members, err := handlers.GetCurrentMembers(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return "", err
+	}
+	return handlers.GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+}
+
+// replyActorError tells the user why the action cannot be recorded for them, handlers.ErrNotMember for non-members
+func replyActorError(bot *gotgbot.Bot, ctx *ext.Context, err error) error {
+	return replyMarkdown(bot, ctx, fmt.Sprintf("*Not Allowed*\n\n%s", err.Error()))
+}
+
+// getCurrentMembers returns the members of the current sheet, or none when they cannot be read,
+// in which case stored references are shown as they are
+func getCurrentMembers(ctx *ext.Context) []models.Member {
+	members, err := handlers.GetCurrentMembers(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to get members: %s", err.Error())
+	}
+	return members
+}
+
+func normalizeUsername(username string) string {
+	if !strings.HasPrefix(username, "@") {
+		return "@" + username
+	}
+	return username
+}
+
+func replyMarkdown(bot *gotgbot.Bot, ctx *ext.Context, text string) error {
+	_, err := ctx.EffectiveMessage.Reply(bot, text, &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+func replyHTML(bot *gotgbot.Bot, ctx *ext.Context, text string) error {
+	_, err := ctx.EffectiveMessage.Reply(bot, text, &gotgbot.SendMessageOpts{ParseMode: "html"})
+	return err
+}
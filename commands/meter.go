@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/utilities"
+)
+
+const meterUsage = "*Meters*\n\n" +
+	"`/meter` - show this month's electric and water usage\n" +
+	"`/meter electric 12345` - record the main electric meter\n" +
+	"`/meter water 678` - record the main water meter\n" +
+	"`/meter electric @username 2345` - record the room sub-meter of a member\n\n" +
+	"The usage is the last reading of the month minus the last reading of the previous month. " +
+	"`/rent` fills in the electric and water amounts from it."
+
+// Meter handles the /meter command.
+func Meter(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "meter", "command called")
+
+	args := ctx.Args()[1:]
+	if len(args) == 0 {
+		return showMeterUsage(bot, ctx)
+	}
+
+	meter := strings.ToLower(args[0])
+	if meter != models.MeterElectric && meter != models.MeterWater {
+		return replyMarkdown(bot, ctx, meterUsage)
+	}
+
+	recordedBy, err := getActorRef(ctx)
+	if err != nil {
+		return replyActorError(bot, ctx, err)
+	}
+	members := getCurrentMembers(ctx)
+	reading := models.MeterReading{Meter: meter, RecordedBy: recordedBy}
+	switch len(args) {
+	case 2:
+	case 3:
+		member := models.FindMemberByRef(members, args[1])
+		if member == nil {
+			return replyMarkdown(bot, ctx, fmt.Sprintf("*Unknown Member*\n\n%s is not a member of this month.", args[1]))
+		}
+		reading.Member = member.Ref()
+	default:
+		return replyMarkdown(bot, ctx, meterUsage)
+	}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(args[len(args)-1], ",", "."), 64)
+	if err != nil || value < 0 {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Invalid Reading*\n\n`%s` is not a meter reading.", args[len(args)-1]))
+	}
+	reading.Reading = value
+
+	household := handlers.HouseholdOf(ctx)
+	svc, spreadsheetId, currentSheetName, err := handlers.GetCurrentSheetInfo(handlers.ContextOf(ctx), household)
+	if err != nil {
+		return err
+	}
+	reading.Month = currentSheetName
+	reading.Timestamp = utilities.GetCurrentTimestamp(household.Location())
+	if err := handlers.AppendMeterReading(handlers.ContextOf(ctx), svc, spreadsheetId, reading); err != nil {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s", err.Error()))
+	}
+
+	target := "main meter"
+	if reading.Member != "" {
+		target = models.DisplayRef(members, reading.Member) + "'s sub-meter"
+	}
+	logUserAction(ctx, "meter_record", fmt.Sprintf("%s %s: %g", meter, target, value))
+
+	message := fmt.Sprintf("*Reading Recorded*\n\n%s %s: %g (`%s`)", meter, target, value, currentSheetName)
+	if usage, err := handlers.GetMeterUsage(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), meter); err == nil {
+		message += "\n\nUsage this month: " + handlers.FormatMeterUsage(usage, members)
+	}
+	return replyMarkdown(bot, ctx, message)
+}
+
+// showMeterUsage shows the usage of each meter in the current month
+func showMeterUsage(bot *gotgbot.Bot, ctx *ext.Context) error {
+	members := getCurrentMembers(ctx)
+
+	var sb strings.Builder
+	sb.WriteString("*Meters*\n\n")
+	for _, meter := range []string{models.MeterElectric, models.MeterWater} {
+		label := "\u26a1 Electric"
+		if meter == models.MeterWater {
+			label = "\U0001F4A7 Water"
+		}
+		usage, err := handlers.GetMeterUsage(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), meter)
+		if err != nil {
+			sb.WriteString(fmt.Sprintf("%s: _%s_\n", label, err.Error()))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s", label, handlers.FormatMeterUsage(usage, members)))
+	}
+	sb.WriteString("\nSend `/meter help` to see how to record readings.")
+	return replyMarkdown(bot, ctx, sb.String())
+}
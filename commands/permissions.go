@@ -0,0 +1,287 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/utilities"
+)
+
+// action is what an update asks to do, checked against the role of the user
+type action string
+
+const (
+	actionNone           action = ""
+	actionView           action = "view"
+	actionWrite          action = "write"
+	actionManageMembers  action = "manage_members"
+	actionCreateSheet    action = "create_sheet"
+	actionManageRoles    action = "manage_roles"
+	actionEditAnyExpense action = "edit_any_expense"
+	actionImport         action = "import"
+	// actionAdministerBot is for the users of telegram.admin_user_ids, in any chat
+	actionAdministerBot action = "administer_bot"
+)
+
+// roleKey is the ctx.Data key of the role resolved by the permission middleware
+const roleKey = "role"
+
+// roleUnresolvedKey is set in ctx.Data when the Roles sheet could not be read
+const roleUnresolvedKey = "role_unresolved"
+
+// requiredRoles is the lowest role allowed to do each action
+var requiredRoles = map[action]models.Role{
+	actionView:           models.RoleViewer,
+	actionWrite:          models.RoleMember,
+	actionManageMembers:  models.RoleAdmin,
+	actionCreateSheet:    models.RoleAdmin,
+	actionManageRoles:    models.RoleAdmin,
+	actionEditAnyExpense: models.RoleAdmin,
+	actionImport:         models.RoleAdmin,
+}
+
+// actionDescriptions completes "Your role cannot ..." in the access denied message
+var actionDescriptions = map[action]string{
+	actionView:           "use this command",
+	actionWrite:          "change the house data",
+	actionManageMembers:  "manage members",
+	actionCreateSheet:    "create month sheets",
+	actionManageRoles:    "manage roles",
+	actionEditAnyExpense: "edit or delete expenses paid by someone else",
+	actionImport:         "import house data",
+}
+
+// commandActions is the action of each command; commands not listed are public
+var commandActions = map[string]action{
+	enum.HelpCommand:               actionView,
+	enum.SplitBillCommand:          actionView,
+	enum.HouseworkCommand:          actionView,
+	enum.GSheetsCommand:            actionView,
+	enum.ShopCommand:               actionView,
+	enum.SettingsCommand:           actionView,
+	enum.SplitBillAddActionCommand: actionWrite,
+	enum.RentCommand:               actionWrite,
+	enum.MeterCommand:              actionWrite,
+	enum.ExportCommand:             actionView,
+	enum.ImportCommand:             actionImport,
+	enum.MembersCommand:            actionManageMembers,
+	enum.RolesCommand:              actionManageRoles,
+	enum.StatusCommand:             actionAdministerBot,
+	enum.DiagCommand:               actionAdministerBot,
+	enum.SetupCommand:              actionAdministerBot,
+}
+
+// callbackActions is the action of the callbacks that do not change the house data, with the numeric
+// parts of their data replaced by "#", e.g., "housework.#.view"; other callbacks of a family are writes
+var callbackActions = map[string]action{
+	"splitbill.view":              actionView,
+	"splitbill.report":            actionView,
+	"splitbill.back":              actionView,
+	"splitbill.update":            actionView, // lists the expenses, selecting one is a write
+	"splitbill.delete":            actionView,
+	"splitbill.delete.cancel":     actionView,
+	HouseworkListCommand:          actionView,
+	HouseworkStatsCommand:         actionView,
+	"housework.#.view":            actionView,
+	ShopListCommand:               actionView,
+	"settings.back":               actionView,
+	"settings.housework_reminder": actionView,
+	GSheetsCreateCommand:          actionCreateSheet,
+	GSheetsConfirmCreateCommand:   actionCreateSheet,
+	GSheetsCancelCreateCommand:    actionView,
+	ImportApplyCommand:            actionImport,
+	ImportCancelCommand:           actionView,
+}
+
+// callbackFamilyActions is the action of the callbacks of a family that are not in callbackActions
+var callbackFamilyActions = map[string]action{
+	"help": actionView,
+}
+
+// callbackActionKey replaces the numeric parts of callback data with "#"
+func callbackActionKey(data string) string {
+	parts := strings.Split(data, ".")
+	for i, part := range parts {
+		if utilities.IsNumeric(part) {
+			parts[i] = "#"
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// updateAction returns the action asked by a command or a callback. Plain messages are not checked:
+// they only reach a conversation started by a command or a callback that was.
+func updateAction(bot *gotgbot.Bot, ctx *ext.Context) action {
+	if cb := ctx.CallbackQuery; cb != nil {
+		if a, ok := callbackActions[callbackActionKey(cb.Data)]; ok {
+			return a
+		}
+		family, _, _ := strings.Cut(cb.Data, ".")
+		if a, ok := callbackFamilyActions[family]; ok {
+			return a
+		}
+		return actionWrite
+	}
+
+	if ctx.Message == nil {
+		return actionNone
+	}
+	command := getCommandFromMessage(bot, ctx.Message)
+	if command == "" {
+		return actionNone
+	}
+	if strings.HasPrefix(command, enum.HouseworkPrefix) {
+		return actionWrite
+	}
+	return commandActions[command]
+}
+
+// permissionMiddleware checks every command and callback before the handlers see it:
+// the chat must be allowed and the role of the user must be high enough for the action
+type permissionMiddleware struct{}
+
+// NewPermissionMiddleware returns the handler to register in a group before the other handlers
+func NewPermissionMiddleware() ext.Handler {
+	return permissionMiddleware{}
+}
+
+func (permissionMiddleware) Name() string {
+	return "permission_middleware"
+}
+
+func (permissionMiddleware) CheckUpdate(bot *gotgbot.Bot, ctx *ext.Context) bool {
+	return ctx.EffectiveUser != nil && ctx.EffectiveChat != nil && updateAction(bot, ctx) != actionNone
+}
+
+func (permissionMiddleware) HandleUpdate(bot *gotgbot.Bot, ctx *ext.Context) error {
+	a := updateAction(bot, ctx)
+	if a == actionAdministerBot {
+		if !isAdmin(ctx.EffectiveUser.Id) {
+			logPermissionDenied(ctx, a, models.RoleNone)
+			denyAccess(bot, ctx, "This command is only available to the bot admins.")
+			return ext.EndGroups
+		}
+		return nil
+	}
+
+	if !isChatAllowed(ctx.EffectiveChat.Id) {
+		logPermissionDenied(ctx, a, models.RoleNone)
+		denyAccess(bot, ctx, "This chat is not authorized to use this command.")
+		return ext.EndGroups
+	}
+
+	role := roleOf(ctx)
+	if !hasPermission(role, a) {
+		logPermissionDenied(ctx, a, role)
+		if unresolved, _ := ctx.Data[roleUnresolvedKey].(bool); unresolved {
+			denyAccess(bot, ctx, "Your role could not be read from the Roles sheet. Try again in a moment.")
+		} else {
+			denyAccess(bot, ctx, deniedMessage(role, a))
+		}
+		return ext.EndGroups
+	}
+	return nil
+}
+
+// isChatAllowed checks if the chat has a household: an allowed channel, a chat of
+// settings.households or a chat linked with /setup
+func isChatAllowed(chatId int64) bool {
+	_, ok := handlers.GetHousehold(chatId)
+	return ok
+}
+
+// hasPermission reports whether role may do the action
+func hasPermission(role models.Role, a action) bool {
+	required, ok := requiredRoles[a]
+	return !ok || role >= required
+}
+
+// roleOf returns the role of the user in the chat: owner for the bot admins, the role of the Roles sheet,
+// or member. When the Roles sheet cannot be read it returns viewer, so writes are denied rather than
+// granted to everyone. It is resolved once per update.
+func roleOf(ctx *ext.Context) models.Role {
+	if role, ok := ctx.Data[roleKey].(models.Role); ok {
+		return role
+	}
+	if ctx.Data == nil {
+		ctx.Data = make(map[string]interface{})
+	}
+
+	role := models.RoleMember
+	if isAdmin(ctx.EffectiveUser.Id) {
+		role = models.RoleOwner
+	} else if assigned, found, err := handlers.GetRole(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), ctx.EffectiveUser.Id); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to get the role of user %d, using viewer: %s", ctx.EffectiveUser.Id, err.Error())
+		role = models.RoleViewer
+		ctx.Data[roleUnresolvedKey] = true
+	} else if found {
+		role = assigned
+	}
+
+	ctx.Data[roleKey] = role
+	return role
+}
+
+// canEditExpense reports whether the user may change the expense: its payer or an admin
+func canEditExpense(ctx *ext.Context, expense *models.Expense) bool {
+	if hasPermission(roleOf(ctx), actionEditAnyExpense) {
+		return true
+	}
+	actor, err := getActorRef(ctx)
+	if err != nil {
+		return false
+	}
+	return models.SameMember(getCurrentMembers(ctx), expense.Payer, actor)
+}
+
+// replyExpenseEditDenied tells the user that only the payer or an admin may change the expense
+func replyExpenseEditDenied(bot *gotgbot.Bot, ctx *ext.Context, expense *models.Expense) error {
+	logPermissionDenied(ctx, actionEditAnyExpense, roleOf(ctx))
+	return replyMarkdown(bot, ctx, fmt.Sprintf(
+		"*Access Denied*\n\nExpense #%d was paid by %s. Only the payer or an admin can change it.",
+		expense.ID, models.DisplayRef(getCurrentMembers(ctx), expense.Payer),
+	))
+}
+
+func deniedMessage(role models.Role, a action) string {
+	return fmt.Sprintf("Your role (%s) cannot %s. Ask an admin of this chat.", role, actionDescriptions[a])
+}
+
+func logPermissionDenied(ctx *ext.Context, a action, role models.Role) {
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
+		"user_id":   ctx.EffectiveUser.Id,
+		"username":  ctx.EffectiveUser.Username,
+		"chat_id":   ctx.EffectiveChat.Id,
+		"chat_type": ctx.EffectiveChat.Type,
+		"action":    string(a),
+		"role":      role.String(),
+	}).Warn("permission denied")
+}
+
+// denyAccess answers a denied callback with an alert, and a denied command with a reply
+func denyAccess(bot *gotgbot.Bot, ctx *ext.Context, reason string) {
+	if cb := ctx.CallbackQuery; cb != nil {
+		_, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Access denied. " + reason, ShowAlert: true})
+		if err != nil {
+			logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to answer denied callback query: %s", err.Error())
+		}
+		return
+	}
+	_, err := ctx.EffectiveMessage.Reply(
+		bot,
+		"*Access Denied*\n\n"+reason,
+		&gotgbot.SendMessageOpts{
+			ParseMode: "markdown",
+		},
+	)
+	if err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to send permission denied message: %s", err.Error())
+	}
+}
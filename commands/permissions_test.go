@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/models"
+)
+
+func testBot() *gotgbot.Bot {
+	return &gotgbot.Bot{User: gotgbot.User{Username: "housemate_bot"}}
+}
+
+func commandContext(text string) *ext.Context {
+	return &ext.Context{Update: &gotgbot.Update{Message: &gotgbot.Message{
+		Text:     text,
+		Entities: []gotgbot.MessageEntity{{Type: "bot_command", Offset: 0}},
+	}}}
+}
+
+func callbackContext(data string) *ext.Context {
+	return &ext.Context{Update: &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{Data: data}}}
+}
+
+func TestUpdateActionCommands(t *testing.T) {
+	tests := []struct {
+		text string
+		want action
+	}{
+		{"/start", actionNone},
+		{"/hello", actionNone},
+		{"/feedback", actionNone},
+		{"/cancel", actionNone},
+		{"/help", actionView},
+		{"/splitbill", actionView},
+		{"/housework", actionView},
+		{"/gsheets", actionView},
+		{"/shop", actionView},
+		{"/settings", actionView},
+		{"/export", actionView},
+		{"/splitbill_add", actionWrite},
+		{"/rent", actionWrite},
+		{"/meter", actionWrite},
+		{"/hw1", actionWrite},
+		{"/hw12", actionWrite},
+		{"/import", actionImport},
+		{"/members", actionManageMembers},
+		{"/roles", actionManageRoles},
+		{"/status", actionAdministerBot},
+		{"/diag", actionAdministerBot},
+		{"/setup", actionAdministerBot},
+		{"/rent@housemate_bot", actionWrite},
+		{"/rent@other_bot", actionNone},
+		{"/members @alice", actionManageMembers},
+	}
+	for _, tt := range tests {
+		if got := updateAction(testBot(), commandContext(tt.text)); got != tt.want {
+			t.Errorf("updateAction(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateActionPlainMessage(t *testing.T) {
+	ctx := &ext.Context{Update: &gotgbot.Update{Message: &gotgbot.Message{Text: "milk, eggs"}}}
+	if got := updateAction(testBot(), ctx); got != actionNone {
+		t.Errorf("updateAction(plain message) = %q, want none", got)
+	}
+}
+
+func TestUpdateActionCallbacks(t *testing.T) {
+	tests := []struct {
+		data string
+		want action
+	}{
+		{"help.splitbill", actionView},
+		{"help.members", actionView},
+		{"splitbill.view", actionView},
+		{"splitbill.report", actionView},
+		{"splitbill.back", actionView},
+		{"splitbill.update", actionView},
+		{"splitbill.delete", actionView},
+		{"splitbill.delete.cancel", actionView},
+		{"splitbill.add", actionWrite},
+		{"splitbill.update.12", actionWrite},
+		{"splitbill.delete.12", actionWrite},
+		{"splitbill.delete.confirm.12", actionWrite},
+		{"housework.list", actionView},
+		{"housework.stats", actionView},
+		{"housework.3.view", actionView},
+		{"housework.add", actionWrite},
+		{"housework.update", actionWrite},
+		{"housework.delete", actionWrite},
+		{"housework.3.done", actionWrite},
+		{"housework.3.assign", actionWrite},
+		{"housework.3.update", actionWrite},
+		{"housework.3.delete", actionWrite},
+		{"housework.3.swap", actionWrite},
+		{"housework.3.swapto.2", actionWrite},
+		{"housework.3.swapwith.2.1", actionWrite},
+		{"housework.3.swaptake.2", actionWrite},
+		{"housework.3.swappick.2", actionWrite},
+		{"housework.3.swapdecline.2", actionWrite},
+		{"housework.3.proof", actionWrite},
+		{"housework.3.approve.7", actionWrite},
+		{"housework.3.reject.7", actionWrite},
+		{"shop.list", actionView},
+		{"shop.add", actionWrite},
+		{"shop.checkout", actionWrite},
+		{"shop.4.check", actionWrite},
+		{"shop.4.remove", actionWrite},
+		{"gsheets.create", actionCreateSheet},
+		{"gsheets.confirm_create", actionCreateSheet},
+		{"gsheets.cancel_create", actionView},
+		{"settings.back", actionView},
+		{"settings.housework_reminder", actionView},
+		{"settings.reminder_toggle", actionWrite},
+		{enum.RentPayerPrefix + "@alice", actionWrite},
+		{enum.RentReviewPrefix + RentReviewSaveAction, actionWrite},
+		{enum.RentPolicyPrefix + RentPolicyDoneAction, actionWrite},
+		{"import.apply", actionImport},
+		{"import.cancel", actionView},
+	}
+	for _, tt := range tests {
+		if got := updateAction(testBot(), callbackContext(tt.data)); got != tt.want {
+			t.Errorf("updateAction(callback %q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestActionsHaveRoleAndDescription(t *testing.T) {
+	actions := make(map[action]bool)
+	for _, a := range commandActions {
+		actions[a] = true
+	}
+	for _, a := range callbackActions {
+		actions[a] = true
+	}
+	for _, a := range callbackFamilyActions {
+		actions[a] = true
+	}
+	delete(actions, actionAdministerBot)
+	for a := range actions {
+		if _, ok := requiredRoles[a]; !ok {
+			t.Errorf("action %q has no required role", a)
+		}
+		if _, ok := actionDescriptions[a]; !ok {
+			t.Errorf("action %q has no description", a)
+		}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role models.Role
+		a    action
+		want bool
+	}{
+		{models.RoleViewer, actionView, true},
+		{models.RoleViewer, actionWrite, false},
+		{models.RoleMember, actionWrite, true},
+		{models.RoleMember, actionManageMembers, false},
+		{models.RoleAdmin, actionImport, true},
+		{models.RoleAdmin, actionEditAnyExpense, true},
+		{models.RoleOwner, actionManageRoles, true},
+		{models.RoleNone, actionView, false},
+	}
+	for _, tt := range tests {
+		if got := hasPermission(tt.role, tt.a); got != tt.want {
+			t.Errorf("hasPermission(%s, %q) = %v, want %v", tt.role, tt.a, got, tt.want)
+		}
+	}
+}
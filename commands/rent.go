@@ -2,44 +2,71 @@ package commands
 
 import (
 	"fmt"
-	"sync"
+	"strings"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	tgBotHandler "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
 
 	"housematee-tgbot/enum"
 	"housematee-tgbot/handlers"
 	"housematee-tgbot/models"
+	"housematee-tgbot/services/state"
 	"housematee-tgbot/utilities"
 )
 
-// rentDataStore stores rent data during conversation (keyed by chat ID)
-var (
-	rentDataStore = make(map[int64]*models.RentData)
-	rentDataMux   sync.RWMutex
+// Review screen actions as used in the callback data
+const (
+	RentReviewSaveAction     = "save"
+	RentReviewTotalAction    = "total"
+	RentReviewElectricAction = "electric"
+	RentReviewWaterAction    = "water"
+	RentReviewPayerAction    = "payer"
+	RentReviewSplitAction    = "split"
 )
 
+// Names of the rent drafts, stored per chat
+const (
+	rentDraftData       = "data"
+	rentDraftReviewing  = "reviewing"
+	rentDraftPolicyEdit = "policy_edit"
+)
+
+// rentDraftOwner returns the owner of the rent drafts of a chat
+func rentDraftOwner(chatID int64) state.Owner {
+	return state.Owner{Flow: enum.FlowRent, ChatID: chatID}
+}
+
 // getRentData gets rent data for a chat
 func getRentData(chatID int64) *models.RentData {
-	rentDataMux.RLock()
-	defer rentDataMux.RUnlock()
-	return rentDataStore[chatID]
+	var data models.RentData
+	if !getDraft(enum.FlowRent, chatID, rentDraftData, &data) {
+		return nil
+	}
+	return &data
 }
 
 // setRentData sets rent data for a chat
 func setRentData(chatID int64, data *models.RentData) {
-	rentDataMux.Lock()
-	defer rentDataMux.Unlock()
-	rentDataStore[chatID] = data
+	putDraft(rentDraftOwner(chatID), rentDraftData, data)
+}
+
+// isRentReviewing reports whether the chat already reached the review step
+func isRentReviewing(chatID int64) bool {
+	var reviewing bool
+	return getDraft(enum.FlowRent, chatID, rentDraftReviewing, &reviewing) && reviewing
+}
+
+// setRentReviewing marks the chat as being at the review step
+func setRentReviewing(chatID int64) {
+	putDraft(rentDraftOwner(chatID), rentDraftReviewing, true)
 }
 
 // clearRentData clears rent data for a chat
 func clearRentData(chatID int64) {
-	rentDataMux.Lock()
-	defer rentDataMux.Unlock()
-	delete(rentDataStore, chatID)
+	deleteDrafts(enum.FlowRent, chatID, rentDraftData, rentDraftReviewing, rentDraftPolicyEdit)
 }
 
 // Rent handles the /rent command - entry point
@@ -48,14 +75,23 @@ func Rent(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return StartRentConversation(bot, ctx)
 }
 
-// StartRentConversation starts the rent conversation flow
+// StartRentConversation starts the rent conversation flow.
+// When the rent of the month is already saved, it is shown on the review screen to be edited.
 func StartRentConversation(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "rent_start", "starting rent flow")
+	clearRentData(ctx.EffectiveChat.Id)
+
+	saved, err := handlers.GetRentData(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to get saved rent, starting a new one: %s", err.Error())
+	} else if saved.TotalBill > 0 {
+		return startSavedRentReview(bot, ctx, saved)
+	}
 
 	// Initialize rent data for this chat
 	setRentData(ctx.EffectiveChat.Id, &models.RentData{})
 
-	_, err := ctx.EffectiveMessage.Reply(
+	_, err = ctx.EffectiveMessage.Reply(
 		bot,
 		"\U0001F3E0 *Add Rent*\n\nPlease enter the \U0001F4B0 *total rent bill* amount:",
 		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
@@ -66,25 +102,78 @@ func StartRentConversation(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return tgBotHandler.NextConversationState(enum.RentStateTotal)
 }
 
-// HandleRentTotalInput handles the total bill input
-func HandleRentTotalInput(bot *gotgbot.Bot, ctx *ext.Context) error {
-	if !CheckPermission(bot, ctx) {
-		return nil
+// startSavedRentReview shows the rent already saved for the month on the review screen
+func startSavedRentReview(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData) error {
+	members := getCurrentMembers(ctx)
+	rentData.PayerName = models.DisplayRef(members, rentData.Payer)
+
+	policy, err := handlers.GetRentSplitPolicy(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to get rent split policy, using default: %s", err.Error())
 	}
+	rentData.SplitPolicy = policy
 
-	input := ctx.EffectiveMessage.Text
-	amount := utilities.ParseAmount(input)
+	// Keep the per-member consumption when the amounts still match the meters
+	if usage := getRentMeterUsage(ctx, models.MeterElectric); usage != nil && usage.Amount == rentData.Electric {
+		rentData.ElectricUsage = usage
+	}
+	if usage := getRentMeterUsage(ctx, models.MeterWater); usage != nil && usage.Amount == rentData.Water {
+		rentData.WaterUsage = usage
+	}
+	rentData.ApplyMeterSplits()
 
-	if amount == "" || !utilities.IsNumeric(amount) {
-		_, err := ctx.EffectiveMessage.Reply(
-			bot,
-			"*Invalid Amount*\n\nPlease enter a valid number for the total bill:",
-			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-		)
-		if err != nil {
+	setRentData(ctx.EffectiveChat.Id, rentData)
+	setRentReviewing(ctx.EffectiveChat.Id)
+	if err := showRentReview(bot, ctx, rentData, "\U0001F3E0 *Saved Rent*\n\nThe rent of this month is already saved. Edit it or /cancel.", false); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.RentStateReview)
+}
+
+// replyInvalidRentAmount asks again for an amount and stays in the same state
+func replyInvalidRentAmount(bot *gotgbot.Bot, ctx *ext.Context, message string, state string) error {
+	_, err := ctx.EffectiveMessage.Reply(bot, message, &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+	if err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(state)
+}
+
+// validateRentInput checks the amounts entered so far against the total.
+// It returns false after asking for the amount of the state again.
+func validateRentInput(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, state string) (bool, error) {
+	err := rentData.Validate()
+	if err == nil {
+		return true, nil
+	}
+	message := fmt.Sprintf("*Invalid Amount*\n\nThe %s.\n\nPlease enter the amount again:", err.Error())
+	return false, replyInvalidRentAmount(bot, ctx, message, state)
+}
+
+// continueRent goes back to the review screen once it was reached, or asks for the next amount
+func continueRent(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, message string, nextState string) error {
+	setRentData(ctx.EffectiveChat.Id, rentData)
+	if isRentReviewing(ctx.EffectiveChat.Id) {
+		if err := showRentReview(bot, ctx, rentData, "", false); err != nil {
 			return err
 		}
-		return tgBotHandler.NextConversationState(enum.RentStateTotal)
+		return tgBotHandler.NextConversationState(enum.RentStateReview)
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(bot, message, &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+	if err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(nextState)
+}
+
+// HandleRentTotalInput handles the total bill input
+func HandleRentTotalInput(bot *gotgbot.Bot, ctx *ext.Context) error {
+	input := ctx.EffectiveMessage.Text
+	amount := utilities.ParseAmount(input)
+
+	if amount == "" || !utilities.IsNumeric(amount) || cast.ToInt64(amount) <= 0 {
+		return replyInvalidRentAmount(bot, ctx, "*Invalid Amount*\n\nPlease enter a valid number for the total bill:", enum.RentStateTotal)
 	}
 
 	// Store total bill
@@ -93,126 +182,308 @@ func HandleRentTotalInput(bot *gotgbot.Bot, ctx *ext.Context) error {
 		rentData = &models.RentData{}
 	}
 	rentData.TotalBill = cast.ToInt64(amount)
-	setRentData(ctx.EffectiveChat.Id, rentData)
-
-	_, err := ctx.EffectiveMessage.Reply(
-		bot,
-		fmt.Sprintf("\U0001F4B0 Total: *%s*\n\nNow enter the \u26a1 *electric* bill amount:", utilities.FormatMoney(int(rentData.TotalBill))),
-		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-	)
-	if err != nil {
+	if ok, err := validateRentInput(bot, ctx, rentData, enum.RentStateTotal); !ok {
 		return err
 	}
-	return tgBotHandler.NextConversationState(enum.RentStateElectric)
+	rentData.ElectricUsage = getRentMeterUsage(ctx, models.MeterElectric)
+
+	return continueRent(bot, ctx, rentData,
+		fmt.Sprintf("\U0001F4B0 Total: *%s*\n\nNow enter the \u26a1 *electric* bill amount:%s", utilities.FormatMoney(int(rentData.TotalBill)), formatRentMeterPrompt(ctx, rentData.ElectricUsage)),
+		enum.RentStateElectric,
+	)
 }
 
 // HandleRentElectricInput handles the electric bill input
 func HandleRentElectricInput(bot *gotgbot.Bot, ctx *ext.Context) error {
-	if !CheckPermission(bot, ctx) {
-		return nil
+	rentData := getRentData(ctx.EffectiveChat.Id)
+	if rentData == nil {
+		return StartRentConversation(bot, ctx)
 	}
 
 	input := ctx.EffectiveMessage.Text
-	amount := utilities.ParseAmount(input)
+	amount, fromMeter := parseRentMeterInput(input, rentData.ElectricUsage)
 
 	if amount == "" || !utilities.IsNumeric(amount) {
-		_, err := ctx.EffectiveMessage.Reply(
-			bot,
-			"*Invalid Amount*\n\nPlease enter a valid number for the electric bill:",
-			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-		)
-		if err != nil {
-			return err
-		}
-		return tgBotHandler.NextConversationState(enum.RentStateElectric)
+		return replyInvalidRentAmount(bot, ctx, "*Invalid Amount*\n\nPlease enter a valid number for the electric bill:", enum.RentStateElectric)
 	}
 
 	// Store electric bill
-	rentData := getRentData(ctx.EffectiveChat.Id)
-	if rentData == nil {
-		clearRentData(ctx.EffectiveChat.Id)
-		return StartRentConversation(bot, ctx)
-	}
 	rentData.Electric = cast.ToInt64(amount)
-	setRentData(ctx.EffectiveChat.Id, rentData)
-
-	_, err := ctx.EffectiveMessage.Reply(
-		bot,
-		fmt.Sprintf("\u26a1 Electric: *%s*\n\nNow enter the \U0001F4A7 *water* bill amount:", utilities.FormatMoney(int(rentData.Electric))),
-		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-	)
-	if err != nil {
+	if ok, err := validateRentInput(bot, ctx, rentData, enum.RentStateElectric); !ok {
 		return err
 	}
-	return tgBotHandler.NextConversationState(enum.RentStateWater)
+	if !fromMeter {
+		rentData.ElectricUsage = nil
+	}
+	rentData.WaterUsage = getRentMeterUsage(ctx, models.MeterWater)
+
+	return continueRent(bot, ctx, rentData,
+		fmt.Sprintf("\u26a1 Electric: *%s*\n\nNow enter the \U0001F4A7 *water* bill amount:%s", utilities.FormatMoney(int(rentData.Electric)), formatRentMeterPrompt(ctx, rentData.WaterUsage)),
+		enum.RentStateWater,
+	)
 }
 
-// HandleRentWaterInput handles the water bill input and saves the rent data
+// HandleRentWaterInput handles the water bill input and asks who paid the rent
 func HandleRentWaterInput(bot *gotgbot.Bot, ctx *ext.Context) error {
-	if !CheckPermission(bot, ctx) {
-		return nil
+	rentData := getRentData(ctx.EffectiveChat.Id)
+	if rentData == nil {
+		return StartRentConversation(bot, ctx)
 	}
 
 	input := ctx.EffectiveMessage.Text
-	amount := utilities.ParseAmount(input)
+	amount, fromMeter := parseRentMeterInput(input, rentData.WaterUsage)
 
 	if amount == "" || !utilities.IsNumeric(amount) {
-		_, err := ctx.EffectiveMessage.Reply(
-			bot,
-			"*Invalid Amount*\n\nPlease enter a valid number for the water bill:",
-			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-		)
-		if err != nil {
-			return err
-		}
-		return tgBotHandler.NextConversationState(enum.RentStateWater)
+		return replyInvalidRentAmount(bot, ctx, "*Invalid Amount*\n\nPlease enter a valid number for the water bill:", enum.RentStateWater)
 	}
 
 	// Store water bill
+	rentData.Water = cast.ToInt64(amount)
+	if ok, err := validateRentInput(bot, ctx, rentData, enum.RentStateWater); !ok {
+		return err
+	}
+	if !fromMeter {
+		rentData.WaterUsage = nil
+	}
+	if isRentReviewing(ctx.EffectiveChat.Id) {
+		return continueRent(bot, ctx, rentData, "", enum.RentStateReview)
+	}
+
+	// Default the payer to the current user (who sent the command), a user who is not a member picks one on the review screen
+	if payer, err := getActorRef(ctx); err == nil {
+		rentData.Payer = payer
+		rentData.PayerName = getActorUsername(ctx)
+	}
+
+	// Start from the split policy of the house, it can be changed on the review screen
+	policy, err := handlers.GetRentSplitPolicy(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to get rent split policy, using default: %s", err.Error())
+	}
+	rentData.SplitPolicy = policy
+	rentData.ApplyMeterSplits()
+	setRentData(ctx.EffectiveChat.Id, rentData)
+
+	if err := showRentPayerMenu(bot, ctx, rentData, false); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.RentStatePayer)
+}
+
+// showRentPayerMenu lets the user pick who paid the rent
+func showRentPayerMenu(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, edit bool) error {
+	members := getCurrentMembers(ctx)
+	keyboard := make([][]gotgbot.InlineKeyboardButton, 0, len(members))
+	for _, m := range members {
+		text := m.Username
+		if models.SameMember(members, m.Ref(), rentData.Payer) {
+			text = "[" + text + "]"
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: text, CallbackData: enum.RentPayerPrefix + m.Ref()},
+		})
+	}
+
+	message := "\U0001F464 *Who paid the rent?*"
+	if edit {
+		_, _, err := ctx.Update.CallbackQuery.Message.EditText(bot, message, &gotgbot.EditMessageTextOpts{
+			ParseMode:   "markdown",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+		})
+		return err
+	}
+	_, err := ctx.EffectiveMessage.Reply(bot, message, &gotgbot.SendMessageOpts{
+		ParseMode:   "markdown",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+	return err
+}
+
+// HandleRentPayerCallback handles the rent.payer.[member ref] buttons and shows the review screen
+func HandleRentPayerCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	logUserAction(ctx, "rent_payer_callback", fmt.Sprintf("callback: %s", cb.Data))
+
 	rentData := getRentData(ctx.EffectiveChat.Id)
 	if rentData == nil {
-		clearRentData(ctx.EffectiveChat.Id)
-		return StartRentConversation(bot, ctx)
+		_, _ = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "This rent was already saved or cancelled"})
+		return tgBotHandler.EndConversation()
 	}
-	rentData.Water = cast.ToInt64(amount)
 
-	// Auto-fill payer with current user (who sent the command)
-	rentData.Payer = "@" + ctx.EffectiveUser.Username
+	members := getCurrentMembers(ctx)
+	member := models.FindMemberByRef(members, strings.TrimPrefix(cb.Data, enum.RentPayerPrefix))
+	if member == nil {
+		_, _ = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "This member is no longer in the house"})
+		return tgBotHandler.NextConversationState(enum.RentStatePayer)
+	}
+	if _, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{}); err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	rentData.Payer = member.Ref()
+	rentData.PayerName = member.Username
+	setRentData(ctx.EffectiveChat.Id, rentData)
+	setRentReviewing(ctx.EffectiveChat.Id)
+
+	if err := showRentReview(bot, ctx, rentData, "", true); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.RentStateReview)
+}
 
-	// Calculate other fees
+// showRentReview shows the rent before it is saved, with buttons to edit any field
+func showRentReview(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, header string, edit bool) error {
 	rentData.CalculateOtherFees()
+	if header == "" {
+		header = "\U0001F4DD *Review Rent*\n\nCheck the rent before saving, or tap a field to change it."
+	}
+
+	var sb strings.Builder
+	sb.WriteString(header + "\n\n")
+	sb.WriteString(fmt.Sprintf("\U0001F4B0 Total: *%s*\n", utilities.FormatMoney(int(rentData.TotalBill))))
+	sb.WriteString(fmt.Sprintf("\u26a1 Electric: %s\n", utilities.FormatMoney(int(rentData.Electric))))
+	sb.WriteString(fmt.Sprintf("\U0001F4A7 Water: %s\n", utilities.FormatMoney(int(rentData.Water))))
+	sb.WriteString(fmt.Sprintf("\U0001F4C4 Other fees: %s\n", utilities.FormatMoney(int(rentData.OtherFees))))
+	sb.WriteString(fmt.Sprintf("\U0001F464 Payer: %s\n", rentData.PayerName))
+	sb.WriteString(fmt.Sprintf("\u2696 Split: electric %s, water %s, other fees %s",
+		rentData.SplitPolicy.Electric.Policy, rentData.SplitPolicy.Water.Policy, rentData.SplitPolicy.OtherFees.Policy))
+
+	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{Text: "Save", CallbackData: enum.RentReviewPrefix + RentReviewSaveAction},
+			},
+			{
+				{Text: "Total", CallbackData: enum.RentReviewPrefix + RentReviewTotalAction},
+				{Text: "Electric", CallbackData: enum.RentReviewPrefix + RentReviewElectricAction},
+				{Text: "Water", CallbackData: enum.RentReviewPrefix + RentReviewWaterAction},
+			},
+			{
+				{Text: "Payer", CallbackData: enum.RentReviewPrefix + RentReviewPayerAction},
+				{Text: "Split", CallbackData: enum.RentReviewPrefix + RentReviewSplitAction},
+			},
+		},
+	}
+
+	if edit {
+		_, _, err := ctx.Update.CallbackQuery.Message.EditText(bot, sb.String(), &gotgbot.EditMessageTextOpts{
+			ParseMode:   "markdown",
+			ReplyMarkup: inlineKeyboard,
+		})
+		return err
+	}
+	_, err := ctx.EffectiveMessage.Reply(bot, sb.String(), &gotgbot.SendMessageOpts{
+		ParseMode:   "markdown",
+		ReplyMarkup: inlineKeyboard,
+	})
+	return err
+}
+
+// HandleRentReviewCallback handles the rent.review.* buttons of the review screen
+func HandleRentReviewCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	logUserAction(ctx, "rent_review_callback", fmt.Sprintf("callback: %s", cb.Data))
 
-	// Validate: other fees should not be negative
-	if rentData.OtherFees < 0 {
-		_, err := ctx.EffectiveMessage.Reply(
-			bot,
-			fmt.Sprintf("*Validation Error*\n\nElectric (%s) + Water (%s) exceeds Total (%s).\n\nPlease start over with /rent",
-				utilities.FormatMoney(int(rentData.Electric)),
-				utilities.FormatMoney(int(rentData.Water)),
-				utilities.FormatMoney(int(rentData.TotalBill)),
-			),
-			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-		)
-		clearRentData(ctx.EffectiveChat.Id)
-		if err != nil {
+	rentData := getRentData(ctx.EffectiveChat.Id)
+	if rentData == nil {
+		_, _ = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "This rent was already saved or cancelled"})
+		return tgBotHandler.EndConversation()
+	}
+	if _, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{}); err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	action := strings.TrimPrefix(cb.Data, enum.RentReviewPrefix)
+	// The rent payer must be a member, as the Balances formulas credit them
+	if action == RentReviewSaveAction && rentData.Payer == "" {
+		action = RentReviewPayerAction
+	}
+	switch action {
+	case RentReviewSaveAction:
+		if _, _, err := cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{}); err != nil {
+			logUserAction(ctx, "rent_review_save", fmt.Sprintf("failed to remove buttons: %s", err.Error()))
+		}
+		return saveRent(bot, ctx, rentData)
+	case RentReviewPayerAction:
+		if err := showRentPayerMenu(bot, ctx, rentData, true); err != nil {
 			return err
 		}
-		return tgBotHandler.EndConversation()
+		return tgBotHandler.NextConversationState(enum.RentStatePayer)
+	case RentReviewSplitAction:
+		if err := showRentPolicyMenu(bot, ctx, rentData, true); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.RentStatePolicy)
 	}
 
-	// Save to Google Sheets
-	err := handlers.SaveRentData(rentData)
+	var message, state string
+	switch action {
+	case RentReviewTotalAction:
+		message = fmt.Sprintf("Enter the new \U0001F4B0 *total rent bill* amount (now %s):", utilities.FormatMoney(int(rentData.TotalBill)))
+		state = enum.RentStateTotal
+	case RentReviewElectricAction:
+		rentData.ElectricUsage = getRentMeterUsage(ctx, models.MeterElectric)
+		message = fmt.Sprintf("Enter the new \u26a1 *electric* bill amount (now %s):%s", utilities.FormatMoney(int(rentData.Electric)), formatRentMeterPrompt(ctx, rentData.ElectricUsage))
+		state = enum.RentStateElectric
+	case RentReviewWaterAction:
+		rentData.WaterUsage = getRentMeterUsage(ctx, models.MeterWater)
+		message = fmt.Sprintf("Enter the new \U0001F4A7 *water* bill amount (now %s):%s", utilities.FormatMoney(int(rentData.Water)), formatRentMeterPrompt(ctx, rentData.WaterUsage))
+		state = enum.RentStateWater
+	default:
+		return fmt.Errorf("invalid callback data: %s", cb.Data)
+	}
+	setRentData(ctx.EffectiveChat.Id, rentData)
+
+	if _, _, err := cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{}); err != nil {
+		logUserAction(ctx, "rent_review_edit", fmt.Sprintf("failed to remove buttons: %s", err.Error()))
+	}
+	_, err := ctx.EffectiveMessage.Reply(bot, message, &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 	if err != nil {
-		_, err := ctx.EffectiveMessage.Reply(
-			bot,
-			fmt.Sprintf("*Failed to Save Rent*\n\n%s", err.Error()),
-			&gotgbot.SendMessageOpts{ParseMode: "markdown"},
-		)
-		clearRentData(ctx.EffectiveChat.Id)
-		if err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(state)
+}
+
+// getRentMeterUsage returns this month's usage of a meter, or nil when the readings are missing
+func getRentMeterUsage(ctx *ext.Context, meter string) *models.MeterUsage {
+	usage, err := handlers.GetMeterUsage(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), meter)
+	if err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Infof("no %s meter usage for rent: %s", meter, err.Error())
+		return nil
+	}
+	return usage
+}
+
+// formatRentMeterPrompt offers the amount computed from the meter readings
+func formatRentMeterPrompt(ctx *ext.Context, usage *models.MeterUsage) string {
+	if usage == nil {
+		return ""
+	}
+	return fmt.Sprintf("\n\nFrom /meter: %sSend `ok` to use it.", handlers.FormatMeterUsage(usage, getCurrentMembers(ctx)))
+}
+
+// parseRentMeterInput returns the amount entered, or the meter amount when the user accepted it with "ok"
+func parseRentMeterInput(input string, usage *models.MeterUsage) (string, bool) {
+	if usage != nil && strings.EqualFold(strings.TrimSpace(input), "ok") {
+		return cast.ToString(usage.Amount), true
+	}
+	return utilities.ParseAmount(input), false
+}
+
+// saveRent writes the rent to Google Sheets, stores the split policy for the next months and sends the summary
+func saveRent(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData) error {
+	err := handlers.SaveRentData(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), rentData)
+	if err != nil {
+		header := fmt.Sprintf("*Failed to Save Rent*\n\n%s\n\nChange the rent or /cancel.", err.Error())
+		if err := showRentReview(bot, ctx, rentData, header, false); err != nil {
 			return err
 		}
-		return tgBotHandler.EndConversation()
+		return tgBotHandler.NextConversationState(enum.RentStateReview)
+	}
+
+	if err := handlers.SaveRentSplitPolicy(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), rentData.SplitPolicy.ForNextMonths()); err != nil {
+		// The rent is saved, only the policy for the next months is lost
+		logrus.WithContext(handlers.ContextOf(ctx)).Warnf("failed to save rent split policy: %s", err.Error())
 	}
 
 	// Send success message with summary
@@ -231,5 +502,3 @@ func HandleRentWaterInput(bot *gotgbot.Bot, ctx *ext.Context) error {
 	}
 	return tgBotHandler.EndConversation()
 }
-
-// HandleRentPayerInput is deprecated - payer is now auto-filled in HandleRentWaterInput
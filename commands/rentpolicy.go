@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	tgBotHandler "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/utilities"
+)
+
+// Rent split components as used in the callback data
+const (
+	RentComponentElectric = "electric"
+	RentComponentWater    = "water"
+	RentComponentOther    = "other"
+
+	RentPolicyDoneAction = "done"
+	RentPolicyEditAction = "edit"
+	RentPolicySetAction  = "set"
+)
+
+// rentPolicyEdit is a component whose policy needs per-member values before it is applied
+type rentPolicyEdit struct {
+	Component string
+	Policy    models.SplitPolicy
+}
+
+// rentComponent returns the split and the amount of a rent component
+func rentComponent(rentData *models.RentData, component string) (*models.ComponentSplit, int64, string) {
+	switch component {
+	case RentComponentElectric:
+		return &rentData.SplitPolicy.Electric, rentData.Electric, "Electric"
+	case RentComponentWater:
+		return &rentData.SplitPolicy.Water, rentData.Water, "Water"
+	case RentComponentOther:
+		return &rentData.SplitPolicy.OtherFees, rentData.OtherFees, "Other fees"
+	}
+	return nil, 0, ""
+}
+
+// showRentPolicyMenu shows the split of each component with buttons to change it or go back to the review
+func showRentPolicyMenu(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, edit bool) error {
+	members := getCurrentMembers(ctx)
+
+	var sb strings.Builder
+	sb.WriteString("\u2696 *Rent Split*\n\n")
+	sb.WriteString(fmt.Sprintf("\u26a1 Electric: %s - *%s*\n", utilities.FormatMoney(int(rentData.Electric)), handlers.FormatComponentSplit(rentData.SplitPolicy.Electric, members)))
+	sb.WriteString(fmt.Sprintf("\U0001F4A7 Water: %s - *%s*\n", utilities.FormatMoney(int(rentData.Water)), handlers.FormatComponentSplit(rentData.SplitPolicy.Water, members)))
+	sb.WriteString(fmt.Sprintf("\U0001F4C4 Other fees: %s - *%s*\n\n", utilities.FormatMoney(int(rentData.OtherFees)), handlers.FormatComponentSplit(rentData.SplitPolicy.OtherFees, members)))
+	sb.WriteString("Tap a component to change how it is split, then go back to the review. The split is kept for the next months.")
+
+	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{Text: "Back to review", CallbackData: enum.RentPolicyPrefix + RentPolicyDoneAction},
+			},
+			{
+				{Text: "Electric", CallbackData: enum.RentPolicyPrefix + RentPolicyEditAction + "." + RentComponentElectric},
+				{Text: "Water", CallbackData: enum.RentPolicyPrefix + RentPolicyEditAction + "." + RentComponentWater},
+				{Text: "Other fees", CallbackData: enum.RentPolicyPrefix + RentPolicyEditAction + "." + RentComponentOther},
+			},
+		},
+	}
+
+	if edit {
+		_, _, err := ctx.Update.CallbackQuery.Message.EditText(bot, sb.String(), &gotgbot.EditMessageTextOpts{
+			ParseMode:   "markdown",
+			ReplyMarkup: inlineKeyboard,
+		})
+		return err
+	}
+	_, err := ctx.EffectiveMessage.Reply(bot, sb.String(), &gotgbot.SendMessageOpts{
+		ParseMode:   "markdown",
+		ReplyMarkup: inlineKeyboard,
+	})
+	return err
+}
+
+// HandleRentPolicyCallback handles the rent.policy.* buttons of the /rent flow
+func HandleRentPolicyCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	logUserAction(ctx, "rent_policy_callback", fmt.Sprintf("callback: %s", cb.Data))
+
+	rentData := getRentData(ctx.EffectiveChat.Id)
+	if rentData == nil {
+		_, _ = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "This rent was already saved or cancelled"})
+		return tgBotHandler.EndConversation()
+	}
+	if _, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{}); err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	// rent.policy.done, rent.policy.edit.[component], rent.policy.set.[component].[policy]
+	elements := strings.Split(strings.TrimPrefix(cb.Data, enum.RentPolicyPrefix), ".")
+	switch elements[0] {
+	case RentPolicyDoneAction:
+		if err := showRentReview(bot, ctx, rentData, "", true); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.RentStateReview)
+	case RentPolicyEditAction:
+		if len(elements) < 2 {
+			return fmt.Errorf("invalid callback data: %s", cb.Data)
+		}
+		if err := showRentComponentPolicies(bot, ctx, rentData, elements[1]); err != nil {
+			return err
+		}
+	case RentPolicySetAction:
+		if len(elements) < 3 {
+			return fmt.Errorf("invalid callback data: %s", cb.Data)
+		}
+		return setRentComponentPolicy(bot, ctx, rentData, elements[1], models.SplitPolicy(elements[2]))
+	}
+	return tgBotHandler.NextConversationState(enum.RentStatePolicy)
+}
+
+// showRentComponentPolicies lets the user pick the policy of a component
+func showRentComponentPolicies(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, component string) error {
+	split, amount, label := rentComponent(rentData, component)
+	if split == nil {
+		return fmt.Errorf("unknown rent component: %s", component)
+	}
+
+	keyboard := make([][]gotgbot.InlineKeyboardButton, 0, len(models.SplitPolicies))
+	for _, policy := range models.SplitPolicies {
+		text := string(policy)
+		if policy == split.Policy {
+			text = "[" + text + "]"
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: text, CallbackData: fmt.Sprintf("%s%s.%s.%s", enum.RentPolicyPrefix, RentPolicySetAction, component, policy)},
+		})
+	}
+
+	message := fmt.Sprintf("*%s Split*\n\nAmount: %s\n\n"+
+		"- *equal*: same share for everyone\n"+
+		"- *weighted*: by member weight\n"+
+		"- *fixed*: fixed amounts, the rest is split equally\n"+
+		"- *percentage*: percentages adding up to 100\n"+
+		"- *room*: by room size in m²\n"+
+		"- *metered*: by consumption per member (filled from /meter sub-meters)",
+		label, utilities.FormatMoney(int(amount)))
+	_, _, err := ctx.Update.CallbackQuery.Message.EditText(bot, message, &gotgbot.EditMessageTextOpts{
+		ParseMode:   "markdown",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+	return err
+}
+
+// setRentComponentPolicy applies a policy without values, or asks for the per-member values
+func setRentComponentPolicy(bot *gotgbot.Bot, ctx *ext.Context, rentData *models.RentData, component string, policy models.SplitPolicy) error {
+	split, _, label := rentComponent(rentData, component)
+	if split == nil {
+		return fmt.Errorf("unknown rent component: %s", component)
+	}
+
+	if !policy.NeedsValues() {
+		*split = models.ComponentSplit{Policy: policy}
+		setRentData(ctx.EffectiveChat.Id, rentData)
+		if err := showRentPolicyMenu(bot, ctx, rentData, true); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.RentStatePolicy)
+	}
+
+	// The policy waits for its values in the rent drafts
+	putDraft(rentDraftOwner(ctx.EffectiveChat.Id), rentDraftPolicyEdit, rentPolicyEdit{Component: component, Policy: policy})
+
+	var example strings.Builder
+	examples := map[models.SplitPolicy][]string{
+		models.SplitFixed:      {"300k", "200k"},
+		models.SplitPercentage: {"60", "40"},
+		models.SplitRoomSize:   {"18", "12.5"},
+		models.SplitMetered:    {"120", "85"},
+	}[policy]
+	for i, m := range getCurrentMembers(ctx) {
+		if i >= len(examples) {
+			break
+		}
+		example.WriteString(fmt.Sprintf("%s %s\n", m.Username, examples[i]))
+	}
+
+	hint := map[models.SplitPolicy]string{
+		models.SplitFixed:      "Send the fixed amount per member. Members not listed split the rest equally.",
+		models.SplitPercentage: "Send the percentage per member. All members must be listed and add up to 100.",
+		models.SplitRoomSize:   "Send the room size in m² per member. All members must be listed.",
+		models.SplitMetered:    "Send the consumption per member. All members must be listed.",
+	}[policy]
+
+	_, err := ctx.EffectiveMessage.Reply(
+		bot,
+		fmt.Sprintf("*%s: %s*\n\n%s One member per line:\n---\n%s", label, policy, hint, example.String()),
+		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+	)
+	if err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.RentStatePolicyValues)
+}
+
+// HandleRentPolicyValuesInput applies the per-member values of the policy being edited
+func HandleRentPolicyValuesInput(bot *gotgbot.Bot, ctx *ext.Context) error {
+	rentData := getRentData(ctx.EffectiveChat.Id)
+	var pending rentPolicyEdit
+	ok := getDraft(enum.FlowRent, ctx.EffectiveChat.Id, rentDraftPolicyEdit, &pending)
+	if rentData == nil || !ok {
+		clearRentData(ctx.EffectiveChat.Id)
+		return StartRentConversation(bot, ctx)
+	}
+
+	members := getCurrentMembers(ctx)
+	values, err := handlers.ParseComponentSplitValues(ctx.EffectiveMessage.Text, members)
+	split, amount, _ := rentComponent(rentData, pending.Component)
+	candidate := models.ComponentSplit{Policy: pending.Policy, Values: values}
+	if err == nil {
+		// Check the values against this month's amount before accepting them
+		_, err = candidate.Split(amount, members)
+	}
+	if err != nil {
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Invalid Split*\n\n%s\n\nPlease send the values again:", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.RentStatePolicyValues)
+	}
+
+	*split = candidate
+	setRentData(ctx.EffectiveChat.Id, rentData)
+	deleteDrafts(enum.FlowRent, ctx.EffectiveChat.Id, rentDraftPolicyEdit)
+
+	if err := showRentPolicyMenu(bot, ctx, rentData, false); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.RentStatePolicy)
+}
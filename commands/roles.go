@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+)
+
+const (
+	RolesSetArg = "set"
+
+	rolesUsage = "*Roles*\n\n" +
+		"`/roles` - list the roles of this chat\n" +
+		"`/roles set @username admin|member|viewer|owner` - change the role of a linked member\n" +
+		"`/roles set admin|member|viewer|owner` - reply to a message to change the role of its sender\n\n" +
+		"Users without a role are members. Admins change member and viewer roles; owners change any role."
+)
+
+// Roles handles the /roles command.
+func Roles(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "roles", "command called")
+
+	args := ctx.Args()[1:]
+	if len(args) == 0 {
+		return showRoles(bot, ctx)
+	}
+	if !strings.EqualFold(args[0], RolesSetArg) {
+		return replyMarkdown(bot, ctx, rolesUsage)
+	}
+
+	var userId int64
+	var name, roleName string
+	members := getCurrentMembers(ctx)
+	switch reply := ctx.EffectiveMessage.ReplyToMessage; {
+	case len(args) == 2 && reply != nil && reply.From != nil:
+		userId, roleName = reply.From.Id, args[1]
+		name = models.DisplayRef(members, models.UserRef(userId))
+		if name == models.UserRef(userId) {
+			name = reply.From.FirstName
+		}
+	case len(args) == 3:
+		member := models.FindMemberByRef(members, normalizeUsername(args[1]))
+		if member == nil {
+			return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s is not a member.", normalizeUsername(args[1])))
+		}
+		if member.UserID == 0 {
+			return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s is not linked yet. Link them with `/members link %s` or reply to their message.", member.Username, member.Username))
+		}
+		userId, name, roleName = member.UserID, member.Username, args[2]
+	default:
+		return replyMarkdown(bot, ctx, rolesUsage)
+	}
+
+	target, err := models.ParseRole(roleName)
+	if err != nil {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s", err.Error()))
+	}
+	if userId == ctx.EffectiveUser.Id {
+		return replyMarkdown(bot, ctx, "*Failed*\n\nYou cannot change your own role.")
+	}
+
+	current := models.RoleMember
+	if isAdmin(userId) {
+		current = models.RoleOwner
+	} else if assigned, found, err := handlers.GetRole(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), userId); err != nil {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s", err.Error()))
+	} else if found {
+		current = assigned
+	}
+
+	role := roleOf(ctx)
+	if !role.CanAssign(current, target) {
+		logPermissionDenied(ctx, actionManageRoles, role)
+		return replyMarkdown(bot, ctx, fmt.Sprintf(
+			"*Access Denied*\n\nYour role (%s) cannot change %s from %s to %s. Only owners grant or revoke the admin and owner roles.",
+			role, name, current, target,
+		))
+	}
+
+	err = handlers.SetRole(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), models.RoleAssignment{
+		ChatID:    ctx.EffectiveChat.Id,
+		UserID:    userId,
+		Role:      target,
+		UpdatedBy: getActorUsername(ctx),
+	})
+	if err != nil {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s", err.Error()))
+	}
+
+	logUserAction(ctx, "roles_set", fmt.Sprintf("user_id=%d role=%s previous=%s", userId, target, current))
+	return replyMarkdown(bot, ctx, fmt.Sprintf("*Role Updated*\n\n%s is now %s in this chat.", name, target))
+}
+
+func showRoles(bot *gotgbot.Bot, ctx *ext.Context) error {
+	roles, err := handlers.GetChatRoles(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return replyMarkdown(bot, ctx, fmt.Sprintf("*Failed*\n\n%s", err.Error()))
+	}
+	members := getCurrentMembers(ctx)
+
+	var sb strings.Builder
+	sb.WriteString("*Roles*\n\n")
+	for _, assignment := range roles {
+		sb.WriteString(fmt.Sprintf("- %s: *%s* (by %s, %s)\n",
+			models.DisplayRef(members, models.UserRef(assignment.UserID)), assignment.Role, assignment.UpdatedBy, assignment.UpdatedAt))
+	}
+	if len(roles) == 0 {
+		sb.WriteString("_No roles assigned yet._\n")
+	}
+	sb.WriteString(fmt.Sprintf("\nEveryone else is a *%s*; the bot admins are *%s* in every chat. Your role: *%s*.\n\nSend `/roles help` to see how to change roles.",
+		models.RoleMember, models.RoleOwner, roleOf(ctx)))
+	return replyMarkdown(bot, ctx, sb.String())
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/handlers"
 )
 
 // Settings action constants
@@ -17,32 +19,40 @@ const (
 	SettingsBack              = "back"
 )
 
-// ReminderState manages the runtime state of housework reminders
+// ReminderState manages the runtime state of housework reminders, which are on unless a chat turned them off
 var (
-	reminderEnabled = true
-	reminderMutex   sync.RWMutex
+	reminderDisabled = make(map[int64]bool)
+	reminderMutex    sync.RWMutex
 )
 
-// IsReminderEnabled returns whether housework reminders are enabled
-func IsReminderEnabled() bool {
+// IsReminderEnabled returns whether housework reminders are enabled in a chat
+func IsReminderEnabled(chatId int64) bool {
 	reminderMutex.RLock()
 	defer reminderMutex.RUnlock()
-	return reminderEnabled
+	return !reminderDisabled[chatId]
 }
 
-// SetReminderEnabled sets the reminder state
-func SetReminderEnabled(enabled bool) {
+// SetReminderEnabled sets the reminder state of a chat
+func SetReminderEnabled(chatId int64, enabled bool) {
 	reminderMutex.Lock()
 	defer reminderMutex.Unlock()
-	reminderEnabled = enabled
+	if enabled {
+		delete(reminderDisabled, chatId)
+	} else {
+		reminderDisabled[chatId] = true
+	}
 }
 
-// ToggleReminder toggles the reminder state and returns the new state
-func ToggleReminder() bool {
+// ToggleReminder toggles the reminder state of a chat and returns the new state
+func ToggleReminder(chatId int64) bool {
 	reminderMutex.Lock()
 	defer reminderMutex.Unlock()
-	reminderEnabled = !reminderEnabled
-	return reminderEnabled
+	if reminderDisabled[chatId] {
+		delete(reminderDisabled, chatId)
+		return true
+	}
+	reminderDisabled[chatId] = true
+	return false
 }
 
 func Settings(bot *gotgbot.Bot, ctx *ext.Context) error {
@@ -55,7 +65,7 @@ func showSettingsMainMenu(bot *gotgbot.Bot, ctx *ext.Context, edit bool) error {
 
 	// Show status indicators in the menu
 	reminderStatus := "ON"
-	if !IsReminderEnabled() {
+	if !IsReminderEnabled(ctx.EffectiveChat.Id) {
 		reminderStatus = "OFF"
 	}
 
@@ -120,7 +130,7 @@ func showHouseworkReminderMenu(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	reminderStatus := "ON"
 	buttonText := "Turn OFF"
-	if !IsReminderEnabled() {
+	if !IsReminderEnabled(ctx.EffectiveChat.Id) {
 		reminderStatus = "OFF"
 		buttonText = "Turn ON"
 	}
@@ -149,7 +159,7 @@ func handleReminderToggle(bot *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.Update.CallbackQuery
 
 	// Toggle the state
-	newState := ToggleReminder()
+	newState := ToggleReminder(ctx.EffectiveChat.Id)
 
 	stateText := "OFF"
 	buttonText := "Turn ON"
@@ -158,9 +168,10 @@ func handleReminderToggle(bot *gotgbot.Bot, ctx *ext.Context) error {
 		buttonText = "Turn OFF"
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(handlers.ContextOf(ctx)).WithFields(logrus.Fields{
 		"user_id":   ctx.EffectiveUser.Id,
 		"username":  ctx.EffectiveUser.Username,
+		"chat_id":   ctx.EffectiveChat.Id,
 		"new_state": stateText,
 	}).Info("housework reminders toggled")
 
@@ -182,7 +193,7 @@ func handleReminderToggle(bot *gotgbot.Bot, ctx *ext.Context) error {
 		ReplyMarkup: inlineKeyboard,
 	})
 	if err != nil {
-		logrus.Errorf("failed to edit settings message: %s", err.Error())
+		logrus.WithContext(handlers.ContextOf(ctx)).Errorf("failed to edit settings message: %s", err.Error())
 	}
 
 	return nil
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	tgBotHandler "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/sirupsen/logrus"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/services/state"
+	"housematee-tgbot/utilities"
+)
+
+// setupDraftSpreadsheet is the draft holding the spreadsheet ID checked by the first step of /setup
+const setupDraftSpreadsheet = "spreadsheet"
+
+// SetupSkipArg keeps the default timezone when linking a chat
+const SetupSkipArg = "skip"
+
+// StartSetupConversation starts linking the chat to a spreadsheet, replacing the one it has
+func StartSetupConversation(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "setup_start", "starting setup flow")
+
+	current := ""
+	if h, ok := handlers.GetHousehold(ctx.EffectiveChat.Id); ok && h.IsLinked() {
+		current = fmt.Sprintf("This chat uses the spreadsheet <code>%s</code>, it is replaced when you finish.\n\n", escapeHTML(h.SpreadsheetID))
+	}
+	text := fmt.Sprintf(
+		"<b>Setup</b>\n\n%sShare the spreadsheet with <code>%s</code> as an editor, then send its link or ID.\n\nSend /cancel to stop.",
+		current, escapeHTML(serviceAccountEmail()),
+	)
+	if err := replyHTML(bot, ctx, text); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.SetupStateSpreadsheet)
+}
+
+// HandleSetupSpreadsheetInput checks that the service account can read the spreadsheet and that it has the sheets the bot needs
+func HandleSetupSpreadsheetInput(bot *gotgbot.Bot, ctx *ext.Context) error {
+	spreadsheetId, ok := utilities.ParseSpreadsheetID(ctx.EffectiveMessage.Text)
+	if !ok {
+		if err := replyHTML(bot, ctx, "<b>Invalid Spreadsheet</b>\n\nSend the link of the spreadsheet, e.g., <code>https://docs.google.com/spreadsheets/d/.../edit</code>, or its ID."); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.SetupStateSpreadsheet)
+	}
+
+	checks, err := handlers.RunDiagnostics(handlers.ContextOf(ctx), models.Household{ChatID: ctx.EffectiveChat.Id, SpreadsheetID: spreadsheetId})
+	if err != nil {
+		logUserAction(ctx, "setup_spreadsheet", fmt.Sprintf("spreadsheet %s not accessible: %s", spreadsheetId, err.Error()))
+		text := fmt.Sprintf(
+			"<b>Spreadsheet Not Accessible</b>\n\nThe bot cannot open <code>%s</code>. Share it with <code>%s</code> as an editor and send the link again.\n\n<b>Error:</b> %s",
+			escapeHTML(spreadsheetId), escapeHTML(serviceAccountEmail()), escapeHTML(err.Error()),
+		)
+		if err := replyHTML(bot, ctx, text); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.SetupStateSpreadsheet)
+	}
+
+	var failed []string
+	for _, check := range checks {
+		if check.Result != handlers.DiagnosticFailed {
+			continue
+		}
+		line := escapeHTML(check.Name)
+		if check.Detail != "" {
+			line += ": " + escapeHTML(check.Detail)
+		}
+		failed = append(failed, "- "+line)
+	}
+	if len(failed) > 0 {
+		logUserAction(ctx, "setup_spreadsheet", fmt.Sprintf("spreadsheet %s failed %d checks", spreadsheetId, len(failed)))
+		text := fmt.Sprintf(
+			"<b>Spreadsheet Not Ready</b>\n\n%s\n\nCopy the template spreadsheet, fix these and send the link again.",
+			strings.Join(failed, "\n"),
+		)
+		if err := replyHTML(bot, ctx, text); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.SetupStateSpreadsheet)
+	}
+
+	putDraft(
+		state.Owner{Flow: enum.FlowSetup, ChatID: ctx.EffectiveChat.Id, UserID: ctx.EffectiveUser.Id},
+		setupDraftSpreadsheet, spreadsheetId,
+	)
+	text := fmt.Sprintf(
+		"<b>Spreadsheet OK</b>\n\nNow send the timezone of the house, e.g., <code>Europe/Berlin</code>, or <code>%s</code> to use %s.",
+		SetupSkipArg, escapeHTML(config.GetAppConfig().Settings.Timezone),
+	)
+	if err := replyHTML(bot, ctx, text); err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.SetupStateTimezone)
+}
+
+// HandleSetupTimezoneInput links the chat to the checked spreadsheet with the timezone sent
+func HandleSetupTimezoneInput(bot *gotgbot.Bot, ctx *ext.Context) error {
+	var spreadsheetId string
+	if !getDraft(enum.FlowSetup, ctx.EffectiveChat.Id, setupDraftSpreadsheet, &spreadsheetId) {
+		// The draft expired or could not be read, start again
+		return StartSetupConversation(bot, ctx)
+	}
+
+	timezone := strings.TrimSpace(ctx.EffectiveMessage.Text)
+	if strings.EqualFold(timezone, SetupSkipArg) {
+		timezone = ""
+	} else if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		text := fmt.Sprintf("<b>Invalid Timezone</b>\n\n<code>%s</code> is not a timezone. Send a name like <code>Asia/Ho_Chi_Minh</code>, or <code>%s</code>.",
+			escapeHTML(timezone), SetupSkipArg)
+		if err := replyHTML(bot, ctx, text); err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.SetupStateTimezone)
+	}
+
+	household := models.Household{
+		ChatID:        ctx.EffectiveChat.Id,
+		Name:          ctx.EffectiveChat.Title,
+		SpreadsheetID: spreadsheetId,
+		Timezone:      timezone,
+		LinkedBy:      getActorUsername(ctx),
+	}
+	household.LinkedAt = utilities.GetCurrentTimestamp(household.Location())
+	if err := handlers.LinkHousehold(household); err != nil {
+		logrus.WithContext(handlers.ContextOf(ctx)).Errorf("failed to link chat %d: %s", household.ChatID, err.Error())
+		if err := replyHTML(bot, ctx, fmt.Sprintf("<b>Failed</b>\n\n%s", escapeHTML(err.Error()))); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+	deleteDrafts(enum.FlowSetup, ctx.EffectiveChat.Id, setupDraftSpreadsheet)
+
+	logUserAction(ctx, "setup_linked", fmt.Sprintf("spreadsheet=%s timezone=%s", spreadsheetId, household.Location()))
+	text := fmt.Sprintf(
+		"<b>Chat Linked</b>\n\nThis chat now uses the spreadsheet <code>%s</code> in the %s timezone. Add the housemates with /members.",
+		escapeHTML(spreadsheetId), escapeHTML(household.Location().String()),
+	)
+	if err := replyHTML(bot, ctx, text); err != nil {
+		return err
+	}
+	return tgBotHandler.EndConversation()
+}
+
+// serviceAccountEmail is the account the spreadsheets are shared with
+func serviceAccountEmail() string {
+	return config.GetAppConfig().GoogleApis.Credentials.ClientEmail
+}
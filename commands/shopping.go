@@ -0,0 +1,317 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	tgBotHandler "github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/spf13/cast"
+
+	"housematee-tgbot/enum"
+	"housematee-tgbot/handlers"
+	"housematee-tgbot/models"
+	"housematee-tgbot/utilities"
+)
+
+const (
+	ShopListCommand     = "shop.list"
+	ShopAddCommand      = "shop.add"
+	ShopCheckoutCommand = "shop.checkout"
+
+	ShopCheckAction  = "check"
+	ShopRemoveAction = "remove"
+)
+
+// Shop handles the /shop command.
+func Shop(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "shop", "command called")
+	return showShoppingList(bot, ctx, "Shopping List")
+}
+
+// HandleShopActionCallback handles the shop.* callback queries that are not conversation entry points
+func HandleShopActionCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	logUserAction(ctx, "shop_callback", fmt.Sprintf("callback: %s", cb.Data))
+
+	var err error
+	switch cb.Data {
+	case ShopListCommand:
+		err = showShoppingList(bot, ctx, "Shopping List")
+	default:
+		// [object].[id].[action]
+		// example: shop.1.check, shop.2.remove
+		commandElements := strings.Split(cb.Data, ".")
+		if len(commandElements) < 3 {
+			return fmt.Errorf("invalid callback data: %s", cb.Data)
+		}
+		itemId := cast.ToInt(commandElements[1])
+		switch commandElements[2] {
+		case ShopCheckAction:
+			err = handleShopToggleCheckAction(bot, ctx, itemId)
+		case ShopRemoveAction:
+			err = handleShopRemoveAction(bot, ctx, itemId)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+	return nil
+}
+
+func showShoppingList(bot *gotgbot.Bot, ctx *ext.Context, title string) error {
+	items, err := handlers.GetShoppingList(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*%s*\n\n", title))
+	if len(items) == 0 {
+		sb.WriteString("_The list is empty._ Use *Add* to add items.")
+	} else {
+		sb.WriteString("Tap an item to check it off. Checked items are bought at *Checkout*.")
+	}
+
+	keyboard := make([][]gotgbot.InlineKeyboardButton, 0, len(items)+1)
+	for _, item := range items {
+		mark := "[ ]"
+		if item.Checked {
+			mark = "[x]"
+		}
+		text := fmt.Sprintf("%s %s", mark, item.Name)
+		if item.EstimatedPrice > 0 {
+			text += fmt.Sprintf(" (~%s)", utilities.FormatMoney(int(item.EstimatedPrice)))
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: text, CallbackData: fmt.Sprintf("shop.%d.check", item.ID)},
+			{Text: "Remove", CallbackData: fmt.Sprintf("shop.%d.remove", item.ID)},
+		})
+	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+		{Text: "Add", CallbackData: ShopAddCommand},
+		{Text: "Checkout", CallbackData: ShopCheckoutCommand},
+	})
+
+	_, err = ctx.EffectiveMessage.Reply(bot, sb.String(), &gotgbot.SendMessageOpts{
+		ParseMode:   "markdown",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send /shop response: %w", err)
+	}
+	return nil
+}
+
+func findShoppingItem(ctx *ext.Context, itemId int) (*models.ShoppingItem, error) {
+	items, err := handlers.GetShoppingList(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.ID == itemId {
+			return &item, nil
+		}
+	}
+	return nil, fmt.Errorf("shopping item with id %d not found", itemId)
+}
+
+func handleShopToggleCheckAction(bot *gotgbot.Bot, ctx *ext.Context, itemId int) error {
+	item, err := findShoppingItem(ctx, itemId)
+	if err != nil {
+		return err
+	}
+
+	item.Checked = !item.Checked
+	logUserAction(ctx, "shop_check", fmt.Sprintf("item_id=%d checked=%t", item.ID, item.Checked))
+	if err := handlers.UpdateShoppingItem(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), *item); err != nil {
+		return err
+	}
+
+	// Refresh the list in place
+	return editShoppingList(bot, ctx)
+}
+
+func handleShopRemoveAction(bot *gotgbot.Bot, ctx *ext.Context, itemId int) error {
+	item, err := findShoppingItem(ctx, itemId)
+	if err != nil {
+		return err
+	}
+
+	logUserAction(ctx, "shop_remove", fmt.Sprintf("item_id=%d name=%s", item.ID, item.Name))
+	if err := handlers.RemoveShoppingItems(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), []int{item.ID}); err != nil {
+		return err
+	}
+
+	return editShoppingList(bot, ctx)
+}
+
+// editShoppingList deletes the old list message and sends a fresh one
+func editShoppingList(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if _, err := ctx.Update.CallbackQuery.Message.Delete(bot, nil); err != nil {
+		logUserAction(ctx, "shop_refresh", fmt.Sprintf("failed to delete old list: %s", err.Error()))
+	}
+	return showShoppingList(bot, ctx, "Shopping List")
+}
+
+// StartAddShoppingItem prompts the user for the items to add
+func StartAddShoppingItem(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "shop_add", "starting add item flow")
+	if ctx.CallbackQuery != nil {
+		_, _ = ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{})
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(
+		bot,
+		"*Add to Shopping List*\n\nSend one item per line, optionally with an estimated price:\n---\nrice 150k\neggs 40k\ndish soap",
+		&gotgbot.SendMessageOpts{ParseMode: "markdown"},
+	)
+	if err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.ShopStateAddItem)
+}
+
+// HandleShopAddItemInput adds the items sent by the user
+func HandleShopAddItemInput(bot *gotgbot.Bot, ctx *ext.Context) error {
+	items := handlers.ParseShoppingItems(ctx.EffectiveMessage.Text, getActorUsername(ctx))
+	if len(items) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Invalid Input*\n\nPlease send at least one item.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.ShopStateAddItem)
+	}
+
+	if _, err := handlers.AddShoppingItems(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), items); err != nil {
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Failed to Add Items*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+	logUserAction(ctx, "shop_add_items", fmt.Sprintf("added %d items", len(items)))
+
+	if err := showShoppingList(bot, ctx, fmt.Sprintf("Added %d item(s)", len(items))); err != nil {
+		return err
+	}
+	return tgBotHandler.EndConversation()
+}
+
+// StartShopCheckout asks the shopper for the total of the checked items
+func StartShopCheckout(bot *gotgbot.Bot, ctx *ext.Context) error {
+	logUserAction(ctx, "shop_checkout", "starting checkout flow")
+	if ctx.CallbackQuery != nil {
+		_, _ = ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{})
+	}
+
+	checked, err := getCheckedShoppingItems(ctx)
+	if err != nil {
+		return err
+	}
+	if len(checked) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Nothing to Checkout*\n\nCheck off the items you bought first.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	var estimated int64
+	names := make([]string, 0, len(checked))
+	for _, item := range checked {
+		estimated += item.EstimatedPrice
+		names = append(names, "- "+item.Name)
+	}
+
+	message := fmt.Sprintf("*Checkout*\n\n%s\n\n", strings.Join(names, "\n"))
+	if estimated > 0 {
+		message += fmt.Sprintf("Estimated: %s\n\n", utilities.FormatMoney(int(estimated)))
+	}
+	message += "Please enter the \U0001F4B0 *total* you paid:"
+
+	_, err = ctx.EffectiveMessage.Reply(bot, message, &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+	if err != nil {
+		return err
+	}
+	return tgBotHandler.NextConversationState(enum.ShopStateCheckout)
+}
+
+// HandleShopCheckoutInput creates the expense for the checked items
+func HandleShopCheckoutInput(bot *gotgbot.Bot, ctx *ext.Context) error {
+	amount := utilities.ParseAmount(strings.TrimSpace(ctx.EffectiveMessage.Text))
+	if amount == "" || !utilities.IsNumeric(amount) || cast.ToInt64(amount) <= 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Invalid Amount*\n\nPlease enter a valid number for the total:", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.NextConversationState(enum.ShopStateCheckout)
+	}
+
+	// Re-read the list, someone may have changed it in the meantime
+	checked, err := getCheckedShoppingItems(ctx)
+	if err != nil {
+		return err
+	}
+	if len(checked) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "*Nothing to Checkout*\n\nThe checked items were already checked out.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	payer, err := getActorRef(ctx)
+	if err != nil {
+		if err := replyActorError(bot, ctx, err); err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+	newExpense, err := handlers.CheckoutShoppingList(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), checked, amount, payer)
+	if err != nil {
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Failed to Checkout*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		if err != nil {
+			return err
+		}
+		return tgBotHandler.EndConversation()
+	}
+
+	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{Text: "Update", CallbackData: fmt.Sprintf("splitbill.update.%d", newExpense.ID)},
+				{Text: "Delete", CallbackData: fmt.Sprintf("splitbill.delete.%d", newExpense.ID)},
+			},
+		},
+	}
+	_, err = ctx.EffectiveMessage.Reply(bot, "*Checked Out*\n\n"+formatExpenseMarkdown(*newExpense, getCurrentMembers(ctx)), &gotgbot.SendMessageOpts{
+		ParseMode:   "markdown",
+		ReplyMarkup: inlineKeyboard,
+	})
+	if err != nil {
+		return err
+	}
+	return tgBotHandler.EndConversation()
+}
+
+func getCheckedShoppingItems(ctx *ext.Context) ([]models.ShoppingItem, error) {
+	items, err := handlers.GetShoppingList(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	checked := make([]models.ShoppingItem, 0, len(items))
+	for _, item := range items {
+		if item.Checked {
+			checked = append(checked, item)
+		}
+	}
+	return checked, nil
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -13,14 +12,14 @@ import (
 	"housematee-tgbot/enum"
 	"housematee-tgbot/handlers"
 	"housematee-tgbot/models"
+	"housematee-tgbot/services/state"
 	"housematee-tgbot/utilities"
 )
 
-// pendingUpdateExpense stores the expense being updated (keyed by user ID)
-var (
-	pendingUpdateExpense = make(map[int64]*models.Expense)
-	pendingUpdateMutex   sync.RWMutex
-)
+// pendingUpdateExpenseDraft returns the name of the draft of the expense a user is updating
+func pendingUpdateExpenseDraft(userID int64) string {
+	return fmt.Sprintf("expense.%d", userID)
+}
 
 // SplitBill handles the /splitbill command.
 func SplitBill(bot *gotgbot.Bot, ctx *ext.Context) error {
@@ -133,7 +132,7 @@ func StartAddSplitBill(bot *gotgbot.Bot, ctx *ext.Context) error {
 [amount]
 [date] <i>(auto-filled: %s)</i>
 [payer] <i>(auto-filled: @%s)</i>
-`, utilities.GetCurrentDate(), ctx.EffectiveUser.Username,
+`, utilities.GetCurrentDate(handlers.HouseholdOf(ctx).Location()), ctx.EffectiveUser.Username,
 	)
 	_, err := ctx.EffectiveMessage.Reply(
 		bot, htlmText, &gotgbot.SendMessageOpts{
@@ -147,9 +146,6 @@ func StartAddSplitBill(bot *gotgbot.Bot, ctx *ext.Context) error {
 }
 
 func AddExpenseConversationHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-	if !CheckPermission(bot, ctx) {
-		return nil
-	}
 	return handlers.HandleExpenseAddAction(bot, ctx)
 }
 
@@ -159,7 +155,7 @@ func AddExpenseConversationHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 func HandleSplitBillUpdateAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "splitbill_update", "showing expense list for update")
 
-	expenses, err := handlers.GetRecentExpenses(5)
+	expenses, err := handlers.GetRecentExpenses(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), 5)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
@@ -208,16 +204,21 @@ func HandleSelectExpenseForUpdate(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	logUserAction(ctx, "splitbill_update_select", fmt.Sprintf("expense_id=%d", expenseId))
 
-	expense, err := handlers.GetExpenseById(expenseId)
+	expense, err := handlers.GetExpenseById(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), expenseId)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
 	}
+	if !canEditExpense(ctx, expense) {
+		return replyExpenseEditDenied(bot, ctx, expense)
+	}
 
 	// Store the expense being updated
-	pendingUpdateMutex.Lock()
-	pendingUpdateExpense[ctx.EffectiveUser.Id] = expense
-	pendingUpdateMutex.Unlock()
+	putDraft(
+		state.Owner{Flow: enum.FlowUpdateExpense, ChatID: ctx.EffectiveChat.Id, UserID: ctx.EffectiveUser.Id},
+		pendingUpdateExpenseDraft(ctx.EffectiveUser.Id),
+		expense,
+	)
 
 	// Show current values and prompt for new amount only
 	message := fmt.Sprintf(`*Update Expense #%d*
@@ -232,7 +233,7 @@ Enter new amount:`,
 		expense.Name,
 		expense.Amount,
 		expense.Date,
-		expense.Payer,
+		models.DisplayRef(getCurrentMembers(ctx), expense.Payer),
 	)
 
 	_, err = ctx.EffectiveMessage.Reply(bot, message, &gotgbot.SendMessageOpts{
@@ -247,16 +248,9 @@ Enter new amount:`,
 
 // UpdateExpenseConversationHandler processes user input and updates the expense
 func UpdateExpenseConversationHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-	if !CheckPermission(bot, ctx) {
-		return nil
-	}
-
 	// Get the pending expense (this is the old expense)
-	pendingUpdateMutex.RLock()
-	oldExpense, exists := pendingUpdateExpense[ctx.EffectiveUser.Id]
-	pendingUpdateMutex.RUnlock()
-
-	if !exists || oldExpense == nil {
+	oldExpense := &models.Expense{}
+	if !getDraft(enum.FlowUpdateExpense, ctx.EffectiveChat.Id, pendingUpdateExpenseDraft(ctx.EffectiveUser.Id), oldExpense) {
 		_, err := ctx.EffectiveMessage.Reply(bot, "*Error*\n\nNo expense selected for update. Please start again.", &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
 	}
@@ -279,22 +273,20 @@ func UpdateExpenseConversationHandler(bot *gotgbot.Bot, ctx *ext.Context) error
 	}
 
 	// Update in Google Sheets with audit logging
-	err := handlers.UpdateExpenseById(*oldExpense, newExpense, username)
+	err := handlers.UpdateExpenseById(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), *oldExpense, newExpense, username)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Failed to Update*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
 	}
 
 	// Clean up pending update
-	pendingUpdateMutex.Lock()
-	delete(pendingUpdateExpense, ctx.EffectiveUser.Id)
-	pendingUpdateMutex.Unlock()
+	deleteDrafts(enum.FlowUpdateExpense, ctx.EffectiveChat.Id, pendingUpdateExpenseDraft(ctx.EffectiveUser.Id))
 
 	// Format amount for display
 	newExpense.Amount = utilities.FormatMoney(cast.ToInt(newExpense.Amount))
 
 	// Reply with updated expense and action buttons
-	response := "*Expense Updated*\n\n" + formatExpenseMarkdown(newExpense)
+	response := "*Expense Updated*\n\n" + formatExpenseMarkdown(newExpense, getCurrentMembers(ctx))
 
 	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
 		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
@@ -316,14 +308,14 @@ func UpdateExpenseConversationHandler(bot *gotgbot.Bot, ctx *ext.Context) error
 	return tgBotHandler.EndConversation()
 }
 
-func formatExpenseMarkdown(expense models.Expense) string {
+func formatExpenseMarkdown(expense models.Expense, members []models.Member) string {
 	return fmt.Sprintf(
 		"*ID*: %d\n*Name*: %s\n*Amount*: %s\n*Date*: %s\n*Payer*: %s\n*Note*: _%s_",
 		expense.ID,
 		expense.Name,
 		expense.Amount,
 		expense.Date,
-		expense.Payer,
+		models.DisplayRef(members, expense.Payer),
 		expense.Note,
 	)
 }
@@ -334,7 +326,7 @@ func formatExpenseMarkdown(expense models.Expense) string {
 func HandleSplitBillDeleteAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "splitbill_delete", "showing expense list for delete")
 
-	expenses, err := handlers.GetRecentExpenses(5)
+	expenses, err := handlers.GetRecentExpenses(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), 5)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
@@ -383,11 +375,14 @@ func HandleSelectExpenseForDelete(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	logUserAction(ctx, "splitbill_delete_select", fmt.Sprintf("expense_id=%d", expenseId))
 
-	expense, err := handlers.GetExpenseById(expenseId)
+	expense, err := handlers.GetExpenseById(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), expenseId)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
 	}
+	if !canEditExpense(ctx, expense) {
+		return replyExpenseEditDenied(bot, ctx, expense)
+	}
 
 	// Show expense details with confirm/cancel buttons
 	message := fmt.Sprintf(`*Delete Expense #%d?*
@@ -402,7 +397,7 @@ Are you sure you want to delete this expense?`,
 		expense.Name,
 		expense.Amount,
 		expense.Date,
-		expense.Payer,
+		models.DisplayRef(getCurrentMembers(ctx), expense.Payer),
 	)
 
 	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
@@ -439,11 +434,14 @@ func HandleConfirmDelete(bot *gotgbot.Bot, ctx *ext.Context) error {
 	logUserAction(ctx, "splitbill_delete_confirm", fmt.Sprintf("expense_id=%d", expenseId))
 
 	// Fetch the expense first to get name, amount, and existing note
-	expense, err := handlers.GetExpenseById(expenseId)
+	expense, err := handlers.GetExpenseById(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), expenseId)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
 	}
+	if !canEditExpense(ctx, expense) {
+		return replyExpenseEditDenied(bot, ctx, expense)
+	}
 
 	// Get username for audit log
 	username := "@" + ctx.EffectiveUser.Username
@@ -455,7 +453,7 @@ func HandleConfirmDelete(bot *gotgbot.Bot, ctx *ext.Context) error {
 	formattedAmount := utilities.FormatMoney(cast.ToInt(expense.Amount))
 
 	// Soft delete the expense (keeps ID, appends deletion to audit log)
-	err = handlers.DeleteExpenseById(expenseId, expense.Name, formattedAmount, expense.Note, username)
+	err = handlers.DeleteExpenseById(handlers.ContextOf(ctx), handlers.HouseholdOf(ctx), expenseId, expense.Name, formattedAmount, expense.Note, username)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Failed to Delete*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
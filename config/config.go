@@ -3,45 +3,161 @@ package config
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/sirupsen/logrus"
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
+
+	"housematee-tgbot/models"
+	"housematee-tgbot/utilities"
 )
 
 type AppConfig struct {
 	Telegram     Telegram     `mapstructure:"telegram" validate:"required"`
 	GoogleApis   GoogleApis   `mapstructure:"google_apis" validate:"required"`
 	GoogleSheets GoogleSheets `mapstructure:"google_sheets" validate:"required"`
+	Settings     Settings     `mapstructure:"settings"`
+	Server       Server       `mapstructure:"server"`
+}
+
+// Server is the HTTP server of the health endpoints and, in webhook mode, of the Telegram webhook
+type Server struct {
+	// Port to listen on, 0 disables the server in polling mode; the PORT environment variable overrides it
+	Port int `mapstructure:"port" validate:"gte=0,lte=65535"`
+}
+
+type Settings struct {
+	// Timezone is the IANA name of the house timezone used for dates, reminders and audit entries
+	Timezone string `mapstructure:"timezone" validate:"required,timezone"`
+	// Tariffs turn meter consumption into electric and water amounts
+	Tariffs Tariffs `mapstructure:"tariffs"`
+	// Cache configures the read-through cache in front of Google Sheets
+	Cache Cache `mapstructure:"cache"`
+	// Drafts configures where the unfinished conversations are kept across restarts
+	Drafts Drafts `mapstructure:"drafts"`
+	// Households maps chats to their own spreadsheet and timezone
+	Households Households `mapstructure:"households"`
+	// Layouts are the versions of the layout of the monthly sheets, oldest first; empty uses DefaultLayouts
+	Layouts []models.LayoutSpec `mapstructure:"layouts"`
+	// Reminders are the times of the scheduled notifications
+	Reminders Reminders `mapstructure:"reminders"`
+}
+
+type Reminders struct {
+	// DueTasks is the cron expression (minute hour day month weekday) of the due tasks notification, in the timezone of each household
+	DueTasks string `mapstructure:"due_tasks"`
+}
+
+type Households struct {
+	// Path of the JSON file of the households linked with /setup, empty keeps them in memory only
+	Path string `mapstructure:"path"`
+	// Chats are the households of the configuration; a chat linked again with /setup uses the new link
+	Chats []HouseholdConfig `mapstructure:"chats" validate:"dive"`
+}
+
+// HouseholdConfig is a chat with its own spreadsheet
+type HouseholdConfig struct {
+	ChatID        int64  `mapstructure:"chat_id" validate:"required"`
+	Name          string `mapstructure:"name"`
+	SpreadsheetId string `mapstructure:"spreadsheet_id" validate:"required"`
+	// Timezone is an IANA name, empty uses settings.timezone
+	Timezone string `mapstructure:"timezone" validate:"omitempty,timezone"`
+}
+
+type Drafts struct {
+	// Path of the JSON file of the conversation states and drafts, empty keeps them in memory only
+	Path string `mapstructure:"path"`
+	// IdleTimeout discards a conversation and its drafts after this long without activity
+	IdleTimeout time.Duration `mapstructure:"idle_timeout" validate:"gt=0"`
+}
+
+type Cache struct {
+	Enabled bool `mapstructure:"enabled"`
+	// DefaultTTL applies to the ranges without a rule, 0 does not cache them
+	DefaultTTL  time.Duration `mapstructure:"default_ttl" validate:"gte=0"`
+	MetadataTTL time.Duration `mapstructure:"metadata_ttl" validate:"gte=0"`
+	// ChangeCheckInterval is how often cached ranges are re-read to catch edits made in the sheet, 0 disables it
+	ChangeCheckInterval time.Duration `mapstructure:"change_check_interval" validate:"gte=0"`
+	Rules               []CacheRule   `mapstructure:"rules" validate:"dive"`
+}
+
+// CacheRule sets the TTL of the ranges starting with a prefix, e.g., "Database!"
+type CacheRule struct {
+	Prefix string        `mapstructure:"prefix" validate:"required"`
+	TTL    time.Duration `mapstructure:"ttl" validate:"gte=0"`
+}
+
+type Tariffs struct {
+	Electric []TariffTier `mapstructure:"electric" validate:"dive"`
+	Water    []TariffTier `mapstructure:"water" validate:"dive"`
+}
+
+// TariffTier is the unit price up to a cumulative consumption (kWh or m³); up_to 0 means no limit
+type TariffTier struct {
+	UpTo  float64 `mapstructure:"up_to" validate:"gte=0"`
+	Price int64   `mapstructure:"price" validate:"gt=0"`
 }
 
 type Telegram struct {
 	ApiToken        string  `mapstructure:"api_token" validate:"required"`
 	AllowedChannels []int64 `mapstructure:"allowed_channels" validate:"required"`
+	// AdminUserIDs are the Telegram user IDs allowed to use /status, /diag and /setup, in any chat
+	AdminUserIDs []int64 `mapstructure:"admin_user_ids"`
+	// Mode is how updates are received: polling or webhook
+	Mode    string  `mapstructure:"mode" validate:"oneof=polling webhook"`
+	Webhook Webhook `mapstructure:"webhook"`
 }
 
+type Webhook struct {
+	// URL is the public base URL Telegram sends the updates to, e.g., https://housematee-tgbot.fly.dev
+	URL string `mapstructure:"url"`
+	// Path is the path of the webhook endpoint, appended to URL
+	Path string `mapstructure:"path" validate:"startswith=/"`
+	// SecretToken is sent by Telegram with every update, requests without it are rejected
+	SecretToken string `mapstructure:"secret_token"`
+}
+
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+)
+
+// webhookSecretPattern is the format Telegram accepts for the webhook secret token
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 type GoogleApis struct {
-	Credentials Credentials `mapstructure:"credentials" validate:"required"`
+	Credentials Credentials `mapstructure:"credentials"`
+	// CredentialsFile is the JSON key file of the service account, it replaces Credentials when set
+	CredentialsFile string `mapstructure:"credentials_file"`
 }
 
+// Credentials are the fields of a service account JSON key file
 type Credentials struct {
-	Type                string `mapstructure:"type"`
-	ProjectID           string `mapstructure:"project_id"`
-	PrivateKeyID        string `mapstructure:"private_key_id"`
-	PrivateKey          string `mapstructure:"private_key"`
-	ClientEmail         string `mapstructure:"client_email"`
-	ClientID            string `mapstructure:"client_id"`
-	AuthURI             string `mapstructure:"auth_uri"`
-	TokenURI            string `mapstructure:"token_uri"`
-	AuthProviderCertURL string `mapstructure:"auth_provider_x509_cert_url"`
-	ClientCertURL       string `mapstructure:"client_x509_cert_url"`
+	Type                string `mapstructure:"type" json:"type"`
+	ProjectID           string `mapstructure:"project_id" json:"project_id"`
+	PrivateKeyID        string `mapstructure:"private_key_id" json:"private_key_id"`
+	PrivateKey          string `mapstructure:"private_key" json:"private_key" validate:"required"`
+	ClientEmail         string `mapstructure:"client_email" json:"client_email" validate:"required"`
+	ClientID            string `mapstructure:"client_id" json:"client_id"`
+	AuthURI             string `mapstructure:"auth_uri" json:"auth_uri"`
+	TokenURI            string `mapstructure:"token_uri" json:"token_uri"`
+	AuthProviderCertURL string `mapstructure:"auth_provider_x509_cert_url" json:"auth_provider_x509_cert_url"`
+	ClientCertURL       string `mapstructure:"client_x509_cert_url" json:"client_x509_cert_url"`
 }
 
 type GoogleSheets struct {
+	// SpreadsheetId is the spreadsheet of the allowed_channels that have no household of their own
 	SpreadsheetId string `mapstructure:"spreadsheet_id" validate:"required"`
 }
 
@@ -49,44 +165,113 @@ var (
 	_, b, _, _        = runtime.Caller(0)
 	basePath          = filepath.Dir(b) //get the absolute directory of the current file
 	defaultConfigFile = basePath + "/local.yaml"
-	v                 = viper.New()
-	appConfig         AppConfig
+	// current is the loaded configuration; a reload replaces it as a whole, so a read sees one version
+	current      atomic.Pointer[AppConfig]
+	sheetLayouts models.Layouts
 )
 
-func init() {
-	Load()
+const (
+	defaultWebhookPath = "/telegram/webhook"
+	defaultServerPort  = 8080
+	// defaultDraftIdleTimeout is a string so viper decodes it like the configured durations
+	defaultDraftIdleTimeout = "30m"
+	defaultDueTasksReminder = "30 18 * * *"
+	defaultTokenURI         = "https://oauth2.googleapis.com/token"
+	// EnvPrefix starts the environment variables that override a single key, e.g., HOUSEMATEE_TELEGRAM_API_TOKEN
+	EnvPrefix = "HOUSEMATEE"
+)
+
+// envAliases are the other environment variables of a key, used when the prefixed one is not set
+var envAliases = map[string][]string{
+	// Hosting platforms such as Fly.io pass the port to listen on in PORT
+	"server.port":                  {"PORT"},
+	"google_apis.credentials_file": {"GOOGLE_APPLICATION_CREDENTIALS"},
 }
 
-func Load() {
-	configReaderMode := os.Getenv("CONFIG_READER_MODE")
+// Load reads the configuration of CONFIG_READER_MODE with the environment overrides and checks it.
+// It reports every problem found at once; the configuration is only replaced when there is none.
+func Load() error {
+	config, layouts, err := read()
+	if err != nil {
+		return err
+	}
+	sheetLayouts = layouts
+	current.Store(config)
+	return nil
+}
 
-	switch configReaderMode {
+// read reads and checks the configuration without loading it
+func read() (*AppConfig, models.Layouts, error) {
+	v := viper.New()
+	switch configReaderMode := os.Getenv("CONFIG_READER_MODE"); configReaderMode {
 	case "file":
-		if err := loadConfigFromFile(); err != nil {
-			panic(err)
+		if err := loadConfigFromFile(v); err != nil {
+			return nil, nil, err
 		}
 	case "secret":
-		if err := loadConfigFromSecret(); err != nil {
-			panic(err)
+		if err := loadConfigFromSecret(v); err != nil {
+			return nil, nil, err
 		}
 	default:
-		panic("Invalid CONFIG_READER_MODE. Please use 'file' or 'secret'.")
+		return nil, nil, fmt.Errorf("invalid CONFIG_READER_MODE %q, use 'file' or 'secret'", configReaderMode)
 	}
 
-	if err := scanConfigFile(&appConfig); err != nil {
-		panic(err)
+	v.SetDefault("settings.timezone", utilities.DefaultTimezone)
+	v.SetDefault("telegram.mode", TelegramModePolling)
+	v.SetDefault("telegram.webhook.path", defaultWebhookPath)
+	v.SetDefault("server.port", defaultServerPort)
+	v.SetDefault("settings.drafts.idle_timeout", defaultDraftIdleTimeout)
+	v.SetDefault("settings.reminders.due_tasks", defaultDueTasksReminder)
+	v.SetDefault("google_apis.credentials.token_uri", defaultTokenURI)
+	if err := bindEnvKeys(v, reflect.TypeOf(AppConfig{}), ""); err != nil {
+		return nil, nil, err
 	}
 
-	if err := validateConfig(&appConfig); err != nil {
-		panic(err)
+	config := &AppConfig{}
+	if err := scanConfigFile(v, config); err != nil {
+		return nil, nil, err
+	}
+	if err := loadCredentialsFile(config); err != nil {
+		return nil, nil, err
+	}
+
+	problems := validateConfig(config)
+	problems = append(problems, validateWebhookConfig(config)...)
+	if _, err := cron.ParseStandard(config.Settings.Reminders.DueTasks); err != nil {
+		problems = append(problems, fmt.Sprintf("settings.reminders.due_tasks: %s", err.Error()))
+	}
+	layouts, err := loadLayouts(config)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return nil, nil, &Error{Problems: problems}
 	}
+	return config, layouts, nil
+}
+
+// Error lists the problems of an invalid configuration
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
 }
 
-func loadConfigFromFile() error {
-	var configFile string
-	if configFile = os.Getenv("CONFIG_PATH"); len(configFile) == 0 {
-		configFile = defaultConfigFile
+// File returns the configuration file in file mode, empty in secret mode
+func File() string {
+	if os.Getenv("CONFIG_READER_MODE") != "file" {
+		return ""
+	}
+	if configFile := os.Getenv("CONFIG_PATH"); configFile != "" {
+		return configFile
 	}
+	return defaultConfigFile
+}
+
+func loadConfigFromFile(v *viper.Viper) error {
+	configFile := File()
 
 	v.AddConfigPath(filepath.Dir(configFile))
 	v.SetConfigName(
@@ -95,15 +280,14 @@ func loadConfigFromFile() error {
 			filepath.Ext(configFile),
 		),
 	)
-	v.AutomaticEnv()
 
 	return v.ReadInConfig()
 }
 
-func loadConfigFromSecret() error {
+func loadConfigFromSecret(v *viper.Viper) error {
 	encodedConfig := os.Getenv("CONFIG_SECRET")
 	if encodedConfig == "" {
-		logrus.Fatal("CONFIG_SECRET is empty")
+		return fmt.Errorf("CONFIG_SECRET is empty")
 	}
 
 	decodedConfig, err := base64.StdEncoding.DecodeString(encodedConfig)
@@ -119,15 +303,145 @@ func loadConfigFromSecret() error {
 	return nil
 }
 
-func scanConfigFile(config any) error {
-	return v.Unmarshal(&config)
+// bindEnvKeys binds every key of the configuration to its environment variable, e.g., telegram.api_token to
+// HOUSEMATEE_TELEGRAM_API_TOKEN, so a key can be overridden even when the file does not set it.
+// Lists are given comma separated.
+func bindEnvKeys(v *viper.Viper, t reflect.Type, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if field.Type.Kind() == reflect.Struct {
+			if err := bindEnvKeys(v, field.Type, key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		envs := append([]string{EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))}, envAliases[key]...)
+		if err := v.BindEnv(append([]string{key}, envs...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanConfigFile(v *viper.Viper, config *AppConfig) error {
+	return v.Unmarshal(config)
+}
+
+// loadCredentialsFile reads the service account key of google_apis.credentials_file, which replaces the inline credentials
+func loadCredentialsFile(config *AppConfig) error {
+	path := config.GoogleApis.CredentialsFile
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("google_apis.credentials_file: %w", err)
+	}
+	var credentials Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return fmt.Errorf("google_apis.credentials_file %s: %w", path, err)
+	}
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = defaultTokenURI
+	}
+	config.GoogleApis.Credentials = credentials
+	return nil
 }
 
-func validateConfig(config any) error {
+// validateConfig checks the validate tags and describes each failure with the key of the configuration file
+func validateConfig(config *AppConfig) []string {
 	validate := validator.New()
-	return validate.Struct(config)
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+	})
+	err := validate.Struct(config)
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		if err != nil {
+			return []string{err.Error()}
+		}
+		return nil
+	}
+
+	problems := make([]string, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		// The namespace starts with the AppConfig type
+		_, key, _ := strings.Cut(fieldError.Namespace(), ".")
+		problem := key + " " + describeValidation(fieldError)
+		if strings.HasPrefix(key, "google_apis.credentials.") {
+			problem += ", or set google_apis.credentials_file"
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+func describeValidation(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "timezone":
+		return fmt.Sprintf("is not an IANA timezone: %q", fieldError.Value())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s, got %q", fieldError.Param(), fieldError.Value())
+	case "gt", "gte", "lt", "lte":
+		operators := map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+		return fmt.Sprintf("must be %s %s, got %v", operators[fieldError.Tag()], fieldError.Param(), fieldError.Value())
+	case "startswith":
+		return fmt.Sprintf("must start with %s", fieldError.Param())
+	default:
+		return fmt.Sprintf("fails the %s check", fieldError.Tag())
+	}
+}
+
+// validateWebhookConfig checks the settings needed in webhook mode
+func validateWebhookConfig(config *AppConfig) []string {
+	if config.Telegram.Mode != TelegramModeWebhook {
+		return nil
+	}
+	var problems []string
+	webhook := config.Telegram.Webhook
+	if !strings.HasPrefix(webhook.URL, "https://") {
+		problems = append(problems, "telegram.webhook.url must be an https URL in webhook mode")
+	}
+	if !webhookSecretPattern.MatchString(webhook.SecretToken) {
+		problems = append(problems, "telegram.webhook.secret_token must be 1-256 characters of A-Z, a-z, 0-9, _ and - in webhook mode")
+	}
+	if config.Server.Port == 0 {
+		problems = append(problems, "server.port must be set in webhook mode")
+	}
+	return problems
 }
 
+// GetAppConfig returns the loaded configuration. Keep the returned pointer for one operation only:
+// a reload replaces the configuration instead of changing it.
 func GetAppConfig() *AppConfig {
-	return &appConfig
+	if config := current.Load(); config != nil {
+		return config
+	}
+	return &AppConfig{}
+}
+
+// loadLayouts parses and checks settings.layouts, or DefaultLayouts when there is none
+func loadLayouts(config *AppConfig) (models.Layouts, error) {
+	specs := config.Settings.Layouts
+	if len(specs) == 0 {
+		specs = DefaultLayouts
+	}
+	layouts, err := models.ParseLayouts(specs)
+	if err != nil {
+		return nil, fmt.Errorf("settings.layouts: %w", err)
+	}
+	return layouts, nil
+}
+
+// GetSheetLayout returns the layout of a monthly sheet or the Template
+func GetSheetLayout(sheetName string) models.SheetLayout {
+	return sheetLayouts.ForSheet(sheetName)
+}
+
+// GetLayouts returns every layout version, oldest first
+func GetLayouts() models.Layouts {
+	return sheetLayouts
 }
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+telegram:
+  api_token: token
+  allowed_channels: [-100]
+google_apis:
+  credentials:
+    client_email: bot@example.iam.gserviceaccount.com
+    private_key: key
+google_sheets:
+  spreadsheet_id: sheet
+settings:
+  timezone: Asia/Ho_Chi_Minh
+`
+
+// writeConfig writes a configuration file and selects it with CONFIG_READER_MODE and CONFIG_PATH
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_READER_MODE", "file")
+	t.Setenv("CONFIG_PATH", path)
+	// Empty variables are ignored, so the environment of the test run does not override the file
+	for _, env := range []string{"PORT", "GOOGLE_APPLICATION_CREDENTIALS"} {
+		t.Setenv(env, "")
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	writeConfig(t, testConfig)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	config := GetAppConfig()
+	if config.Telegram.Mode != TelegramModePolling || config.Server.Port != defaultServerPort {
+		t.Errorf("telegram.mode = %q, server.port = %d", config.Telegram.Mode, config.Server.Port)
+	}
+	if config.Settings.Drafts.IdleTimeout != 30*time.Minute || config.Settings.Reminders.DueTasks != defaultDueTasksReminder {
+		t.Errorf("settings = %+v", config.Settings)
+	}
+	if config.GoogleApis.Credentials.TokenURI != defaultTokenURI {
+		t.Errorf("token_uri = %q", config.GoogleApis.Credentials.TokenURI)
+	}
+	if len(GetLayouts()) != len(DefaultLayouts) {
+		t.Errorf("layouts = %d, want the default layouts", len(GetLayouts()))
+	}
+	// Sheets created before the rent shares column keep the layout they were created with
+	if GetSheetLayout("2026_10").HasRentShares() || !GetSheetLayout("2026_11").HasRentShares() {
+		t.Error("only the sheets from 2026_11 should have the rent shares column")
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	writeConfig(t, testConfig)
+	t.Setenv("HOUSEMATEE_TELEGRAM_API_TOKEN", "from-env")
+	t.Setenv("HOUSEMATEE_TELEGRAM_ALLOWED_CHANNELS", "1,2")
+	t.Setenv("HOUSEMATEE_SETTINGS_DRAFTS_IDLE_TIMEOUT", "5m")
+	t.Setenv("PORT", "9090")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	config := GetAppConfig()
+	if config.Telegram.ApiToken != "from-env" {
+		t.Errorf("api_token = %q", config.Telegram.ApiToken)
+	}
+	if !reflect.DeepEqual(config.Telegram.AllowedChannels, []int64{1, 2}) {
+		t.Errorf("allowed_channels = %v", config.Telegram.AllowedChannels)
+	}
+	if config.Settings.Drafts.IdleTimeout != 5*time.Minute || config.Server.Port != 9090 {
+		t.Errorf("idle_timeout = %s, port = %d", config.Settings.Drafts.IdleTimeout, config.Server.Port)
+	}
+}
+
+func TestLoadCredentialsFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	key := `{"type": "service_account", "client_email": "file@example.iam.gserviceaccount.com", "private_key": "file-key"}`
+	if err := os.WriteFile(keyFile, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, strings.Replace(testConfig, "google_apis:\n", "google_apis:\n  credentials_file: "+keyFile+"\n", 1))
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	credentials := GetAppConfig().GoogleApis.Credentials
+	if credentials.ClientEmail != "file@example.iam.gserviceaccount.com" || credentials.PrivateKey != "file-key" {
+		t.Errorf("credentials = %+v", credentials)
+	}
+	if credentials.TokenURI != defaultTokenURI {
+		t.Errorf("token_uri = %q", credentials.TokenURI)
+	}
+
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+	if err := Load(); err == nil || !strings.Contains(err.Error(), "credentials_file") {
+		t.Errorf("a missing key file must fail, got %v", err)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	writeConfig(t, testConfig)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := GetAppConfig()
+
+	writeConfig(t, `
+telegram:
+  mode: webhook
+settings:
+  timezone: Mars/Olympus
+  reminders:
+    due_tasks: "every evening"
+`)
+	err := Load()
+	var configErr *Error
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Load() = %v, want a configuration error", err)
+	}
+	for _, want := range []string{
+		"telegram.api_token is required",
+		"telegram.allowed_channels is required",
+		"google_apis.credentials.private_key is required, or set google_apis.credentials_file",
+		"google_sheets.spreadsheet_id is required",
+		`settings.timezone is not an IANA timezone: "Mars/Olympus"`,
+		"telegram.webhook.url must be an https URL",
+		"settings.reminders.due_tasks",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("the report misses %q:\n%s", want, err.Error())
+		}
+	}
+	if GetAppConfig() != loaded {
+		t.Error("an invalid configuration must not replace the loaded one")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := strings.NewReplacer(
+		"api_token: token", "api_token: other",
+		"allowed_channels: [-100]", "allowed_channels: [-100, -200]",
+		"timezone: Asia/Ho_Chi_Minh", "timezone: Europe/Berlin\n  reminders:\n    due_tasks: \"0 9 * * *\"",
+	).Replace(testConfig)
+	if err := os.WriteFile(path, []byte(changed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"telegram.allowed_channels", "settings.timezone", "settings.reminders"}; !reflect.DeepEqual(result.Applied, want) {
+		t.Errorf("applied = %v, want %v", result.Applied, want)
+	}
+	if !reflect.DeepEqual(result.Ignored, []string{"telegram.api_token"}) {
+		t.Errorf("ignored = %v", result.Ignored)
+	}
+	config := GetAppConfig()
+	if config.Telegram.ApiToken != "token" || config.Settings.Timezone != "Europe/Berlin" || len(config.Telegram.AllowedChannels) != 2 {
+		t.Errorf("reloaded config = %+v", config)
+	}
+
+	if err := os.WriteFile(path, []byte("telegram: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Reload(); err == nil {
+		t.Error("an invalid configuration must not reload")
+	}
+	if GetAppConfig() != config {
+		t.Error("a failed reload must keep the loaded configuration")
+	}
+}
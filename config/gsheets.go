@@ -1,56 +1,95 @@
 package config
 
+import "housematee-tgbot/models"
+
 // Indexes of data in Google Sheets
 var (
 	// Database sheet
 	SeperatedSheetDatabaseName = "Database"
 	CurrentSheetNameCell       = "Database!B2"
+	// Rent split policy of the house, one row per component: A = label, B = policy
+	// e.g., "weighted", "percentage:111=60,222=40" (values keyed by member reference)
+	RentSplitPolicyRange = "Database!A4:B6" // Electric, Water, Other fees
+	// How records reference members: A = label, B = MemberRefsByUserID once /members migrate ran, empty for @usernames
+	MemberRefsRange    = "Database!A8:B8"
+	MemberRefsCell     = "Database!B8"
+	MemberRefsByUserID = "user_id"
 
 	// Template sheet
 	TemplateSheetName = "Template"
 
-	// Expenses sheet
-	NextExpenseIdCell = "B2" // example: "9/2023!B2"
-	ExpenseStartRow   = 3
-	ExpenseStartCol   = "A"
-	ExpenseEndCol     = "G"
-
-	// Report sheet - updated for new template with expanded rent section
-	ReportStartCell  = "I3"
-	ReportEndCell    = "M9"  // Rows 3-9: Header, Expenses, Electric, Water, Other Fees, Total Rent, Total
-	BalanceStartRow  = 13    // Data starts at row 13 (row 11 is label, row 12 is header)
-	BalanceStartCell = "I13" // Data starts at I13
-	BalanceEndCol    = "M"   // BalanceEndRow = BalanceStartRow + numberOfMembers - 1
-
-	// Rent section cells - bot writes Amount column (J) and Payer (M8)
-	RentElectricCell  = "J5" // Electric amount
-	RentWaterCell     = "J6" // Water amount
-	RentOtherFeesCell = "J7" // Other fees amount
-	RentTotalCell     = "J8" // Total rent amount
-	RentPayerCell     = "M8" // Payer username
-
 	// Tasks sheet
 	SeparatedSheetTasksName = "Tasks"
 	TaskStartRow            = 2
 	TaskStartCol            = "A"
-	TaskEndCol              = "I" // A-I: ID, Name, Frequency, LastDone, NextDue, Assignee, TurnsRemaining, ChannelId, Note
+	TaskEndCol              = "K" // A-K: ID, Name, Frequency, LastDone, NextDue, Assignee, TurnsRemaining, ChannelId, Note, RequiresProof, HandoverFrom
 	NumberOfTasksCell       = "B1"
 	NumberOfTasksReadRange  = "Tasks!B1"
 
-	// Members sheet (O:Q)
-	// Row 2: "Members" label, count in P2
-	// Row 3: Headers (ID, Username, Weight)
-	// Row 4+: Data
-	NumberOfMembersCell = "P2"
-	MembersStartRow     = 4 // Data starts at row 4 (row 3 is header)
-	MembersStartCol     = "O"
-	MembersEndCol       = "Q" // O=ID, P=Username, Q=Weight
+	// TaskHistory sheet (append-only log of task events)
+	// Row 1: Headers, Row 2+: Data
+	SeparatedSheetTaskHistoryName = "TaskHistory"
+	TaskHistoryStartRow           = 2
+	TaskHistoryStartCol           = "A"
+	TaskHistoryEndCol             = "H" // A-H: Timestamp, TaskID, TaskName, Event, Doer, Assignee, DueDate, Note
+
+	// Shopping sheet
+	// B1: Next item ID, Row 2: Headers, Row 3+: Data (row = ShoppingStartRow + ID)
+	SeparatedSheetShoppingName = "Shopping"
+	NextShoppingItemIdCell     = "Shopping!B1"
+	ShoppingStartRow           = 2
+	ShoppingStartCol           = "A"
+	ShoppingEndCol             = "E" // A-E: ID, Name, EstimatedPrice, AddedBy, Checked
+
+	// Meters sheet (append-only log of meter readings)
+	// Row 1: Headers, Row 2+: Data
+	SeparatedSheetMetersName = "Meters"
+	MetersStartRow           = 2
+	MetersStartCol           = "A"
+	MetersEndCol             = "F" // A-F: Month, Meter, Member, Reading, Timestamp, RecordedBy
+
+	// Roles sheet (role of a user in a chat, users without a row are members)
+	// Row 1: Headers, Row 2+: Data
+	SeparatedSheetRolesName = "Roles"
+	RolesStartRow           = 2
+	RolesStartCol           = "A"
+	RolesEndCol             = "E" // A-E: ChatID, UserID, Role, UpdatedBy, UpdatedAt
 )
 
 const (
-	ExpenseNameRent = "rent"
+	ExpenseNameRent     = "rent"
+	ExpenseNameShopping = "Shopping"
 )
 
-func GetNextExpenseIdCell(sheetName string) string {
-	return sheetName + "!" + NextExpenseIdCell
+// DefaultLayouts are the layouts of the monthly sheets of the sample spreadsheet, oldest first, used when
+// settings.layouts is empty. Add a version instead of changing one when the Template changes.
+var DefaultLayouts = []models.LayoutSpec{
+	{
+		Version:       1,
+		NextExpenseID: "B2",
+		Expenses:      "A3:G", // expense n lives on row 3 + n
+		// Rows 3-9: Header, Expenses, Electric, Water, Other Fees, Total Rent, Total
+		Report:       "I3:M9",
+		ReportRows:   models.ReportRowsSpec{Expenses: 4, Rent: 8, Total: 9},
+		Balances:     "I12:M", // row 11 is the "Balances" label
+		Rent:         "J5:J8", // bot writes the Amount column and the payer
+		RentPayer:    "M8",
+		MembersCount: "P2",
+		Members:      "O3:S", // O=ID, P=Username, Q=Weight, R=Telegram user ID, S=Display name
+	},
+	{
+		// The rent shares column, written by /rent next to the members
+		Version:       2,
+		From:          "2026_11",
+		NextExpenseID: "B2",
+		Expenses:      "A3:G",
+		Report:        "I3:M9",
+		ReportRows:    models.ReportRowsSpec{Expenses: 4, Rent: 8, Total: 9},
+		Balances:      "I12:M",
+		Rent:          "J5:J8",
+		RentPayer:     "M8",
+		RentShares:    "T3:T",
+		MembersCount:  "P2",
+		Members:       "O3:S",
+	},
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// reloadableKey is a key a reload applies while the bot runs: it is read again at each use, or the bot
+// reapplies it after the reload (settings.timezone, settings.reminders)
+type reloadableKey struct {
+	key  string
+	copy func(dst, src *AppConfig)
+}
+
+var reloadableKeys = []reloadableKey{
+	{"telegram.allowed_channels", func(dst, src *AppConfig) { dst.Telegram.AllowedChannels = src.Telegram.AllowedChannels }},
+	{"telegram.admin_user_ids", func(dst, src *AppConfig) { dst.Telegram.AdminUserIDs = src.Telegram.AdminUserIDs }},
+	{"settings.timezone", func(dst, src *AppConfig) { dst.Settings.Timezone = src.Settings.Timezone }},
+	{"settings.tariffs", func(dst, src *AppConfig) { dst.Settings.Tariffs = src.Settings.Tariffs }},
+	{"settings.households.chats", func(dst, src *AppConfig) { dst.Settings.Households.Chats = src.Settings.Households.Chats }},
+	{"settings.drafts.idle_timeout", func(dst, src *AppConfig) { dst.Settings.Drafts.IdleTimeout = src.Settings.Drafts.IdleTimeout }},
+	{"settings.reminders", func(dst, src *AppConfig) { dst.Settings.Reminders = src.Settings.Reminders }},
+}
+
+// ReloadResult lists the keys whose value changed in a reload
+type ReloadResult struct {
+	Applied []string
+	// Ignored keys keep their loaded value until the bot restarts
+	Ignored []string
+}
+
+// Changed reports whether the reload applied a key
+func (r ReloadResult) Changed(key string) bool {
+	return slices.Contains(r.Applied, key)
+}
+
+var reloadMu sync.Mutex
+
+// Reload reads and checks the configuration again and applies the reloadable keys. The other keys, such as the
+// token, the credentials or the layouts, need a restart and are listed as ignored. Nothing changes when the
+// configuration is invalid.
+func Reload() (ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, _, err := read()
+	if err != nil {
+		return ReloadResult{}, err
+	}
+
+	loaded := GetAppConfig()
+	merged := *loaded
+	result := ReloadResult{Applied: make([]string, 0), Ignored: make([]string, 0)}
+	for _, k := range reloadableKeys {
+		before := merged
+		k.copy(&merged, next)
+		if !reflect.DeepEqual(before, merged) {
+			result.Applied = append(result.Applied, k.key)
+		}
+	}
+
+	// What still differs once the reloadable keys are the same needs a restart
+	rest := *next
+	for _, k := range reloadableKeys {
+		k.copy(&rest, &merged)
+	}
+	result.Ignored = changedKeys(reflect.ValueOf(merged), reflect.ValueOf(rest), "", result.Ignored)
+
+	current.Store(&merged)
+	return result, nil
+}
+
+// changedKeys lists the keys that differ between two configurations, without their values
+func changedKeys(a, b reflect.Value, prefix string, keys []string) []string {
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		key := prefix + strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if field.Type.Kind() == reflect.Struct {
+			keys = changedKeys(a.Field(i), b.Field(i), key+".", keys)
+		} else if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
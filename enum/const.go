@@ -8,10 +8,19 @@ const (
 	SplitBillAddActionCommand = "splitbill_add"
 	RentCommand               = "rent"
 	HouseworkCommand          = "housework"
+	ShopCommand               = "shop"
+	MembersCommand            = "members"
+	MeterCommand              = "meter"
 	SettingsCommand           = "settings"
 	FeedbackCommand           = "feedback"
 	HelpCommand               = "help"
 	CancelCommand             = "cancel"
+	StatusCommand             = "status"
+	DiagCommand               = "diag"
+	RolesCommand              = "roles"
+	SetupCommand              = "setup"
+	ExportCommand             = "export"
+	ImportCommand             = "import"
 )
 
 func GetCommandAsText(cmd string) string {
@@ -24,6 +33,20 @@ const (
 	HouseworkPrefix = "hw"
 )
 
+// Conversation flows, their states and drafts are persisted under these names
+const (
+	FlowAddExpense    = "add_expense"
+	FlowUpdateExpense = "update_expense"
+	FlowRent          = "rent"
+	FlowShop          = "shop"
+	FlowSetup         = "setup"
+	FlowImport        = "import"
+	// FlowHouseworkProof keeps the photo proof requests and the photos waiting for review
+	FlowHouseworkProof = "housework_proof"
+	// FlowHouseworkSwap keeps the open swap offers
+	FlowHouseworkSwap = "housework_swap"
+)
+
 // Splitbill action constants
 const (
 	SplitBillActionPrefix = "splitbill."
@@ -35,6 +58,45 @@ const (
 	RentStateElectric = "rent_state_electric"
 	RentStateWater    = "rent_state_water"
 	RentStatePayer    = "rent_state_payer"
+	RentStateReview   = "rent_state_review"
+	// Split policy menu and per-member values of the policy being edited
+	RentStatePolicy       = "rent_state_policy"
+	RentStatePolicyValues = "rent_state_policy_values"
+)
+
+// Rent action constants
+const (
+	RentPolicyPrefix = "rent.policy."
+	RentPayerPrefix  = "rent.payer."
+	RentReviewPrefix = "rent.review."
+)
+
+// Shopping list conversation states
+const (
+	ShopStateAddItem  = "shop_state_add_item"
+	ShopStateCheckout = "shop_state_checkout"
+)
+
+// Setup conversation states
+const (
+	SetupStateSpreadsheet = "setup_state_spreadsheet"
+	SetupStateTimezone    = "setup_state_timezone"
+)
+
+// Import conversation states
+const (
+	ImportStateFile    = "import_state_file"
+	ImportStateConfirm = "import_state_confirm"
+)
+
+// Import action constants
+const (
+	ImportActionPrefix = "import."
+)
+
+// Shopping list action constants
+const (
+	ShopActionPrefix = "shop."
 )
 
 // GSheets action constants
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+)
+
+// balanceTolerance is the difference allowed between a computed balance and the sheet, which rounds the shares
+const balanceTolerance = 1
+
+// BalanceCheck compares the balance of a member computed from the records with the Balances section of the sheet
+type BalanceCheck struct {
+	Computed models.MemberBalance
+	// Sheet is empty when the member has no line in the Balances section
+	Sheet   models.BalanceData
+	InSheet bool
+	// Mismatches names the columns that differ, e.g., "final balance 3,471,150 in the sheet"
+	Mismatches []string
+}
+
+// RecomputeBalances computes the balances of a monthly sheet from its expenses, members and rent, and compares them
+// with the Balances section, which the sheet computes with formulas. Like the formulas, it uses the rent shares saved
+// in the sheet, so the policy of the month at the time /rent saved it, and the default split for the members without
+// one. It reads past the cache and also returns the expenses left out of the computation.
+func RecomputeBalances(ctx context.Context, household models.Household, sheetName string) ([]BalanceCheck, []uint32, error) {
+	if !household.IsLinked() {
+		return nil, nil, ErrHouseholdNotLinked
+	}
+	svc, spreadsheetId := services.GetUncachedGSheetsSvc(), household.SpreadsheetID
+
+	month, err := readMonth(ctx, svc, spreadsheetId, sheetName)
+	if err != nil {
+		return nil, nil, err
+	}
+	sheetBalances, err := getBalances(ctx, svc, spreadsheetId, sheetName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rentShares, err := monthRentShares(month)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	computed, skipped := models.ComputeBalances(month, rentShares)
+	checks := make([]BalanceCheck, 0, len(computed))
+	for _, balance := range computed {
+		check := BalanceCheck{Computed: balance}
+		// The Balances section shows the username of each member
+		for username, data := range sheetBalances.Users {
+			if m := models.FindMemberByRef(month.Members, username); m != nil && m.Username == balance.Username {
+				check.Sheet, check.InSheet = data, true
+				break
+			}
+		}
+		if check.InSheet {
+			check.Mismatches = balanceMismatches(balance, check.Sheet)
+		}
+		checks = append(checks, check)
+	}
+	return checks, skipped, nil
+}
+
+// monthRentShares returns the rent share of each member of the month: the share saved in the sheet, or the default
+// split for the members after the saved ones, as the Balances formulas do
+func monthRentShares(month models.MonthData) ([]int64, error) {
+	if month.Rent == nil {
+		return nil, nil
+	}
+	if len(month.Rent.Shares) >= len(month.Members) {
+		return month.Rent.Shares[:len(month.Members)], nil
+	}
+
+	rent := models.RentData{Electric: month.Rent.Electric, Water: month.Rent.Water, OtherFees: month.Rent.OtherFees, TotalBill: month.Rent.Total}
+	if err := rent.CalculateMemberShares(month.Members, models.DefaultRentSplitPolicy()); err != nil {
+		return nil, fmt.Errorf("cannot split rent: %w", err)
+	}
+	shares := make([]int64, 0, len(month.Members))
+	for i, share := range rent.MemberShares {
+		if i < len(month.Rent.Shares) {
+			shares = append(shares, month.Rent.Shares[i])
+		} else {
+			shares = append(shares, share.TotalShare)
+		}
+	}
+	return shares, nil
+}
+
+// balanceMismatches lists the columns of the sheet that differ from the computed balance
+func balanceMismatches(computed models.MemberBalance, sheet models.BalanceData) []string {
+	columns := []struct {
+		name     string
+		sheet    string
+		computed int64
+	}{
+		{"total paid", sheet.TotalPaid, computed.TotalPaid},
+		{"have to pay", sheet.HaveToPay, computed.HaveToPay},
+		{"balance", sheet.Balance, computed.Balance},
+		{"final balance", sheet.FinalBalance, computed.FinalBalance},
+	}
+	mismatches := make([]string, 0)
+	for _, c := range columns {
+		if diff := parseSheetAmount(c.sheet) - c.computed; diff > balanceTolerance || diff < -balanceTolerance {
+			mismatches = append(mismatches, fmt.Sprintf("%s %s in the sheet", c.name, c.sheet))
+		}
+	}
+	return mismatches
+}
+
+// balanceFormulaUpdate writes the Balances formulas of the members from index fromIndex of a sheet, keyed on the user
+// ID or the username of the members, and clears the line after the last member, left over when a member was removed
+func balanceFormulaUpdate(sheetName string, numberOfMembers int, fromIndex int, byUserID bool) *sheets.ValueRange {
+	layout := config.GetSheetLayout(sheetName)
+	values := make([][]interface{}, 0, numberOfMembers-fromIndex+1)
+	for i := fromIndex; i < numberOfMembers; i++ {
+		values = append(values, layout.BalanceFormulas(i, byUserID))
+	}
+	values = append(values, []interface{}{"", "", "", "", ""})
+	first := layout.Balances.FirstRow()
+	return &sheets.ValueRange{
+		Range:  layout.Balances.Rows(sheetName, first+fromIndex, first+numberOfMembers),
+		Values: values,
+	}
+}
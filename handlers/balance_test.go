@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"housematee-tgbot/models"
+)
+
+func TestMonthRentShares(t *testing.T) {
+	members := []models.Member{{ID: 1, Username: "@alice", Weight: 2}, {ID: 2, Username: "@bob", Weight: 1}, {ID: 3, Username: "@carol", Weight: 1}}
+	rent := models.RentCells{Electric: 400000, Water: 200000, OtherFees: 3000000, Total: 3600000}
+
+	tests := []struct {
+		name   string
+		shares []int64
+		want   []int64
+	}{
+		// electric and water by weight, other fees equally
+		{"default split", nil, []int64{1300000, 1150000, 1150000}},
+		{"saved shares", []int64{1200000, 1200000, 1200000}, []int64{1200000, 1200000, 1200000}},
+		{"member added after saving", []int64{1800000, 1800000}, []int64{1800000, 1800000, 1150000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells := rent
+			cells.Shares = tt.shares
+			got, err := monthRentShares(models.MonthData{Members: members, Rent: &cells})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shares = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, err := monthRentShares(models.MonthData{Members: members}); err != nil || got != nil {
+		t.Errorf("shares without rent = %v, %v, want none", got, err)
+	}
+}
@@ -4,24 +4,34 @@ import (
 	"context"
 	"github.com/sirupsen/logrus"
 	"housematee-tgbot/config"
+	"housematee-tgbot/models"
 	services "housematee-tgbot/services/gsheets"
 )
 
-func GetCurrentSheetInfo() (svc *services.GSheets, spreadsheetId string, currentSheetName string, err error) {
+// GetCurrentSheetInfo returns the service, the spreadsheet of the household and its current month sheet
+func GetCurrentSheetInfo(ctx context.Context, household models.Household) (svc services.IGSheets, spreadsheetId string, currentSheetName string, err error) {
+	if !household.IsLinked() {
+		err = ErrHouseholdNotLinked
+		return
+	}
+
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
 	svc = services.GetGSheetsSvc()
-	spreadsheetId = config.GetAppConfig().GoogleSheets.SpreadsheetId
+	spreadsheetId = household.SpreadsheetID
 
 	// get current sheet name
-	logrus.Infof("Reading current sheet from: %s, cell: %s", spreadsheetId, config.CurrentSheetNameCell)
+	logrus.WithContext(ctx).Infof("Reading current sheet from: %s, cell: %s", spreadsheetId, config.CurrentSheetNameCell)
 	currentSheetName, err = svc.GetValue(
-		context.TODO(),
+		reqCtx,
 		spreadsheetId,
 		config.CurrentSheetNameCell,
 	)
 	if err != nil {
-		logrus.Errorf("failed to get current sheet name: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get current sheet name: %s", err.Error())
 		return
 	}
-	logrus.Infof("Current sheet name value: %s", currentSheetName)
+	logrus.WithContext(ctx).Infof("Current sheet name value: %s", currentSheetName)
 	return
 }
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/utilities"
+)
+
+// Results of a diagnostic check
+const (
+	DiagnosticOK      = "ok"
+	DiagnosticWarning = "warning"
+	DiagnosticFailed  = "failed"
+)
+
+// DiagnosticCheck is the result of one check of the spreadsheet run by /diag
+type DiagnosticCheck struct {
+	Name   string
+	Result string
+	Detail string
+}
+
+// layoutCheck is a range of a sheet the bot expects at a fixed place: a header row or a counter cell
+type layoutCheck struct {
+	name string
+	// startCol and row locate the first cell; header checks cover one column per wanted header
+	startCol string
+	row      int
+	headers  []string
+	// numeric checks a single counter cell instead of headers
+	numeric bool
+}
+
+func (c layoutCheck) cellRange(sheetName string) string {
+	if c.numeric {
+		return fmt.Sprintf("%s!%s%d", sheetName, c.startCol, c.row)
+	}
+	return fmt.Sprintf("%s!%s%d:%s%d", sheetName, c.startCol, c.row, columnAfter(c.startCol, len(c.headers)-1), c.row)
+}
+
+// columnAfter returns the column n columns to the right of col; the layout only uses columns A-Z
+func columnAfter(col string, n int) string {
+	return string(rune(col[0]) + rune(n))
+}
+
+// splitCell splits an A1 cell such as "I13" into its column and row
+func splitCell(cell string) (string, int) {
+	i := strings.IndexFunc(cell, func(r rune) bool { return r >= '0' && r <= '9' })
+	if i < 0 {
+		return cell, 0
+	}
+	row, _ := strconv.Atoi(cell[i:])
+	return cell[:i], row
+}
+
+// monthSheetLayout is the layout of the Template or of a monthly sheet copied from it, from the layout version of the sheet
+func monthSheetLayout(sheetName string) []layoutCheck {
+	layout := config.GetSheetLayout(sheetName)
+	return []layoutCheck{
+		{name: "next expense ID", startCol: layout.NextExpenseID.Col, row: layout.NextExpenseID.Row, numeric: true},
+		{name: "expenses header", startCol: layout.Expenses.StartCol, row: layout.Expenses.HeaderRow,
+			headers: expenseHeaders},
+		// The member columns between Amount and Payer depend on the house
+		{name: "report header", startCol: layout.Report.Start.Col, row: layout.Report.Start.Row, headers: []string{"Category", "Amount"}},
+		{name: "balances header", startCol: layout.Balances.StartCol, row: layout.Balances.HeaderRow,
+			headers: []string{"Username", "TotalPaid", "ExpenseBalance", "RentBalance", "FinalBalance"}},
+		{name: "number of members", startCol: layout.MembersCount.Col, row: layout.MembersCount.Row, numeric: true},
+		{name: "members header", startCol: layout.Members.StartCol, row: layout.Members.HeaderRow,
+			headers: []string{"ID", "Username", "Weight", "Telegram user ID", "Display name"}},
+	}
+}
+
+// sheetLayouts is the layout of the other sheets, by sheet name
+func sheetLayouts() map[string][]layoutCheck {
+	taskCountCol, taskCountRow := splitCell(config.NumberOfTasksCell)
+	_, nextItemCell, _ := strings.Cut(config.NextShoppingItemIdCell, "!")
+	nextItemCol, nextItemRow := splitCell(nextItemCell)
+	return map[string][]layoutCheck{
+		config.SeparatedSheetTasksName: {
+			{name: "number of tasks", startCol: taskCountCol, row: taskCountRow, numeric: true},
+			{name: "tasks header", startCol: config.TaskStartCol, row: config.TaskStartRow,
+				headers: taskHeaders},
+		},
+		config.SeparatedSheetTaskHistoryName: {
+			{name: "task history header", startCol: config.TaskHistoryStartCol, row: config.TaskHistoryStartRow - 1,
+				headers: []string{"Timestamp", "TaskID", "TaskName", "Event", "Doer", "Assignee", "DueDate", "Note"}},
+		},
+		config.SeparatedSheetShoppingName: {
+			{name: "next item ID", startCol: nextItemCol, row: nextItemRow, numeric: true},
+			{name: "shopping header", startCol: config.ShoppingStartCol, row: config.ShoppingStartRow,
+				headers: shoppingHeaders},
+		},
+		config.SeparatedSheetMetersName: {
+			{name: "meters header", startCol: config.MetersStartCol, row: config.MetersStartRow - 1,
+				headers: []string{"Month", "Meter", "Member", "Reading", "Timestamp", "RecordedBy"}},
+		},
+		config.SeparatedSheetRolesName: {
+			{name: "roles header", startCol: config.RolesStartCol, row: config.RolesStartRow - 1,
+				headers: []string{"ChatID", "UserID", "Role", "UpdatedBy", "UpdatedAt"}},
+		},
+	}
+}
+
+// RunDiagnostics checks that the spreadsheet of the household has the sheets the bot needs and that the
+// headers and counters are where config/gsheets.go expects them. It reads past the cache.
+func RunDiagnostics(ctx context.Context, household models.Household) ([]DiagnosticCheck, error) {
+	if !household.IsLinked() {
+		return nil, ErrHouseholdNotLinked
+	}
+
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc := services.GetUncachedGSheetsSvc()
+	spreadsheetId := household.SpreadsheetID
+
+	spreadsheet, err := svc.GetSpreadsheet(reqCtx, spreadsheetId)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(spreadsheet.Sheets))
+	for _, sheet := range spreadsheet.Sheets {
+		existing[sheet.Properties.Title] = true
+	}
+
+	checks := make([]DiagnosticCheck, 0)
+	// The bot cannot work without these sheets; the others are only used by some commands
+	for _, name := range []string{config.SeperatedSheetDatabaseName, config.TemplateSheetName, config.SeparatedSheetTasksName} {
+		if existing[name] {
+			checks = append(checks, DiagnosticCheck{Name: "sheet " + name, Result: DiagnosticOK})
+		} else {
+			checks = append(checks, DiagnosticCheck{Name: "sheet " + name, Result: DiagnosticFailed, Detail: "missing"})
+		}
+	}
+	optionalSheets := map[string]string{
+		config.SeparatedSheetTaskHistoryName: "housework history and stats",
+		config.SeparatedSheetShoppingName:    "/shop",
+		config.SeparatedSheetMetersName:      "/meter",
+		config.SeparatedSheetRolesName:       "/roles (everyone is a member without it)",
+	}
+	for _, name := range []string{config.SeparatedSheetTaskHistoryName, config.SeparatedSheetShoppingName, config.SeparatedSheetMetersName,
+		config.SeparatedSheetRolesName} {
+		if existing[name] {
+			checks = append(checks, DiagnosticCheck{Name: "sheet " + name, Result: DiagnosticOK})
+		} else {
+			checks = append(checks, DiagnosticCheck{Name: "sheet " + name, Result: DiagnosticWarning, Detail: "missing, needed by " + optionalSheets[name]})
+		}
+	}
+
+	layouts := sheetLayouts()
+	sheetsToCheck := []string{config.TemplateSheetName}
+	if existing[config.SeperatedSheetDatabaseName] {
+		currentSheetName, err := svc.GetValue(reqCtx, spreadsheetId, config.CurrentSheetNameCell)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case currentSheetName == "":
+			checks = append(checks, DiagnosticCheck{Name: "current sheet", Result: DiagnosticFailed, Detail: config.CurrentSheetNameCell + " is empty"})
+		case !existing[currentSheetName]:
+			checks = append(checks, DiagnosticCheck{Name: "current sheet", Result: DiagnosticFailed,
+				Detail: fmt.Sprintf("%s names %q, which does not exist", config.CurrentSheetNameCell, currentSheetName)})
+		default:
+			checks = append(checks, DiagnosticCheck{Name: "current sheet", Result: DiagnosticOK, Detail: currentSheetName})
+			if currentSheetName != config.TemplateSheetName {
+				sheetsToCheck = append(sheetsToCheck, currentSheetName)
+			}
+		}
+	}
+	for _, name := range sheetsToCheck {
+		layouts[name] = monthSheetLayout(name)
+		checks = append(checks, DiagnosticCheck{Name: name + ": layout", Result: DiagnosticOK,
+			Detail: fmt.Sprintf("version %d", config.GetSheetLayout(name).Version)})
+	}
+
+	// One read per sheet, in a stable order
+	for _, name := range append(sheetsToCheck, config.SeparatedSheetTasksName, config.SeparatedSheetTaskHistoryName,
+		config.SeparatedSheetShoppingName, config.SeparatedSheetMetersName, config.SeparatedSheetRolesName) {
+		if !existing[name] {
+			continue
+		}
+		sheetChecks, err := checkSheetLayout(reqCtx, svc, spreadsheetId, name, layouts[name])
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, sheetChecks...)
+	}
+	return checks, nil
+}
+
+// checkSheetLayout reads the ranges of layout from one sheet in a single request and compares them
+func checkSheetLayout(reqCtx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, layout []layoutCheck) ([]DiagnosticCheck, error) {
+	ranges := make([]string, 0, len(layout))
+	for _, c := range layout {
+		ranges = append(ranges, c.cellRange(sheetName))
+	}
+	valueRanges, err := svc.BatchGet(reqCtx, spreadsheetId, ranges...)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]DiagnosticCheck, 0, len(layout))
+	for i, c := range layout {
+		var row []interface{}
+		if i < len(valueRanges) && len(valueRanges[i].Values) > 0 {
+			row = valueRanges[i].Values[0]
+		}
+		name := fmt.Sprintf("%s: %s (%s)", sheetName, c.name, strings.TrimPrefix(ranges[i], sheetName+"!"))
+		problems := compareLayout(c, row)
+		if len(problems) == 0 {
+			checks = append(checks, DiagnosticCheck{Name: name, Result: DiagnosticOK})
+			continue
+		}
+		checks = append(checks, DiagnosticCheck{Name: name, Result: DiagnosticFailed, Detail: strings.Join(problems, "; ")})
+	}
+	return checks, nil
+}
+
+// compareLayout returns what differs between the expected layout and the cells read
+func compareLayout(c layoutCheck, row []interface{}) []string {
+	cellValue := func(i int) string {
+		if i < len(row) {
+			return strings.TrimSpace(fmt.Sprint(row[i]))
+		}
+		return ""
+	}
+
+	problems := make([]string, 0)
+	if c.numeric {
+		if value := cellValue(0); !utilities.IsNumeric(value) {
+			problems = append(problems, fmt.Sprintf("%s%d is %q, expected a number", c.startCol, c.row, value))
+		}
+		return problems
+	}
+	for i, want := range c.headers {
+		if got := cellValue(i); models.NormalizeHeader(got) != models.NormalizeHeader(want) {
+			problems = append(problems, fmt.Sprintf("%s%d is %q, expected %q", columnAfter(c.startCol, i), c.row, got, want))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/utilities"
+)
+
+// ExportHousehold reads the monthly sheets of the period with their members, expenses and rent,
+// the tasks as they are now and the task history of the period
+func ExportHousehold(ctx context.Context, household models.Household, period models.ExportPeriod) (models.Export, error) {
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return models.Export{}, err
+	}
+
+	titles, err := getSheetTitles(ctx, svc, spreadsheetId)
+	if err != nil {
+		return models.Export{}, err
+	}
+	var monthSheets []string
+	for _, title := range titles {
+		if period.IncludesSheet(title) {
+			monthSheets = append(monthSheets, title)
+		}
+	}
+	if len(monthSheets) == 0 {
+		return models.Export{}, fmt.Errorf("there is no monthly sheet in %s", period)
+	}
+	sort.Strings(monthSheets)
+
+	export := models.Export{
+		Format:     models.ExportFormat,
+		Period:     period,
+		ExportedAt: utilities.GetCurrentTimestamp(household.Location()),
+	}
+	export.Months, err = readMonths(ctx, svc, spreadsheetId, monthSheets)
+	if err != nil {
+		return models.Export{}, err
+	}
+	export.Tasks, export.TaskHistory, err = readTasks(ctx, svc, spreadsheetId, titles, period)
+	if err != nil {
+		return models.Export{}, err
+	}
+	export.Audit = models.BuildAudit(export.Months, export.TaskHistory)
+	return export, nil
+}
+
+// PlanImport checks an export and compares it past the cache with the data of the spreadsheet, without writing
+func PlanImport(ctx context.Context, household models.Household, incoming models.Export) (models.ImportPlan, error) {
+	if err := incoming.Validate(); err != nil {
+		return models.ImportPlan{}, err
+	}
+	if !household.IsLinked() {
+		return models.ImportPlan{}, ErrHouseholdNotLinked
+	}
+	svc := services.GetUncachedGSheetsSvc()
+	spreadsheetId := household.SpreadsheetID
+
+	titles, err := getSheetTitles(ctx, svc, spreadsheetId)
+	if err != nil {
+		return models.ImportPlan{}, err
+	}
+	var existing []string
+	for _, month := range incoming.Months {
+		if slices.Contains(titles, month.Sheet) {
+			existing = append(existing, month.Sheet)
+		} else if err := checkTemplateLayout(month.Sheet); err != nil {
+			return models.ImportPlan{}, err
+		}
+	}
+
+	current := models.Export{Period: incoming.Period}
+	current.Months, err = readMonths(ctx, svc, spreadsheetId, existing)
+	if err != nil {
+		return models.ImportPlan{}, err
+	}
+	// The whole task history, so entries of another period are not imported twice
+	current.Tasks, current.TaskHistory, err = readTasks(ctx, svc, spreadsheetId, titles, models.ExportAll)
+	if err != nil {
+		return models.ImportPlan{}, err
+	}
+	if len(incoming.TaskHistory) > 0 && !slices.Contains(titles, config.SeparatedSheetTaskHistoryName) {
+		return models.ImportPlan{}, fmt.Errorf("the spreadsheet has no %s sheet for the task history", config.SeparatedSheetTaskHistoryName)
+	}
+	template := models.MonthData{}
+	if len(existing) < len(incoming.Months) {
+		if template, err = readMonth(ctx, svc, spreadsheetId, config.TemplateSheetName); err != nil {
+			return models.ImportPlan{}, err
+		}
+	}
+	return models.PlanImport(current, incoming, template), nil
+}
+
+// ApplyImport writes an import planned by PlanImport: it creates the new sheets from the Template without making
+// them current, then writes each month, the tasks and the task history. Records are written at the row of their ID,
+// so it stops when the rows of a table are out of order.
+func ApplyImport(ctx context.Context, household models.Household, plan models.ImportPlan) error {
+	if !household.IsLinked() {
+		return ErrHouseholdNotLinked
+	}
+	svc := services.GetGSheetsSvc()
+	spreadsheetId := household.SpreadsheetID
+
+	for _, sheetName := range plan.NewSheets {
+		if _, err := createMonthSheet(ctx, svc, spreadsheetId, sheetName, MonthDisplayName(sheetName), false); err != nil {
+			return fmt.Errorf("failed to create %s: %w", sheetName, err)
+		}
+	}
+	for _, month := range plan.Months {
+		if err := importMonth(ctx, svc, spreadsheetId, month); err != nil {
+			return fmt.Errorf("%s: %w", month.Sheet, err)
+		}
+	}
+	if err := importTasks(ctx, svc, spreadsheetId, plan.Tasks); err != nil {
+		return fmt.Errorf("%s: %w", config.SeparatedSheetTasksName, err)
+	}
+	if err := appendTaskHistory(ctx, svc, spreadsheetId, plan.TaskHistory); err != nil {
+		return fmt.Errorf("%s: %w", config.SeparatedSheetTaskHistoryName, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"chat_id":      household.ChatID,
+		"changes":      len(plan.Changes),
+		"new_sheets":   len(plan.NewSheets),
+		"task_history": len(plan.TaskHistory),
+	}).Info("household data imported")
+	return nil
+}
+
+func getSheetTitles(ctx context.Context, svc services.IGSheets, spreadsheetId string) ([]string, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	spreadsheet, err := svc.GetSpreadsheet(reqCtx, spreadsheetId)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get spreadsheet: %s", err.Error())
+		return nil, err
+	}
+	titles := make([]string, 0, len(spreadsheet.Sheets))
+	for _, sheet := range spreadsheet.Sheets {
+		titles = append(titles, sheet.Properties.Title)
+	}
+	return titles, nil
+}
+
+func readMonths(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetNames []string) ([]models.MonthData, error) {
+	months := make([]models.MonthData, 0, len(sheetNames))
+	for _, sheetName := range sheetNames {
+		month, err := readMonth(ctx, svc, spreadsheetId, sheetName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sheetName, err)
+		}
+		months = append(months, month)
+	}
+	return months, nil
+}
+
+func readMonth(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string) (models.MonthData, error) {
+	month := models.MonthData{Sheet: sheetName}
+
+	members, err := GetMembers(ctx, svc, spreadsheetId, sheetName)
+	if err != nil {
+		return month, err
+	}
+	month.Members = members
+
+	layout := config.GetSheetLayout(sheetName)
+	table := layout.Expenses
+	records, err := readRecordTable(ctx, svc, spreadsheetId, sheetName, table.StartCol, table.EndCol, table.HeaderRow, expenseHeaders)
+	if err != nil {
+		return month, err
+	}
+	month.Expenses = make([]models.Expense, 0)
+	for _, row := range records.Records() {
+		expense := expenseFromRecord(records, row)
+		// Amounts are exported as plain numbers, whatever the money format of the sheet
+		if expense.Amount != "" {
+			expense.Amount = strconv.FormatInt(parseSheetAmount(expense.Amount), 10)
+		}
+		expense.Participants = splitList(cast.ToString(records.Value(row, "Participants")))
+		month.Expenses = append(month.Expenses, expense)
+	}
+
+	if layout.HasRent() {
+		rent, err := readRentCells(ctx, svc, spreadsheetId, sheetName)
+		if err != nil {
+			return month, err
+		}
+		month.Rent = &rent
+	}
+	return month, nil
+}
+
+// readTasks reads the tasks and the task history of the period
+func readTasks(ctx context.Context, svc services.IGSheets, spreadsheetId string, titles []string, period models.ExportPeriod) ([]models.Task, []models.TaskHistory, error) {
+	tasks := make([]models.Task, 0)
+	history := make([]models.TaskHistory, 0)
+
+	if slices.Contains(titles, config.SeparatedSheetTasksName) {
+		houseworkMap, err := getHouseworkMap(ctx, svc, spreadsheetId)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, task := range houseworkMap {
+			if task.ID != 0 {
+				tasks = append(tasks, task)
+			}
+		}
+		sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	}
+
+	if slices.Contains(titles, config.SeparatedSheetTaskHistoryName) {
+		entries, err := GetTaskHistory(ctx, svc, spreadsheetId)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			if period.IncludesTimestamp(entry.Timestamp) {
+				history = append(history, entry)
+			}
+		}
+	}
+	return tasks, history, nil
+}
+
+// importMonth writes the members, the expenses and their counter, and the rent of a month
+func importMonth(ctx context.Context, svc services.IGSheets, spreadsheetId string, month models.MonthImport) error {
+	if month.Members != nil {
+		if err := writeMembers(ctx, svc, spreadsheetId, month.Sheet, month.Members, 0); err != nil {
+			return err
+		}
+	}
+
+	if len(month.Expenses) > 0 {
+		if err := importExpenses(ctx, svc, spreadsheetId, month.Sheet, month.Expenses); err != nil {
+			return err
+		}
+	}
+
+	if month.Rent != nil {
+		return writeRentCells(ctx, svc, spreadsheetId, month.Sheet, *month.Rent)
+	}
+	return nil
+}
+
+func importExpenses(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, expenses []models.Expense) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	// Hold the ID allocations of /splitbill while the rows and the counter are written
+	unlock := services.LockIDs(spreadsheetId)
+	defer unlock()
+
+	layout := config.GetSheetLayout(sheetName)
+	table := layout.Expenses
+	records, err := readRecordTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId, sheetName, table.StartCol, table.EndCol, table.HeaderRow, expenseHeaders)
+	if err != nil {
+		return err
+	}
+	if err := records.CheckOrder(); err != nil {
+		return err
+	}
+	nextIdValue, err := services.GetUncachedGSheetsSvc().GetValue(reqCtx, spreadsheetId, layout.NextExpenseID.In(sheetName))
+	if err != nil {
+		return fmt.Errorf("failed to read next expense id: %w", err)
+	}
+	nextId := cast.ToInt(nextIdValue)
+
+	updates := make([]*sheets.ValueRange, 0, len(expenses)+1)
+	for _, expense := range expenses {
+		row := table.HeaderRow + int(expense.ID)
+		amount := any(expense.Amount)
+		if n, err := strconv.ParseInt(expense.Amount, 10, 64); err == nil {
+			amount = n
+		}
+		updates = append(updates, &sheets.ValueRange{
+			Range: table.Rows(sheetName, row, row),
+			Values: [][]interface{}{records.Row(map[string]any{
+				"ID":           expense.ID,
+				"Name":         expense.Name,
+				"Amount":       amount,
+				"Date":         expense.Date,
+				"Payer":        expense.Payer,
+				"Participants": strings.Join(expense.Participants, ","),
+				"Note":         expense.Note,
+			})},
+		})
+		if int(expense.ID) >= nextId {
+			nextId = int(expense.ID) + 1
+		}
+	}
+	updates = append(updates, &sheets.ValueRange{Range: layout.NextExpenseID.In(sheetName), Values: [][]interface{}{{nextId}}})
+
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, updates...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to import expenses of %s: %s", sheetName, err.Error())
+		return err
+	}
+	return nil
+}
+
+// importTasks writes the tasks at the row of their ID and raises the number of tasks to the last ID
+func importTasks(ctx context.Context, svc services.IGSheets, spreadsheetId string, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	records, err := readTaskTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return err
+	}
+	if err := records.CheckOrder(); err != nil {
+		return err
+	}
+	numTasks, err := services.GetUncachedGSheetsSvc().GetValue(reqCtx, spreadsheetId, config.NumberOfTasksReadRange)
+	if err != nil {
+		return fmt.Errorf("failed to read number of tasks: %w", err)
+	}
+	count := cast.ToInt(numTasks)
+
+	updates := make([]*sheets.ValueRange, 0, len(tasks)+1)
+	lastId := count
+	for _, task := range tasks {
+		updates = append(updates, taskUpdates(&records, task, config.TaskStartRow+task.ID)...)
+		lastId = max(lastId, task.ID)
+	}
+	if lastId > count {
+		updates = append(updates, &sheets.ValueRange{Range: config.NumberOfTasksReadRange, Values: [][]interface{}{{lastId}}})
+	}
+
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, updates...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to import tasks: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// appendTaskHistory appends the entries to the TaskHistory sheet in one request
+func appendTaskHistory(ctx context.Context, svc services.IGSheets, spreadsheetId string, entries []models.TaskHistory) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	values := make([][]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		values = append(values, []interface{}{
+			entry.Timestamp, entry.TaskID, entry.TaskName, entry.Event, entry.Doer, entry.Assignee, entry.DueDate, entry.Note,
+		})
+	}
+	appendRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetTaskHistoryName, config.TaskHistoryStartCol, config.TaskHistoryStartRow, config.TaskHistoryEndCol)
+	if _, err := svc.Append(reqCtx, spreadsheetId, appendRange, &sheets.ValueRange{Values: values}); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to import task history: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// MonthDisplayName returns the MM/YYYY name of a YYYY_MM sheet written in A1
+func MonthDisplayName(sheetName string) string {
+	year, month, _ := strings.Cut(sheetName, "_")
+	return month + "/" + year
+}
+
+// splitList splits a comma separated list of member references
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -3,11 +3,13 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 	"google.golang.org/api/sheets/v4"
 
 	"housematee-tgbot/config"
+	"housematee-tgbot/models"
 	services "housematee-tgbot/services/gsheets"
 )
 
@@ -18,8 +20,8 @@ type SheetInfo struct {
 }
 
 // GetCurrentSheetName returns the current sheet name from Database!B2
-func GetCurrentSheetName() (string, error) {
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+func GetCurrentSheetName(ctx context.Context, household models.Household) (string, error) {
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return "", err
 	}
@@ -29,10 +31,13 @@ func GetCurrentSheetName() (string, error) {
 }
 
 // GetSheetIdByName finds a sheet's numeric ID by its name
-func GetSheetIdByName(svc *services.GSheets, spreadsheetId string, sheetName string) (int64, error) {
-	spreadsheet, err := svc.GetSpreadsheet(context.TODO(), spreadsheetId)
+func GetSheetIdByName(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string) (int64, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	spreadsheet, err := svc.GetSpreadsheet(reqCtx, spreadsheetId)
 	if err != nil {
-		logrus.Errorf("failed to get spreadsheet: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get spreadsheet: %s", err.Error())
 		return 0, err
 	}
 
@@ -45,11 +50,40 @@ func GetSheetIdByName(svc *services.GSheets, spreadsheetId string, sheetName str
 	return 0, fmt.Errorf("sheet '%s' not found", sheetName)
 }
 
+// Headers of the record tables, in the order of the sample spreadsheet
+var (
+	expenseHeaders  = []string{models.IDHeader, "Name", "Amount", "Date", "Payer", "Participants", "Note"}
+	taskHeaders     = []string{models.IDHeader, "Name", "Frequency", "LastDone", "NextDue", "Assignee", "TurnsRemaining", "ChannelId", "Note"}
+	shoppingHeaders = []string{models.IDHeader, "Name", "EstimatedPrice", "AddedBy", "Checked"}
+	// optionalTaskHeaders were added after the sample spreadsheet: a Tasks sheet without them reads their zero value,
+	// and the header is added the first time a task needs the column
+	optionalTaskHeaders = []string{"RequiresProof", "HandoverFrom"}
+)
+
+// readRecordTable reads a table of records from its header row down; pass the uncached service before a write
+func readRecordTable(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, startCol string, endCol string, headerRow int, headers []string) (models.RecordTable, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	resp, err := svc.Get(reqCtx, spreadsheetId, fmt.Sprintf("%s!%s%d:%s", sheetName, startCol, headerRow, endCol))
+	if err != nil {
+		return models.RecordTable{}, err
+	}
+	table, err := models.NewRecordTable(resp.Values, headerRow, headers...)
+	if err != nil {
+		return models.RecordTable{}, fmt.Errorf("%s: %w", sheetName, err)
+	}
+	return table, nil
+}
+
 // SheetExists checks if a sheet with the given name already exists
-func SheetExists(svc *services.GSheets, spreadsheetId string, sheetName string) (bool, error) {
-	spreadsheet, err := svc.GetSpreadsheet(context.TODO(), spreadsheetId)
+func SheetExists(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string) (bool, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	spreadsheet, err := svc.GetSpreadsheet(reqCtx, spreadsheetId)
 	if err != nil {
-		logrus.Errorf("failed to get spreadsheet: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get spreadsheet: %s", err.Error())
 		return false, err
 	}
 
@@ -62,15 +96,71 @@ func SheetExists(svc *services.GSheets, spreadsheetId string, sheetName string)
 	return false, nil
 }
 
+// ensuredSheets are the "spreadsheetId/sheetName" known to exist, so ensureSheet reads the metadata once per sheet
+var ensuredSheets sync.Map
+
+// ensureSheet adds a sheet with its header row in row 1 when the spreadsheet does not have it yet, for the sheets
+// added after the sample spreadsheet (e.g., TaskHistory)
+func ensureSheet(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, headers []string) error {
+	key := spreadsheetId + "/" + sheetName
+	if _, ok := ensuredSheets.Load(key); ok {
+		return nil
+	}
+	exists, err := SheetExists(ctx, svc, spreadsheetId, sheetName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		reqCtx, cancel := services.NewRequestContext(ctx)
+		defer cancel()
+
+		if _, err := svc.AddSheet(reqCtx, spreadsheetId, sheetName); err != nil {
+			return fmt.Errorf("failed to create the %s sheet: %w", sheetName, err)
+		}
+		row := make([]interface{}, len(headers))
+		for i, header := range headers {
+			row[i] = header
+		}
+		if _, err := svc.Update(reqCtx, spreadsheetId, fmt.Sprintf("%s!A1", sheetName), &sheets.ValueRange{Values: [][]interface{}{row}}); err != nil {
+			return fmt.Errorf("failed to write the headers of the %s sheet: %w", sheetName, err)
+		}
+		logrus.WithContext(ctx).WithField("sheet", sheetName).Info("sheet created")
+	}
+	ensuredSheets.Store(key, true)
+	return nil
+}
+
 // CreateNewMonthSheet creates a new sheet by copying the Template and updates Database!B2
-func CreateNewMonthSheet(newSheetName string, displayName string) (*SheetInfo, error) {
-	svc, spreadsheetId, _, err := GetCurrentSheetInfo()
+func CreateNewMonthSheet(ctx context.Context, household models.Household, newSheetName string, displayName string) (*SheetInfo, error) {
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkTemplateLayout(newSheetName); err != nil {
+		return nil, err
+	}
+	return createMonthSheet(ctx, svc, spreadsheetId, newSheetName, displayName, true)
+}
+
+// checkTemplateLayout refuses to copy the Template to a month of an older layout version: the cells of the copy
+// would not be where the layout of that month expects them
+func checkTemplateLayout(sheetName string) error {
+	latest := config.GetLayouts().Latest()
+	if layout := config.GetSheetLayout(sheetName); layout.Version != latest.Version {
+		return fmt.Errorf("%s would be created from the Template, which has layout version %d instead of version %d of that month",
+			sheetName, latest.Version, layout.Version)
+	}
+	return nil
+}
+
+// createMonthSheet copies the Template to a new sheet with the display name (MM/YYYY) in A1, and makes it the current
+// sheet in Database!B2 when makeCurrent is set
+func createMonthSheet(ctx context.Context, svc services.IGSheets, spreadsheetId string, newSheetName string, displayName string, makeCurrent bool) (*SheetInfo, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
 
 	// Check if sheet already exists
-	exists, err := SheetExists(svc, spreadsheetId, newSheetName)
+	exists, err := SheetExists(ctx, svc, spreadsheetId, newSheetName)
 	if err != nil {
 		return nil, err
 	}
@@ -79,29 +169,25 @@ func CreateNewMonthSheet(newSheetName string, displayName string) (*SheetInfo, e
 	}
 
 	// Get the Template sheet ID
-	templateSheetId, err := GetSheetIdByName(svc, spreadsheetId, config.TemplateSheetName)
+	templateSheetId, err := GetSheetIdByName(ctx, svc, spreadsheetId, config.TemplateSheetName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find Template sheet: %w", err)
 	}
 
 	// Duplicate the Template sheet with the new name
-	newSheetProps, err := svc.DuplicateSheet(context.TODO(), spreadsheetId, templateSheetId, newSheetName)
+	newSheetProps, err := svc.DuplicateSheet(reqCtx, spreadsheetId, templateSheetId, newSheetName)
 	if err != nil {
-		logrus.Errorf("failed to duplicate sheet: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to duplicate sheet: %s", err.Error())
 		return nil, err
 	}
 
-	// Update cell A1 in the new sheet with the display name (MM/YYYY)
-	err = updateSheetCell(svc, spreadsheetId, newSheetName, "A1", displayName)
-	if err != nil {
-		logrus.Errorf("failed to update A1 cell: %s", err.Error())
-		return nil, err
+	updates := []*sheets.ValueRange{{Range: fmt.Sprintf("%s!A1", newSheetName), Values: [][]interface{}{{displayName}}}}
+	if makeCurrent {
+		updates = append(updates, &sheets.ValueRange{Range: config.CurrentSheetNameCell, Values: [][]interface{}{{newSheetName}}})
 	}
-
-	// Update Database!B2 with the new sheet name
-	err = updateCurrentSheetName(svc, spreadsheetId, newSheetName)
+	_, err = svc.BatchUpdate(reqCtx, spreadsheetId, updates...)
 	if err != nil {
-		logrus.Errorf("failed to update current sheet name: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to update the new sheet cells: %s", err.Error())
 		return nil, err
 	}
 
@@ -111,31 +197,36 @@ func CreateNewMonthSheet(newSheetName string, displayName string) (*SheetInfo, e
 	}, nil
 }
 
-// updateCurrentSheetName updates the Database!B2 cell with the new sheet name
-func updateCurrentSheetName(svc *services.GSheets, spreadsheetId string, sheetName string) error {
-	valueRange := &sheets.ValueRange{
-		Values: [][]interface{}{{sheetName}},
+// SetCurrentSheet makes an existing monthly sheet the current sheet in Database!B2
+func SetCurrentSheet(ctx context.Context, household models.Household, sheetName string) error {
+	if !household.IsLinked() {
+		return ErrHouseholdNotLinked
 	}
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
 
-	_, err := svc.Update(context.TODO(), spreadsheetId, config.CurrentSheetNameCell, valueRange)
+	svc, spreadsheetId := services.GetGSheetsSvc(), household.SpreadsheetID
+	exists, err := SheetExists(ctx, svc, spreadsheetId, sheetName)
 	if err != nil {
 		return err
 	}
-
-	return nil
-}
-
-// updateSheetCell updates a specific cell in a sheet
-func updateSheetCell(svc *services.GSheets, spreadsheetId string, sheetName string, cell string, value string) error {
-	cellRange := fmt.Sprintf("%s!%s", sheetName, cell)
-	valueRange := &sheets.ValueRange{
-		Values: [][]interface{}{{value}},
+	if !exists {
+		return fmt.Errorf("sheet '%s' does not exist", sheetName)
 	}
-
-	_, err := svc.Update(context.TODO(), spreadsheetId, cellRange, valueRange)
+	_, err = svc.Update(reqCtx, spreadsheetId, config.CurrentSheetNameCell, &sheets.ValueRange{Values: [][]interface{}{{sheetName}}})
 	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to update the current sheet: %s", err.Error())
 		return err
 	}
-
 	return nil
 }
+
+// CheckSheetsConnection checks that the spreadsheet can be read with the service account
+func CheckSheetsConnection(ctx context.Context) error {
+	return services.CheckConnection(ctx, config.GetAppConfig().GoogleSheets.SpreadsheetId)
+}
+
+// GetCacheStats returns the counters of the sheets cache, false when the cache is disabled
+func GetCacheStats() (services.CacheStats, bool) {
+	return services.GetCacheStats()
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	"housematee-tgbot/services/household"
+)
+
+const (
+	// householdKey is the ctx.Data key of the household of the update
+	householdKey = "household"
+	// contextKey is the ctx.Data key of the context of the update, which carries its correlation ID
+	contextKey = "context"
+)
+
+// ErrHouseholdNotLinked is returned by the reads and writes of a chat without a spreadsheet
+var ErrHouseholdNotLinked = errors.New("this chat is not linked to a spreadsheet, a bot admin can link it with /setup")
+
+// GetHousehold returns the household of a chat: the one linked with /setup, the one of
+// settings.households, or the google_sheets.spreadsheet_id for the allowed channels.
+// It returns false when the chat has none.
+func GetHousehold(chatId int64) (models.Household, bool) {
+	if h, ok := household.GetRegistry().Get(chatId); ok {
+		return h, true
+	}
+	appConfig := config.GetAppConfig()
+	for _, c := range appConfig.Settings.Households.Chats {
+		if c.ChatID == chatId {
+			return householdFromConfig(c), true
+		}
+	}
+	for _, id := range appConfig.Telegram.AllowedChannels {
+		if id == chatId {
+			return defaultHousehold(chatId), true
+		}
+	}
+	return models.Household{}, false
+}
+
+// SetContext makes c the context of the update, passed to the reads and writes of its handlers
+func SetContext(ctx *ext.Context, c context.Context) {
+	if ctx.Data == nil {
+		ctx.Data = make(map[string]interface{})
+	}
+	ctx.Data[contextKey] = c
+}
+
+// ContextOf returns the context of the update set by SetContext, or an empty one
+func ContextOf(ctx *ext.Context) context.Context {
+	if c, ok := ctx.Data[contextKey].(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// HouseholdOf returns the household of the chat of the update, resolved once per update.
+// A chat without a household gets one without a spreadsheet, so its reads fail with ErrHouseholdNotLinked.
+func HouseholdOf(ctx *ext.Context) models.Household {
+	if h, ok := ctx.Data[householdKey].(models.Household); ok {
+		return h
+	}
+	h, ok := GetHousehold(ctx.EffectiveChat.Id)
+	if !ok {
+		h = models.Household{ChatID: ctx.EffectiveChat.Id}
+	}
+	if ctx.Data == nil {
+		ctx.Data = make(map[string]interface{})
+	}
+	ctx.Data[householdKey] = h
+	return h
+}
+
+// GetHouseholds returns the household of every chat served by the bot, for the scheduled jobs
+func GetHouseholds() []models.Household {
+	households := household.GetRegistry().All()
+	seen := make(map[int64]bool, len(households))
+	for _, h := range households {
+		seen[h.ChatID] = true
+	}
+	appConfig := config.GetAppConfig()
+	for _, c := range appConfig.Settings.Households.Chats {
+		if !seen[c.ChatID] {
+			seen[c.ChatID] = true
+			households = append(households, householdFromConfig(c))
+		}
+	}
+	for _, id := range appConfig.Telegram.AllowedChannels {
+		if !seen[id] {
+			seen[id] = true
+			households = append(households, defaultHousehold(id))
+		}
+	}
+	return households
+}
+
+// LinkHousehold records the household of a chat, replacing the one it had
+func LinkHousehold(h models.Household) error {
+	return household.GetRegistry().Put(h)
+}
+
+func householdFromConfig(c config.HouseholdConfig) models.Household {
+	return models.Household{
+		ChatID:        c.ChatID,
+		Name:          c.Name,
+		SpreadsheetID: c.SpreadsheetId,
+		Timezone:      c.Timezone,
+	}
+}
+
+// defaultHousehold is the household of an allowed channel: the spreadsheet and timezone of the configuration
+func defaultHousehold(chatId int64) models.Household {
+	return models.Household{
+		ChatID:        chatId,
+		SpreadsheetID: config.GetAppConfig().GoogleSheets.SpreadsheetId,
+	}
+}
@@ -3,121 +3,172 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
 	"google.golang.org/api/sheets/v4"
+
 	"housematee-tgbot/config"
 	"housematee-tgbot/models"
 	services "housematee-tgbot/services/gsheets"
 	"housematee-tgbot/utilities"
 )
 
-func GetHouseworkMap() (houseworkMap map[int]models.Task, err error) {
+func GetHouseworkMap(ctx context.Context, household models.Household) (houseworkMap map[int]models.Task, err error) {
 	// get current sheet info
-	svc, spreadsheetId, _, err := GetCurrentSheetInfo()
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return
 	}
+	return getHouseworkMap(ctx, svc, spreadsheetId)
+}
 
-	// Get the number of tasks
-	numTasksValue, err := svc.GetValue(context.TODO(), spreadsheetId, config.NumberOfTasksReadRange)
+func getHouseworkMap(ctx context.Context, svc services.IGSheets, spreadsheetId string) (houseworkMap map[int]models.Task, err error) {
+	table, err := readTaskTable(ctx, svc, spreadsheetId)
 	if err != nil {
-		logrus.Errorf("failed to get number of tasks: %s", err.Error())
-		return
+		logrus.WithContext(ctx).Errorf("failed to get tasks: %s", err.Error())
+		return nil, err
 	}
 
-	numTasks := cast.ToInt(numTasksValue)
-
-	if numTasks == 0 {
-		return nil, nil
+	// convert the records to a map of tasks with key is the task id
+	houseworkMap = make(map[int]models.Task)
+	for _, record := range table.Records() {
+		housework := taskFromRecord(table, record)
+		houseworkMap[housework.ID] = housework
 	}
+	return houseworkMap, nil
+}
 
-	// Get the list of tasks
-	tasksReadRange := fmt.Sprintf("%s!%s%d:%s%d", config.SeparatedSheetTasksName, config.TaskStartCol, config.TaskStartRow, config.TaskEndCol, config.TaskStartRow+numTasks)
-	result, err := svc.Get(context.TODO(), spreadsheetId, tasksReadRange)
-	if err != nil {
-		logrus.Errorf("failed to get tasks: %s", err.Error())
-		return
+// readTaskTable reads the Tasks sheet from its header row; pass the uncached service before a write
+func readTaskTable(ctx context.Context, svc services.IGSheets, spreadsheetId string) (models.RecordTable, error) {
+	return readRecordTable(ctx, svc, spreadsheetId, config.SeparatedSheetTasksName,
+		config.TaskStartCol, config.TaskEndCol, config.TaskStartRow, taskHeaders)
+}
+
+// taskFromRecord reads a task from its row, by header
+func taskFromRecord(table models.RecordTable, record []any) models.Task {
+	value := func(header string) string {
+		return strings.TrimSpace(cast.ToString(table.Value(record, header)))
+	}
+	return models.Task{
+		ID:             cast.ToInt(value("ID")),
+		Name:           value("Name"),
+		Frequency:      cast.ToInt(value("Frequency")),
+		LastDone:       value("LastDone"),
+		NextDue:        value("NextDue"),
+		Assignee:       value("Assignee"),
+		TurnsRemaining: cast.ToInt(value("TurnsRemaining")),
+		ChannelId:      cast.ToInt64(value("ChannelId")),
+		Note:           value("Note"),
+		RequiresProof:  cast.ToBool(value("RequiresProof")),
+		HandoverFrom:   value("HandoverFrom"),
 	}
+}
 
-	// map result to the fixed length array (9 columns: ID, Name, Frequency, LastDone, NextDue, Assignee, TurnsRemaining, ChannelId, Note)
-	values := make([][9]string, numTasks)
-	for i := 1; i < len(result.Values); i++ {
-		for j := 0; j < len(result.Values[i]); j++ {
-			if j < 9 {
-				values[i-1][j] = cast.ToString(result.Values[i][j])
-			}
-		}
+// taskUpdates returns the ranges writing a task at its row, after the header cells of the optional columns the task
+// needs and the sheet does not have yet
+func taskUpdates(table *models.RecordTable, housework models.Task, row int) []*sheets.ValueRange {
+	values := map[string]any{
+		"ID":             housework.ID,
+		"Name":           housework.Name,
+		"Frequency":      housework.Frequency,
+		"LastDone":       housework.LastDone,
+		"NextDue":        housework.NextDue,
+		"Assignee":       housework.Assignee,
+		"TurnsRemaining": housework.TurnsRemaining,
+		"ChannelId":      housework.ChannelId,
+		"Note":           housework.Note,
+		"RequiresProof":  housework.RequiresProof,
+		"HandoverFrom":   housework.HandoverFrom,
 	}
 
-	// convert the result to a map of tasks with key is the task id
-	houseworkMap = make(map[int]models.Task)
-	for _, value := range values {
-		housework := models.Task{
-			ID:             cast.ToInt(value[0]),
-			Name:           value[1],
-			Frequency:      cast.ToInt(value[2]),
-			LastDone:       value[3],
-			NextDue:        value[4],
-			Assignee:       value[5],
-			TurnsRemaining: cast.ToInt(value[6]),
-			ChannelId:      cast.ToInt64(value[7]),
-			Note:           value[8],
+	var updates []*sheets.ValueRange
+	for _, header := range optionalTaskHeaders {
+		if table.Has(header) || reflect.ValueOf(values[header]).IsZero() {
+			continue
 		}
-		houseworkMap[housework.ID] = housework
+		col := columnAfter(config.TaskStartCol, table.AddColumn(header))
+		updates = append(updates, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!%s%d", config.SeparatedSheetTasksName, col, config.TaskStartRow),
+			Values: [][]interface{}{{header}},
+		})
 	}
-	return houseworkMap, nil
+	return append(updates, &sheets.ValueRange{
+		Range:  fmt.Sprintf("%s!%s%d:%s%d", config.SeparatedSheetTasksName, config.TaskStartCol, row, config.TaskEndCol, row),
+		Values: [][]interface{}{table.Row(values)},
+	})
 }
 
-func UpdateHousework(svc *services.GSheets, spreadsheetId string, currentSheetName string, housework models.Task, numberOfTask int) error {
-	// if the housework has id, update it
-	if housework.ID == 0 {
-		return fmt.Errorf("housework id is not set")
+// UpdateHouseworks writes several tasks in one request, so either all of them change or none
+func UpdateHouseworks(ctx context.Context, svc services.IGSheets, spreadsheetId string, houseworks ...models.Task) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	// Check past the cache that task n is still n rows below the header before writing over it
+	records, err := readTaskTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return err
 	}
 
-	// update the housework
-	writeRow := config.TaskStartRow + housework.ID
-	houseworkWriteRange := fmt.Sprintf("%s!%s%d:%s%d", config.SeparatedSheetTasksName, config.TaskStartCol, writeRow, config.TaskEndCol, writeRow)
-	houseworkValues := [][]interface{}{
-		{
-			housework.ID,
-			housework.Name,
-			housework.Frequency,
-			housework.LastDone,
-			housework.NextDue,
-			housework.Assignee,
-			housework.TurnsRemaining,
-			housework.ChannelId,
-			housework.Note,
-		},
+	var updates []*sheets.ValueRange
+	for _, housework := range houseworks {
+		// if the housework has id, update it
+		if housework.ID == 0 {
+			return fmt.Errorf("housework id is not set")
+		}
+		writeRow, err := records.WriteRow(housework.ID)
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("refused to update housework %d: %s", housework.ID, err.Error())
+			return err
+		}
+		// the headers of the optional columns a task needs are written in the same request
+		updates = append(updates, taskUpdates(&records, housework, writeRow)...)
 	}
-	_, err := svc.Update(context.TODO(), spreadsheetId, houseworkWriteRange, &sheets.ValueRange{
-		Values: houseworkValues,
-	})
 
+	_, err = svc.BatchUpdate(reqCtx, spreadsheetId, updates...)
 	if err != nil {
-		logrus.Errorf("failed to update housework: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to update housework: %s", err.Error())
 		return err
 	}
 	return nil
 }
 
-func ConvertHouseworkToMarkdownFormat(housework models.Task) string {
+// NextAssignee returns the reference of the member after the current assignee (round-robin over the members list).
+// It returns an empty string when the current assignee is not a member.
+func NextAssignee(members []models.Member, currentAssignee string) string {
+	for i, member := range members {
+		if models.SameMember(members, member.Ref(), currentAssignee) {
+			return members[(i+1)%len(members)].Ref()
+		}
+	}
+	return ""
+}
+
+func ConvertHouseworkToMarkdownFormat(housework models.Task, members []models.Member, loc *time.Location) string {
 	frequency := fmt.Sprintf("%d days", housework.Frequency)
 	note := fmt.Sprintf("_%s_", housework.Note)
 	// if the next due is today, add an emoji
 	nextDue := housework.NextDue
-	if housework.NextDue == utilities.GetCurrentDate() {
+	if housework.NextDue == utilities.GetCurrentDate(loc) {
 		nextDue = fmt.Sprintf("*%s >> Today*", housework.NextDue)
 	}
 
+	proof := "not required"
+	if housework.RequiresProof {
+		proof = "photo + approval"
+	}
+
 	return fmt.Sprintf(
-		"*Name*: %s\n*Frequency*: %s\n*Last done*: %s\n*Next due*: %s\n*Assignee*: %s\n*Note*: %s",
+		"*Name*: %s\n*Frequency*: %s\n*Last done*: %s\n*Next due*: %s\n*Assignee*: %s\n*Proof*: %s\n*Note*: %s",
 		housework.Name,
 		frequency,
 		housework.LastDone,
 		nextDue,
-		housework.Assignee,
+		models.DisplayRef(members, housework.Assignee),
+		proof,
 		note,
 	)
 }
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"housematee-tgbot/models"
+)
+
+func TestTaskRecordsWithoutOptionalColumns(t *testing.T) {
+	// A Tasks sheet from before RequiresProof, with Note and Name swapped
+	values := [][]any{
+		{"ID", "Note", "Frequency", "LastDone", "NextDue", "Assignee", "TurnsRemaining", "ChannelId", "Name"},
+		{"1", "kitchen", "7", "01/10/2026", "08/10/2026", "@alice", "1", "-100", "Dishes"},
+	}
+	table, err := models.NewRecordTable(values, 2, taskHeaders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := taskFromRecord(table, table.Records()[0])
+	want := models.Task{ID: 1, Name: "Dishes", Frequency: 7, LastDone: "01/10/2026", NextDue: "08/10/2026", Assignee: "@alice",
+		TurnsRemaining: 1, ChannelId: -100, Note: "kitchen"}
+	if task != want {
+		t.Errorf("task = %+v, want %+v", task, want)
+	}
+
+	if updates := taskUpdates(&table, task, 3); len(updates) != 1 || updates[0].Range != "Tasks!A3:K3" {
+		t.Errorf("a task without proof must not add the column, got %+v", updates)
+	}
+
+	task.RequiresProof = true
+	updates := taskUpdates(&table, task, 3)
+	if len(updates) != 2 || updates[0].Range != "Tasks!J2" || !reflect.DeepEqual(updates[0].Values, [][]interface{}{{"RequiresProof"}}) {
+		t.Fatalf("the RequiresProof header must be added first, got %+v", updates)
+	}
+	if row := updates[1].Values[0]; len(row) != 10 || row[9] != true || row[8] != "Dishes" {
+		t.Errorf("row = %v", row)
+	}
+
+	// RequiresProof was added above, a handover adds the column after it
+	task.HandoverFrom = "@bob"
+	updates = taskUpdates(&table, task, 3)
+	if len(updates) != 2 || updates[0].Range != "Tasks!K2" {
+		t.Fatalf("the HandoverFrom header must be added, got %+v", updates)
+	}
+	if row := updates[1].Values[0]; len(row) != 11 || row[10] != "@bob" {
+		t.Errorf("row = %v", row)
+	}
+}
+
+func TestRotationAssigneeAfterHandover(t *testing.T) {
+	members := []models.Member{{Username: "@alice"}, {Username: "@bob"}, {Username: "@carol"}}
+	// @bob took over the turn of @alice: the next turn is @bob's own, not @carol's
+	task := models.Task{Assignee: "@bob", HandoverFrom: "@alice"}
+	if next := NextAssignee(members, task.RotationAssignee()); next != "@bob" {
+		t.Errorf("next assignee = %s, want @bob", next)
+	}
+	task.HandoverFrom = ""
+	if next := NextAssignee(members, task.RotationAssignee()); next != "@carol" {
+		t.Errorf("next assignee without handover = %s, want @carol", next)
+	}
+}
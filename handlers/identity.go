@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+)
+
+// monthSheetNamePattern matches the monthly sheet names, e.g., 2023_09
+var monthSheetNamePattern = regexp.MustCompile(`^\d{4}_\d{2}$`)
+
+// GetCurrentMembers returns the members of the current sheet
+func GetCurrentMembers(ctx context.Context, household models.Household) ([]models.Member, error) {
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return nil, err
+	}
+	return GetMembers(ctx, svc, spreadsheetId, currentSheetName)
+}
+
+// ErrNotMember is returned instead of the reference of a Telegram user who has no member row
+var ErrNotMember = errors.New("you are not a member of this house yet, an admin can add you with /members add")
+
+// GetActorRef returns the reference stored in records for a Telegram user, found by user ID or by username.
+// Users who are not members get ErrNotMember: their user ID or name would match no member in the balance formulas.
+func GetActorRef(members []models.Member, userId int64, username string) (string, error) {
+	if m := models.FindMemberByRef(members, models.UserRef(userId)); m != nil {
+		return m.Ref(), nil
+	}
+	if username != "" {
+		if m := models.FindMemberByRef(members, "@"+username); m != nil {
+			return m.Ref(), nil
+		}
+	}
+	return "", ErrNotMember
+}
+
+// memberRefsByUserID reports whether the records of the spreadsheet reference members by Telegram user ID
+func memberRefsByUserID(ctx context.Context, svc services.IGSheets, spreadsheetId string) (bool, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	value, err := svc.GetValue(reqCtx, spreadsheetId, config.MemberRefsCell)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get the member references mode: %s", err.Error())
+		return false, err
+	}
+	return strings.TrimSpace(value) == config.MemberRefsByUserID, nil
+}
+
+// MemberRefMigrationResult counts the cells rewritten by MigrateMemberRefs
+type MemberRefMigrationResult struct {
+	Expenses    int
+	RentPayers  int
+	Tasks       int
+	TaskHistory int
+	// Linked counts the member rows of the other sheets given the Telegram user ID of the member of the current sheet
+	Linked int
+	// Sheets are the sheets whose Balances formulas now match user IDs
+	Sheets []string
+	// Skipped are the monthly sheets left on @usernames, as some of their members are not in the current sheet
+	Skipped []string
+}
+
+// Total returns the number of rewritten cells
+func (r MemberRefMigrationResult) Total() int {
+	return r.Expenses + r.RentPayers + r.Tasks + r.TaskHistory
+}
+
+// MigrateMemberRefs switches the spreadsheet to Telegram user ID references, so each member column holds one kind of
+// value. It refuses while a member of the current sheet is not linked. Then it links the member rows of the Template
+// and the monthly sheets by username, rewrites the @username values of the expense, task and task history sheets,
+// marks the spreadsheet in Database!B8 and writes the Balances formulas keyed on the user ID column of the members.
+// Monthly sheets with members who are not in the current sheet any more keep their @usernames and formulas.
+// It is safe to run again, for example when the formulas could not be written.
+func MigrateMemberRefs(ctx context.Context, household models.Household) (MemberRefMigrationResult, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	var result MemberRefMigrationResult
+
+	_, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return result, err
+	}
+	svc := services.GetUncachedGSheetsSvc()
+	members, err := GetMembers(ctx, svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return result, err
+	}
+	if unlinked := unlinkedMembers(members); len(unlinked) > 0 {
+		return result, fmt.Errorf("every member needs a Telegram user ID first, link %s with /members link", strings.Join(unlinked, ", "))
+	}
+	for i := range members {
+		members[i].RefByUserID = true
+	}
+
+	spreadsheet, err := svc.GetSpreadsheet(reqCtx, spreadsheetId)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get spreadsheet: %s", err.Error())
+		return result, err
+	}
+	sheetNames := []string{config.TemplateSheetName}
+	for _, sheet := range spreadsheet.Sheets {
+		if monthSheetNamePattern.MatchString(sheet.Properties.Title) {
+			sheetNames = append(sheetNames, sheet.Properties.Title)
+		}
+	}
+
+	// Collect the changed ranges first and write them in one batch, so the migration is all or nothing
+	var changes, formulas []*sheets.ValueRange
+	for _, sheetName := range sheetNames {
+		sheetMembers, err := GetMembers(ctx, svc, spreadsheetId, sheetName)
+		if err != nil {
+			return result, err
+		}
+		linked, count, ok := linkMembers(sheetMembers, members)
+		if !ok {
+			if sheetName == currentSheetName || sheetName == config.TemplateSheetName {
+				return result, fmt.Errorf("%s has members who are not in %s, update its members with /members first", sheetName, currentSheetName)
+			}
+			result.Skipped = append(result.Skipped, sheetName)
+			continue
+		}
+		if count > 0 {
+			changes = append(changes, memberUpdates(sheetName, linked, 0)...)
+			result.Linked += count
+		}
+		if sheetName != config.TemplateSheetName {
+			sheetChanges, expenses, rentPayers, err := migrateExpenseSheetRefs(ctx, svc, spreadsheetId, sheetName, linked)
+			if err != nil {
+				return result, err
+			}
+			changes = append(changes, sheetChanges...)
+			result.Expenses += expenses
+			result.RentPayers += rentPayers
+		}
+		formulas = append(formulas, balanceFormulaUpdate(sheetName, len(linked), 0, true))
+		result.Sheets = append(result.Sheets, sheetName)
+	}
+
+	// Tasks: Assignee and HandoverFrom, found by header like the readers
+	change, count, err := migrateTaskRefs(ctx, svc, spreadsheetId, members)
+	if err != nil {
+		return result, err
+	}
+	changes = appendChange(changes, change)
+	result.Tasks = count
+
+	// TaskHistory: Doer (E), Assignee (F)
+	historyRange := fmt.Sprintf("%s!E%d:F", config.SeparatedSheetTaskHistoryName, config.TaskHistoryStartRow)
+	change, count, err = migrateColumnRefs(ctx, svc, spreadsheetId, historyRange, members)
+	if err != nil {
+		return result, err
+	}
+	changes = appendChange(changes, change)
+	result.TaskHistory = count
+
+	changes = append(changes, &sheets.ValueRange{
+		Range:  config.MemberRefsRange,
+		Values: [][]interface{}{{"Member references", config.MemberRefsByUserID}},
+	})
+	if err := writeMigratedRefs(ctx, services.GetGSheetsSvc(), spreadsheetId, changes); err != nil {
+		return MemberRefMigrationResult{}, err
+	}
+	if _, err := services.GetGSheetsSvc().BatchUpdateFormulas(reqCtx, spreadsheetId, formulas...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to write the balance formulas: %s", err.Error())
+		return result, fmt.Errorf("the member references were migrated but the Balances formulas were not written, run the migration again: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"expenses":     result.Expenses,
+		"rent_payers":  result.RentPayers,
+		"tasks":        result.Tasks,
+		"task_history": result.TaskHistory,
+		"linked":       result.Linked,
+		"sheets":       strings.Join(result.Sheets, ","),
+		"skipped":      strings.Join(result.Skipped, ","),
+	}).Info("member references migrated")
+
+	return result, nil
+}
+
+// unlinkedMembers returns the usernames of the members without a Telegram user ID
+func unlinkedMembers(members []models.Member) []string {
+	unlinked := make([]string, 0)
+	for _, m := range members {
+		if m.UserID == 0 {
+			unlinked = append(unlinked, m.Username)
+		}
+	}
+	return unlinked
+}
+
+// linkMembers gives the member rows of a sheet the Telegram user ID of the current member with the same username and
+// references them by user ID. It returns the number of rows it linked, and false when a row cannot be linked.
+func linkMembers(sheetMembers []models.Member, current []models.Member) ([]models.Member, int, bool) {
+	linked := make([]models.Member, len(sheetMembers))
+	count := 0
+	for i, m := range sheetMembers {
+		if m.UserID == 0 {
+			found := FindMember(current, m.Username)
+			if found == nil {
+				return nil, 0, false
+			}
+			m.UserID = found.UserID
+			count++
+		}
+		m.RefByUserID = true
+		linked[i] = m
+	}
+	return linked, count, true
+}
+
+// migrateExpenseSheetRefs migrates the Payer (E) and Participants (F) of the expenses and the rent payer of a monthly sheet
+func migrateExpenseSheetRefs(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, members []models.Member) ([]*sheets.ValueRange, int, int, error) {
+	var changes []*sheets.ValueRange
+	layout := config.GetSheetLayout(sheetName)
+	nextExpenseId := cast.ToInt(getValueOrEmpty(ctx, svc, spreadsheetId, layout.NextExpenseID.In(sheetName)))
+	expenses := 0
+	if nextExpenseId > 1 {
+		// Payer and Participants are the 5th and 6th columns of the expenses
+		payerCol := columnAfter(layout.Expenses.StartCol, 4)
+		expensesRange := fmt.Sprintf("%s!%s%d:%s%d", sheetName, payerCol, layout.Expenses.FirstRow(), columnAfter(payerCol, 1), layout.Expenses.HeaderRow+nextExpenseId-1)
+		change, count, err := migrateColumnRefs(ctx, svc, spreadsheetId, expensesRange, members)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		changes = appendChange(changes, change)
+		expenses = count
+	}
+
+	if !layout.HasRent() {
+		return changes, expenses, 0, nil
+	}
+	change, rentPayers, err := migrateColumnRefs(ctx, svc, spreadsheetId, layout.RentPayer.In(sheetName), members)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return appendChange(changes, change), expenses, rentPayers, nil
+}
+
+// appendChange adds the range to write when there is one
+func appendChange(changes []*sheets.ValueRange, change *sheets.ValueRange) []*sheets.ValueRange {
+	if change == nil {
+		return changes
+	}
+	return append(changes, change)
+}
+
+// writeMigratedRefs writes the migrated ranges in one batch
+func writeMigratedRefs(ctx context.Context, svc services.IGSheets, spreadsheetId string, changes []*sheets.ValueRange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, changes...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to write migrated member references: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// migrateTaskRefs rewrites the member values of the Tasks sheet under their headers. It returns the range to write
+// back, nil when nothing changed, and the number of changed values.
+func migrateTaskRefs(ctx context.Context, svc services.IGSheets, spreadsheetId string, members []models.Member) (*sheets.ValueRange, int, error) {
+	table, err := readTaskTable(ctx, svc, spreadsheetId)
+	if err != nil {
+		return nil, 0, err
+	}
+	values, changed := table.Rewrite([]string{"Assignee", "HandoverFrom"}, func(value string) string {
+		return migrateRefList(members, value)
+	})
+	if changed == 0 {
+		return nil, 0, nil
+	}
+	writeRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetTasksName, config.TaskStartCol, config.TaskStartRow+1, config.TaskEndCol)
+	return &sheets.ValueRange{Range: writeRange, Values: values}, changed, nil
+}
+
+// migrateColumnRefs rewrites every member value of a range, including comma separated lists.
+// It returns the range to write back, nil when nothing changed, and the number of changed values.
+func migrateColumnRefs(ctx context.Context, svc services.IGSheets, spreadsheetId string, readRange string, members []models.Member) (*sheets.ValueRange, int, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	resp, err := svc.Get(reqCtx, spreadsheetId, readRange)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to read %s: %s", readRange, err.Error())
+		return nil, 0, err
+	}
+
+	changed := 0
+	width := 0
+	for _, row := range resp.Values {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	values := make([][]interface{}, len(resp.Values))
+	for i, row := range resp.Values {
+		values[i] = make([]interface{}, width)
+		for j := range values[i] {
+			if j >= len(row) {
+				values[i][j] = ""
+				continue
+			}
+			value := cast.ToString(row[j])
+			migrated := migrateRefList(members, value)
+			if migrated != value {
+				changed++
+			}
+			values[i][j] = migrated
+		}
+	}
+	if changed == 0 {
+		return nil, 0, nil
+	}
+
+	writeRange := readRange
+	if resp.Range != "" {
+		writeRange = resp.Range
+	}
+	return &sheets.ValueRange{Range: writeRange, Values: values}, changed, nil
+}
+
+// migrateRefList converts the @usernames of a single value or comma separated list to member references
+func migrateRefList(members []models.Member, value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		parts[i] = models.NormalizeRef(members, strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+func getValueOrEmpty(ctx context.Context, svc services.IGSheets, spreadsheetId string, readRange string) string {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	value, err := svc.GetValue(reqCtx, spreadsheetId, readRange)
+	if err != nil {
+		logrus.WithContext(ctx).Warnf("failed to read %s: %s", readRange, err.Error())
+		return ""
+	}
+	return value
+}
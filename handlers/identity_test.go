@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"housematee-tgbot/models"
+)
+
+func TestGetActorRef(t *testing.T) {
+	members := []models.Member{
+		{ID: 1, Username: "@alice", UserID: 111, RefByUserID: true},
+		{ID: 2, Username: "@bob", UserID: 222, RefByUserID: true},
+	}
+
+	tests := []struct {
+		name     string
+		userId   int64
+		username string
+		want     string
+		wantErr  error
+	}{
+		{name: "by user ID", userId: 111, want: "111"},
+		{name: "by username after a new account", userId: 999, username: "bob", want: "222"},
+		{name: "not a member", userId: 333, username: "carol", wantErr: ErrNotMember},
+		{name: "not a member without username", userId: 333, wantErr: ErrNotMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetActorRef(members, tt.userId, tt.username)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetActorRef() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	// Before /members migrate, linked members are still referenced by username
+	members[0].RefByUserID = false
+	if got, err := GetActorRef(members, 111, ""); got != "@alice" || err != nil {
+		t.Errorf("GetActorRef() = %q, %v, want the username", got, err)
+	}
+}
+
+func TestLinkMembers(t *testing.T) {
+	current := []models.Member{
+		{ID: 1, Username: "@alice", UserID: 111},
+		{ID: 2, Username: "@bob", UserID: 222},
+	}
+
+	// An older sheet where @bob was not linked yet
+	linked, count, ok := linkMembers([]models.Member{
+		{ID: 1, Username: "@alice", UserID: 111},
+		{ID: 2, Username: "@Bob"},
+	}, current)
+	want := []models.Member{
+		{ID: 1, Username: "@alice", UserID: 111, RefByUserID: true},
+		{ID: 2, Username: "@Bob", UserID: 222, RefByUserID: true},
+	}
+	if !ok || count != 1 || !reflect.DeepEqual(linked, want) {
+		t.Errorf("linkMembers() = %+v, %d, %v", linked, count, ok)
+	}
+
+	// A member who left cannot be linked, the sheet keeps its usernames
+	if _, _, ok := linkMembers([]models.Member{{ID: 1, Username: "@carol"}}, current); ok {
+		t.Error("a member who is not in the current sheet must not be linked")
+	}
+
+	if unlinked := unlinkedMembers(append(current, models.Member{Username: "@carol"})); !reflect.DeepEqual(unlinked, []string{"@carol"}) {
+		t.Errorf("unlinkedMembers() = %v", unlinked)
+	}
+}
+
+func TestAddMemberNeedsAUserIDOnceMigrated(t *testing.T) {
+	members := []models.Member{{ID: 1, Username: "@alice", Weight: 1, UserID: 111, RefByUserID: true}}
+	if _, _, err := addMember(members, models.Member{Username: "@bob", Weight: 1, RefByUserID: true}, "Template"); err == nil {
+		t.Error("a member without a Telegram user would match no Balances line")
+	}
+	if _, _, err := addMember(members, models.Member{Username: "@bob", Weight: 1, UserID: 222, RefByUserID: true}, "Template"); err != nil {
+		t.Errorf("addMember() = %v", err)
+	}
+}
@@ -3,21 +3,27 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"strings"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
 	"housematee-tgbot/config"
 	"housematee-tgbot/models"
 	services "housematee-tgbot/services/gsheets"
 )
 
-func GetNumberOfMembers(svc *services.GSheets, spreadsheetId string, currentSheetName string) (int, error) {
+func GetNumberOfMembers(ctx context.Context, svc services.IGSheets, spreadsheetId string, currentSheetName string) (int, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
 	// get number of members read range
-	numberOfMembersReadRange := currentSheetName + "!" + config.NumberOfMembersCell
+	numberOfMembersReadRange := config.GetSheetLayout(currentSheetName).MembersCount.In(currentSheetName)
 
 	// get number of members data
-	numberOfMembersValue, err := svc.GetValue(context.TODO(), spreadsheetId, numberOfMembersReadRange)
+	numberOfMembersValue, err := svc.GetValue(reqCtx, spreadsheetId, numberOfMembersReadRange)
 	if err != nil {
-		logrus.Errorf("failed to get number of members data: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get number of members data: %s", err.Error())
 		return 0, err
 	}
 
@@ -27,51 +33,370 @@ func GetNumberOfMembers(svc *services.GSheets, spreadsheetId string, currentShee
 }
 
 // GetMembers gets the list of members from the spreadsheet
-// Columns: O = ID, P = Username, Q = Weight
-func GetMembers(svc *services.GSheets, spreadsheetId string, currentSheetName string) ([]models.Member, error) {
+// Columns: ID, Username, Weight, Telegram user ID, Display name (O:S in the default layout)
+func GetMembers(ctx context.Context, svc services.IGSheets, spreadsheetId string, currentSheetName string) ([]models.Member, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
 	// get number of members
-	numberOfMembers, err := GetNumberOfMembers(svc, spreadsheetId, currentSheetName)
+	numberOfMembers, err := GetNumberOfMembers(ctx, svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return nil, err
+	}
+	if numberOfMembers == 0 {
+		return []models.Member{}, nil
+	}
+	refByUserID, err := memberRefsByUserID(ctx, svc, spreadsheetId)
 	if err != nil {
 		return nil, err
 	}
 
-	// get members read range (O:Q, starting from row 4, row 3 is header)
-	membersReadRange := fmt.Sprintf("%s!%s%d:%s%d", currentSheetName, config.MembersStartCol, config.MembersStartRow, config.MembersEndCol, config.MembersStartRow+numberOfMembers-1)
-	logrus.Debugf("reading members from range: %s", membersReadRange)
+	// get members read range, the rows below the header
+	table := config.GetSheetLayout(currentSheetName).Members
+	membersReadRange := table.Rows(currentSheetName, table.FirstRow(), table.HeaderRow+numberOfMembers)
+	logrus.WithContext(ctx).Debugf("reading members from range: %s", membersReadRange)
 
-	membersResult, err := svc.Get(context.Background(), spreadsheetId, membersReadRange)
+	membersResult, err := svc.Get(reqCtx, spreadsheetId, membersReadRange)
 	if err != nil {
-		logrus.Errorf("failed to get members: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get members: %s", err.Error())
 		return nil, err
 	}
 
 	// convert the result to a slice of members
-	// Column O = ID, Column P = Username, Column Q = Weight
 	members := make([]models.Member, 0, numberOfMembers)
 	for _, row := range membersResult.Values {
 		if len(row) < 2 {
 			continue
 		}
-		id := cast.ToInt(row[0])
-		username := cast.ToString(row[1])
-		weight := 1 // default weight
-		if len(row) >= 3 {
-			weight = cast.ToInt(row[2])
-			if weight == 0 {
-				weight = 1
-			}
+		// map row to the fixed length array (5 columns: ID, Username, Weight, UserID, DisplayName)
+		var value [5]string
+		for j := 0; j < len(row) && j < 5; j++ {
+			value[j] = cast.ToString(row[j])
 		}
 		member := models.Member{
-			ID:       id,
-			Username: username,
-			Weight:   weight,
+			ID:          cast.ToInt(value[0]),
+			Username:    value[1],
+			Weight:      1, // default weight when the cell is empty
+			UserID:      cast.ToInt64(value[3]),
+			DisplayName: value[4],
+			RefByUserID: refByUserID,
+		}
+		if value[2] != "" {
+			member.Weight = cast.ToInt(value[2])
+			if member.Weight <= 0 {
+				logrus.WithContext(ctx).Warnf("member %s has invalid weight %q, using 1", member.Username, value[2])
+				member.Weight = 1
+			}
 		}
 		members = append(members, member)
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"members": members,
 	}).Debug("loaded members with weights")
 
 	return members, nil
 }
+
+// FindMember returns the member with the given username (case-insensitive), or nil
+func FindMember(members []models.Member, username string) *models.Member {
+	for i := range members {
+		if strings.EqualFold(members[i].Username, username) {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// ValidateMember checks the username format and weight of a member
+func ValidateMember(member models.Member) error {
+	if !strings.HasPrefix(member.Username, "@") || len(member.Username) < 2 || strings.ContainsAny(member.Username, " \t") {
+		return fmt.Errorf("username must look like @username")
+	}
+	if member.Weight <= 0 {
+		return fmt.Errorf("weight must be a positive number")
+	}
+	return nil
+}
+
+// AddMember appends a member to the members section of the sheets and increments their member count, in one batch.
+// It returns the member as added to the first sheet.
+func AddMember(ctx context.Context, household models.Household, sheetNames []string, member models.Member) (*models.Member, error) {
+	var added *models.Member
+	err := changeMembers(ctx, household, sheetNames, func(sheetName string, members []models.Member, refByUserID bool) ([]models.Member, int, error) {
+		member.RefByUserID = refByUserID
+		members, m, err := addMember(members, member, sheetName)
+		if err != nil {
+			return nil, 0, err
+		}
+		if added == nil {
+			added = &m
+		}
+		return members, len(members) - 1, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"sheets":  strings.Join(sheetNames, ","),
+		"member":  member.Username,
+		"weight":  member.Weight,
+		"user_id": member.UserID,
+	}).Info("member added")
+
+	return added, nil
+}
+
+// RemoveMember removes a member from the members section of the sheets, shifting the following rows up, in one batch
+func RemoveMember(ctx context.Context, household models.Household, sheetNames []string, username string) error {
+	err := changeMembers(ctx, household, sheetNames, func(sheetName string, members []models.Member, _ bool) ([]models.Member, int, error) {
+		return removeMember(members, username, sheetName)
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"sheets": strings.Join(sheetNames, ","),
+		"member": username,
+	}).Info("member removed")
+
+	return nil
+}
+
+// UpdateMember applies fn to the member with the given username in every sheet and writes the rows back in one batch.
+// It returns the member as updated in the first sheet.
+func UpdateMember(ctx context.Context, household models.Household, sheetNames []string, username string, fn func(member *models.Member) error) (*models.Member, error) {
+	var updated *models.Member
+	err := changeMembers(ctx, household, sheetNames, func(sheetName string, members []models.Member, _ bool) ([]models.Member, int, error) {
+		members, index, err := updateMember(members, username, sheetName, fn)
+		if err != nil {
+			return nil, 0, err
+		}
+		if updated == nil {
+			updated = &members[index]
+		}
+		return members, index, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// changeMembers applies change to the members of every sheet, then writes the rows from the index it returns and the
+// member counts of all the sheets in one batch. A change refused on one sheet is written to none of them.
+// Adding or removing a member clears the rent shares of the sheet, which were split between the previous members,
+// and the Balances lines follow the member rows.
+func changeMembers(ctx context.Context, household models.Household, sheetNames []string, change func(sheetName string, members []models.Member, refByUserID bool) ([]models.Member, int, error)) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return err
+	}
+
+	refByUserID, err := memberRefsByUserID(ctx, svc, spreadsheetId)
+	if err != nil {
+		return err
+	}
+
+	updates := make([]*sheets.ValueRange, 0, 2*len(sheetNames))
+	formulas := make([]*sheets.ValueRange, 0, len(sheetNames))
+	for _, sheetName := range sheetNames {
+		previous, err := GetMembers(ctx, svc, spreadsheetId, sheetName)
+		if err != nil {
+			return err
+		}
+		members, fromIndex, err := change(sheetName, previous, refByUserID)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, memberUpdates(sheetName, members, fromIndex)...)
+		if len(members) != len(previous) && config.GetSheetLayout(sheetName).HasRentShares() {
+			updates = append(updates, rentSharesUpdate(sheetName, nil, max(len(members), len(previous))))
+		}
+		formulas = append(formulas, balanceFormulaUpdate(sheetName, len(members), fromIndex, refByUserID))
+	}
+
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, updates...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to write members of %s: %s", strings.Join(sheetNames, ", "), err.Error())
+		return err
+	}
+	if _, err := svc.BatchUpdateFormulas(reqCtx, spreadsheetId, formulas...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to write the balance formulas of %s: %s", strings.Join(sheetNames, ", "), err.Error())
+		return fmt.Errorf("the members were saved but not their Balances formulas, the next member change or /rent writes them: %w", err)
+	}
+	return nil
+}
+
+// addMember validates the member, checks that its username and Telegram user are not in the sheet yet and appends it
+// with the next ID
+func addMember(members []models.Member, member models.Member, sheetName string) ([]models.Member, models.Member, error) {
+	if err := ValidateMember(member); err != nil {
+		return nil, member, err
+	}
+	// Records reference members by user ID, a member without one would match no Balances line
+	if member.RefByUserID && member.UserID == 0 {
+		return nil, member, fmt.Errorf("reply to a message of %s to add them with their Telegram account", member.Username)
+	}
+	if existing := FindMember(members, member.Username); existing != nil {
+		return nil, member, fmt.Errorf("member %s already exists in %s", existing.Username, sheetName)
+	}
+	for _, m := range members {
+		if member.UserID != 0 && m.UserID == member.UserID {
+			return nil, member, fmt.Errorf("telegram user is already linked to %s in %s", m.Username, sheetName)
+		}
+	}
+
+	// IDs stay stable, the new member gets the next one
+	member.ID = 1
+	for _, m := range members {
+		if m.ID >= member.ID {
+			member.ID = m.ID + 1
+		}
+	}
+	return append(members[:len(members):len(members)], member), member, nil
+}
+
+// removeMember returns the members without the one with the username and the index it had
+func removeMember(members []models.Member, username string, sheetName string) ([]models.Member, int, error) {
+	for i, m := range members {
+		if strings.EqualFold(m.Username, username) {
+			return append(members[:i:i], members[i+1:]...), i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("member %s not found in %s", username, sheetName)
+}
+
+// updateMember applies fn to a copy of the members and validates the result, returning the index of the member
+func updateMember(members []models.Member, username string, sheetName string, fn func(member *models.Member) error) ([]models.Member, int, error) {
+	members = append([]models.Member(nil), members...)
+	for i := range members {
+		if !strings.EqualFold(members[i].Username, username) {
+			continue
+		}
+		if err := fn(&members[i]); err != nil {
+			return nil, 0, err
+		}
+		if err := ValidateMember(members[i]); err != nil {
+			return nil, 0, err
+		}
+		for j, m := range members {
+			if j == i {
+				continue
+			}
+			if strings.EqualFold(m.Username, members[i].Username) {
+				return nil, 0, fmt.Errorf("member %s already exists in %s", m.Username, sheetName)
+			}
+			if members[i].UserID != 0 && m.UserID == members[i].UserID {
+				return nil, 0, fmt.Errorf("telegram user is already linked to %s in %s", m.Username, sheetName)
+			}
+		}
+		return members, i, nil
+	}
+	return nil, 0, fmt.Errorf("member %s not found in %s", username, sheetName)
+}
+
+// SyncMemberIdentity links a Telegram user to their member row in the current sheet.
+// A row that is already linked gets its username updated when the account was renamed;
+// otherwise an unlinked row with the same username is linked to the user ID.
+func SyncMemberIdentity(ctx context.Context, household models.Household, userId int64, username string) error {
+	if userId == 0 || username == "" {
+		return nil
+	}
+
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return err
+	}
+	members, err := GetMembers(ctx, svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if m.UserID == userId {
+			if m.Username == username {
+				return nil
+			}
+			_, err := UpdateMember(ctx, household, []string{currentSheetName}, m.Username, func(member *models.Member) error {
+				member.Username = username
+				return nil
+			})
+			if err == nil {
+				logrus.WithContext(ctx).WithFields(logrus.Fields{
+					"user_id":      userId,
+					"old_username": m.Username,
+					"new_username": username,
+				}).Info("member username updated after rename")
+			}
+			return err
+		}
+	}
+
+	if m := FindMember(members, username); m != nil && m.UserID == 0 {
+		_, err := UpdateMember(ctx, household, []string{currentSheetName}, m.Username, func(member *models.Member) error {
+			member.UserID = userId
+			return nil
+		})
+		if err == nil {
+			logrus.WithContext(ctx).WithFields(logrus.Fields{
+				"user_id":  userId,
+				"username": username,
+			}).Info("member linked to telegram user")
+		}
+		return err
+	}
+	return nil
+}
+
+// writeMembers writes the member rows starting at index fromIndex and updates the member count in one batch
+func writeMembers(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, members []models.Member, fromIndex int) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, memberUpdates(sheetName, members, fromIndex)...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to write members: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// memberUpdates writes the member rows starting at index fromIndex and the member count of a sheet.
+// The row after the last member is cleared, as it is left over when a member was removed.
+func memberUpdates(sheetName string, members []models.Member, fromIndex int) []*sheets.ValueRange {
+	values := make([][]interface{}, 0, len(members)-fromIndex+1)
+	for _, m := range members[fromIndex:] {
+		values = append(values, memberToRow(m))
+	}
+	values = append(values, []interface{}{"", "", "", "", ""})
+	layout := config.GetSheetLayout(sheetName)
+	startRow := layout.Members.FirstRow() + fromIndex
+
+	return []*sheets.ValueRange{
+		{
+			Range:  getMembersRange(sheetName, startRow, layout.Members.FirstRow()+len(members)),
+			Values: values,
+		},
+		{
+			Range:  layout.MembersCount.In(sheetName),
+			Values: [][]interface{}{{len(members)}},
+		},
+	}
+}
+
+func memberToRow(m models.Member) []interface{} {
+	// stored as text so it matches the member references written to other sheets
+	userId := ""
+	if m.UserID != 0 {
+		userId = models.UserRef(m.UserID)
+	}
+	return []interface{}{m.ID, m.Username, m.Weight, userId, m.DisplayName}
+}
+
+func getMembersRange(sheetName string, startRow int, endRow int) string {
+	return config.GetSheetLayout(sheetName).Members.Rows(sheetName, startRow, endRow)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+)
+
+func TestValidateMember(t *testing.T) {
+	tests := []struct {
+		name    string
+		member  models.Member
+		wantErr string
+	}{
+		{name: "valid", member: models.Member{Username: "@alice", Weight: 2}},
+		{name: "missing @", member: models.Member{Username: "alice", Weight: 1}, wantErr: "username"},
+		{name: "only @", member: models.Member{Username: "@", Weight: 1}, wantErr: "username"},
+		{name: "space in the username", member: models.Member{Username: "@ali ce", Weight: 1}, wantErr: "username"},
+		{name: "zero weight", member: models.Member{Username: "@alice"}, wantErr: "weight"},
+		{name: "negative weight", member: models.Member{Username: "@alice", Weight: -1}, wantErr: "weight"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMember(tt.member)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("ValidateMember() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ValidateMember() = %v, want an error about the %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddMember(t *testing.T) {
+	members := []models.Member{
+		{ID: 1, Username: "@alice", Weight: 1, UserID: 100},
+		{ID: 3, Username: "@bob", Weight: 1},
+	}
+
+	got, added, err := addMember(members, models.Member{Username: "@carol", Weight: 2, UserID: 300}, "Template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID != 4 || len(got) != 3 || got[2] != added {
+		t.Errorf("added %+v, members = %+v", added, got)
+	}
+	if len(members) != 2 {
+		t.Error("addMember must not change the members it was given")
+	}
+
+	for _, tt := range []struct {
+		name   string
+		member models.Member
+	}{
+		{name: "username taken, ignoring case", member: models.Member{Username: "@Alice", Weight: 1}},
+		{name: "telegram user already linked", member: models.Member{Username: "@dave", Weight: 1, UserID: 100}},
+		{name: "weight not positive", member: models.Member{Username: "@dave", Weight: 0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := addMember(members, tt.member, "Template"); err == nil {
+				t.Errorf("addMember(%+v) must fail", tt.member)
+			}
+		})
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	members := []models.Member{
+		{ID: 1, Username: "@alice", Weight: 1},
+		{ID: 2, Username: "@bob", Weight: 1},
+		{ID: 3, Username: "@carol", Weight: 1},
+	}
+
+	got, index, err := removeMember(members, "@BOB", "Template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 1 || !reflect.DeepEqual(got, []models.Member{members[0], members[2]}) {
+		t.Errorf("index = %d, members = %+v", index, got)
+	}
+	if members[1].Username != "@bob" {
+		t.Error("removeMember must not change the members it was given")
+	}
+
+	if _, _, err := removeMember(members, "@dave", "Template"); err == nil {
+		t.Error("removing a member who is not in the sheet must fail")
+	}
+}
+
+func TestUpdateMember(t *testing.T) {
+	members := []models.Member{
+		{ID: 1, Username: "@alice", Weight: 1, UserID: 100},
+		{ID: 2, Username: "@bob", Weight: 1},
+	}
+	setWeight := func(weight int) func(*models.Member) error {
+		return func(member *models.Member) error {
+			member.Weight = weight
+			return nil
+		}
+	}
+
+	got, index, err := updateMember(members, "@bob", "Template", setWeight(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 1 || got[1].Weight != 3 || members[1].Weight != 1 {
+		t.Errorf("index = %d, members = %+v, given = %+v", index, got, members)
+	}
+
+	if _, _, err := updateMember(members, "@bob", "Template", setWeight(0)); err == nil {
+		t.Error("a weight of 0 must be refused")
+	}
+	if _, _, err := updateMember(members, "@bob", "Template", func(member *models.Member) error {
+		member.UserID = 100
+		return nil
+	}); err == nil {
+		t.Error("linking a telegram user that is linked to another member must be refused")
+	}
+	refused := errors.New("refused")
+	if _, _, err := updateMember(members, "@bob", "Template", func(*models.Member) error { return refused }); !errors.Is(err, refused) {
+		t.Errorf("updateMember() = %v, want the error of fn", err)
+	}
+}
+
+func TestChangeMembersNeedsALinkedHousehold(t *testing.T) {
+	err := RemoveMember(context.Background(), models.Household{}, []string{"10/2026", config.TemplateSheetName}, "@alice")
+	if !errors.Is(err, ErrHouseholdNotLinked) {
+		t.Errorf("RemoveMember() = %v, want ErrHouseholdNotLinked", err)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/utilities"
+)
+
+// AppendMeterReading appends a reading to the Meters sheet
+func AppendMeterReading(ctx context.Context, svc services.IGSheets, spreadsheetId string, reading models.MeterReading) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	if reading.Timestamp == "" {
+		reading.Timestamp = utilities.GetCurrentTimestamp(utilities.Location())
+	}
+
+	appendRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetMetersName, config.MetersStartCol, config.MetersStartRow, config.MetersEndCol)
+	values := [][]interface{}{
+		{
+			reading.Month,
+			reading.Meter,
+			reading.Member,
+			reading.Reading,
+			reading.Timestamp,
+			reading.RecordedBy,
+		},
+	}
+	_, err := svc.Append(reqCtx, spreadsheetId, appendRange, &sheets.ValueRange{
+		Values: values,
+	})
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to append meter reading: %s", err.Error())
+		return err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"month":   reading.Month,
+		"meter":   reading.Meter,
+		"member":  reading.Member,
+		"reading": reading.Reading,
+	}).Info("meter reading appended")
+	return nil
+}
+
+// GetMeterReadings reads all readings of the Meters sheet in recording order
+func GetMeterReadings(ctx context.Context, svc services.IGSheets, spreadsheetId string) ([]models.MeterReading, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	readRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetMetersName, config.MetersStartCol, config.MetersStartRow, config.MetersEndCol)
+	result, err := svc.Get(reqCtx, spreadsheetId, readRange)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get meter readings: %s", err.Error())
+		return nil, err
+	}
+
+	readings := make([]models.MeterReading, 0, len(result.Values))
+	for _, row := range result.Values {
+		// map row to the fixed length array (6 columns: Month, Meter, Member, Reading, Timestamp, RecordedBy)
+		var value [6]string
+		for j := 0; j < len(row) && j < 6; j++ {
+			value[j] = cast.ToString(row[j])
+		}
+		if value[0] == "" || value[1] == "" {
+			continue
+		}
+		readings = append(readings, models.MeterReading{
+			Month:      value[0],
+			Meter:      strings.ToLower(value[1]),
+			Member:     value[2],
+			Reading:    cast.ToFloat64(value[3]),
+			Timestamp:  value[4],
+			RecordedBy: value[5],
+		})
+	}
+	return readings, nil
+}
+
+// GetTariff returns the configured tariff of a meter
+func GetTariff(meter string) models.Tariff {
+	tariffs := config.GetAppConfig().Settings.Tariffs
+	tiers := tariffs.Electric
+	if meter == models.MeterWater {
+		tiers = tariffs.Water
+	}
+
+	tariff := make(models.Tariff, 0, len(tiers))
+	for _, tier := range tiers {
+		tariff = append(tariff, models.TariffTier{UpTo: tier.UpTo, Price: tier.Price})
+	}
+	return tariff
+}
+
+// GetMeterUsage computes the usage of a meter in the current month from the Meters sheet
+func GetMeterUsage(ctx context.Context, household models.Household, meter string) (*models.MeterUsage, error) {
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return nil, err
+	}
+	members, err := GetMembers(ctx, svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return nil, err
+	}
+	readings, err := GetMeterReadings(ctx, svc, spreadsheetId)
+	if err != nil {
+		return nil, err
+	}
+
+	tariff := GetTariff(meter)
+	if len(tariff) == 0 {
+		return nil, fmt.Errorf("no %s tariff configured", meter)
+	}
+	return models.CalculateMeterUsage(readings, meter, currentSheetName, tariff, members)
+}
+
+// FormatMeterUsage formats the usage of a meter as a Markdown message line
+func FormatMeterUsage(usage *models.MeterUsage, members []models.Member) string {
+	unit := "kWh"
+	if usage.Meter == models.MeterWater {
+		unit = "m³"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%g %s = *%s*\n", usage.Consumption, unit, utilities.FormatMoney(int(usage.Amount))))
+	if len(usage.ByMember) > 0 {
+		refs := make([]string, 0, len(usage.ByMember))
+		for ref := range usage.ByMember {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			sb.WriteString(fmt.Sprintf("  - %s: %.2f %s\n", models.DisplayRef(members, ref), usage.ByMember[ref], unit))
+		}
+	}
+	return sb.String()
+}
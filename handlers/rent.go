@@ -3,59 +3,61 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
 	"google.golang.org/api/sheets/v4"
 
 	"housematee-tgbot/config"
 	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
 	"housematee-tgbot/utilities"
 )
 
-// SaveRentData writes rent data to Google Sheets and calculates member shares
-// Writes to cells: J5 (Electric), J6 (Water), J7 (Other Fees), J8 (Total), M8 (Payer)
-func SaveRentData(rentData *models.RentData) error {
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+// rentSharesHeader is the header of the rent shares column
+const rentSharesHeader = "Rent share"
+
+// SaveRentData calculates the share of each member with the split policy and writes the rent to Google Sheets:
+// Electric, Water, Other Fees, Total (J5:J8), Payer (M8) and the rent shares next to the members, which the
+// Balances formulas of the sheet subtract from the balance of each member
+func SaveRentData(ctx context.Context, household models.Household, rentData *models.RentData) error {
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return err
 	}
 
 	// Get members with weights to calculate shares
-	members, err := GetMembers(svc, spreadsheetId, currentSheetName)
+	members, err := GetMembers(ctx, svc, spreadsheetId, currentSheetName)
 	if err != nil {
-		logrus.Warnf("failed to get members for share calculation: %s", err.Error())
-		// Continue without member shares
-	} else {
-		// Calculate per-member shares
-		rentData.CalculateMemberShares(members)
-	}
-
-	// Prepare batch update requests
-	updates := []struct {
-		cell  string
-		value interface{}
-	}{
-		{config.RentElectricCell, rentData.Electric},
-		{config.RentWaterCell, rentData.Water},
-		{config.RentOtherFeesCell, rentData.OtherFees},
-		{config.RentTotalCell, rentData.TotalBill},
-		{config.RentPayerCell, rentData.Payer},
-	}
-
-	// Write each value to the sheet
-	for _, update := range updates {
-		cellRange := fmt.Sprintf("%s!%s", currentSheetName, update.cell)
-		_, err = svc.Update(context.TODO(), spreadsheetId, cellRange, &sheets.ValueRange{
-			Values: [][]interface{}{{update.value}},
-		})
-		if err != nil {
-			logrus.Errorf("failed to update rent cell %s: %s", update.cell, err.Error())
-			return err
-		}
+		return fmt.Errorf("cannot split rent without the members: %w", err)
+	}
+	if err := rentData.CalculateMemberShares(members, rentData.SplitPolicy); err != nil {
+		// A policy that does not fit the members must be fixed before saving
+		return fmt.Errorf("cannot split rent: %w", err)
+	}
+	shares := make([]int64, 0, len(rentData.MemberShares))
+	for _, share := range rentData.MemberShares {
+		shares = append(shares, share.TotalShare)
 	}
 
-	logrus.WithFields(logrus.Fields{
+	err = writeRentCells(ctx, svc, spreadsheetId, currentSheetName, models.RentCells{
+		Electric:  rentData.Electric,
+		Water:     rentData.Water,
+		OtherFees: rentData.OtherFees,
+		Total:     rentData.TotalBill,
+		Payer:     rentData.Payer,
+		Shares:    shares,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeRentFormulas(ctx, svc, spreadsheetId, currentSheetName, members); err != nil {
+		return err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"total":      rentData.TotalBill,
 		"electric":   rentData.Electric,
 		"water":      rentData.Water,
@@ -66,6 +68,272 @@ func SaveRentData(rentData *models.RentData) error {
 	return nil
 }
 
+// noRentCellsError is returned for the sheets created with a layout without rent cells
+func noRentCellsError(sheetName string, layout models.SheetLayout) error {
+	return fmt.Errorf("sheet %s uses layout version %d, which has no rent cells", sheetName, layout.Version)
+}
+
+// writeRentCells writes the rent cells and the rent shares of a sheet in one batch so a failure leaves the sheet
+// unchanged. A sheet without a rent shares column splits the rent with its own formulas.
+func writeRentCells(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, rent models.RentCells) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	layout := config.GetSheetLayout(sheetName)
+	if !layout.HasRent() {
+		return noRentCellsError(sheetName, layout)
+	}
+
+	updates := []*sheets.ValueRange{
+		{
+			Range:  layout.Rent.In(sheetName),
+			Values: [][]interface{}{{rent.Electric}, {rent.Water}, {rent.OtherFees}, {rent.Total}},
+		},
+		{
+			Range:  layout.RentPayer.In(sheetName),
+			Values: [][]interface{}{{rent.Payer}},
+		},
+	}
+	if layout.HasRentShares() {
+		updates = append(updates, rentSharesUpdate(sheetName, rent.Shares, len(rent.Shares)))
+	}
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, updates...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to update rent cells: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// rentSharesUpdate writes the header of the rent shares column of a sheet, the shares in the order of the members,
+// and clears the rows up to the row after member number rows
+func rentSharesUpdate(sheetName string, shares []int64, rows int) *sheets.ValueRange {
+	table := config.GetSheetLayout(sheetName).RentShares
+	values := [][]interface{}{{rentSharesHeader}}
+	for i := 0; i <= rows; i++ {
+		if i < len(shares) {
+			values = append(values, []interface{}{shares[i]})
+		} else {
+			values = append(values, []interface{}{""})
+		}
+	}
+	return &sheets.ValueRange{
+		Range:  table.Rows(sheetName, table.HeaderRow, table.FirstRow()+rows),
+		Values: values,
+	}
+}
+
+// writeRentFormulas writes the Balances formulas of the members of a sheet so they subtract the rent shares
+func writeRentFormulas(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string, members []models.Member) error {
+	if len(members) == 0 || !config.GetSheetLayout(sheetName).HasRentShares() {
+		return nil
+	}
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	update := balanceFormulaUpdate(sheetName, len(members), 0, members[0].RefByUserID)
+	if _, err := svc.BatchUpdateFormulas(reqCtx, spreadsheetId, update); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to write the balance formulas of %s: %s", sheetName, err.Error())
+		return fmt.Errorf("the rent was saved but not the Balances formulas that split it, save it again: %w", err)
+	}
+	return nil
+}
+
+// GetRentData reads the rent saved in the current sheet.
+// A rent that was not saved yet has a zero TotalBill.
+func GetRentData(ctx context.Context, household models.Household) (*models.RentData, error) {
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return nil, err
+	}
+
+	rent, err := readRentCells(ctx, svc, spreadsheetId, currentSheetName)
+	if err != nil {
+		return nil, err
+	}
+	rentData := &models.RentData{
+		Electric:  rent.Electric,
+		Water:     rent.Water,
+		OtherFees: rent.OtherFees,
+		TotalBill: rent.Total,
+		Payer:     rent.Payer,
+	}
+	return rentData, nil
+}
+
+// readRentCells reads the rent amounts, the payer and the rent shares of a sheet
+func readRentCells(ctx context.Context, svc services.IGSheets, spreadsheetId string, sheetName string) (models.RentCells, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	layout := config.GetSheetLayout(sheetName)
+	if !layout.HasRent() {
+		return models.RentCells{}, noRentCellsError(sheetName, layout)
+	}
+
+	// Electric, Water, Other fees, Total (J5:J8), Payer (M8) and the rent shares below their header
+	ranges := []string{layout.Rent.In(sheetName), layout.RentPayer.In(sheetName)}
+	if layout.HasRentShares() {
+		shares := layout.RentShares
+		ranges = append(ranges, fmt.Sprintf("%s!%s%d:%s", sheetName, shares.StartCol, shares.FirstRow(), shares.EndCol))
+	}
+	resp, err := svc.BatchGet(reqCtx, spreadsheetId, ranges...)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get rent data: %s", err.Error())
+		return models.RentCells{}, err
+	}
+	var amounts [4]int64
+	for i := 0; len(resp) > 0 && i < len(resp[0].Values) && i < 4; i++ {
+		if len(resp[0].Values[i]) > 0 {
+			amounts[i] = parseSheetAmount(cast.ToString(resp[0].Values[i][0]))
+		}
+	}
+	payer := ""
+	if len(resp) > 1 && len(resp[1].Values) > 0 && len(resp[1].Values[0]) > 0 {
+		payer = cast.ToString(resp[1].Values[0][0])
+	}
+
+	// The shares stop at the first blank row, the rent is split by default while there are none
+	var shares []int64
+	for i := 0; len(resp) > 2 && i < len(resp[2].Values); i++ {
+		if len(resp[2].Values[i]) == 0 || cast.ToString(resp[2].Values[i][0]) == "" {
+			break
+		}
+		shares = append(shares, parseSheetAmount(cast.ToString(resp[2].Values[i][0])))
+	}
+
+	return models.RentCells{Electric: amounts[0], Water: amounts[1], OtherFees: amounts[2], Total: amounts[3], Payer: payer, Shares: shares}, nil
+}
+
+// parseSheetAmount reads an amount shown with the money format of the sheet, e.g., "300,000 ₫" or "-721,150 ₫".
+// The decimals of an amount like "1.5" are dropped, the balances differ by less than the rounding allowed.
+func parseSheetAmount(value string) int64 {
+	var amount int64
+	negative, digits := false, false
+	for _, r := range value {
+		if r == '.' {
+			break
+		}
+		if r >= '0' && r <= '9' {
+			amount = amount*10 + int64(r-'0')
+			digits = true
+		} else if r == '-' && !digits {
+			negative = true
+		}
+	}
+	if negative {
+		return -amount
+	}
+	return amount
+}
+
+// GetRentSplitPolicy reads the rent split policy of the house.
+// Empty or invalid cells fall back to the default policy of the component.
+func GetRentSplitPolicy(ctx context.Context, household models.Household) (models.RentSplitPolicy, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	policy := models.DefaultRentSplitPolicy()
+
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return policy, err
+	}
+	resp, err := svc.Get(reqCtx, spreadsheetId, config.RentSplitPolicyRange)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get rent split policy: %s", err.Error())
+		return policy, err
+	}
+
+	components := []*models.ComponentSplit{&policy.Electric, &policy.Water, &policy.OtherFees}
+	for i, row := range resp.Values {
+		if i >= len(components) || len(row) < 2 || cast.ToString(row[1]) == "" {
+			continue
+		}
+		split, err := models.ParseComponentSplit(cast.ToString(row[1]))
+		if err != nil {
+			logrus.WithContext(ctx).Warnf("invalid rent split policy %q, using %s: %s", row[1], components[i].Policy, err.Error())
+			continue
+		}
+		*components[i] = split
+	}
+	return policy, nil
+}
+
+// SaveRentSplitPolicy stores the rent split policy of the house
+func SaveRentSplitPolicy(ctx context.Context, household models.Household, policy models.RentSplitPolicy) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return err
+	}
+	_, err = svc.Update(reqCtx, spreadsheetId, config.RentSplitPolicyRange, &sheets.ValueRange{
+		Values: [][]interface{}{
+			{"Rent split: electric", policy.Electric.String()},
+			{"Rent split: water", policy.Water.String()},
+			{"Rent split: other fees", policy.OtherFees.String()},
+		},
+	})
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to save rent split policy: %s", err.Error())
+		return err
+	}
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"electric":   policy.Electric.String(),
+		"water":      policy.Water.String(),
+		"other_fees": policy.OtherFees.String(),
+	}).Info("rent split policy saved")
+	return nil
+}
+
+// FormatComponentSplit describes a component split for users, e.g., "percentage (@a 60, @b 40)"
+func FormatComponentSplit(split models.ComponentSplit, members []models.Member) string {
+	if len(split.Values) == 0 {
+		return string(split.Policy)
+	}
+	values := make([]string, 0, len(split.Values))
+	for _, m := range members {
+		for ref, v := range split.Values {
+			if found := models.FindMemberByRef(members, ref); found != nil && found.Ref() == m.Ref() {
+				values = append(values, fmt.Sprintf("%s %s", m.Username, strconv.FormatFloat(v, 'f', -1, 64)))
+			}
+		}
+	}
+	return fmt.Sprintf("%s (%s)", split.Policy, strings.Join(values, ", "))
+}
+
+// ParseComponentSplitValues parses one "@username value" pair per line into values keyed by member reference
+func ParseComponentSplitValues(text string, members []models.Member) (map[string]float64, error) {
+	values := make(map[string]float64)
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected \"@username value\", got %q", line)
+		}
+		member := models.FindMemberByRef(members, fields[0])
+		if member == nil {
+			return nil, fmt.Errorf("%s is not a member", fields[0])
+		}
+		number := fields[1]
+		if parsed := utilities.ParseAmount(strings.ToLower(strings.TrimSuffix(number, "%"))); parsed != "" {
+			number = parsed
+		}
+		v, err := strconv.ParseFloat(number, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid value %q for %s", fields[1], member.Username)
+		}
+		values[member.Ref()] = v
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values given")
+	}
+	return values, nil
+}
+
 // FormatRentSummary formats the rent data for display to user with emojis
 func FormatRentSummary(rentData *models.RentData) string {
 	var sb strings.Builder
@@ -78,7 +346,13 @@ func FormatRentSummary(rentData *models.RentData) string {
 	sb.WriteString(fmt.Sprintf("\U0001F4C4 Other Fees: %s\n", utilities.FormatMoney(int(rentData.OtherFees))))
 	sb.WriteString("-----------------\n")
 	sb.WriteString(fmt.Sprintf("\U0001F4B0 *Total Rent:* %s\n", utilities.FormatMoney(int(rentData.TotalBill))))
-	sb.WriteString(fmt.Sprintf("\U0001F464 *Payer:* %s\n", rentData.Payer))
+	payerName := rentData.PayerName
+	if payerName == "" {
+		payerName = rentData.Payer
+	}
+	sb.WriteString(fmt.Sprintf("\U0001F464 *Payer:* %s\n", payerName))
+	sb.WriteString(fmt.Sprintf("\u2696 *Split:* electric %s, water %s, other fees %s\n",
+		rentData.SplitPolicy.Electric.Policy, rentData.SplitPolicy.Water.Policy, rentData.SplitPolicy.OtherFees.Policy))
 
 	// Add per-member breakdown if available
 	if len(rentData.MemberShares) > 0 {
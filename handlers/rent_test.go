@@ -0,0 +1,22 @@
+package handlers
+
+import "testing"
+
+func TestParseSheetAmount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"300,000 ₫", 300000},
+		{"-721,150 ₫", -721150},
+		{"5000000", 5000000},
+		{"1.5", 1},
+		{"-2,400.75 ₫", -2400},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseSheetAmount(tt.value); got != tt.want {
+			t.Errorf("parseSheetAmount(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
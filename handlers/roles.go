@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/utilities"
+)
+
+// rolesMux serialises the role changes, so two changes of the same user do not both append a row
+var rolesMux sync.Mutex
+
+// getRoleRows reads every row of the Roles sheet; the index of a row is its offset from RolesStartRow
+func getRoleRows(ctx context.Context, svc services.IGSheets, spreadsheetId string) ([]models.RoleAssignment, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	readRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetRolesName, config.RolesStartCol, config.RolesStartRow, config.RolesEndCol)
+	result, err := svc.Get(reqCtx, spreadsheetId, readRange)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.RoleAssignment, 0, len(result.Values))
+	for _, row := range result.Values {
+		// map row to the fixed length array (5 columns: ChatID, UserID, Role, UpdatedBy, UpdatedAt)
+		var value [5]string
+		for j := 0; j < len(row) && j < 5; j++ {
+			value[j] = cast.ToString(row[j])
+		}
+		// Rows with an unknown role keep their place but grant nothing
+		role, _ := models.ParseRole(value[2])
+		rows = append(rows, models.RoleAssignment{
+			ChatID:    cast.ToInt64(value[0]),
+			UserID:    cast.ToInt64(value[1]),
+			Role:      role,
+			UpdatedBy: value[3],
+			UpdatedAt: value[4],
+		})
+	}
+	return rows, nil
+}
+
+// GetChatRoles returns the roles assigned in the chat of a household
+func GetChatRoles(ctx context.Context, household models.Household) ([]models.RoleAssignment, error) {
+	if !household.IsLinked() {
+		return nil, ErrHouseholdNotLinked
+	}
+	rows, err := getRoleRows(ctx, services.GetGSheetsSvc(), household.SpreadsheetID)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]models.RoleAssignment, 0)
+	for _, row := range rows {
+		if row.ChatID == household.ChatID && row.Role != models.RoleNone {
+			roles = append(roles, row)
+		}
+	}
+	return roles, nil
+}
+
+// GetRole returns the role assigned to a user in the chat of a household, false when none is assigned
+func GetRole(ctx context.Context, household models.Household, userId int64) (models.Role, bool, error) {
+	roles, err := GetChatRoles(ctx, household)
+	if err != nil {
+		return models.RoleNone, false, err
+	}
+	for _, assignment := range roles {
+		if assignment.UserID == userId {
+			return assignment.Role, true, nil
+		}
+	}
+	return models.RoleNone, false, nil
+}
+
+// SetRole writes the role of a user in the chat of a household over their row, or appends one
+func SetRole(ctx context.Context, household models.Household, assignment models.RoleAssignment) error {
+	if !household.IsLinked() {
+		return ErrHouseholdNotLinked
+	}
+	assignment.ChatID = household.ChatID
+
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	rolesMux.Lock()
+	defer rolesMux.Unlock()
+
+	svc := services.GetGSheetsSvc()
+	spreadsheetId := household.SpreadsheetID
+	rows, err := getRoleRows(ctx, svc, spreadsheetId)
+	if err != nil {
+		return err
+	}
+
+	if assignment.UpdatedAt == "" {
+		assignment.UpdatedAt = utilities.GetCurrentTimestamp(household.Location())
+	}
+	values := [][]interface{}{{
+		strconv.FormatInt(assignment.ChatID, 10),
+		strconv.FormatInt(assignment.UserID, 10),
+		assignment.Role.String(),
+		assignment.UpdatedBy,
+		assignment.UpdatedAt,
+	}}
+
+	for i, row := range rows {
+		if row.ChatID != assignment.ChatID || row.UserID != assignment.UserID {
+			continue
+		}
+		rowNumber := config.RolesStartRow + i
+		writeRange := fmt.Sprintf("%s!%s%d:%s%d", config.SeparatedSheetRolesName, config.RolesStartCol, rowNumber, config.RolesEndCol, rowNumber)
+		_, err = svc.Update(reqCtx, spreadsheetId, writeRange, &sheets.ValueRange{Values: values})
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("failed to update role: %s", err.Error())
+		}
+		return err
+	}
+
+	appendRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetRolesName, config.RolesStartCol, config.RolesStartRow, config.RolesEndCol)
+	_, err = svc.Append(reqCtx, spreadsheetId, appendRange, &sheets.ValueRange{Values: values})
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to append role: %s", err.Error())
+	}
+	return err
+}
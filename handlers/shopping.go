@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/utilities"
+)
+
+// GetShoppingList returns the items of the shopping list that were not removed
+func GetShoppingList(ctx context.Context, household models.Household) ([]models.ShoppingItem, error) {
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := readShoppingTable(ctx, svc, spreadsheetId)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get shopping list: %s", err.Error())
+		return nil, err
+	}
+
+	items := make([]models.ShoppingItem, 0)
+	for _, record := range table.Records() {
+		item := shoppingItemFromRecord(table, record)
+		// Skip removed items (empty Name)
+		if item.Name == "" {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// AddShoppingItems writes items to the rows of removed items first, then appends the rest and updates the next item ID
+func AddShoppingItems(ctx context.Context, household models.Household, items []models.ShoppingItem) ([]models.ShoppingItem, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold the ID allocations of the spreadsheet while the free rows and the counter are read and written
+	unlock := services.LockIDs(spreadsheetId)
+	defer unlock()
+
+	nextItemId, err := getNextShoppingItemId(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return nil, err
+	}
+	table, err := readShoppingTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return nil, err
+	}
+
+	newNextItemId := assignShoppingIds(items, freeShoppingIds(table, nextItemId), nextItemId)
+	updates := make([]*sheets.ValueRange, 0, len(items)+1)
+	for _, item := range items {
+		updates = append(updates, &sheets.ValueRange{
+			Range: shoppingRowRange(config.ShoppingStartRow+item.ID, config.ShoppingStartRow+item.ID),
+			Values: [][]interface{}{table.Row(map[string]any{
+				models.IDHeader:  item.ID,
+				"Name":           item.Name,
+				"EstimatedPrice": item.EstimatedPrice,
+				"AddedBy":        item.AddedBy,
+				"Checked":        item.Checked,
+			})},
+		})
+	}
+	if newNextItemId != nextItemId {
+		updates = append(updates, &sheets.ValueRange{Range: config.NextShoppingItemIdCell, Values: [][]interface{}{{newNextItemId}}})
+	}
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, updates...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to add shopping items: %s", err.Error())
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// UpdateShoppingItem writes an item back to its row
+func UpdateShoppingItem(ctx context.Context, household models.Household, item models.ShoppingItem) error {
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return err
+	}
+	return writeShoppingItemRow(ctx, svc, spreadsheetId, item.ID, map[string]any{
+		"ID":             item.ID,
+		"Name":           item.Name,
+		"EstimatedPrice": item.EstimatedPrice,
+		"AddedBy":        item.AddedBy,
+		"Checked":        item.Checked,
+	})
+}
+
+// RemoveShoppingItems clears the rows of the given items, keeping their IDs so new items reuse the rows.
+// Removed items at the end of the list are cleared with their IDs and the next item ID moves back to them.
+func RemoveShoppingItems(ctx context.Context, household models.Household, ids []int) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return err
+	}
+
+	// Hold the ID allocations of the spreadsheet while the rows and the counter are read and written
+	unlock := services.LockIDs(spreadsheetId)
+	defer unlock()
+
+	nextItemId, err := getNextShoppingItemId(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return err
+	}
+	table, err := readShoppingTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return err
+	}
+
+	removed := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if _, err := table.WriteRow(id); err != nil {
+			logrus.WithContext(ctx).Errorf("refused to remove shopping item %d: %s", id, err.Error())
+			return err
+		}
+		removed[id] = true
+	}
+
+	newNextItemId := trimmedNextShoppingId(table, removed, nextItemId)
+	updates := make([]*sheets.ValueRange, 0, len(ids)+2)
+	for _, id := range ids {
+		if id >= newNextItemId {
+			continue
+		}
+		updates = append(updates, &sheets.ValueRange{
+			Range:  shoppingRowRange(config.ShoppingStartRow+id, config.ShoppingStartRow+id),
+			Values: [][]interface{}{table.Row(map[string]any{models.IDHeader: id, "Name": "", "EstimatedPrice": "", "AddedBy": "", "Checked": ""})},
+		})
+	}
+	if newNextItemId < nextItemId {
+		blank := table.Row(map[string]any{models.IDHeader: "", "Name": "", "EstimatedPrice": "", "AddedBy": "", "Checked": ""})
+		values := make([][]interface{}, 0, nextItemId-newNextItemId)
+		for id := newNextItemId; id < nextItemId; id++ {
+			values = append(values, blank)
+		}
+		updates = append(updates,
+			&sheets.ValueRange{Range: shoppingRowRange(config.ShoppingStartRow+newNextItemId, config.ShoppingStartRow+nextItemId-1), Values: values},
+			&sheets.ValueRange{Range: config.NextShoppingItemIdCell, Values: [][]interface{}{{newNextItemId}}},
+		)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	if _, err := svc.BatchUpdate(reqCtx, spreadsheetId, updates...); err != nil {
+		logrus.WithContext(ctx).Errorf("failed to remove shopping items: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// freeShoppingIds returns the IDs below nextItemId whose row holds no item, in order. Rows that are not at their
+// ID are left alone, like writeShoppingItemRow does.
+func freeShoppingIds(table models.RecordTable, nextItemId int) []int {
+	free := make([]int, 0)
+	for _, record := range table.Records() {
+		item := shoppingItemFromRecord(table, record)
+		if item.Name != "" || item.ID >= nextItemId {
+			continue
+		}
+		if _, err := table.WriteRow(item.ID); err == nil {
+			free = append(free, item.ID)
+		}
+	}
+	sort.Ints(free)
+	return free
+}
+
+// assignShoppingIds gives the items the free IDs first and IDs from nextItemId after, and returns the next item ID
+func assignShoppingIds(items []models.ShoppingItem, free []int, nextItemId int) int {
+	for i := range items {
+		if i < len(free) {
+			items[i].ID = free[i]
+			continue
+		}
+		items[i].ID = nextItemId
+		nextItemId++
+	}
+	return nextItemId
+}
+
+// trimmedNextShoppingId returns the ID after the last item that is kept, so the removed items at the end of the list
+// give their rows back
+func trimmedNextShoppingId(table models.RecordTable, removed map[int]bool, nextItemId int) int {
+	last := 0
+	for _, record := range table.Records() {
+		item := shoppingItemFromRecord(table, record)
+		if item.Name != "" && !removed[item.ID] && item.ID > last {
+			last = item.ID
+		}
+	}
+	if last+1 > nextItemId {
+		return nextItemId
+	}
+	return last + 1
+}
+
+func readShoppingTable(ctx context.Context, svc services.IGSheets, spreadsheetId string) (models.RecordTable, error) {
+	return readRecordTable(ctx, svc, spreadsheetId, config.SeparatedSheetShoppingName,
+		config.ShoppingStartCol, config.ShoppingEndCol, config.ShoppingStartRow, shoppingHeaders)
+}
+
+func shoppingItemFromRecord(table models.RecordTable, record []any) models.ShoppingItem {
+	return models.ShoppingItem{
+		ID:             cast.ToInt(table.Value(record, models.IDHeader)),
+		Name:           cast.ToString(table.Value(record, "Name")),
+		EstimatedPrice: cast.ToInt64(table.Value(record, "EstimatedPrice")),
+		AddedBy:        cast.ToString(table.Value(record, "AddedBy")),
+		Checked:        cast.ToBool(table.Value(record, "Checked")),
+	}
+}
+
+func shoppingRowRange(startRow int, endRow int) string {
+	return fmt.Sprintf("%s!%s%d:%s%d", config.SeparatedSheetShoppingName, config.ShoppingStartCol, startRow, config.ShoppingEndCol, endRow)
+}
+
+// writeShoppingItemRow writes the values under their headers on the row of the item, refusing when the row holds another item
+func writeShoppingItemRow(ctx context.Context, svc services.IGSheets, spreadsheetId string, id int, values map[string]any) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	// A removal or an add may be reusing the row
+	unlock := services.LockIDs(spreadsheetId)
+	defer unlock()
+
+	records, err := readShoppingTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId)
+	if err != nil {
+		return err
+	}
+	writeRow, err := records.WriteRow(id)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("refused to update shopping item %d: %s", id, err.Error())
+		return err
+	}
+	_, err = svc.Update(reqCtx, spreadsheetId, shoppingRowRange(writeRow, writeRow), &sheets.ValueRange{
+		Values: [][]interface{}{records.Row(values)},
+	})
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to update shopping item %d: %s", id, err.Error())
+		return err
+	}
+	return nil
+}
+
+func getNextShoppingItemId(ctx context.Context, svc services.IGSheets, spreadsheetId string) (int, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	value, err := svc.GetValue(reqCtx, spreadsheetId, config.NextShoppingItemIdCell)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get next shopping item id: %s", err.Error())
+		return 0, err
+	}
+	nextItemId := cast.ToInt(value)
+	if nextItemId < 1 {
+		nextItemId = 1
+	}
+	return nextItemId, nil
+}
+
+// ParseShoppingItems parses one item per line: "[name] [estimated price]"
+// The price is optional and supports "k" and "m", e.g., "rice 150k"
+func ParseShoppingItems(text string, addedBy string) []models.ShoppingItem {
+	items := make([]models.ShoppingItem, 0)
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var price int64
+		if len(fields) > 1 {
+			amount := utilities.ParseAmount(strings.ToLower(fields[len(fields)-1]))
+			if amount != "" && utilities.IsNumeric(amount) {
+				price = cast.ToInt64(amount)
+				fields = fields[:len(fields)-1]
+			}
+		}
+		items = append(items, models.ShoppingItem{
+			Name:           strings.Join(fields, " "),
+			EstimatedPrice: price,
+			AddedBy:        addedBy,
+		})
+	}
+	return items
+}
+
+// CheckoutShoppingList creates an expense for the checked items and removes them from the list
+func CheckoutShoppingList(ctx context.Context, household models.Household, items []models.ShoppingItem, total string, payer string) (*models.Expense, error) {
+	if !utilities.IsNumeric(total) || cast.ToInt64(total) <= 0 {
+		return nil, fmt.Errorf("the total must be a number greater than 0")
+	}
+
+	names := make([]string, 0, len(items))
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+		ids = append(ids, item.ID)
+	}
+
+	expense := models.Expense{
+		Name:         config.ExpenseNameShopping,
+		Amount:       total,
+		Date:         utilities.GetCurrentDate(household.Location()),
+		Payer:        payer,
+		Participants: []string{},
+		Note:         "Items: " + strings.Join(names, ", ") + "\n" + NewExpenseAuditEntry(household, total, payer),
+	}
+
+	newExpense, err := AddExpense(ctx, household, expense)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := RemoveShoppingItems(ctx, household, ids); err != nil {
+		// The expense is already recorded, the items can be removed by hand
+		logrus.WithContext(ctx).Warnf("failed to remove checked out shopping items: %s", err.Error())
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"expense_id": newExpense.ID,
+		"items":      names,
+		"total":      total,
+		"payer":      payer,
+	}).Info("shopping list checked out")
+
+	return newExpense, nil
+}
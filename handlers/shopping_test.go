@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+)
+
+func TestParseShoppingItems(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []models.ShoppingItem
+	}{
+		{
+			name: "prices with k and m",
+			text: "rice 150k\nfridge 1.5m\neggs 30000",
+			want: []models.ShoppingItem{
+				{Name: "rice", EstimatedPrice: 150000, AddedBy: "@alice"},
+				{Name: "fridge", EstimatedPrice: 1500000, AddedBy: "@alice"},
+				{Name: "eggs", EstimatedPrice: 30000, AddedBy: "@alice"},
+			},
+		},
+		{
+			name: "no price",
+			text: "dish soap",
+			want: []models.ShoppingItem{{Name: "dish soap", AddedBy: "@alice"}},
+		},
+		{
+			name: "blank lines",
+			text: "\n  milk 20k  \n\n\t\n",
+			want: []models.ShoppingItem{{Name: "milk", EstimatedPrice: 20000, AddedBy: "@alice"}},
+		},
+		{
+			name: "a single word is a name",
+			text: "100",
+			want: []models.ShoppingItem{{Name: "100", AddedBy: "@alice"}},
+		},
+		{
+			name: "a numeric last word is the price",
+			text: "paper towels 3 50k\nbatteries aa 4",
+			want: []models.ShoppingItem{
+				{Name: "paper towels 3", EstimatedPrice: 50000, AddedBy: "@alice"},
+				{Name: "batteries aa", EstimatedPrice: 4, AddedBy: "@alice"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseShoppingItems(tt.text, "@alice"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseShoppingItems() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// shoppingTable returns a Shopping sheet from its header row; row n below the header holds the given values
+func shoppingTable(t *testing.T, rows ...[]any) models.RecordTable {
+	t.Helper()
+	values := append([][]any{{"ID", "Name", "EstimatedPrice", "AddedBy", "Checked"}}, rows...)
+	table, err := models.NewRecordTable(values, config.ShoppingStartRow, shoppingHeaders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestAssignShoppingIdsReusesFreedRows(t *testing.T) {
+	table := shoppingTable(t,
+		[]any{"1", "rice"},
+		[]any{"2", ""},
+		[]any{"3", "eggs"},
+		[]any{"4"},
+		// Moved rows are not reused
+		[]any{"7", ""},
+	)
+	free := freeShoppingIds(table, 6)
+	if !reflect.DeepEqual(free, []int{2, 4}) {
+		t.Fatalf("free = %v, want [2 4]", free)
+	}
+
+	items := make([]models.ShoppingItem, 3)
+	if next := assignShoppingIds(items, free, 6); next != 7 {
+		t.Errorf("next item ID = %d, want 7", next)
+	}
+	if ids := []int{items[0].ID, items[1].ID, items[2].ID}; !reflect.DeepEqual(ids, []int{2, 4, 6}) {
+		t.Errorf("IDs = %v, want [2 4 6]", ids)
+	}
+
+	items = make([]models.ShoppingItem, 1)
+	if next := assignShoppingIds(items, free, 6); next != 6 || items[0].ID != 2 {
+		t.Errorf("next item ID = %d, ID = %d, want 6 and 2", next, items[0].ID)
+	}
+}
+
+func TestTrimmedNextShoppingId(t *testing.T) {
+	table := shoppingTable(t,
+		[]any{"1", "rice"},
+		[]any{"2", "milk"},
+		[]any{"3", ""},
+		[]any{"4", "eggs"},
+	)
+	tests := []struct {
+		name    string
+		removed map[int]bool
+		want    int
+	}{
+		{name: "removing the last item frees the freed rows before it", removed: map[int]bool{4: true}, want: 3},
+		{name: "removing an item in the middle keeps the next ID", removed: map[int]bool{2: true}, want: 5},
+		{name: "removing everything starts over", removed: map[int]bool{1: true, 2: true, 4: true}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimmedNextShoppingId(table, tt.removed, 5); got != tt.want {
+				t.Errorf("trimmedNextShoppingId() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckoutShoppingListRejectsNonPositiveTotals(t *testing.T) {
+	for _, total := range []string{"0", "-50000", "abc"} {
+		if _, err := CheckoutShoppingList(context.Background(), models.Household{}, nil, total, "@alice"); err == nil {
+			t.Errorf("total %q must be rejected", total)
+		}
+	}
+}
@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -19,7 +19,11 @@ import (
 )
 
 func HandleSplitBillViewAction(bot *gotgbot.Bot, ctx *ext.Context) error {
-	readRange, err := getLast5ExpenseReadRange()
+	reqCtx, cancel := services.NewRequestContext(ContextOf(ctx))
+	defer cancel()
+
+	household := HouseholdOf(ctx)
+	readRange, err := getLast5ExpenseReadRange(ContextOf(ctx), household)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
@@ -28,9 +32,8 @@ func HandleSplitBillViewAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return err
 	}
 
-	spreadsheetId := config.GetAppConfig().GoogleSheets.SpreadsheetId
 	svc := services.GetGSheetsSvc()
-	resp, err := svc.Get(context.TODO(), spreadsheetId, readRange)
+	resp, err := svc.Get(reqCtx, household.SpreadsheetID, readRange)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
@@ -51,6 +54,11 @@ func HandleSplitBillViewAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 		}
 	}
 
+	members, err := GetCurrentMembers(ContextOf(ctx), household)
+	if err != nil {
+		logrus.WithContext(ContextOf(ctx)).Warnf("failed to get members, showing stored payers: %s", err.Error())
+	}
+
 	for _, row := range respValues {
 
 		// map row to Expense
@@ -77,7 +85,7 @@ func HandleSplitBillViewAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	// Iterate over the expenses and format them as list items
 	for _, expense := range expenses {
-		formattedExpense := convertExpenseModelToMarkdown(expense)
+		formattedExpense := convertExpenseModelToMarkdown(expense, members)
 
 		// Append the formatted expense to the Markdown list
 		markdownList += formattedExpense
@@ -94,13 +102,14 @@ func HandleSplitBillViewAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func convertExpenseModelToMarkdown(expense models.Expense) string {
+func convertExpenseModelToMarkdown(expense models.Expense, members []models.Member) string {
 	participants := "*everyone*"
 	if len(expense.Participants) > 0 {
-		participants = strings.Join(
-			expense.Participants,
-			", ",
-		) // Join participant names with commas
+		names := make([]string, 0, len(expense.Participants))
+		for _, participant := range expense.Participants {
+			names = append(names, models.DisplayRef(members, participant))
+		}
+		participants = strings.Join(names, ", ") // Join participant names with commas
 	}
 
 	// Format the expense data with bold keys
@@ -111,28 +120,20 @@ func convertExpenseModelToMarkdown(expense models.Expense) string {
 		expense.Name,
 		expense.Amount,
 		expense.Date,
-		expense.Payer,
+		models.DisplayRef(members, expense.Payer),
 		participants,
 		note,
 	)
 	return formattedExpense
 }
 
-func getLast5ExpenseReadRange() (string, error) {
-	// read spreadsheetId from config
-	svc := services.GetGSheetsSvc()
-	spreadsheetId := config.GetAppConfig().GoogleSheets.SpreadsheetId
-	currentSheetName, err := svc.GetValue(
-		context.TODO(),
-		spreadsheetId,
-		config.CurrentSheetNameCell,
-	)
+func getLast5ExpenseReadRange(ctx context.Context, household models.Household) (string, error) {
+	currentSheetName, err := GetCurrentSheetName(ctx, household)
 	if err != nil {
-		logrus.Errorf("failed to get current sheet name: %s", err.Error())
 		return "", err
 	}
 
-	nextExpenseIdValue, err := getNextExpenseId()
+	nextExpenseIdValue, err := getNextExpenseId(ctx, household)
 	if err != nil {
 		return "", err
 	}
@@ -146,12 +147,13 @@ func getLast5ExpenseReadRange() (string, error) {
 	// example:
 	// currentSheetName = "9/2023"
 	// nextExpenseId = 7 => currentExpenseId = 6
-	// ExpensesStartRow = 3
+	// expenses header row = 3
 	// lastExpenseRow = 9
 	// => return "9/2023!A5:G9"
 
 	lastExpenseId := nextExpenseId - 1
-	lastExpenseRow := config.ExpenseStartRow + lastExpenseId
+	table := config.GetSheetLayout(currentSheetName).Expenses
+	lastExpenseRow := table.HeaderRow + lastExpenseId
 
 	readRangeStartRow := lastExpenseRow - 4 // (-5+1)
 	readRangeEndRow := lastExpenseRow
@@ -160,20 +162,13 @@ func getLast5ExpenseReadRange() (string, error) {
 		// example:
 		// currentSheetName = "9/2023"
 		// nextExpenseId = 4
-		// ExpensesStartRow = 3
+		// expenses header row = 3
 		// => return "9/2023!A4:G6"
 
-		readRangeStartRow = config.ExpenseStartRow + 1
+		readRangeStartRow = table.FirstRow()
 	}
 
-	readRange := fmt.Sprintf(
-		"%s!%s%d:%s%d",
-		currentSheetName,
-		config.ExpenseStartCol,
-		readRangeStartRow,
-		config.ExpenseEndCol,
-		readRangeEndRow,
-	)
+	readRange := table.Rows(currentSheetName, readRangeStartRow, readRangeEndRow)
 	return readRange, nil
 }
 
@@ -202,11 +197,24 @@ func HandleExpenseAddAction(bot *gotgbot.Bot, ctx *ext.Context) (err error) {
 	payer := details[3]
 
 	// fulfill default values
+	household := HouseholdOf(ctx)
 	if dateStr == "" {
-		dateStr = utilities.GetCurrentDate()
+		dateStr = utilities.GetCurrentDate(household.Location())
 	}
-	if payer == "" {
-		payer = "@" + ctx.EffectiveUser.Username
+	// Payer is stored as a member reference, users who are not members are refused
+	members, err := GetCurrentMembers(ContextOf(ctx), household)
+	if err != nil {
+		logrus.WithContext(ContextOf(ctx)).Errorf("failed to get members: %s", err.Error())
+	} else if payer == "" {
+		payer, err = GetActorRef(members, ctx.EffectiveUser.Id, ctx.EffectiveUser.Username)
+	} else if m := models.FindMemberByRef(members, strings.TrimSpace(payer)); m != nil {
+		payer = m.Ref()
+	} else {
+		err = fmt.Errorf("payer %s is not a member of this house", payer)
+	}
+	if err != nil {
+		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Validation Error*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
+		return err
 	}
 
 	// Parse amount
@@ -225,11 +233,7 @@ func HandleExpenseAddAction(bot *gotgbot.Bot, ctx *ext.Context) (err error) {
 	}
 
 	// Create initial audit entry
-	formattedAmount := utilities.FormatMoney(cast.ToInt(amount))
-	initialAudit := fmt.Sprintf("[%s]: amount: %s - by %s",
-		time.Now().Format("02/01/2006 15:04"),
-		formattedAmount,
-		username)
+	initialAudit := NewExpenseAuditEntry(household, amount, username)
 
 	expense := models.Expense{
 		Name:         expenseName,
@@ -257,14 +261,14 @@ func HandleExpenseAddAction(bot *gotgbot.Bot, ctx *ext.Context) (err error) {
 	}
 
 	// Add regular expense to Google Sheets
-	newExpense, err = addNewExpense(expense)
+	newExpense, err = addNewExpense(ContextOf(ctx), household, expense)
 	if err != nil {
 		_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("*Failed to Add Expense*\n\n%s", err.Error()), &gotgbot.SendMessageOpts{ParseMode: "markdown"})
 		return err
 	}
 
 	// Reply to user with the details and action buttons
-	response := "*Expense Added*\n\n" + convertExpenseModelToMarkdown(*newExpense)
+	response := "*Expense Added*\n\n" + convertExpenseModelToMarkdown(*newExpense, members)
 
 	inlineKeyboard := gotgbot.InlineKeyboardMarkup{
 		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
@@ -287,70 +291,59 @@ func HandleExpenseAddAction(bot *gotgbot.Bot, ctx *ext.Context) (err error) {
 
 // upsertRentExpense is deprecated - use /rent command with handlers/rent.go instead
 
-func addNewExpense(expense models.Expense) (*models.Expense, error) {
-	// read spreadsheetId from config
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
-	if err != nil {
-		return nil, err
-	}
+// NewExpenseAuditEntry builds the initial audit entry of a new expense
+// e.g., [28/01/2026 21:22]: amount: 92,000 ₫ - by @tasszz2k
+func NewExpenseAuditEntry(household models.Household, amount string, username string) string {
+	return fmt.Sprintf("[%s]: amount: %s - by %s",
+		utilities.GetCurrentTimestamp(household.Location()),
+		utilities.FormatMoney(cast.ToInt(amount)),
+		username)
+}
 
-	// get next expense id
-	nextExpenseId, err := getNextExpenseId()
+// AddExpense adds a new expense to the current sheet and returns it with its ID and formatted amount
+func AddExpense(ctx context.Context, household models.Household, expense models.Expense) (*models.Expense, error) {
+	return addNewExpense(ctx, household, expense)
+}
+
+func addNewExpense(ctx context.Context, household models.Household, expense models.Expense) (*models.Expense, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	// read spreadsheetId from config
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return nil, err
 	}
 
-	// get next expense row
-	nextExpenseRow := config.ExpenseStartRow + nextExpenseId
-
-	// get next expense range
-	expenseRange := fmt.Sprintf(
-		"%s!%s%d:%s%d",
-		currentSheetName,
-		config.ExpenseStartCol,
-		nextExpenseRow,
-		config.ExpenseEndCol,
-		nextExpenseRow,
-	)
-
 	if expense.Participants == nil {
 		expense.Participants = []string{}
 	}
-	// write expense to Google Sheets
-	expense.ID = cast.ToUint32(nextExpenseId)
-	expenseValues := [][]interface{}{
-		{
-			expense.ID,
-			expense.Name,
-			cast.ToInt(expense.Amount),
-			expense.Date,
-			expense.Payer,
-			strings.Join(expense.Participants, ","),
-			expense.Note,
-		},
-	}
-	_, err = svc.Update(context.TODO(), spreadsheetId, expenseRange, &sheets.ValueRange{
-		Values: expenseValues,
-	})
+	// write expense to Google Sheets, the ID is allocated with the row
+	layout := config.GetSheetLayout(currentSheetName)
+	expenseValues := []interface{}{
+		nil,
+		expense.Name,
+		cast.ToInt(expense.Amount),
+		expense.Date,
+		expense.Payer,
+		strings.Join(expense.Participants, ","),
+		expense.Note,
+	}
+	id, err := services.AppendWithID(reqCtx, svc, spreadsheetId, services.IDTable{
+		SheetName:  currentSheetName,
+		StartCol:   layout.Expenses.StartCol,
+		EndCol:     layout.Expenses.EndCol,
+		HeaderRow:  layout.Expenses.HeaderRow,
+		NextIDCell: layout.NextExpenseID.String(),
+	}, expenseValues)
 	if err != nil {
-		logrus.Errorf("failed to update expense: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to add expense: %s", err.Error())
 		return nil, err
 	}
+	expense.ID = cast.ToUint32(id)
 
 	expense.Amount = utilities.FormatMoney(cast.ToInt(expense.Amount))
 
-	// update next expense id
-	nextExpenseId = nextExpenseId + 1
-	nextExpenseIdCell := config.GetNextExpenseIdCell(currentSheetName)
-	if _, err := svc.Update(context.TODO(), spreadsheetId, nextExpenseIdCell, &sheets.ValueRange{
-		Values: [][]interface{}{
-			{nextExpenseId},
-		},
-	}); err != nil {
-		logrus.Errorf("failed to update next expense id: %s", err.Error())
-		return nil, err
-	}
-
 	// return new expense
 
 	return &expense, nil
@@ -374,22 +367,25 @@ func checkValidExpenseInput(name string, amount string, str string, payer string
 	return nil
 }
 
-func getNextExpenseId() (int, error) {
+func getNextExpenseId(ctx context.Context, household models.Household) (int, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
 	// read spreadsheetId from config
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return 0, err
 	}
 
 	// get next expense id
-	nextExpenseIdCell := config.GetNextExpenseIdCell(currentSheetName)
+	nextExpenseIdCell := config.GetSheetLayout(currentSheetName).NextExpenseID.In(currentSheetName)
 	nextExpenseIdValue, err := svc.GetValue(
-		context.TODO(),
+		reqCtx,
 		spreadsheetId,
 		nextExpenseIdCell,
 	)
 	if err != nil {
-		logrus.Errorf("failed to get next expense id: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get next expense id: %s", err.Error())
 		return 0, err
 	}
 	nextExpenseId := cast.ToInt(nextExpenseIdValue)
@@ -414,7 +410,7 @@ func getNextExpenseId() (int, error) {
 // =================================================================
 func HandleSplitBillReportAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 	// Read the spreadsheet data and calculate the report
-	report, err := generateSplitBillReport()
+	report, err := generateSplitBillReport(ContextOf(ctx), HouseholdOf(ctx))
 	if err != nil {
 		return err
 	}
@@ -426,38 +422,60 @@ func HandleSplitBillReportAction(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return err
 }
 
-func generateSplitBillReport() (result string, err error) {
-	// read spreadsheetId from config
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+func generateSplitBillReport(ctx context.Context, household models.Household) (result string, err error) {
+	currentSheetName, err := GetCurrentSheetName(ctx, household)
 	if err != nil {
 		return "", err
 	}
-
-	report, err := getReport(svc, spreadsheetId, currentSheetName)
+	report, balances, err := GetMonthReport(ctx, household, currentSheetName)
 	if err != nil {
 		return "", err
 	}
+	return renderReportMarkdown(report, balances), nil
+}
+
+// GetMonthReport reads the report and the balances of a monthly sheet, with the rent payer as a @username
+func GetMonthReport(ctx context.Context, household models.Household, sheetName string) (models.Report, models.Balance, error) {
+	svc, spreadsheetId, _, err := GetCurrentSheetInfo(ctx, household)
+	if err != nil {
+		return models.Report{}, models.Balance{}, err
+	}
 
-	balances, err := getBalances(svc, spreadsheetId, currentSheetName)
+	report, err := getReport(ctx, svc, spreadsheetId, sheetName)
 	if err != nil {
-		return "", err
+		return models.Report{}, models.Balance{}, err
 	}
 
-	return renderReportMarkdown(report, balances), nil
+	balances, err := getBalances(ctx, svc, spreadsheetId, sheetName)
+	if err != nil {
+		return models.Report{}, models.Balance{}, err
+	}
+
+	// The rent payer cell stores a member reference
+	members, err := GetMembers(ctx, svc, spreadsheetId, sheetName)
+	if err != nil {
+		logrus.WithContext(ctx).Warnf("failed to get members, showing stored rent payer: %s", err.Error())
+	}
+	report.Rent.Note = models.DisplayRef(members, report.Rent.Note)
+
+	return report, balances, nil
 }
 
-func getBalances(svc *services.GSheets, spreadsheetId string, currentSheetName string) (models.Balance, error) {
+func getBalances(ctx context.Context, svc services.IGSheets, spreadsheetId string, currentSheetName string) (models.Balance, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
 	// get balances read range
-	numberOfMembers, err := GetNumberOfMembers(svc, spreadsheetId, currentSheetName)
+	numberOfMembers, err := GetNumberOfMembers(ctx, svc, spreadsheetId, currentSheetName)
 	if err != nil {
 		return models.Balance{}, err
 	}
 	balancesReadRange := getBalancesReadRange(currentSheetName, numberOfMembers)
 
 	// get balances data
-	balancesData, err := svc.Get(context.TODO(), spreadsheetId, balancesReadRange)
+	balancesData, err := svc.Get(reqCtx, spreadsheetId, balancesReadRange)
 	if err != nil {
-		logrus.Errorf("failed to get balances data: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get balances data: %s", err.Error())
 		return models.Balance{}, err
 	}
 
@@ -529,87 +547,72 @@ func renderReportMarkdown(report models.Report, balances models.Balance) string
 	return text
 }
 
-func getReport(svc *services.GSheets, spreadsheetId string, currentSheetName string) (models.Report, error) {
+func getReport(ctx context.Context, svc services.IGSheets, spreadsheetId string, currentSheetName string) (models.Report, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
 	// get report read range
 	reportReadRange := getReportReadRange(currentSheetName)
 
 	// get report data
-	reportData, err := svc.Get(context.TODO(), spreadsheetId, reportReadRange)
+	reportData, err := svc.Get(reqCtx, spreadsheetId, reportReadRange)
 	if err != nil {
-		logrus.Errorf("failed to get report data: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get report data: %s", err.Error())
 		return models.Report{}, err
 	}
 
 	// convert report data to models.Report
-	report := convertReportDataToReportModel(reportData.Values)
+	report := convertReportDataToReportModel(reportData.Values, config.GetSheetLayout(currentSheetName))
 	return report, nil
 }
 
-func convertReportDataToReportModel(data [][]any) models.Report {
-	// New template format (7 rows):
-	// Row 0: Header (Category, Amount, @tasszz2k, @ng0cth1nh, Payer)
-	// Row 1: Expenses
-	// Row 2: Electric
-	// Row 3: Water
-	// Row 4: Other Fees
-	// Row 5: Total Rent
-	// Row 6: Total
-
-	// convert data to [7][5] string array
-	reportArray := make([][5]string, 7)
-	for i, row := range data {
-		if i >= 7 {
-			break
-		}
-		for j, col := range row {
-			if j >= 5 {
-				break
+// convertReportDataToReportModel reads the expenses, total rent and grand total lines of the report.
+// In the default layout the rows are Header (Category, Amount, @tasszz2k, @ng0cth1nh, Payer), Expenses,
+// Electric, Water, Other Fees, Total Rent and Total; the payer is the last column.
+func convertReportDataToReportModel(data [][]any, layout models.SheetLayout) models.Report {
+	payerCol := layout.Report.Width() - 1
+	line := func(row int) models.ReportData {
+		i := row - layout.Report.Start.Row
+		value := func(j int) string {
+			if i >= len(data) || j >= len(data[i]) {
+				return ""
 			}
-			reportArray[i][j] = cast.ToString(col)
+			return cast.ToString(data[i][j])
+		}
+		return models.ReportData{
+			Amount:  value(1),
+			Average: value(2),
+			Note:    value(payerCol),
 		}
 	}
 
 	return models.Report{
-		Expenses: models.ReportData{
-			Amount:  reportArray[1][1],
-			Average: reportArray[1][2],
-			Note:    reportArray[1][4], // Payer column
-		},
-		Rent: models.ReportData{
-			Amount:  reportArray[5][1], // Total Rent row
-			Average: reportArray[5][2],
-			Note:    reportArray[5][4], // Payer column
-		},
-		Total: models.ReportData{
-			Amount:  reportArray[6][1], // Total row
-			Average: reportArray[6][2],
-			Note:    reportArray[6][4],
-		},
+		Expenses: line(layout.ReportRows.Expenses),
+		Rent:     line(layout.ReportRows.Rent),
+		Total:    line(layout.ReportRows.Total),
 	}
 }
 
 func getReportReadRange(currentSheetName string) string {
-	return fmt.Sprintf("%s!%s:%s", currentSheetName, config.ReportStartCell, config.ReportEndCell)
+	return config.GetSheetLayout(currentSheetName).Report.In(currentSheetName)
 }
 
 func getBalancesReadRange(currentSheetName string, numberOfMembers int) string {
-	return fmt.Sprintf(
-		"%s!%s:%s%d",
-		currentSheetName,
-		config.BalanceStartCell,
-		config.BalanceEndCol,
-		config.BalanceStartRow+numberOfMembers-1,
-	)
+	balances := config.GetSheetLayout(currentSheetName).Balances
+	return balances.Rows(currentSheetName, balances.FirstRow(), balances.HeaderRow+numberOfMembers)
 }
 
 // GetRecentExpenses fetches the last N expenses from Google Sheets
-func GetRecentExpenses(limit int) ([]models.Expense, error) {
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+func GetRecentExpenses(ctx context.Context, household models.Household, limit int) ([]models.Expense, error) {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return nil, err
 	}
 
-	nextExpenseId, err := getNextExpenseId()
+	nextExpenseId, err := getNextExpenseId(ctx, household)
 	if err != nil {
 		return nil, err
 	}
@@ -619,26 +622,20 @@ func GetRecentExpenses(limit int) ([]models.Expense, error) {
 	}
 
 	lastExpenseId := nextExpenseId - 1
-	lastExpenseRow := config.ExpenseStartRow + lastExpenseId
+	table := config.GetSheetLayout(currentSheetName).Expenses
+	lastExpenseRow := table.HeaderRow + lastExpenseId
 
 	// Calculate start row (limit expenses back from last)
 	startRow := lastExpenseRow - limit + 1
-	if startRow < config.ExpenseStartRow+1 {
-		startRow = config.ExpenseStartRow + 1
+	if startRow < table.FirstRow() {
+		startRow = table.FirstRow()
 	}
 
-	readRange := fmt.Sprintf(
-		"%s!%s%d:%s%d",
-		currentSheetName,
-		config.ExpenseStartCol,
-		startRow,
-		config.ExpenseEndCol,
-		lastExpenseRow,
-	)
+	readRange := table.Rows(currentSheetName, startRow, lastExpenseRow)
 
-	resp, err := svc.Get(context.TODO(), spreadsheetId, readRange)
+	resp, err := svc.Get(reqCtx, spreadsheetId, readRange)
 	if err != nil {
-		logrus.Errorf("failed to get recent expenses: %s", err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get recent expenses: %s", err.Error())
 		return nil, err
 	}
 
@@ -672,70 +669,69 @@ func GetRecentExpenses(limit int) ([]models.Expense, error) {
 }
 
 // GetExpenseById fetches a single expense by its ID
-func GetExpenseById(id int) (*models.Expense, error) {
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+func GetExpenseById(ctx context.Context, household models.Household, id int) (*models.Expense, error) {
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate row: ExpenseStartRow + id (row 4 for ID 1, row 5 for ID 2, etc.)
-	expenseRow := config.ExpenseStartRow + id
-
-	readRange := fmt.Sprintf(
-		"%s!%s%d:%s%d",
-		currentSheetName,
-		config.ExpenseStartCol,
-		expenseRow,
-		config.ExpenseEndCol,
-		expenseRow,
-	)
-
-	resp, err := svc.Get(context.TODO(), spreadsheetId, readRange)
+	table := config.GetSheetLayout(currentSheetName).Expenses
+	records, err := readRecordTable(ctx, svc, spreadsheetId, currentSheetName, table.StartCol, table.EndCol, table.HeaderRow, expenseHeaders)
 	if err != nil {
-		logrus.Errorf("failed to get expense by id %d: %s", id, err.Error())
+		logrus.WithContext(ctx).Errorf("failed to get expense by id %d: %s", id, err.Error())
 		return nil, err
 	}
 
-	if len(resp.Values) == 0 || len(resp.Values[0]) < 5 {
+	_, row, err := records.Find(id)
+	if errors.Is(err, models.ErrRecordNotFound) {
 		return nil, fmt.Errorf("expense with ID %d not found", id)
+	} else if err != nil {
+		return nil, err
 	}
 
-	row := resp.Values[0]
+	expense := expenseFromRecord(records, row)
+	return &expense, nil
+}
+
+// expenseFromRecord reads an expense from its row, by header
+func expenseFromRecord(records models.RecordTable, row []any) models.Expense {
 	expense := models.Expense{
-		ID:     cast.ToUint32(row[0]),
-		Name:   cast.ToString(row[1]),
-		Amount: cast.ToString(row[2]),
-		Date:   cast.ToString(row[3]),
-		Payer:  cast.ToString(row[4]),
-	}
-	if len(row) > 5 {
-		expense.Participants = cast.ToStringSlice(row[5])
+		ID:     cast.ToUint32(records.Value(row, "ID")),
+		Name:   cast.ToString(records.Value(row, "Name")),
+		Amount: cast.ToString(records.Value(row, "Amount")),
+		Date:   cast.ToString(records.Value(row, "Date")),
+		Payer:  cast.ToString(records.Value(row, "Payer")),
+		Note:   cast.ToString(records.Value(row, "Note")),
 	}
-	if len(row) > 6 {
-		expense.Note = cast.ToString(row[6])
+	if participants := records.Value(row, "Participants"); participants != nil {
+		expense.Participants = cast.ToStringSlice(participants)
 	}
-
-	return &expense, nil
+	return expense
 }
 
 // UpdateExpenseById updates an existing expense in Google Sheets with audit logging
-func UpdateExpenseById(oldExpense, newExpense models.Expense, username string) error {
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+func UpdateExpenseById(ctx context.Context, household models.Household, oldExpense, newExpense models.Expense, username string) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return err
 	}
 
-	// Calculate row: ExpenseStartRow + id
-	expenseRow := config.ExpenseStartRow + int(newExpense.ID)
+	// Check past the cache that expense n is still n rows below the header before writing over it
+	table := config.GetSheetLayout(currentSheetName).Expenses
+	records, err := readRecordTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId, currentSheetName, table.StartCol, table.EndCol, table.HeaderRow, expenseHeaders)
+	if err != nil {
+		return err
+	}
+	expenseRow, err := records.WriteRow(int(newExpense.ID))
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("refused to update expense id %d: %s", newExpense.ID, err.Error())
+		return err
+	}
 
-	expenseRange := fmt.Sprintf(
-		"%s!%s%d:%s%d",
-		currentSheetName,
-		config.ExpenseStartCol,
-		expenseRow,
-		config.ExpenseEndCol,
-		expenseRow,
-	)
+	expenseRange := table.Rows(currentSheetName, expenseRow, expenseRow)
 
 	if newExpense.Participants == nil {
 		newExpense.Participants = []string{}
@@ -744,7 +740,7 @@ func UpdateExpenseById(oldExpense, newExpense models.Expense, username string) e
 	// Build audit entry with formatted amount
 	formattedAmount := utilities.FormatMoney(cast.ToInt(newExpense.Amount))
 	auditEntry := fmt.Sprintf("[%s]: update amount: %s - by %s",
-		time.Now().Format("02/01/2006 15:04"),
+		utilities.GetCurrentTimestamp(household.Location()),
 		formattedAmount,
 		username)
 
@@ -756,26 +752,26 @@ func UpdateExpenseById(oldExpense, newExpense models.Expense, username string) e
 	}
 
 	expenseValues := [][]interface{}{
-		{
-			newExpense.ID,
-			newExpense.Name,
-			cast.ToInt(newExpense.Amount),
-			newExpense.Date,
-			newExpense.Payer,
-			strings.Join(newExpense.Participants, ","),
-			newExpense.Note,
-		},
-	}
-
-	_, err = svc.Update(context.TODO(), spreadsheetId, expenseRange, &sheets.ValueRange{
+		records.Row(map[string]any{
+			"ID":           newExpense.ID,
+			"Name":         newExpense.Name,
+			"Amount":       cast.ToInt(newExpense.Amount),
+			"Date":         newExpense.Date,
+			"Payer":        newExpense.Payer,
+			"Participants": strings.Join(newExpense.Participants, ","),
+			"Note":         newExpense.Note,
+		}),
+	}
+
+	_, err = svc.Update(reqCtx, spreadsheetId, expenseRange, &sheets.ValueRange{
 		Values: expenseValues,
 	})
 	if err != nil {
-		logrus.Errorf("failed to update expense id %d: %s", newExpense.ID, err.Error())
+		logrus.WithContext(ctx).Errorf("failed to update expense id %d: %s", newExpense.ID, err.Error())
 		return err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"expense_id": newExpense.ID,
 		"name":       newExpense.Name,
 		"amount":     newExpense.Amount,
@@ -786,27 +782,32 @@ func UpdateExpenseById(oldExpense, newExpense models.Expense, username string) e
 }
 
 // DeleteExpenseById performs a soft delete: keeps ID, clears other fields, appends deletion entry to audit log
-func DeleteExpenseById(id int, name string, amount string, existingNote string, username string) error {
-	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo()
+func DeleteExpenseById(ctx context.Context, household models.Household, id int, name string, amount string, existingNote string, username string) error {
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	svc, spreadsheetId, currentSheetName, err := GetCurrentSheetInfo(ctx, household)
 	if err != nil {
 		return err
 	}
 
-	// Calculate row: ExpenseStartRow + id
-	expenseRow := config.ExpenseStartRow + id
+	// Check past the cache that expense n is still n rows below the header before clearing it
+	table := config.GetSheetLayout(currentSheetName).Expenses
+	records, err := readRecordTable(ctx, services.GetUncachedGSheetsSvc(), spreadsheetId, currentSheetName, table.StartCol, table.EndCol, table.HeaderRow, expenseHeaders)
+	if err != nil {
+		return err
+	}
+	expenseRow, err := records.WriteRow(id)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("refused to delete expense id %d: %s", id, err.Error())
+		return err
+	}
 
-	expenseRange := fmt.Sprintf(
-		"%s!%s%d:%s%d",
-		currentSheetName,
-		config.ExpenseStartCol,
-		expenseRow,
-		config.ExpenseEndCol,
-		expenseRow,
-	)
+	expenseRange := table.Rows(currentSheetName, expenseRow, expenseRow)
 
 	// Build deletion audit entry
 	deletionEntry := fmt.Sprintf("[%s]: deleted: %s - %s - by %s",
-		time.Now().Format("02/01/2006 15:04"),
+		utilities.GetCurrentTimestamp(household.Location()),
 		name,
 		amount,
 		username)
@@ -821,18 +822,18 @@ func DeleteExpenseById(id int, name string, amount string, existingNote string,
 
 	// Soft delete: keep ID, clear other fields, append deletion to audit log
 	deleteValues := [][]interface{}{
-		{id, "", "", "", "", "", finalNote},
+		records.Row(map[string]any{"ID": id, "Name": "", "Amount": "", "Date": "", "Payer": "", "Participants": "", "Note": finalNote}),
 	}
 
-	_, err = svc.Update(context.TODO(), spreadsheetId, expenseRange, &sheets.ValueRange{
+	_, err = svc.Update(reqCtx, spreadsheetId, expenseRange, &sheets.ValueRange{
 		Values: deleteValues,
 	})
 	if err != nil {
-		logrus.Errorf("failed to delete expense id %d: %s", id, err.Error())
+		logrus.WithContext(ctx).Errorf("failed to delete expense id %d: %s", id, err.Error())
 		return err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"expense_id": id,
 		"name":       name,
 		"amount":     amount,
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/config"
+	"housematee-tgbot/models"
+	services "housematee-tgbot/services/gsheets"
+	"housematee-tgbot/utilities"
+)
+
+// taskHistoryHeaders are the headers of the TaskHistory sheet, written when the sheet is created
+var taskHistoryHeaders = []string{"Timestamp", "TaskID", "TaskName", "Event", "Doer", "Assignee", "DueDate", "Note"}
+
+// AppendTaskHistory appends an entry to the TaskHistory sheet, creating the sheet on first use
+func AppendTaskHistory(ctx context.Context, svc services.IGSheets, spreadsheetId string, entry models.TaskHistory) error {
+	if err := ensureSheet(ctx, svc, spreadsheetId, config.SeparatedSheetTaskHistoryName, taskHistoryHeaders); err != nil {
+		return err
+	}
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	if entry.Timestamp == "" {
+		entry.Timestamp = utilities.GetCurrentTimestamp(utilities.Location())
+	}
+
+	appendRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetTaskHistoryName, config.TaskHistoryStartCol, config.TaskHistoryStartRow, config.TaskHistoryEndCol)
+	values := [][]interface{}{
+		{
+			entry.Timestamp,
+			entry.TaskID,
+			entry.TaskName,
+			entry.Event,
+			entry.Doer,
+			entry.Assignee,
+			entry.DueDate,
+			entry.Note,
+		},
+	}
+	_, err := svc.Append(reqCtx, spreadsheetId, appendRange, &sheets.ValueRange{
+		Values: values,
+	})
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to append task history: %s", err.Error())
+		return err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"task_id":  entry.TaskID,
+		"event":    entry.Event,
+		"doer":     entry.Doer,
+		"assignee": entry.Assignee,
+	}).Info("task history appended")
+	return nil
+}
+
+// GetTaskHistory reads all entries of the TaskHistory sheet in chronological order, creating the sheet on first use
+func GetTaskHistory(ctx context.Context, svc services.IGSheets, spreadsheetId string) ([]models.TaskHistory, error) {
+	if err := ensureSheet(ctx, svc, spreadsheetId, config.SeparatedSheetTaskHistoryName, taskHistoryHeaders); err != nil {
+		return nil, err
+	}
+	reqCtx, cancel := services.NewRequestContext(ctx)
+	defer cancel()
+
+	readRange := fmt.Sprintf("%s!%s%d:%s", config.SeparatedSheetTaskHistoryName, config.TaskHistoryStartCol, config.TaskHistoryStartRow, config.TaskHistoryEndCol)
+	result, err := svc.Get(reqCtx, spreadsheetId, readRange)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("failed to get task history: %s", err.Error())
+		return nil, err
+	}
+
+	history := make([]models.TaskHistory, 0, len(result.Values))
+	for _, row := range result.Values {
+		// map row to the fixed length array (8 columns: Timestamp, TaskID, TaskName, Event, Doer, Assignee, DueDate, Note)
+		var value [8]string
+		for j := 0; j < len(row) && j < 8; j++ {
+			value[j] = cast.ToString(row[j])
+		}
+		if value[0] == "" {
+			continue
+		}
+		history = append(history, models.TaskHistory{
+			Timestamp: value[0],
+			TaskID:    cast.ToInt(value[1]),
+			TaskName:  value[2],
+			Event:     value[3],
+			Doer:      value[4],
+			Assignee:  value[5],
+			DueDate:   value[6],
+			Note:      value[7],
+		})
+	}
+	return history, nil
+}
+
+// CalculateHouseworkStats builds per-member statistics from the task history and the current tasks.
+// Members are returned in the order of the members list; doers who are not members are appended at the end.
+func CalculateHouseworkStats(history []models.TaskHistory, members []models.Member, tasks map[int]models.Task, now time.Time) []models.HouseworkStats {
+	statsByUser := make(map[string]*models.HouseworkStats)
+	order := make([]string, 0, len(members))
+	get := func(ref string) *models.HouseworkStats {
+		if s, ok := statsByUser[ref]; ok {
+			return s
+		}
+		s := &models.HouseworkStats{Username: ref, CoveredFor: make(map[string]int)}
+		statsByUser[ref] = s
+		order = append(order, ref)
+		return s
+	}
+	for _, m := range members {
+		get(m.Ref())
+	}
+
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	// Monday-based week
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+
+	for _, entry := range history {
+		if entry.Event != models.TaskEventDone || entry.Doer == "" {
+			continue
+		}
+		// Older entries store @usernames, newer ones member references
+		entry.Doer = models.NormalizeRef(members, entry.Doer)
+		entry.Assignee = models.NormalizeRef(members, entry.Assignee)
+		doneAt, err := time.ParseInLocation(utilities.TimestampLayout, entry.Timestamp, loc)
+		if err != nil {
+			logrus.Warnf("skipping task history entry with invalid timestamp %q", entry.Timestamp)
+			continue
+		}
+
+		doer := get(entry.Doer)
+		if !doneAt.Before(weekStart) {
+			doer.WeekDone++
+		}
+		inMonth := !doneAt.Before(monthStart)
+		if inMonth {
+			doer.MonthDone++
+		}
+
+		if entry.Assignee == "" {
+			continue
+		}
+		assignee := get(entry.Assignee)
+		if entry.Assignee == entry.Doer {
+			// A late turn breaks the streak like a covered one
+			if isLate(doneAt, entry.DueDate, loc) {
+				assignee.Streak = 0
+				if inMonth {
+					assignee.LateThisMonth++
+				}
+			} else {
+				assignee.Streak++
+			}
+		} else {
+			assignee.Streak = 0
+			if inMonth {
+				doer.CoveredFor[entry.Assignee]++
+			}
+		}
+	}
+
+	for _, task := range tasks {
+		if task.Assignee == "" {
+			continue
+		}
+		// Due today is not overdue yet
+		due, err := time.ParseInLocation(utilities.DateLayout, task.NextDue, loc)
+		if err == nil && due.Before(today) {
+			get(models.NormalizeRef(members, task.Assignee)).Overdue++
+		}
+	}
+
+	stats := make([]models.HouseworkStats, 0, len(order))
+	for _, ref := range order {
+		s := *statsByUser[ref]
+		s.Username = models.DisplayRef(members, ref)
+		coveredFor := make(map[string]int, len(s.CoveredFor))
+		for assignee, count := range s.CoveredFor {
+			coveredFor[models.DisplayRef(members, assignee)] += count
+		}
+		s.CoveredFor = coveredFor
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// isLate reports whether a task was completed after the day it was due
+func isLate(doneAt time.Time, dueDate string, loc *time.Location) bool {
+	due, err := time.ParseInLocation(utilities.DateLayout, dueDate, loc)
+	if err != nil {
+		return false
+	}
+	return doneAt.After(due.AddDate(0, 0, 1))
+}
+
+// FormatHouseworkStats formats the per-member statistics as markdown
+func FormatHouseworkStats(stats []models.HouseworkStats) string {
+	var sb strings.Builder
+	sb.WriteString("*Housework Stats*\n\n")
+	if len(stats) == 0 {
+		sb.WriteString("_No completions recorded yet._")
+		return sb.String()
+	}
+
+	for _, s := range stats {
+		sb.WriteString(fmt.Sprintf("*%s*\n", s.Username))
+		sb.WriteString(fmt.Sprintf("• *Done*: %d this week, %d this month\n", s.WeekDone, s.MonthDone))
+		sb.WriteString(fmt.Sprintf("• *Streak*: %d\n", s.Streak))
+		sb.WriteString(fmt.Sprintf("• *Overdue*: %d (late this month: %d)\n", s.Overdue, s.LateThisMonth))
+		if len(s.CoveredFor) > 0 {
+			covered := make([]string, 0, len(s.CoveredFor))
+			for assignee, count := range s.CoveredFor {
+				covered = append(covered, fmt.Sprintf("%s (%d)", assignee, count))
+			}
+			sort.Strings(covered)
+			sb.WriteString(fmt.Sprintf("• *Covered for*: %s\n", strings.Join(covered, ", ")))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
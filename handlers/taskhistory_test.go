@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"housematee-tgbot/models"
+)
+
+func TestCalculateHouseworkStats(t *testing.T) {
+	loc := time.UTC
+	// Wednesday; the week starts on Monday 12/10/2026
+	now := time.Date(2026, 10, 14, 20, 0, 0, 0, loc)
+	members := []models.Member{{ID: 1, Username: "@alice"}, {ID: 2, Username: "@bob"}}
+	done := func(at, doer, assignee, due string) models.TaskHistory {
+		return models.TaskHistory{Timestamp: at, TaskID: 1, Event: models.TaskEventDone, Doer: doer, Assignee: assignee, DueDate: due}
+	}
+
+	tests := []struct {
+		name    string
+		history []models.TaskHistory
+		tasks   map[int]models.Task
+		want    map[string]models.HouseworkStats
+	}{
+		{
+			name: "week and month counts",
+			history: []models.TaskHistory{
+				done("30/09/2026 10:00", "@alice", "@alice", "30/09/2026"),
+				done("05/10/2026 10:00", "@alice", "@alice", "05/10/2026"),
+				done("12/10/2026 10:00", "@alice", "@alice", "12/10/2026"),
+				done("14/10/2026 10:00", "@bob", "@bob", "14/10/2026"),
+			},
+			want: map[string]models.HouseworkStats{
+				"@alice": {WeekDone: 1, MonthDone: 2, Streak: 3},
+				"@bob":   {WeekDone: 1, MonthDone: 1, Streak: 1},
+			},
+		},
+		{
+			name: "covering resets the streak of the assignee",
+			history: []models.TaskHistory{
+				done("05/10/2026 10:00", "@alice", "@alice", "05/10/2026"),
+				done("06/10/2026 10:00", "@alice", "@alice", "06/10/2026"),
+				done("07/10/2026 10:00", "@bob", "@alice", "07/10/2026"),
+			},
+			want: map[string]models.HouseworkStats{
+				"@alice": {MonthDone: 2},
+				"@bob":   {MonthDone: 1, CoveredFor: map[string]int{"@alice": 1}},
+			},
+		},
+		{
+			name: "a late turn resets the streak",
+			history: []models.TaskHistory{
+				done("05/10/2026 10:00", "@alice", "@alice", "05/10/2026"),
+				done("08/10/2026 10:00", "@alice", "@alice", "06/10/2026"),
+				done("09/10/2026 23:00", "@alice", "@alice", "09/10/2026"),
+			},
+			want: map[string]models.HouseworkStats{
+				"@alice": {MonthDone: 3, Streak: 1, LateThisMonth: 1},
+				"@bob":   {},
+			},
+		},
+		{
+			name: "overdue tasks, not the ones due today",
+			tasks: map[int]models.Task{
+				1: {ID: 1, Assignee: "@bob", NextDue: "13/10/2026"},
+				2: {ID: 2, Assignee: "@bob", NextDue: "14/10/2026"},
+				3: {ID: 3, Assignee: "@alice", NextDue: "20/10/2026"},
+			},
+			want: map[string]models.HouseworkStats{
+				"@alice": {},
+				"@bob":   {Overdue: 1},
+			},
+		},
+		{
+			name: "doers who are not members and other events",
+			history: []models.TaskHistory{
+				done("14/10/2026 10:00", "@carol", "@bob", "14/10/2026"),
+				{Timestamp: "14/10/2026 11:00", Event: models.TaskEventSwap, Doer: "@alice", Assignee: "@bob"},
+				done("not a date", "@alice", "@alice", "14/10/2026"),
+			},
+			want: map[string]models.HouseworkStats{
+				"@alice": {},
+				"@bob":   {},
+				"@carol": {WeekDone: 1, MonthDone: 1, CoveredFor: map[string]int{"@bob": 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := CalculateHouseworkStats(tt.history, members, tt.tasks, now)
+			if len(stats) != len(tt.want) {
+				t.Fatalf("stats = %+v", stats)
+			}
+			for _, got := range stats {
+				want, ok := tt.want[got.Username]
+				if !ok {
+					t.Errorf("unexpected member %s", got.Username)
+					continue
+				}
+				want.Username = got.Username
+				if want.CoveredFor == nil {
+					want.CoveredFor = map[string]int{}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %+v, want %+v", got.Username, got, want)
+				}
+			}
+		})
+	}
+}
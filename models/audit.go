@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// auditAmountPattern matches the entries of an added or updated expense, e.g., "update amount: 160,000 ₫ - by @bob"
+	auditAmountPattern = regexp.MustCompile(`^(?:update )?amount: (.+) - by .+$`)
+	// auditDeletedPattern matches the entry of a deleted expense, e.g., "deleted: Milk - 30,000 ₫ - by @bob"
+	auditDeletedPattern = regexp.MustCompile(`^deleted: .* - by .+$`)
+)
+
+// ExpenseReplay is the state of an expense replayed from the audit lines of its note
+type ExpenseReplay struct {
+	Amount  int64
+	Deleted bool
+	// At is the timestamp of the last replayed line
+	At string
+}
+
+// AuditFinding is an expense whose row does not match the replay of its audit trail,
+// such as an amount edited directly in the spreadsheet
+type AuditFinding struct {
+	Sheet     string
+	ExpenseID uint32
+	Problem   string
+}
+
+// ReplayExpenseAudit replays the audit lines of the note of an expense in order.
+// It returns false when the note has no amount or deletion line.
+func ReplayExpenseAudit(note string) (ExpenseReplay, bool) {
+	var replay ExpenseReplay
+	found := false
+	for _, line := range strings.Split(note, "\n") {
+		m := auditLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		if amount := auditAmountPattern.FindStringSubmatch(m[2]); amount != nil {
+			replay = ExpenseReplay{Amount: parseDigits(amount[1]), At: m[1]}
+			found = true
+		} else if auditDeletedPattern.MatchString(m[2]) {
+			replay = ExpenseReplay{Deleted: true, At: m[1]}
+			found = true
+		}
+	}
+	return replay, found
+}
+
+// ReplayAudit replays the audit trail of every expense of the months and lists the rows that do not match it.
+// Amounts must be plain numbers, as in an export.
+func ReplayAudit(months []MonthData) []AuditFinding {
+	findings := make([]AuditFinding, 0)
+	for _, month := range months {
+		for _, expense := range month.Expenses {
+			replay, ok := ReplayExpenseAudit(expense.Note)
+			problem := ""
+			switch {
+			case !ok && expense.Amount != "":
+				problem = "no audit trail, added outside the bot"
+			case !ok:
+				continue
+			case replay.Deleted && expense.Amount != "":
+				problem = fmt.Sprintf("deleted at %s but the row has amount %s", replay.At, expense.Amount)
+			case !replay.Deleted && expense.Amount == "":
+				problem = fmt.Sprintf("cleared without a deletion entry, last amount %d at %s", replay.Amount, replay.At)
+			case !replay.Deleted && parseDigits(expense.Amount) != replay.Amount:
+				problem = fmt.Sprintf("amount %s, the audit trail ends with %d at %s", expense.Amount, replay.Amount, replay.At)
+			}
+			if problem != "" {
+				findings = append(findings, AuditFinding{Sheet: month.Sheet, ExpenseID: expense.ID, Problem: problem})
+			}
+		}
+	}
+	return findings
+}
+
+// parseDigits reads the digits of an amount, ignoring the separators and the currency, e.g., "92,000 ₫"
+func parseDigits(value string) int64 {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+	n, _ := strconv.ParseInt(digits, 10, 64)
+	return n
+}
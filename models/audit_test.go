@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplayExpenseAudit(t *testing.T) {
+	note := "bought at the market\n[25/10/2026 10:30]: amount: 150,000 ₫ - by @alice\n[26/10/2026 09:00]: update amount: 160,000 ₫ - by @bob"
+	replay, ok := ReplayExpenseAudit(note)
+	if !ok || replay.Amount != 160000 || replay.Deleted || replay.At != "26/10/2026 09:00" {
+		t.Errorf("replay = %+v, %v", replay, ok)
+	}
+
+	replay, ok = ReplayExpenseAudit(note + "\n[27/10/2026 08:00]: deleted: Milk - 160,000 ₫ - by @bob")
+	if !ok || !replay.Deleted {
+		t.Errorf("replay of a deleted expense = %+v, %v", replay, ok)
+	}
+
+	if _, ok := ReplayExpenseAudit("bought at the market"); ok {
+		t.Error("a note without audit lines has nothing to replay")
+	}
+}
+
+func TestReplayAudit(t *testing.T) {
+	added := "[25/10/2026 10:30]: amount: 150,000 ₫ - by @alice"
+	deleted := added + "\n[26/10/2026 09:00]: deleted: Milk - 150,000 ₫ - by @alice"
+	months := []MonthData{{Sheet: "2026_10", Expenses: []Expense{
+		{ID: 1, Amount: "150000", Note: added},
+		{ID: 2, Amount: "170000", Note: added},
+		{ID: 3, Note: deleted},
+		{ID: 4, Amount: "150000", Note: deleted},
+		{ID: 5, Note: added},
+		{ID: 6, Amount: "30000"},
+		{ID: 7},
+	}}}
+
+	findings := ReplayAudit(months)
+	want := map[uint32]string{2: "amount 170000", 4: "deleted at", 5: "cleared without", 6: "no audit trail"}
+	if len(findings) != len(want) {
+		t.Fatalf("findings = %+v", findings)
+	}
+	for _, finding := range findings {
+		if finding.Sheet != "2026_10" || !strings.Contains(finding.Problem, want[finding.ExpenseID]) {
+			t.Errorf("unexpected finding %+v", finding)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// MemberBalance is the balance of a member in a monthly sheet, with the columns of the Balances section
+type MemberBalance struct {
+	Username string
+	// TotalPaid is the sum of the expenses paid by the member
+	TotalPaid int64
+	// HaveToPay is the share of the expenses of the member
+	HaveToPay int64
+	// Balance is TotalPaid - HaveToPay
+	Balance int64
+	// FinalBalance is Balance, plus the total rent when the member paid it, minus the rent share
+	FinalBalance int64
+}
+
+// ComputeBalances computes the balances of the members of a month from its expenses and rent, the way the
+// Balances section of the sheet does: an expense is shared equally by its participants, or by every member
+// when it has none, and the rent by rentShares, in the order of month.Members.
+// It also returns the IDs of the expenses left out because their payer or a participant is not a member.
+func ComputeBalances(month MonthData, rentShares []int64) ([]MemberBalance, []uint32) {
+	members := month.Members
+	paid := make([]float64, len(members))
+	owed := make([]float64, len(members))
+	skipped := make([]uint32, 0)
+
+	memberIndex := func(ref string) int {
+		m := FindMemberByRef(members, ref)
+		if m == nil {
+			return -1
+		}
+		for i := range members {
+			if &members[i] == m {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, expense := range month.Expenses {
+		// Deleted expenses keep their ID with the other cells cleared
+		if expense.Amount == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(expense.Amount, 64)
+		if err != nil {
+			skipped = append(skipped, expense.ID)
+			continue
+		}
+		payer := memberIndex(expense.Payer)
+		participants := make([]int, 0, len(expense.Participants))
+		for _, ref := range expense.Participants {
+			participants = append(participants, memberIndex(ref))
+		}
+		if len(participants) == 0 {
+			for i := range members {
+				participants = append(participants, i)
+			}
+		}
+		if payer < 0 || len(participants) == 0 || slices.Contains(participants, -1) {
+			skipped = append(skipped, expense.ID)
+			continue
+		}
+
+		paid[payer] += amount
+		for _, i := range participants {
+			owed[i] += amount / float64(len(participants))
+		}
+	}
+
+	rentPayer, rentTotal := -1, int64(0)
+	if month.Rent != nil {
+		rentPayer, rentTotal = memberIndex(month.Rent.Payer), month.Rent.Total
+	}
+
+	balances := make([]MemberBalance, len(members))
+	for i, m := range members {
+		b := MemberBalance{
+			Username:  m.Username,
+			TotalPaid: int64(math.Round(paid[i])),
+			HaveToPay: int64(math.Round(owed[i])),
+		}
+		b.Balance = b.TotalPaid - b.HaveToPay
+		b.FinalBalance = b.Balance
+		if i == rentPayer {
+			b.FinalBalance += rentTotal
+		}
+		if i < len(rentShares) {
+			b.FinalBalance -= rentShares[i]
+		}
+		balances[i] = b
+	}
+	return balances, skipped
+}
+
+// BalanceFormulas returns the formulas of the Balances line of the member on row i (0 for the first member) of the
+// Members section. They match the payer and participants against the Telegram user ID of the member when byUserID,
+// the value the records hold once /members migrate switched the spreadsheet to user ID references, and against the
+// username before, and compute what ComputeBalances computes. The line is empty while the member row is.
+func (l SheetLayout) BalanceFormulas(i int, byUserID bool) []any {
+	row := l.Members.FirstRow() + i
+	balanceRow := l.Balances.FirstRow() + i
+	username := fmt.Sprintf("$%s%d", columnAt(l.Members.StartCol, 1), row)
+	ref := fmt.Sprintf("%s&\"\"", username)
+	if byUserID {
+		ref = fmt.Sprintf("$%s%d&\"\"", columnAt(l.Members.StartCol, 3), row)
+	}
+
+	// Whole columns of the expenses, below the header
+	column := func(n int) string {
+		col := columnAt(l.Expenses.StartCol, n)
+		return fmt.Sprintf("$%s$%d:$%s", col, l.Expenses.FirstRow(), col)
+	}
+	ids, amounts, payers, participants := column(0), column(2), column(4), column(5)
+	count := fmt.Sprintf("$%s$%d", l.MembersCount.Col, l.MembersCount.Row)
+
+	totalPaid := fmt.Sprintf("SUMPRODUCT(ARRAYFORMULA(IFERROR((%s&\"\"=%s)*%s,0)))", payers, ref, amounts)
+	// An expense without participants is shared by every member
+	participantCount := fmt.Sprintf("(LEN(%s)-LEN(SUBSTITUTE(%s,\",\",\"\"))+1)", participants, participants)
+	isParticipant := fmt.Sprintf("ISNUMBER(SEARCH(\",\"&%s&\",\",\",\"&SUBSTITUTE(%s,\" \",\"\")&\",\"))", ref, participants)
+	haveToPay := fmt.Sprintf("ROUND(SUMPRODUCT(ARRAYFORMULA(IFERROR(IF(%s=\"\",(%s<>\"\")*%s/%s,%s*%s/%s),0))))",
+		participants, ids, amounts, count, isParticipant, amounts, participantCount)
+
+	balanceCol := func(n int) string {
+		return fmt.Sprintf("%s%d", columnAt(l.Balances.StartCol, n), balanceRow)
+	}
+	finalBalance := balanceCol(3)
+	if l.HasRent() {
+		total := fmt.Sprintf("$%s$%d", l.Rent.Start.Col, l.Rent.Start.Row+3)
+		payer := fmt.Sprintf("$%s$%d", l.RentPayer.Col, l.RentPayer.Row)
+		finalBalance = fmt.Sprintf("%s+IF(%s&\"\"=%s,%s,0)-%s", balanceCol(3), payer, ref, total, l.rentShareFormula(i))
+	}
+
+	guard := func(formula string) any {
+		return fmt.Sprintf("=IF(%s=\"\",\"\",%s)", username, formula)
+	}
+	return []any{
+		guard(username),
+		guard(totalPaid),
+		guard(haveToPay),
+		guard(fmt.Sprintf("%s-%s", balanceCol(1), balanceCol(2))),
+		guard(finalBalance),
+	}
+}
+
+// rentShareFormula is the rent share of the member on row i of the Members section: the share /rent wrote with the
+// split policy of the month, or while there is none, the default policy: electric and water by weight, where an
+// empty weight is 1, and the other fees equally
+func (l SheetLayout) rentShareFormula(i int) string {
+	row := l.Members.FirstRow() + i
+	usernames := fmt.Sprintf("$%s$%d:$%s", columnAt(l.Members.StartCol, 1), l.Members.FirstRow(), columnAt(l.Members.StartCol, 1))
+	weightCol := columnAt(l.Members.StartCol, 2)
+	weights := fmt.Sprintf("$%s$%d:$%s", weightCol, l.Members.FirstRow(), weightCol)
+	weight := fmt.Sprintf("IF($%s%d=\"\",1,$%s%d)", weightCol, row, weightCol, row)
+	totalWeight := fmt.Sprintf("(SUM(%s)+COUNTIFS(%s,\"<>\",%s,\"\"))", weights, usernames, weights)
+	amount := func(n int) string {
+		return fmt.Sprintf("$%s$%d", l.Rent.Start.Col, l.Rent.Start.Row+n)
+	}
+	count := fmt.Sprintf("$%s$%d", l.MembersCount.Col, l.MembersCount.Row)
+	byDefault := fmt.Sprintf("ROUND((%s+%s)*%s/%s+%s/%s)", amount(0), amount(1), weight, totalWeight, amount(2), count)
+	if !l.HasRentShares() {
+		return byDefault
+	}
+	share := fmt.Sprintf("$%s%d", l.RentShares.StartCol, row)
+	return fmt.Sprintf("IF(%s=\"\",%s,%s)", share, byDefault, share)
+}
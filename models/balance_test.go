@@ -0,0 +1,104 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeBalances(t *testing.T) {
+	// The example of the Balances section: @alice paid the rent of 5,500,000 split in two
+	month := MonthData{
+		Members: []Member{{ID: 1, Username: "@alice", UserID: 111}, {ID: 2, Username: "@bob"}},
+		Expenses: []Expense{
+			{ID: 1, Amount: "1720900", Payer: "111"},
+			{ID: 2, Amount: "278600", Payer: "@bob", Participants: []string{}},
+			// Deleted
+			{ID: 3},
+			{ID: 4, Amount: "90000", Payer: "@carol"},
+		},
+		Rent: &RentCells{Total: 5500000, Payer: "111"},
+	}
+
+	balances, skipped := ComputeBalances(month, []int64{2750000, 2750000})
+	want := []MemberBalance{
+		{Username: "@alice", TotalPaid: 1720900, HaveToPay: 999750, Balance: 721150, FinalBalance: 3471150},
+		{Username: "@bob", TotalPaid: 278600, HaveToPay: 999750, Balance: -721150, FinalBalance: -3471150},
+	}
+	if !reflect.DeepEqual(balances, want) {
+		t.Errorf("balances = %+v, want %+v", balances, want)
+	}
+	if !reflect.DeepEqual(skipped, []uint32{4}) {
+		t.Errorf("skipped = %v, want [4]", skipped)
+	}
+}
+
+func TestComputeBalancesParticipants(t *testing.T) {
+	month := MonthData{
+		Members: []Member{{Username: "@alice"}, {Username: "@bob"}, {Username: "@carol"}},
+		Expenses: []Expense{
+			{ID: 1, Amount: "100", Payer: "@alice", Participants: []string{"@alice", "@bob", "@carol"}},
+			{ID: 2, Amount: "60", Payer: "@carol", Participants: []string{"@bob", "@carol"}},
+		},
+	}
+	balances, _ := ComputeBalances(month, nil)
+	// 100 / 3 is rounded for each member
+	for i, want := range []int64{33, 63, 63} {
+		if balances[i].HaveToPay != want {
+			t.Errorf("%s has to pay %d, want %d", balances[i].Username, balances[i].HaveToPay, want)
+		}
+	}
+	if balances[2].FinalBalance != balances[2].Balance {
+		t.Errorf("without rent the final balance is the balance, got %+v", balances[2])
+	}
+}
+
+func TestBalanceFormulas(t *testing.T) {
+	layout, err := ParseLayout(sampleLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second member: row 5 of the Members section, row 14 of the Balances section
+	formulas := layout.BalanceFormulas(1, true)
+	want := []any{
+		`=IF($P5="","",$P5)`,
+		`=IF($P5="","",SUMPRODUCT(ARRAYFORMULA(IFERROR(($E$4:$E&""=$R5&"")*$C$4:$C,0))))`,
+		`=IF($P5="","",ROUND(SUMPRODUCT(ARRAYFORMULA(IFERROR(IF($F$4:$F="",($A$4:$A<>"")*$C$4:$C/$P$2,` +
+			`ISNUMBER(SEARCH(","&$R5&""&",",","&SUBSTITUTE($F$4:$F," ","")&","))*$C$4:$C/(LEN($F$4:$F)-LEN(SUBSTITUTE($F$4:$F,",",""))+1)),0)))))`,
+		`=IF($P5="","",J14-K14)`,
+		`=IF($P5="","",L14+IF($M$8&""=$R5&"",$J$8,0)-IF($T5="",` +
+			`ROUND(($J$5+$J$6)*IF($Q5="",1,$Q5)/(SUM($Q$4:$Q)+COUNTIFS($P$4:$P,"<>",$Q$4:$Q,""))+$J$7/$P$2),$T5))`,
+	}
+	if !reflect.DeepEqual(formulas, want) {
+		for i := range want {
+			if formulas[i] != want[i] {
+				t.Errorf("column %d = %s\nwant %s", i, formulas[i], want[i])
+			}
+		}
+	}
+
+	// Before /members migrate, the records hold usernames
+	if got := layout.BalanceFormulas(1, false)[1]; got != `=IF($P5="","",SUMPRODUCT(ARRAYFORMULA(IFERROR(($E$4:$E&""=$P5&"")*$C$4:$C,0))))` {
+		t.Errorf("total paid by username = %s", got)
+	}
+
+	// Without rent shares, the rent is split by default
+	spec := sampleLayout()
+	spec.RentShares = ""
+	if layout, err = ParseLayout(spec); err != nil {
+		t.Fatal(err)
+	}
+	if got := layout.BalanceFormulas(1, true)[4]; got != `=IF($P5="","",L14+IF($M$8&""=$R5&"",$J$8,0)-`+
+		`ROUND(($J$5+$J$6)*IF($Q5="",1,$Q5)/(SUM($Q$4:$Q)+COUNTIFS($P$4:$P,"<>",$Q$4:$Q,""))+$J$7/$P$2))` {
+		t.Errorf("final balance without rent shares = %s", got)
+	}
+
+	// Without rent cells, the final balance is the balance
+	spec.Report, spec.ReportRows, spec.Balances, spec.Rent, spec.RentPayer = "I3:M6", ReportRowsSpec{Expenses: 4, Rent: 5, Total: 6}, "I8:M", "", ""
+	if layout, err = ParseLayout(spec); err != nil {
+		t.Fatal(err)
+	}
+	if got := layout.BalanceFormulas(0, true)[4]; got != `=IF($P4="","",L9)` {
+		t.Errorf("final balance without rent = %s", got)
+	}
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"housematee-tgbot/utilities"
+)
+
+// ExportFormat is the version of the export format, imports of another version are refused
+const ExportFormat = 1
+
+// Export is the data of a household for a month or a year, as written to export.json by /export and read by /import
+type Export struct {
+	Format     int          `json:"format"`
+	Period     ExportPeriod `json:"period"`
+	ExportedAt string       `json:"exported_at"`
+	Months     []MonthData  `json:"months"`
+	// Tasks are the tasks as they are now, whatever the period
+	Tasks       []Task        `json:"tasks"`
+	TaskHistory []TaskHistory `json:"task_history"`
+	// Audit is built from the expense notes and the task history; imports ignore it
+	Audit []AuditEntry `json:"audit"`
+}
+
+// MonthData is the data of a monthly sheet
+type MonthData struct {
+	Sheet    string    `json:"sheet"`
+	Members  []Member  `json:"members"`
+	Expenses []Expense `json:"expenses"`
+	// Rent is nil when the layout of the sheet has no rent cells
+	Rent *RentCells `json:"rent,omitempty"`
+}
+
+// RentCells are the rent amounts and the payer saved in a monthly sheet
+type RentCells struct {
+	Electric  int64  `json:"electric"`
+	Water     int64  `json:"water"`
+	OtherFees int64  `json:"other_fees"`
+	Total     int64  `json:"total"`
+	Payer     string `json:"payer"`
+	// Shares are the rent shares of the members, in their order, that /rent saved with the split policy of the month
+	Shares []int64 `json:"shares,omitempty"`
+}
+
+// Equal reports whether two rents have the same amounts, payer and shares
+func (r RentCells) Equal(other RentCells) bool {
+	return r.Electric == other.Electric && r.Water == other.Water && r.OtherFees == other.OtherFees &&
+		r.Total == other.Total && r.Payer == other.Payer && slices.Equal(r.Shares, other.Shares)
+}
+
+// AuditEntry is a line of the audit trail of an expense or a task history event
+type AuditEntry struct {
+	Timestamp string `json:"timestamp"`
+	Source    string `json:"source"` // "expense" or "task"
+	Sheet     string `json:"sheet,omitempty"`
+	RecordID  int    `json:"record_id"`
+	Entry     string `json:"entry"`
+}
+
+// ExportPeriod is the month (YYYY_MM) or the year (YYYY) of an export
+type ExportPeriod string
+
+// ExportAll is the period of every monthly sheet, "all" in commands
+const ExportAll ExportPeriod = ""
+
+var exportPeriodPattern = regexp.MustCompile(`^\d{4}(_(0[1-9]|1[0-2]))?$`)
+
+// monthSheetPattern matches the names of the monthly sheets
+var monthSheetPattern = regexp.MustCompile(`^\d{4}_(0[1-9]|1[0-2])$`)
+
+// ParseExportPeriod parses a month as YYYY_MM, a year as YYYY or "all"
+func ParseExportPeriod(s string) (ExportPeriod, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "all") {
+		return ExportAll, nil
+	}
+	if !exportPeriodPattern.MatchString(s) {
+		return "", fmt.Errorf("%q is not a month (YYYY_MM), a year (YYYY) or all", s)
+	}
+	return ExportPeriod(s), nil
+}
+
+func (p ExportPeriod) String() string {
+	if p == ExportAll {
+		return "all"
+	}
+	return string(p)
+}
+
+// IncludesSheet reports whether a monthly sheet is in the period; other sheets never are
+func (p ExportPeriod) IncludesSheet(sheetName string) bool {
+	return monthSheetPattern.MatchString(sheetName) && strings.HasPrefix(sheetName, string(p))
+}
+
+// IncludesTimestamp reports whether a DD/MM/YYYY HH:mm timestamp or a DD/MM/YYYY date is in the period
+func (p ExportPeriod) IncludesTimestamp(timestamp string) bool {
+	if p == ExportAll {
+		return true
+	}
+	t, err := time.Parse(utilities.TimestampLayout, timestamp)
+	if err != nil {
+		if t, err = time.Parse(utilities.DateLayout, timestamp); err != nil {
+			return false
+		}
+	}
+	return strings.HasPrefix(t.Format("2006_01"), string(p))
+}
+
+// auditLinePattern matches the audit lines of the expense notes, e.g., "[25/01/2026 10:30]: amount: 150,000 - by @alice"
+var auditLinePattern = regexp.MustCompile(`^\[([^\]]+)\]:\s*(.*)$`)
+
+// BuildAudit lists the audit lines of the expense notes and the task history events, oldest sheet first
+func BuildAudit(months []MonthData, history []TaskHistory) []AuditEntry {
+	entries := make([]AuditEntry, 0)
+	for _, month := range months {
+		for _, expense := range month.Expenses {
+			for _, line := range strings.Split(expense.Note, "\n") {
+				m := auditLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+				if m == nil {
+					continue
+				}
+				entries = append(entries, AuditEntry{Timestamp: m[1], Source: "expense", Sheet: month.Sheet, RecordID: int(expense.ID), Entry: m[2]})
+			}
+		}
+	}
+	for _, h := range history {
+		entry := fmt.Sprintf("%s by %s", h.Event, h.Doer)
+		if h.Note != "" {
+			entry += ": " + h.Note
+		}
+		entries = append(entries, AuditEntry{Timestamp: h.Timestamp, Source: "task", RecordID: h.TaskID, Entry: entry})
+	}
+	return entries
+}
+
+// Validate checks an export before it is imported
+func (e Export) Validate() error {
+	if e.Format != ExportFormat {
+		return fmt.Errorf("export format %d is not supported, expected %d", e.Format, ExportFormat)
+	}
+	sheets := make(map[string]bool)
+	for _, month := range e.Months {
+		if !monthSheetPattern.MatchString(month.Sheet) {
+			return fmt.Errorf("%q is not a monthly sheet (YYYY_MM)", month.Sheet)
+		}
+		if sheets[month.Sheet] {
+			return fmt.Errorf("sheet %s is exported twice", month.Sheet)
+		}
+		sheets[month.Sheet] = true
+
+		usernames := make(map[string]bool)
+		for _, m := range month.Members {
+			name := strings.ToLower(m.Username)
+			if name == "" || usernames[name] {
+				return fmt.Errorf("%s: member %q is empty or listed twice", month.Sheet, m.Username)
+			}
+			usernames[name] = true
+		}
+		ids := make(map[uint32]bool)
+		for _, expense := range month.Expenses {
+			if expense.ID == 0 || ids[expense.ID] {
+				return fmt.Errorf("%s: expense ID %d is missing or listed twice", month.Sheet, expense.ID)
+			}
+			ids[expense.ID] = true
+		}
+	}
+	ids := make(map[int]bool)
+	for _, task := range e.Tasks {
+		if task.ID <= 0 || ids[task.ID] {
+			return fmt.Errorf("task ID %d is missing or listed twice", task.ID)
+		}
+		ids[task.ID] = true
+	}
+	return nil
+}
+
+// Import actions
+const (
+	ImportCreateSheet = "create"
+	ImportAdd         = "add"
+	ImportUpdate      = "update"
+)
+
+// ImportChange is a change an import makes to the spreadsheet, shown in the dry run
+type ImportChange struct {
+	Action string
+	Target string // e.g., "2026_10 expense 3"
+	Detail string
+}
+
+// MonthImport is what an import writes to a monthly sheet
+type MonthImport struct {
+	Sheet string
+	// Members is the merged members list, nil when it does not change
+	Members []Member
+	// Expenses are the expenses to add or overwrite
+	Expenses []Expense
+	// Rent is nil when it does not change
+	Rent *RentCells
+}
+
+// ImportPlan is the result of the dry run of an import: what changes and what to write.
+// Imports never remove: members, expenses, tasks and history entries that are only in the spreadsheet stay.
+type ImportPlan struct {
+	Changes   []ImportChange
+	Unchanged int
+	// NewSheets are created from the Template before the months are written
+	NewSheets   []string
+	Months      []MonthImport
+	Tasks       []Task
+	TaskHistory []TaskHistory
+}
+
+// IsEmpty reports whether the import changes nothing
+func (p ImportPlan) IsEmpty() bool {
+	return len(p.Changes) == 0
+}
+
+// Hash identifies the changes and the writes of the plan: two plans with the same hash write the same data
+func (p ImportPlan) Hash() string {
+	// the plan only holds plain values, so it always marshals
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// PlanImport compares an export with the current data of the same months; current.Months only has the sheets that exist.
+// The sheets that do not exist are created from the Template and compared with its data.
+func PlanImport(current, incoming Export, template MonthData) ImportPlan {
+	var plan ImportPlan
+	existing := make(map[string]MonthData, len(current.Months))
+	for _, month := range current.Months {
+		existing[month.Sheet] = month
+	}
+
+	for _, month := range incoming.Months {
+		cur, ok := existing[month.Sheet]
+		if !ok {
+			cur = template
+			plan.NewSheets = append(plan.NewSheets, month.Sheet)
+			plan.Changes = append(plan.Changes, ImportChange{Action: ImportCreateSheet, Target: month.Sheet, Detail: "from the Template"})
+		}
+		if m := plan.planMonth(cur, month); m.Members != nil || len(m.Expenses) > 0 || m.Rent != nil {
+			plan.Months = append(plan.Months, m)
+		}
+	}
+
+	tasks := make(map[int]Task, len(current.Tasks))
+	for _, task := range current.Tasks {
+		tasks[task.ID] = task
+	}
+	for _, task := range incoming.Tasks {
+		target := fmt.Sprintf("task %d", task.ID)
+		cur, ok := tasks[task.ID]
+		switch {
+		case !ok:
+			plan.add(ImportAdd, target, task.Name)
+		case cur != task:
+			plan.add(ImportUpdate, target, changedFields(
+				"name", cur.Name, task.Name, "frequency", cur.Frequency, task.Frequency,
+				"last done", cur.LastDone, task.LastDone, "next due", cur.NextDue, task.NextDue,
+				"assignee", cur.Assignee, task.Assignee, "turns", cur.TurnsRemaining, task.TurnsRemaining,
+				"channel", cur.ChannelId, task.ChannelId, "note", cur.Note, task.Note,
+				"requires proof", cur.RequiresProof, task.RequiresProof, "handover from", cur.HandoverFrom, task.HandoverFrom,
+			))
+		default:
+			plan.Unchanged++
+			continue
+		}
+		plan.Tasks = append(plan.Tasks, task)
+	}
+
+	for _, entry := range incoming.TaskHistory {
+		if slices.Contains(current.TaskHistory, entry) {
+			plan.Unchanged++
+			continue
+		}
+		plan.TaskHistory = append(plan.TaskHistory, entry)
+	}
+	if len(plan.TaskHistory) > 0 {
+		plan.add(ImportAdd, "task history", fmt.Sprintf("%d entries", len(plan.TaskHistory)))
+	}
+	return plan
+}
+
+func (p *ImportPlan) planMonth(cur, month MonthData) MonthImport {
+	result := MonthImport{Sheet: month.Sheet}
+
+	// Members are matched by username; the ones only in the sheet keep their place
+	members := slices.Clone(cur.Members)
+	changed := false
+	for _, m := range month.Members {
+		target := fmt.Sprintf("%s member %s", month.Sheet, m.Username)
+		i := slices.IndexFunc(members, func(c Member) bool { return strings.EqualFold(c.Username, m.Username) })
+		if i < 0 {
+			m.ID = nextMemberID(members)
+			members = append(members, m)
+			p.add(ImportAdd, target, fmt.Sprintf("weight %d", m.Weight))
+			changed = true
+			continue
+		}
+		c := members[i]
+		if c.Weight == m.Weight && c.UserID == m.UserID && c.DisplayName == m.DisplayName {
+			p.Unchanged++
+			continue
+		}
+		p.add(ImportUpdate, target, changedFields("weight", c.Weight, m.Weight, "user ID", c.UserID, m.UserID, "display name", c.DisplayName, m.DisplayName))
+		members[i].Weight, members[i].UserID, members[i].DisplayName = m.Weight, m.UserID, m.DisplayName
+		changed = true
+	}
+	if changed {
+		result.Members = members
+	}
+
+	expenses := make(map[uint32]Expense, len(cur.Expenses))
+	for _, expense := range cur.Expenses {
+		expenses[expense.ID] = expense
+	}
+	for _, expense := range month.Expenses {
+		target := fmt.Sprintf("%s expense %d", month.Sheet, expense.ID)
+		c, ok := expenses[expense.ID]
+		switch {
+		case !ok:
+			p.add(ImportAdd, target, fmt.Sprintf("%s %s", expense.Name, expense.Amount))
+		case c.Name != expense.Name || c.Amount != expense.Amount || c.Date != expense.Date || c.Payer != expense.Payer ||
+			strings.Join(c.Participants, ",") != strings.Join(expense.Participants, ",") || c.Note != expense.Note:
+			p.add(ImportUpdate, target, changedFields(
+				"name", c.Name, expense.Name, "amount", c.Amount, expense.Amount, "date", c.Date, expense.Date,
+				"payer", c.Payer, expense.Payer,
+				"participants", strings.Join(c.Participants, ","), strings.Join(expense.Participants, ","),
+				"note", c.Note, expense.Note,
+			))
+		default:
+			p.Unchanged++
+			continue
+		}
+		result.Expenses = append(result.Expenses, expense)
+	}
+
+	if month.Rent != nil {
+		rent := *month.Rent
+		// Exports made before the rent shares were saved keep the shares of the sheet
+		if rent.Shares == nil && cur.Rent != nil {
+			rent.Shares = cur.Rent.Shares
+		}
+		switch {
+		case cur.Rent == nil || cur.Rent.Equal(RentCells{}):
+			p.add(ImportAdd, month.Sheet+" rent", fmt.Sprintf("total %d", rent.Total))
+			result.Rent = &rent
+		case !cur.Rent.Equal(rent):
+			p.add(ImportUpdate, month.Sheet+" rent", changedFields(
+				"electric", cur.Rent.Electric, rent.Electric, "water", cur.Rent.Water, rent.Water,
+				"other fees", cur.Rent.OtherFees, rent.OtherFees, "total", cur.Rent.Total, rent.Total,
+				"payer", cur.Rent.Payer, rent.Payer, "shares", cur.Rent.Shares, rent.Shares,
+			))
+			result.Rent = &rent
+		default:
+			p.Unchanged++
+		}
+	}
+	return result
+}
+
+func (p *ImportPlan) add(action, target, detail string) {
+	p.Changes = append(p.Changes, ImportChange{Action: action, Target: target, Detail: detail})
+}
+
+func nextMemberID(members []Member) int {
+	id := 1
+	for _, m := range members {
+		if m.ID >= id {
+			id = m.ID + 1
+		}
+	}
+	return id
+}
+
+// changedFields describes the fields that differ, given as name, old value, new value triples.
+// Long values such as notes are only named.
+func changedFields(fields ...any) string {
+	var parts []string
+	for i := 0; i+2 < len(fields); i += 3 {
+		before, after := fmt.Sprint(fields[i+1]), fmt.Sprint(fields[i+2])
+		if before == after {
+			continue
+		}
+		if len(before) > 30 || len(after) > 30 || strings.Contains(before+after, "\n") {
+			parts = append(parts, fmt.Sprintf("%s changed", fields[i]))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s -> %s", fields[i], strconv.Quote(before), strconv.Quote(after)))
+	}
+	return strings.Join(parts, ", ")
+}
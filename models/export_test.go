@@ -0,0 +1,163 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExportPeriod(t *testing.T) {
+	for _, bad := range []string{"2026_13", "26_10", "2026-10", "Template", ""} {
+		if _, err := ParseExportPeriod(bad); err == nil {
+			t.Errorf("ParseExportPeriod(%q) should fail", bad)
+		}
+	}
+	year, err := ParseExportPeriod("2026")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sheet, want := range map[string]bool{"2026_01": true, "2026_12": true, "2025_12": false, "Template": false, "2026_Notes": false} {
+		if got := year.IncludesSheet(sheet); got != want {
+			t.Errorf("2026 includes %s = %v, want %v", sheet, got, want)
+		}
+	}
+	all, err := ParseExportPeriod("all")
+	if err != nil || all != ExportAll || all.String() != "all" || !all.IncludesSheet("2019_01") || !all.IncludesTimestamp("garbage") {
+		t.Errorf("ParseExportPeriod(all) = %q, %v", all, err)
+	}
+	month := ExportPeriod("2026_10")
+	for timestamp, want := range map[string]bool{"25/10/2026 10:30": true, "31/10/2026": true, "01/11/2026 00:00": false, "garbage": false} {
+		if got := month.IncludesTimestamp(timestamp); got != want {
+			t.Errorf("2026_10 includes %s = %v, want %v", timestamp, got, want)
+		}
+	}
+}
+
+func TestBuildAudit(t *testing.T) {
+	months := []MonthData{{Sheet: "2026_10", Expenses: []Expense{
+		{ID: 1, Note: "[25/10/2026 10:30]: amount: 150,000 - by @alice\n[26/10/2026 09:00]: update amount: 160,000 - by @bob"},
+		{ID: 2, Note: "bought at the market"},
+	}}}
+	history := []TaskHistory{{Timestamp: "27/10/2026 18:00", TaskID: 3, Event: TaskEventDone, Doer: "111"}}
+
+	want := []AuditEntry{
+		{Timestamp: "25/10/2026 10:30", Source: "expense", Sheet: "2026_10", RecordID: 1, Entry: "amount: 150,000 - by @alice"},
+		{Timestamp: "26/10/2026 09:00", Source: "expense", Sheet: "2026_10", RecordID: 1, Entry: "update amount: 160,000 - by @bob"},
+		{Timestamp: "27/10/2026 18:00", Source: "task", RecordID: 3, Entry: "done by 111"},
+	}
+	if got := BuildAudit(months, history); !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildAudit = %+v, want %+v", got, want)
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	current := Export{
+		Months: []MonthData{{
+			Sheet:    "2026_10",
+			Members:  []Member{{ID: 1, Username: "@alice", Weight: 1}, {ID: 2, Username: "@carol", Weight: 1}},
+			Expenses: []Expense{{ID: 1, Name: "Milk", Amount: "30000"}, {ID: 2, Name: "Eggs", Amount: "45000"}},
+			// The export below was made before the rent shares were saved
+			Rent: &RentCells{Total: 5000000, Payer: "111", Shares: []int64{2500000, 2500000}},
+		}},
+		Tasks:       []Task{{ID: 1, Name: "Trash", Frequency: 2}},
+		TaskHistory: []TaskHistory{{Timestamp: "27/10/2026 18:00", TaskID: 1, Event: TaskEventDone}},
+	}
+	incoming := Export{
+		Format: ExportFormat,
+		Months: []MonthData{
+			{
+				Sheet:    "2026_10",
+				Members:  []Member{{ID: 1, Username: "@Alice", Weight: 2}, {ID: 7, Username: "@bob", Weight: 1}},
+				Expenses: []Expense{{ID: 1, Name: "Milk", Amount: "30000"}, {ID: 2, Name: "Eggs", Amount: "50000"}, {ID: 3, Name: "Rice", Amount: "90000"}},
+				Rent:     &RentCells{Total: 5000000, Payer: "111"},
+			},
+			{Sheet: "2026_11", Rent: &RentCells{Total: 5100000}},
+		},
+		Tasks: []Task{{ID: 1, Name: "Trash", Frequency: 2}, {ID: 2, Name: "Dishes", Frequency: 1}},
+		TaskHistory: []TaskHistory{
+			{Timestamp: "27/10/2026 18:00", TaskID: 1, Event: TaskEventDone},
+			{Timestamp: "28/10/2026 18:00", TaskID: 1, Event: TaskEventDone},
+		},
+	}
+	if err := incoming.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := PlanImport(current, incoming, MonthData{Rent: &RentCells{}})
+
+	var targets []string
+	for _, change := range plan.Changes {
+		targets = append(targets, change.Action+" "+change.Target)
+	}
+	wantTargets := []string{
+		"update 2026_10 member @Alice", "add 2026_10 member @bob",
+		"update 2026_10 expense 2", "add 2026_10 expense 3",
+		"create 2026_11", "add 2026_11 rent",
+		"add task 2", "add task history",
+	}
+	if !reflect.DeepEqual(targets, wantTargets) {
+		t.Errorf("changes = %v, want %v", targets, wantTargets)
+	}
+	// Milk, the rent of 2026_10, task 1 and the first history entry
+	if plan.Unchanged != 4 {
+		t.Errorf("unchanged = %d, want 4", plan.Unchanged)
+	}
+	if !reflect.DeepEqual(plan.NewSheets, []string{"2026_11"}) {
+		t.Errorf("new sheets = %v", plan.NewSheets)
+	}
+
+	october := plan.Months[0]
+	// carol is only in the sheet and stays; bob gets the next ID of the sheet
+	wantMembers := []Member{{ID: 1, Username: "@alice", Weight: 2}, {ID: 2, Username: "@carol", Weight: 1}, {ID: 3, Username: "@bob", Weight: 1}}
+	if !reflect.DeepEqual(october.Members, wantMembers) {
+		t.Errorf("members = %+v, want %+v", october.Members, wantMembers)
+	}
+	if len(october.Expenses) != 2 || october.Expenses[0].ID != 2 || october.Expenses[1].ID != 3 || october.Rent != nil {
+		t.Errorf("october writes = %+v", october)
+	}
+	if len(plan.Tasks) != 1 || plan.Tasks[0].ID != 2 || len(plan.TaskHistory) != 1 {
+		t.Errorf("tasks = %+v, history = %+v", plan.Tasks, plan.TaskHistory)
+	}
+
+	if again := PlanImport(current, Export{Format: ExportFormat, Months: current.Months[:1], Tasks: current.Tasks}, MonthData{}); !again.IsEmpty() {
+		t.Errorf("importing the current data should change nothing, got %+v", again.Changes)
+	}
+
+	if PlanImport(current, incoming, MonthData{Rent: &RentCells{}}).Hash() != plan.Hash() {
+		t.Error("planning the same import twice should give the same hash")
+	}
+	// Same number of changes, but the sheet now has another amount for expense 2
+	current.Months[0].Expenses[1].Amount = "40000"
+	if changed := PlanImport(current, incoming, MonthData{Rent: &RentCells{}}); len(changed.Changes) != len(plan.Changes) || changed.Hash() == plan.Hash() {
+		t.Errorf("a plan with other changes should have another hash, got %d changes", len(changed.Changes))
+	}
+}
+
+func TestExportValidate(t *testing.T) {
+	tests := map[string]Export{
+		"format":            {Format: 2},
+		"sheet name":        {Format: ExportFormat, Months: []MonthData{{Sheet: "Template"}}},
+		"duplicated sheet":  {Format: ExportFormat, Months: []MonthData{{Sheet: "2026_10"}, {Sheet: "2026_10"}}},
+		"duplicated member": {Format: ExportFormat, Months: []MonthData{{Sheet: "2026_10", Members: []Member{{Username: "@a"}, {Username: "@A"}}}}},
+		"expense ID":        {Format: ExportFormat, Months: []MonthData{{Sheet: "2026_10", Expenses: []Expense{{Name: "Milk"}}}}},
+		"task ID":           {Format: ExportFormat, Tasks: []Task{{ID: 1}, {ID: 1}}},
+	}
+	for name, e := range tests {
+		if err := e.Validate(); err == nil {
+			t.Errorf("%s: Validate should fail", name)
+		}
+	}
+}
+
+func TestPlanImportRentShares(t *testing.T) {
+	month := func(shares ...int64) Export {
+		return Export{Format: ExportFormat, Months: []MonthData{{Sheet: "2026_10", Rent: &RentCells{Total: 5000000, Payer: "111", Shares: shares}}}}
+	}
+
+	plan := PlanImport(month(3000000, 2000000), month(2500000, 2500000), MonthData{})
+	if len(plan.Changes) != 1 || plan.Changes[0].Detail != "shares \"[3000000 2000000]\" -> \"[2500000 2500000]\"" {
+		t.Errorf("changes = %+v, want the shares updated", plan.Changes)
+	}
+	if got := plan.Months[0].Rent.Shares; !reflect.DeepEqual(got, []int64{2500000, 2500000}) {
+		t.Errorf("imported shares = %v", got)
+	}
+}
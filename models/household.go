@@ -0,0 +1,43 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"housematee-tgbot/utilities"
+)
+
+// Household is a house served by the bot: the chat of its members, its spreadsheet and its settings
+type Household struct {
+	ChatID        int64  `json:"chat_id"`
+	Name          string `json:"name,omitempty"`
+	SpreadsheetID string `json:"spreadsheet_id"`
+	// Timezone is the IANA name of the timezone of the house, empty uses settings.timezone
+	Timezone string `json:"timezone,omitempty"`
+	LinkedBy string `json:"linked_by,omitempty"`
+	LinkedAt string `json:"linked_at,omitempty"`
+}
+
+// locations caches the loaded timezones by name
+var locations sync.Map
+
+// Location returns the timezone of the household, the house timezone when it has none or it is unknown
+func (h Household) Location() *time.Location {
+	if h.Timezone == "" {
+		return utilities.Location()
+	}
+	if loc, ok := locations.Load(h.Timezone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(h.Timezone)
+	if err != nil {
+		return utilities.Location()
+	}
+	locations.Store(h.Timezone, loc)
+	return loc
+}
+
+// IsLinked reports whether the household has a spreadsheet
+func (h Household) IsLinked() bool {
+	return h.SpreadsheetID != ""
+}
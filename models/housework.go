@@ -10,4 +10,15 @@ type Task struct {
 	TurnsRemaining int    `json:"turns_remaining"`
 	ChannelId      int64  `json:"channel_id"`
 	Note           string `json:"note"`
+	RequiresProof  bool   `json:"requires_proof"` // Completion needs a photo approved by another member
+	// HandoverFrom is the member whose turn was handed over to the assignee; the rotation goes on from them
+	HandoverFrom string `json:"handover_from,omitempty"`
+}
+
+// RotationAssignee returns the member the rotation goes on from: the one who handed the current turn over, or the assignee
+func (t Task) RotationAssignee() string {
+	if t.HandoverFrom != "" {
+		return t.HandoverFrom
+	}
+	return t.Assignee
 }
@@ -0,0 +1,368 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// LayoutSpec is a version of the layout of the monthly sheets as written in settings.layouts:
+// the A1 place of each section of the Template. Columns are A-Z.
+type LayoutSpec struct {
+	Version int `mapstructure:"version"`
+	// From is the first monthly sheet (YYYY_MM) created with this layout, empty for the oldest one
+	From string `mapstructure:"from"`
+	// NextExpenseID is the counter cell of the expenses, e.g., "B2"
+	NextExpenseID string `mapstructure:"next_expense_id"`
+	// Expenses is the header row and the columns of the expenses, e.g., "A3:G"; expense n is n rows below the header
+	Expenses string `mapstructure:"expenses"`
+	// Report is the report block with its header row, e.g., "I3:M9"
+	Report     string         `mapstructure:"report"`
+	ReportRows ReportRowsSpec `mapstructure:"report_rows"`
+	// Balances is the header row and the columns of the balances, e.g., "I12:M"
+	Balances string `mapstructure:"balances"`
+	// Rent is the column of the electric, water, other fees and total amounts, e.g., "J5:J8"; empty when the sheet has no rent
+	Rent      string `mapstructure:"rent"`
+	RentPayer string `mapstructure:"rent_payer"`
+	// RentShares is the header row and the column of the rent share of each member, e.g., "T3:T", on the header row of
+	// the members so share n is next to member n; empty when the Balances formulas split the rent by default
+	RentShares string `mapstructure:"rent_shares"`
+	// MembersCount is the cell of the number of members, e.g., "P2"
+	MembersCount string `mapstructure:"members_count"`
+	// Members is the header row and the columns of the members, e.g., "O3:S"
+	Members string `mapstructure:"members"`
+}
+
+// ReportRowsSpec are the rows of the report lines the bot reads
+type ReportRowsSpec struct {
+	Expenses int `mapstructure:"expenses"`
+	Rent     int `mapstructure:"rent"`
+	Total    int `mapstructure:"total"`
+}
+
+// Widths of the sections whose columns the bot reads and writes by position
+const (
+	ExpenseColumns = 7 // ID, Name, Amount, Date, Payer, Participants, Note
+	BalanceColumns = 5 // Username, TotalPaid, ExpenseBalance, RentBalance, FinalBalance
+	MemberColumns  = 5 // ID, Username, Weight, Telegram user ID, Display name
+	// The report has at least Category, Amount and Average; its last column is the payer
+	minReportColumns = 3
+	rentRows         = 4 // Electric, Water, Other fees, Total
+)
+
+// Cell is a single A1 cell
+type Cell struct {
+	Col string
+	Row int
+}
+
+func (c Cell) String() string {
+	return fmt.Sprintf("%s%d", c.Col, c.Row)
+}
+
+// In returns the cell on a sheet, e.g., "2026_10!B2"
+func (c Cell) In(sheetName string) string {
+	return sheetName + "!" + c.String()
+}
+
+// Block is a fixed rectangle of cells
+type Block struct {
+	Start Cell
+	End   Cell
+}
+
+// In returns the block on a sheet, e.g., "2026_10!I3:M9"
+func (b Block) In(sheetName string) string {
+	return fmt.Sprintf("%s!%s:%s", sheetName, b.Start, b.End)
+}
+
+// Width is the number of columns of the block
+func (b Block) Width() int {
+	return columnNumber(b.End.Col) - columnNumber(b.Start.Col) + 1
+}
+
+// Table is a section with a header row followed by one row per record, growing down
+type Table struct {
+	StartCol  string
+	EndCol    string
+	HeaderRow int
+}
+
+// FirstRow is the row of the first record
+func (t Table) FirstRow() int {
+	return t.HeaderRow + 1
+}
+
+// Width is the number of columns of the table
+func (t Table) Width() int {
+	return columnNumber(t.EndCol) - columnNumber(t.StartCol) + 1
+}
+
+// Rows returns the rows from startRow to endRow of the table on a sheet, e.g., "2026_10!O4:S6"
+func (t Table) Rows(sheetName string, startRow int, endRow int) string {
+	return fmt.Sprintf("%s!%s%d:%s%d", sheetName, t.StartCol, startRow, t.EndCol, endRow)
+}
+
+// SheetLayout is a parsed and validated LayoutSpec
+type SheetLayout struct {
+	Version       int
+	From          string
+	NextExpenseID Cell
+	Expenses      Table
+	Report        Block
+	// ReportRows are the rows of the expenses, total rent and grand total lines
+	ReportRows ReportRowsSpec
+	Balances   Table
+	// Rent is the column of the electric, water, other fees and total amounts, nil when the sheet has none
+	Rent      *Block
+	RentPayer Cell
+	// RentShares is the column of the rent share of each member, nil when the sheet has none
+	RentShares   *Table
+	MembersCount Cell
+	Members      Table
+}
+
+// HasRent reports whether the sheets of the layout have the rent cells
+func (l SheetLayout) HasRent() bool {
+	return l.Rent != nil
+}
+
+// HasRentShares reports whether the sheets of the layout store the rent share of each member
+func (l SheetLayout) HasRentShares() bool {
+	return l.RentShares != nil
+}
+
+// Layouts are the versions of the layout of the monthly sheets, oldest first
+type Layouts []SheetLayout
+
+// ForSheet returns the layout a sheet was created with: the latest one whose From is not after the
+// sheet name. The Template and the sheets not named YYYY_MM use the latest layout.
+func (ls Layouts) ForSheet(sheetName string) SheetLayout {
+	latest := ls[len(ls)-1]
+	if !monthSheetName.MatchString(sheetName) {
+		return latest
+	}
+	for i := len(ls) - 1; i >= 0; i-- {
+		if ls[i].From <= sheetName {
+			return ls[i]
+		}
+	}
+	return ls[0]
+}
+
+// Latest returns the layout of the Template
+func (ls Layouts) Latest() SheetLayout {
+	return ls[len(ls)-1]
+}
+
+var (
+	monthSheetName = regexp.MustCompile(`^\d{4}_\d{2}$`)
+	cellPattern    = regexp.MustCompile(`^([A-Z])(\d+)$`)
+	tablePattern   = regexp.MustCompile(`^([A-Z])(\d+):([A-Z])$`)
+	blockPattern   = regexp.MustCompile(`^([A-Z])(\d+):([A-Z])(\d+)$`)
+)
+
+// ParseLayouts parses and checks the layout versions: versions and From months increase, only the
+// first version may have no From, every section is in place and no section runs into another one.
+func ParseLayouts(specs []LayoutSpec) (Layouts, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no sheet layout")
+	}
+	layouts := make(Layouts, 0, len(specs))
+	for i, spec := range specs {
+		layout, err := ParseLayout(spec)
+		if err != nil {
+			return nil, fmt.Errorf("layout version %d: %w", spec.Version, err)
+		}
+		if i > 0 {
+			previous := layouts[i-1]
+			if layout.Version <= previous.Version {
+				return nil, fmt.Errorf("layout version %d: versions must increase, it follows version %d", layout.Version, previous.Version)
+			}
+			if layout.From == "" || layout.From <= previous.From {
+				return nil, fmt.Errorf("layout version %d: from must be a month after %q", layout.Version, previous.From)
+			}
+		}
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// ParseLayout parses and checks one layout version
+func ParseLayout(spec LayoutSpec) (SheetLayout, error) {
+	layout := SheetLayout{Version: spec.Version, From: spec.From, ReportRows: spec.ReportRows}
+	if spec.Version <= 0 {
+		return layout, fmt.Errorf("version must be a positive number")
+	}
+	if spec.From != "" && !monthSheetName.MatchString(spec.From) {
+		return layout, fmt.Errorf("from %q is not a month sheet name like 2026_01", spec.From)
+	}
+
+	var err error
+	if layout.NextExpenseID, err = parseCell("next_expense_id", spec.NextExpenseID); err != nil {
+		return layout, err
+	}
+	if layout.Expenses, err = parseTable("expenses", spec.Expenses, ExpenseColumns); err != nil {
+		return layout, err
+	}
+	if layout.Report, err = parseBlock("report", spec.Report); err != nil {
+		return layout, err
+	}
+	if layout.Report.Width() < minReportColumns {
+		return layout, fmt.Errorf("report %s must have at least %d columns", spec.Report, minReportColumns)
+	}
+	reportRows := []struct {
+		name string
+		row  int
+	}{{"expenses", spec.ReportRows.Expenses}, {"rent", spec.ReportRows.Rent}, {"total", spec.ReportRows.Total}}
+	for _, r := range reportRows {
+		if r.row <= layout.Report.Start.Row || r.row > layout.Report.End.Row {
+			return layout, fmt.Errorf("report_rows.%s %d must be a row of the report below its header", r.name, r.row)
+		}
+	}
+	if layout.Balances, err = parseTable("balances", spec.Balances, BalanceColumns); err != nil {
+		return layout, err
+	}
+	if layout.MembersCount, err = parseCell("members_count", spec.MembersCount); err != nil {
+		return layout, err
+	}
+	if layout.Members, err = parseTable("members", spec.Members, MemberColumns); err != nil {
+		return layout, err
+	}
+	if spec.Rent != "" {
+		rent, err := parseBlock("rent", spec.Rent)
+		if err != nil {
+			return layout, err
+		}
+		if rent.Width() != 1 || rent.End.Row-rent.Start.Row+1 != rentRows {
+			return layout, fmt.Errorf("rent %s must be one column of %d cells", spec.Rent, rentRows)
+		}
+		layout.Rent = &rent
+		if layout.RentPayer, err = parseCell("rent_payer", spec.RentPayer); err != nil {
+			return layout, err
+		}
+	}
+	if spec.RentShares != "" {
+		if !layout.HasRent() {
+			return layout, fmt.Errorf("rent_shares %s needs the rent cells", spec.RentShares)
+		}
+		shares, err := parseTable("rent_shares", spec.RentShares, 1)
+		if err != nil {
+			return layout, err
+		}
+		if shares.HeaderRow != layout.Members.HeaderRow {
+			return layout, fmt.Errorf("rent_shares %s must start on the header row of the members, row %d", spec.RentShares, layout.Members.HeaderRow)
+		}
+		layout.RentShares = &shares
+	}
+	return layout, checkOverlaps(layout)
+}
+
+// area is the rectangle of a section; endRow 0 means it grows down without limit
+type area struct {
+	name             string
+	startCol, endCol int
+	startRow, endRow int
+}
+
+func (a area) overlaps(b area) bool {
+	if a.endCol < b.startCol || b.endCol < a.startCol {
+		return false
+	}
+	if a.endRow != 0 && a.endRow < b.startRow {
+		return false
+	}
+	if b.endRow != 0 && b.endRow < a.startRow {
+		return false
+	}
+	return true
+}
+
+// checkOverlaps makes sure the tables cannot grow into another section. The rent cells are part of the report.
+func checkOverlaps(l SheetLayout) error {
+	cellArea := func(name string, c Cell) area {
+		col := columnNumber(c.Col)
+		return area{name, col, col, c.Row, c.Row}
+	}
+	tableArea := func(name string, t Table) area {
+		return area{name, columnNumber(t.StartCol), columnNumber(t.EndCol), t.HeaderRow, 0}
+	}
+	areas := []area{
+		tableArea("expenses", l.Expenses),
+		tableArea("balances", l.Balances),
+		tableArea("members", l.Members),
+		cellArea("next_expense_id", l.NextExpenseID),
+		{"report", columnNumber(l.Report.Start.Col), columnNumber(l.Report.End.Col), l.Report.Start.Row, l.Report.End.Row},
+		cellArea("members_count", l.MembersCount),
+	}
+	if l.Rent != nil {
+		areas = append(areas,
+			area{"rent", columnNumber(l.Rent.Start.Col), columnNumber(l.Rent.End.Col), l.Rent.Start.Row, l.Rent.End.Row},
+			cellArea("rent_payer", l.RentPayer),
+		)
+	}
+	if l.RentShares != nil {
+		areas = append(areas, tableArea("rent_shares", *l.RentShares))
+	}
+	for i := 0; i < len(areas); i++ {
+		for j := i + 1; j < len(areas); j++ {
+			a, b := areas[i], areas[j]
+			if a.name == "report" && (b.name == "rent" || b.name == "rent_payer") {
+				continue
+			}
+			if a.overlaps(b) {
+				return fmt.Errorf("%s runs into %s", a.name, b.name)
+			}
+		}
+	}
+	return nil
+}
+
+func parseCell(name string, value string) (Cell, error) {
+	m := cellPattern.FindStringSubmatch(value)
+	if m == nil {
+		return Cell{}, fmt.Errorf("%s %q is not a cell like B2", name, value)
+	}
+	row, _ := strconv.Atoi(m[2])
+	if row < 1 {
+		return Cell{}, fmt.Errorf("%s %q is not a cell like B2", name, value)
+	}
+	return Cell{Col: m[1], Row: row}, nil
+}
+
+func parseTable(name string, value string, width int) (Table, error) {
+	m := tablePattern.FindStringSubmatch(value)
+	if m == nil {
+		return Table{}, fmt.Errorf("%s %q is not a header row and columns like A3:G", name, value)
+	}
+	row, _ := strconv.Atoi(m[2])
+	table := Table{StartCol: m[1], EndCol: m[3], HeaderRow: row}
+	if row < 1 || table.Width() != width {
+		return Table{}, fmt.Errorf("%s %q must start on row 1 or below and have %d columns", name, value, width)
+	}
+	return table, nil
+}
+
+func parseBlock(name string, value string) (Block, error) {
+	m := blockPattern.FindStringSubmatch(value)
+	if m == nil {
+		return Block{}, fmt.Errorf("%s %q is not a range like I3:M9", name, value)
+	}
+	startRow, _ := strconv.Atoi(m[2])
+	endRow, _ := strconv.Atoi(m[4])
+	block := Block{Start: Cell{Col: m[1], Row: startRow}, End: Cell{Col: m[3], Row: endRow}}
+	if startRow < 1 || endRow < startRow || block.Width() < 1 {
+		return Block{}, fmt.Errorf("%s %q must go from the top left to the bottom right cell", name, value)
+	}
+	return block, nil
+}
+
+// columnAt returns the column n columns after col, within A-Z
+func columnAt(col string, n int) string {
+	return string(rune(col[0]) + rune(n))
+}
+
+// columnNumber returns the 1-based number of a column A-Z
+func columnNumber(col string) int {
+	return int(col[0]-'A') + 1
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// sampleLayout is the latest layout of the sample spreadsheet, as in config.DefaultLayouts
+func sampleLayout() LayoutSpec {
+	return LayoutSpec{
+		Version:       1,
+		NextExpenseID: "B2",
+		Expenses:      "A3:G",
+		Report:        "I3:M9",
+		ReportRows:    ReportRowsSpec{Expenses: 4, Rent: 8, Total: 9},
+		Balances:      "I12:M",
+		Rent:          "J5:J8",
+		RentPayer:     "M8",
+		RentShares:    "T3:T",
+		MembersCount:  "P2",
+		Members:       "O3:S",
+	}
+}
+
+func TestLayoutsForSheet(t *testing.T) {
+	// Version 1 has no rent cells and its balances start right below the short report
+	v1 := sampleLayout()
+	v1.Report, v1.ReportRows, v1.Balances, v1.Rent, v1.RentPayer, v1.RentShares = "I3:M6", ReportRowsSpec{Expenses: 4, Rent: 5, Total: 6}, "I8:M", "", "", ""
+	v2 := sampleLayout()
+	v2.Version, v2.From = 2, "2026_01"
+	v3 := sampleLayout()
+	v3.Version, v3.From, v3.Members = 3, "2026_11", "U3:Y"
+
+	layouts, err := ParseLayouts([]LayoutSpec{v1, v2, v3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sheet, want := range map[string]int{"2025_09": 1, "2025_12": 1, "2026_01": 2, "2026_10": 2, "2026_11": 3, "2027_03": 3, "Template": 3} {
+		if got := layouts.ForSheet(sheet).Version; got != want {
+			t.Errorf("ForSheet(%q) = version %d, want %d", sheet, got, want)
+		}
+	}
+
+	old := layouts.ForSheet("2025_12")
+	if old.HasRent() {
+		t.Error("version 1 should have no rent cells")
+	}
+	if got := old.Balances.Rows("2025_12", old.Balances.FirstRow(), old.Balances.HeaderRow+2); got != "2025_12!I9:M10" {
+		t.Errorf("balances of 2 members = %s, want 2025_12!I9:M10", got)
+	}
+	latest := layouts.Latest()
+	if got := latest.Members.Rows("Template", latest.Members.FirstRow(), latest.Members.FirstRow()); got != "Template!U4:Y4" {
+		t.Errorf("first member row = %s, want Template!U4:Y4", got)
+	}
+	if got := latest.Rent.In("2026_11"); got != "2026_11!J5:J8" {
+		t.Errorf("rent cells = %s, want 2026_11!J5:J8", got)
+	}
+}
+
+func TestParseLayoutsRejectsBrokenLayouts(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(spec *LayoutSpec)
+		error string
+	}{
+		{"bad cell", func(s *LayoutSpec) { s.NextExpenseID = "B" }, "next_expense_id"},
+		{"wrong width", func(s *LayoutSpec) { s.Members = "O3:R" }, "5 columns"},
+		{"report row outside", func(s *LayoutSpec) { s.ReportRows.Total = 10 }, "report_rows.total"},
+		{"rent shape", func(s *LayoutSpec) { s.Rent = "J5:K8" }, "one column of 4 cells"},
+		{"balances into report", func(s *LayoutSpec) { s.Balances = "I9:M" }, "balances runs into report"},
+		{"members into balances", func(s *LayoutSpec) { s.Members, s.RentShares = "K14:O", "" }, "balances runs into members"},
+		{"counter in table", func(s *LayoutSpec) { s.MembersCount = "P5" }, "members runs into members_count"},
+		{"rent payer in table", func(s *LayoutSpec) { s.RentPayer = "G8" }, "expenses runs into rent_payer"},
+		{"rent shares without rent", func(s *LayoutSpec) { s.Rent, s.RentPayer = "", "" }, "needs the rent cells"},
+		{"rent shares off the members", func(s *LayoutSpec) { s.RentShares = "T4:T" }, "header row of the members"},
+		{"rent shares wide", func(s *LayoutSpec) { s.RentShares = "T3:U" }, "1 columns"},
+		{"rent shares in members", func(s *LayoutSpec) { s.RentShares = "S3:S" }, "members runs into rent_shares"},
+	}
+	for _, tt := range tests {
+		spec := sampleLayout()
+		tt.edit(&spec)
+		_, err := ParseLayouts([]LayoutSpec{spec})
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: error = %v, want one about %q", tt.name, err, tt.error)
+		}
+	}
+
+	v2 := sampleLayout()
+	v2.Version = 2
+	if _, err := ParseLayouts([]LayoutSpec{sampleLayout(), v2}); err == nil {
+		t.Error("a second version without from should fail")
+	}
+	v2.From = "2026_01"
+	v1 := sampleLayout()
+	v1.Version = 3
+	if _, err := ParseLayouts([]LayoutSpec{v1, v2}); err == nil {
+		t.Error("decreasing versions should fail")
+	}
+}
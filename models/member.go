@@ -1,7 +1,90 @@
 package models
 
+import (
+	"strconv"
+	"strings"
+)
+
 type Member struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Weight   int    `json:"weight"`
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	Weight      int    `json:"weight"`
+	UserID      int64  `json:"user_id"`      // Telegram user ID, 0 if not linked yet
+	DisplayName string `json:"display_name"` // Optional, falls back to Username
+	// RefByUserID is set once /members migrate switched the spreadsheet to user ID references
+	RefByUserID bool `json:"-"`
+}
+
+// Name returns the display name of the member, or the username if not set
+func (m Member) Name() string {
+	if m.DisplayName != "" {
+		return m.DisplayName
+	}
+	return m.Username
+}
+
+// Ref returns the value stored in records (payer, assignee, doer) to reference the member: the Telegram user ID once
+// the spreadsheet references members by user ID, the @username before. Every member is linked by then.
+func (m Member) Ref() string {
+	if m.RefByUserID && m.UserID != 0 {
+		return UserRef(m.UserID)
+	}
+	return m.Username
+}
+
+// UserRef returns the stored reference of a Telegram user
+func UserRef(userId int64) string {
+	return strconv.FormatInt(userId, 10)
+}
+
+// FindMemberByRef returns the member referenced by a stored value, or nil.
+// A numeric value is matched against the Telegram user ID, anything else against the username.
+func FindMemberByRef(members []Member, ref string) *Member {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+	if userId, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		for i := range members {
+			if members[i].UserID == userId {
+				return &members[i]
+			}
+		}
+		return nil
+	}
+	if !strings.HasPrefix(ref, "@") {
+		ref = "@" + ref
+	}
+	for i := range members {
+		if strings.EqualFold(members[i].Username, ref) {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// NormalizeRef converts a stored value or a typed @username to the member reference.
+// Values that do not match a member are returned unchanged.
+func NormalizeRef(members []Member, value string) string {
+	if m := FindMemberByRef(members, value); m != nil {
+		return m.Ref()
+	}
+	return value
+}
+
+// DisplayRef returns the @username of the referenced member, or the value itself if unknown
+func DisplayRef(members []Member, ref string) string {
+	if m := FindMemberByRef(members, ref); m != nil {
+		return m.Username
+	}
+	return ref
+}
+
+// SameMember reports whether two stored values reference the same member
+func SameMember(members []Member, a string, b string) bool {
+	if a == b {
+		return a != ""
+	}
+	ma, mb := FindMemberByRef(members, a), FindMemberByRef(members, b)
+	return ma != nil && ma == mb
 }
@@ -0,0 +1,88 @@
+package models
+
+import "testing"
+
+func TestMemberRefs(t *testing.T) {
+	members := []Member{
+		{ID: 1, Username: "@tasszz2k", Weight: 1, UserID: 111, RefByUserID: true},
+		{ID: 2, Username: "@ng0cth1nh", Weight: 2},
+	}
+
+	testCases := []struct {
+		name            string
+		value           string
+		expectedRef     string
+		expectedDisplay string
+	}{
+		{
+			name:            "username of linked member",
+			value:           "@tasszz2k",
+			expectedRef:     "111",
+			expectedDisplay: "@tasszz2k",
+		},
+		{
+			name:            "username without @ and other case",
+			value:           "TASSZZ2K",
+			expectedRef:     "111",
+			expectedDisplay: "@tasszz2k",
+		},
+		{
+			name:            "user id of linked member",
+			value:           "111",
+			expectedRef:     "111",
+			expectedDisplay: "@tasszz2k",
+		},
+		{
+			name:            "unlinked member keeps username",
+			value:           "@ng0cth1nh",
+			expectedRef:     "@ng0cth1nh",
+			expectedDisplay: "@ng0cth1nh",
+		},
+		{
+			name:            "unknown user id",
+			value:           "222",
+			expectedRef:     "222",
+			expectedDisplay: "222",
+		},
+		{
+			name:            "first name of non member",
+			value:           "Alice",
+			expectedRef:     "Alice",
+			expectedDisplay: "Alice",
+		},
+	}
+
+	for _, testCase := range testCases {
+		if actual := NormalizeRef(members, testCase.value); actual != testCase.expectedRef {
+			t.Errorf("%s: expected ref %q, got %q", testCase.name, testCase.expectedRef, actual)
+		}
+		if actual := DisplayRef(members, testCase.value); actual != testCase.expectedDisplay {
+			t.Errorf("%s: expected display %q, got %q", testCase.name, testCase.expectedDisplay, actual)
+		}
+	}
+
+	if !SameMember(members, "@tasszz2k", "111") {
+		t.Errorf("expected @tasszz2k and 111 to be the same member")
+	}
+	if SameMember(members, "@tasszz2k", "@ng0cth1nh") {
+		t.Errorf("expected @tasszz2k and @ng0cth1nh to be different members")
+	}
+	if SameMember(members, "", "") {
+		t.Errorf("expected empty values not to match")
+	}
+}
+
+func TestMemberRefBeforeMigration(t *testing.T) {
+	// Until /members migrate, linked members are still referenced by username like the others
+	member := Member{ID: 1, Username: "@tasszz2k", UserID: 111}
+	if ref := member.Ref(); ref != "@tasszz2k" {
+		t.Errorf("ref = %q, want the username", ref)
+	}
+	member.RefByUserID = true
+	if ref := member.Ref(); ref != "111" {
+		t.Errorf("ref = %q, want the user ID", ref)
+	}
+	if !SameMember([]Member{member}, "@tasszz2k", "111") {
+		t.Error("both kinds of values must still find the member")
+	}
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Meter types
+const (
+	MeterElectric = "electric"
+	MeterWater    = "water"
+)
+
+// MeterReading is a meter value recorded with /meter.
+// Member is empty for the main meter and holds the member reference for a room sub-meter.
+type MeterReading struct {
+	Month      string  `json:"month"` // sheet name of the month, e.g., 2026_10
+	Meter      string  `json:"meter"`
+	Member     string  `json:"member"`
+	Reading    float64 `json:"reading"`
+	Timestamp  string  `json:"timestamp"`
+	RecordedBy string  `json:"recorded_by"`
+}
+
+// TariffTier is the unit price up to a cumulative consumption; UpTo 0 means no limit
+type TariffTier struct {
+	UpTo  float64
+	Price int64
+}
+
+// Tariff is a list of tiers sorted by UpTo, the last tier usually has no limit
+type Tariff []TariffTier
+
+// Cost returns the amount for a consumption, charging each tier at its own price.
+// The last tier has no limit.
+func (t Tariff) Cost(consumption float64) int64 {
+	var cost, from float64
+	for i, tier := range t {
+		if consumption <= from {
+			break
+		}
+		to := tier.UpTo
+		if to == 0 || i == len(t)-1 {
+			to = math.Inf(1)
+		}
+		cost += (math.Min(consumption, to) - from) * float64(tier.Price)
+		from = to
+	}
+	return int64(math.Round(cost))
+}
+
+// MeterUsage is the consumption of a meter in a month and its amount
+type MeterUsage struct {
+	Meter       string
+	Consumption float64
+	Amount      int64
+	// ByMember is the consumption attributed to each member (keyed by member reference) when
+	// room sub-meters are recorded: the own sub-meter plus an equal part of the common consumption
+	ByMember map[string]float64
+}
+
+// MeteredSplit returns a metered split with the consumption of each member,
+// or false when no room sub-meters were recorded
+func (u *MeterUsage) MeteredSplit() (ComponentSplit, bool) {
+	if u == nil || len(u.ByMember) == 0 {
+		return ComponentSplit{}, false
+	}
+	values := make(map[string]float64, len(u.ByMember))
+	for ref, consumption := range u.ByMember {
+		values[ref] = math.Round(consumption*100) / 100
+	}
+	return ComponentSplit{Policy: SplitMetered, Values: values}, true
+}
+
+// CalculateMeterUsage computes the consumption of a meter in a month from the last reading of the
+// month and the last reading of an earlier month, and prices it with the tariff
+func CalculateMeterUsage(readings []MeterReading, meter string, month string, tariff Tariff, members []Member) (*MeterUsage, error) {
+	isMainMeter := func(member string) bool { return member == "" }
+	consumption, err := meterConsumption(readings, meter, isMainMeter, month)
+	if err != nil {
+		return nil, err
+	}
+	usage := &MeterUsage{
+		Meter:       meter,
+		Consumption: consumption,
+		Amount:      tariff.Cost(consumption),
+	}
+
+	subMeters := make(map[string]float64)
+	var subTotal float64
+	for _, m := range members {
+		isSubMeter := func(member string) bool { return SameMember(members, member, m.Ref()) }
+		sub, err := meterConsumption(readings, meter, isSubMeter, month)
+		if err != nil {
+			// No sub-meter for this member
+			continue
+		}
+		subMeters[m.Ref()] = sub
+		subTotal += sub
+	}
+	if len(subMeters) == 0 {
+		return usage, nil
+	}
+	if subTotal > consumption {
+		return nil, fmt.Errorf("%s sub-meters (%s) exceed the main meter (%s)", meter, formatReading(subTotal), formatReading(consumption))
+	}
+
+	common := (consumption - subTotal) / float64(len(members))
+	usage.ByMember = make(map[string]float64, len(members))
+	for _, m := range members {
+		usage.ByMember[m.Ref()] = subMeters[m.Ref()] + common
+	}
+	return usage, nil
+}
+
+// meterConsumption returns the difference between the last reading of the month and the last reading before it
+func meterConsumption(readings []MeterReading, meter string, matchMember func(member string) bool, month string) (float64, error) {
+	var current, previous *MeterReading
+	for i := range readings {
+		r := &readings[i]
+		if r.Meter != meter || !matchMember(r.Member) {
+			continue
+		}
+		// Readings are in recording order, so a later reading of a month replaces an earlier one
+		if r.Month == month {
+			current = r
+		} else if r.Month < month && (previous == nil || r.Month >= previous.Month) {
+			previous = r
+		}
+	}
+	if current == nil {
+		return 0, fmt.Errorf("no %s reading for %s", meter, month)
+	}
+	if previous == nil {
+		return 0, fmt.Errorf("no %s reading before %s", meter, month)
+	}
+	consumption := current.Reading - previous.Reading
+	if consumption < 0 {
+		return 0, fmt.Errorf("%s reading %s is lower than the previous one (%s)", meter, formatReading(current.Reading), formatReading(previous.Reading))
+	}
+	return consumption, nil
+}
+
+func formatReading(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
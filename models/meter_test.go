@@ -0,0 +1,113 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testTariff = Tariff{
+	{UpTo: 50, Price: 1806},
+	{UpTo: 100, Price: 1866},
+	{UpTo: 200, Price: 2167},
+	{UpTo: 0, Price: 3151},
+}
+
+func TestTariffCost(t *testing.T) {
+	testCases := []struct {
+		name        string
+		consumption float64
+		expected    int64
+	}{
+		{name: "nothing used", consumption: 0, expected: 0},
+		{name: "first tier", consumption: 40, expected: 40 * 1806},
+		{name: "tier boundary", consumption: 50, expected: 50 * 1806},
+		{name: "second tier", consumption: 70, expected: 50*1806 + 20*1866},
+		{name: "last tier has no limit", consumption: 250, expected: 50*1806 + 50*1866 + 100*2167 + 50*3151},
+		{name: "decimal consumption", consumption: 10.5, expected: 18963},
+	}
+
+	for _, testCase := range testCases {
+		if actual := testTariff.Cost(testCase.consumption); actual != testCase.expected {
+			t.Errorf("%s: expected %d, got %d", testCase.name, testCase.expected, actual)
+		}
+	}
+}
+
+func TestCalculateMeterUsage(t *testing.T) {
+	readings := []MeterReading{
+		{Month: "2026_09", Meter: MeterElectric, Reading: 1000},
+		{Month: "2026_09", Meter: MeterElectric, Member: "111", Reading: 200},
+		{Month: "2026_09", Meter: MeterWater, Reading: 50},
+		{Month: "2026_10", Meter: MeterElectric, Reading: 1090},
+		// A corrected reading replaces the earlier one of the same month
+		{Month: "2026_10", Meter: MeterElectric, Reading: 1100},
+		{Month: "2026_10", Meter: MeterElectric, Member: "@a", Reading: 240},
+		{Month: "2026_10", Meter: MeterWater, Reading: 62},
+	}
+
+	usage, err := CalculateMeterUsage(readings, MeterElectric, "2026_10", testTariff, splitTestMembers)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if usage.Consumption != 100 || usage.Amount != 50*1806+50*1866 {
+		t.Errorf("unexpected electric usage %+v", usage)
+	}
+	// @a used 40 kWh in their room, the 60 kWh left are shared by the three members
+	expected := map[string]float64{"111": 60, "222": 20, "@c": 20}
+	if !reflect.DeepEqual(usage.ByMember, expected) {
+		t.Errorf("expected %v, got %v", expected, usage.ByMember)
+	}
+	split, ok := usage.MeteredSplit()
+	if !ok || split.Policy != SplitMetered || !reflect.DeepEqual(split.Values, expected) {
+		t.Errorf("unexpected metered split %+v", split)
+	}
+
+	usage, err = CalculateMeterUsage(readings, MeterWater, "2026_10", testTariff, splitTestMembers)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if usage.Consumption != 12 || usage.ByMember != nil {
+		t.Errorf("unexpected water usage %+v", usage)
+	}
+	if _, ok := usage.MeteredSplit(); ok {
+		t.Errorf("expected no metered split without sub-meters")
+	}
+}
+
+func TestCalculateMeterUsageErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		readings []MeterReading
+	}{
+		{
+			name:     "no reading this month",
+			readings: []MeterReading{{Month: "2026_09", Meter: MeterElectric, Reading: 1000}},
+		},
+		{
+			name:     "no earlier reading",
+			readings: []MeterReading{{Month: "2026_10", Meter: MeterElectric, Reading: 1000}},
+		},
+		{
+			name: "reading went down",
+			readings: []MeterReading{
+				{Month: "2026_09", Meter: MeterElectric, Reading: 1000},
+				{Month: "2026_10", Meter: MeterElectric, Reading: 900},
+			},
+		},
+		{
+			name: "sub-meters exceed the main meter",
+			readings: []MeterReading{
+				{Month: "2026_09", Meter: MeterElectric, Reading: 1000},
+				{Month: "2026_09", Meter: MeterElectric, Member: "111", Reading: 0},
+				{Month: "2026_10", Meter: MeterElectric, Reading: 1010},
+				{Month: "2026_10", Meter: MeterElectric, Member: "111", Reading: 20},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		if _, err := CalculateMeterUsage(testCase.readings, MeterElectric, "2026_10", testTariff, splitTestMembers); err == nil {
+			t.Errorf("%s: expected an error", testCase.name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// ErrRecordNotFound is returned when no row of a table holds the ID
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrRecordMoved is returned when the row where a record is written holds another ID: rows were sorted or inserted in the sheet
+var ErrRecordMoved = errors.New("the rows of the sheet are out of order")
+
+// IDHeader is the header of the ID column of the record tables
+const IDHeader = "ID"
+
+// NormalizeHeader ignores case, spaces and underscores, so "Last Done" matches "LastDone"
+func NormalizeHeader(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(strings.TrimSpace(s)))
+}
+
+// RecordTable is a table of records read with its header row. Columns are found by their header and records by
+// the value of their ID column. The bot writes record n on the row n rows below the header.
+type RecordTable struct {
+	headerRow int
+	columns   map[string]int
+	// width is the number of cells of the header row, up to the last header
+	width int
+	rows  [][]any
+}
+
+// NewRecordTable reads a table whose first row is the header row at headerRow; every wanted header must be there
+func NewRecordTable(values [][]any, headerRow int, headers ...string) (RecordTable, error) {
+	table := RecordTable{headerRow: headerRow, columns: make(map[string]int)}
+	if len(values) > 0 {
+		for i, header := range values[0] {
+			name := NormalizeHeader(cast.ToString(header))
+			if _, ok := table.columns[name]; !ok && name != "" {
+				table.columns[name] = i
+			}
+		}
+		table.width = len(values[0])
+		table.rows = values[1:]
+	}
+
+	var missing []string
+	for _, header := range append([]string{IDHeader}, headers...) {
+		if _, ok := table.columns[NormalizeHeader(header)]; !ok {
+			missing = append(missing, header)
+		}
+	}
+	if len(missing) > 0 {
+		return RecordTable{}, fmt.Errorf("header row %d has no column %s", headerRow, strings.Join(missing, ", "))
+	}
+	return table, nil
+}
+
+// Has reports whether the header row has the header, for the optional columns
+func (t RecordTable) Has(header string) bool {
+	_, ok := t.columns[NormalizeHeader(header)]
+	return ok
+}
+
+// AddColumn adds a column after the last header and returns its index from the first column of the table, so Row
+// places values under it; the caller writes the header cell. A header the table already has keeps its column.
+func (t *RecordTable) AddColumn(header string) int {
+	if i, ok := t.columns[NormalizeHeader(header)]; ok {
+		return i
+	}
+	i := t.width
+	t.columns[NormalizeHeader(header)] = i
+	t.width++
+	return i
+}
+
+// Find returns the sheet row and the values of the record with the ID
+func (t RecordTable) Find(id int) (int, []any, error) {
+	found := -1
+	for i, row := range t.rows {
+		if t.id(row) != id {
+			continue
+		}
+		if found >= 0 {
+			return 0, nil, fmt.Errorf("ID %d is on rows %d and %d", id, t.headerRow+1+found, t.headerRow+1+i)
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, nil, fmt.Errorf("ID %d: %w", id, ErrRecordNotFound)
+	}
+	return t.headerRow + 1 + found, t.rows[found], nil
+}
+
+// WriteRow returns the row to write the record with the ID to, n rows below the header for ID n.
+// It fails when that row holds another ID instead of writing over another record.
+func (t RecordTable) WriteRow(id int) (int, error) {
+	row, _, err := t.Find(id)
+	if err != nil {
+		return 0, err
+	}
+	if expected := t.headerRow + id; row != expected {
+		return 0, fmt.Errorf("ID %d is on row %d instead of row %d, sort the rows by ID: %w", id, row, expected, ErrRecordMoved)
+	}
+	return row, nil
+}
+
+// Records returns the rows that hold an ID, in the order of the sheet
+func (t RecordTable) Records() [][]any {
+	records := make([][]any, 0, len(t.rows))
+	for _, row := range t.rows {
+		if t.id(row) != 0 {
+			records = append(records, row)
+		}
+	}
+	return records
+}
+
+// CheckOrder checks that every record is n rows below the header for ID n, so records can be written at their row
+func (t RecordTable) CheckOrder() error {
+	for i, row := range t.rows {
+		if id := t.id(row); id != 0 && id != i+1 {
+			return fmt.Errorf("ID %d is on row %d instead of row %d, sort the rows by ID: %w", id, t.headerRow+1+i, t.headerRow+id, ErrRecordMoved)
+		}
+	}
+	return nil
+}
+
+// Value returns the value of a record under the header, nil when the row is shorter
+func (t RecordTable) Value(record []any, header string) any {
+	i, ok := t.columns[NormalizeHeader(header)]
+	if !ok || i >= len(record) {
+		return nil
+	}
+	return record[i]
+}
+
+// Row places the values under their headers; the other cells are nil, which the Sheets API leaves unchanged
+func (t RecordTable) Row(values map[string]any) []any {
+	width := 0
+	for header := range values {
+		if i, ok := t.columns[NormalizeHeader(header)]; ok && i+1 > width {
+			width = i + 1
+		}
+	}
+	row := make([]any, width)
+	for header, value := range values {
+		if i, ok := t.columns[NormalizeHeader(header)]; ok {
+			row[i] = value
+		}
+	}
+	return row
+}
+
+// Rewrite applies fn to the values under the headers on every row below the header, for a write starting on the
+// row after the header. Cells fn leaves unchanged are nil; it also returns the number of changed values.
+func (t RecordTable) Rewrite(headers []string, fn func(value string) string) ([][]any, int) {
+	changed := 0
+	values := make([][]any, len(t.rows))
+	for i, row := range t.rows {
+		updates := make(map[string]any)
+		for _, header := range headers {
+			value := cast.ToString(t.Value(row, header))
+			if rewritten := fn(value); rewritten != value {
+				updates[header] = rewritten
+			}
+		}
+		changed += len(updates)
+		values[i] = t.Row(updates)
+	}
+	return values, changed
+}
+
+func (t RecordTable) id(row []any) int {
+	i := t.columns[NormalizeHeader(IDHeader)]
+	if i >= len(row) || cast.ToString(row[i]) == "" {
+		return 0
+	}
+	return cast.ToInt(strings.TrimSpace(cast.ToString(row[i])))
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRecordTableFindsRecordsByID(t *testing.T) {
+	// Header on row 2 with the columns in another order than the sample spreadsheet
+	values := [][]any{
+		{"Name", "id", "Estimated Price"},
+		{"Milk", "1", "30000"},
+		{"Eggs", "3", "45000"},
+		{"Bread", "2", ""},
+	}
+	table, err := NewRecordTable(values, 2, "Name", "EstimatedPrice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, record, err := table.Find(3)
+	if err != nil || row != 4 || table.Value(record, "Name") != "Eggs" {
+		t.Errorf("Find(3) = row %d, %v, %v; want row 4 with Eggs", row, record, err)
+	}
+	if got := table.Value(values[3], "EstimatedPrice"); got != "" {
+		t.Errorf("Value of an empty cell = %v", got)
+	}
+	if _, _, err := table.Find(4); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Find(4) error = %v, want ErrRecordNotFound", err)
+	}
+
+	if got, err := table.WriteRow(1); got != 3 || err != nil {
+		t.Errorf("WriteRow(1) = %d, %v; want 3", got, err)
+	}
+	// Rows 4 and 5 were swapped: writing ID 2 at row 4 would overwrite ID 3
+	if _, err := table.WriteRow(2); !errors.Is(err, ErrRecordMoved) {
+		t.Errorf("WriteRow(2) error = %v, want ErrRecordMoved", err)
+	}
+
+	if err := table.CheckOrder(); !errors.Is(err, ErrRecordMoved) {
+		t.Errorf("CheckOrder error = %v, want ErrRecordMoved", err)
+	}
+	if got := len(table.Records()); got != 3 {
+		t.Errorf("Records = %d rows, want 3", got)
+	}
+
+	want := []any{"Butter", 1}
+	if got := table.Row(map[string]any{"ID": 1, "Name": "Butter"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Row = %v, want %v", got, want)
+	}
+}
+
+func TestRecordTableRejectsBrokenTables(t *testing.T) {
+	if _, err := NewRecordTable([][]any{{"ID", "Name"}}, 2, "Name", "Checked"); err == nil {
+		t.Error("a missing header should fail")
+	}
+	if _, err := NewRecordTable(nil, 2); err == nil {
+		t.Error("a table without header row should fail")
+	}
+
+	table, err := NewRecordTable([][]any{{"ID"}, {"1"}, {"1"}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := table.Find(1); err == nil || errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("a duplicated ID should fail, got %v", err)
+	}
+}
+
+func TestRecordTableAddColumn(t *testing.T) {
+	table, err := NewRecordTable([][]any{{"ID", "Name"}, {"1", "Dishes"}}, 2, "Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Has("RequiresProof") || !table.Has("name") {
+		t.Error("Has should only report the headers of the row")
+	}
+	if got := table.AddColumn("RequiresProof"); got != 2 {
+		t.Errorf("AddColumn = %d, want the column after Name", got)
+	}
+	if got := table.AddColumn("Requires Proof"); got != 2 {
+		t.Errorf("AddColumn of an existing header = %d, want 2", got)
+	}
+	want := []any{1, nil, true}
+	if got := table.Row(map[string]any{"ID": 1, "RequiresProof": true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Row = %v, want %v", got, want)
+	}
+}
+
+func TestRecordTableRewrite(t *testing.T) {
+	// Assignee is not in column F of the sample spreadsheet
+	values := [][]any{
+		{"Assignee", "ID", "Name", "Handover From"},
+		{"@alice", "1", "Dishes", ""},
+		{"@bob", "2", "Trash", "@alice"},
+		{},
+		{"111", "3", "Floor"},
+	}
+	table, err := NewRecordTable(values, 2, "Name", "Assignee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{"@alice": "111", "@bob": "222"}
+	got, changed := table.Rewrite([]string{"Assignee", "HandoverFrom", "Missing"}, func(value string) string {
+		if id, ok := ids[value]; ok {
+			return id
+		}
+		return value
+	})
+	want := [][]any{
+		{"111"},
+		{"222", nil, nil, "111"},
+		{},
+		{},
+	}
+	if changed != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Rewrite = %v, %d changes; want %v, 3 changes", got, changed, want)
+	}
+}
@@ -1,14 +1,28 @@
 package models
 
+import (
+	"fmt"
+
+	"housematee-tgbot/utilities"
+)
+
 // RentData holds the rent information collected from user
 type RentData struct {
 	TotalBill int64  // Total rent amount
 	Electric  int64  // Electric amount
 	Water     int64  // Water amount
 	OtherFees int64  // Calculated: TotalBill - Electric - Water
-	Payer     string // Who paid the rent (e.g., @ng0cth1nh)
+	Payer     string // Member reference of who paid the rent (Telegram user ID once linked)
+	PayerName string // Display handle of the payer (e.g., @ng0cth1nh)
+
+	// Meter usage the electric and water amounts were taken from (nil when entered by hand)
+	ElectricUsage *MeterUsage
+	WaterUsage    *MeterUsage
+
+	// Split policy chosen in the /rent flow
+	SplitPolicy RentSplitPolicy
 
-	// Per-member shares (calculated based on weights)
+	// Per-member shares (calculated with the split policy)
 	MemberShares []MemberShare
 }
 
@@ -21,40 +35,63 @@ type MemberShare struct {
 	TotalShare    int64
 }
 
+// ApplyMeterSplits splits the metered components by the consumption of each member
+// when room sub-meters were recorded
+func (r *RentData) ApplyMeterSplits() {
+	if split, ok := r.ElectricUsage.MeteredSplit(); ok {
+		r.SplitPolicy.Electric = split
+	}
+	if split, ok := r.WaterUsage.MeteredSplit(); ok {
+		r.SplitPolicy.Water = split
+	}
+}
+
+// Validate checks that the amounts are not negative and that electric and water fit in the total
+func (r *RentData) Validate() error {
+	if r.TotalBill < 0 || r.Electric < 0 || r.Water < 0 {
+		return fmt.Errorf("amounts cannot be negative")
+	}
+	if r.Electric+r.Water > r.TotalBill {
+		return fmt.Errorf("electric (%s) + water (%s) exceed the total (%s)",
+			utilities.FormatMoney(int(r.Electric)), utilities.FormatMoney(int(r.Water)), utilities.FormatMoney(int(r.TotalBill)))
+	}
+	return nil
+}
+
 // CalculateOtherFees calculates and sets the OtherFees field
 func (r *RentData) CalculateOtherFees() {
 	r.OtherFees = r.TotalBill - r.Electric - r.Water
 }
 
-// CalculateMemberShares calculates per-member shares based on weights
-// Electric and Water: split by weight
-// OtherFees: split equally
-func (r *RentData) CalculateMemberShares(members []Member) {
+// CalculateMemberShares calculates per-member shares with the split policy of each component.
+// The shares of a component always add up to the component amount.
+func (r *RentData) CalculateMemberShares(members []Member, policy RentSplitPolicy) error {
 	if len(members) == 0 {
-		return
+		return nil
 	}
 
-	// Calculate total weight
-	totalWeight := 0
-	for _, m := range members {
-		totalWeight += m.Weight
+	electric, err := policy.Electric.Split(r.Electric, members)
+	if err != nil {
+		return fmt.Errorf("electric: %w", err)
+	}
+	water, err := policy.Water.Split(r.Water, members)
+	if err != nil {
+		return fmt.Errorf("water: %w", err)
+	}
+	other, err := policy.OtherFees.Split(r.OtherFees, members)
+	if err != nil {
+		return fmt.Errorf("other fees: %w", err)
 	}
 
-	// Calculate shares
 	r.MemberShares = make([]MemberShare, len(members))
 	for i, m := range members {
-		// Electric and Water: split by weight
-		electricShare := (r.Electric * int64(m.Weight)) / int64(totalWeight)
-		waterShare := (r.Water * int64(m.Weight)) / int64(totalWeight)
-		// Other fees: split equally
-		otherShare := r.OtherFees / int64(len(members))
-
 		r.MemberShares[i] = MemberShare{
 			Username:      m.Username,
-			ElectricShare: electricShare,
-			WaterShare:    waterShare,
-			OtherShare:    otherShare,
-			TotalShare:    electricShare + waterShare + otherShare,
+			ElectricShare: electric[i],
+			WaterShare:    water[i],
+			OtherShare:    other[i],
+			TotalShare:    electric[i] + water[i] + other[i],
 		}
 	}
+	return nil
 }
@@ -0,0 +1,28 @@
+package models
+
+import "testing"
+
+func TestRentDataValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rentData RentData
+		valid    bool
+	}{
+		{name: "electric and water fit", rentData: RentData{TotalBill: 1000, Electric: 300, Water: 200}, valid: true},
+		{name: "no other fees", rentData: RentData{TotalBill: 500, Electric: 300, Water: 200}, valid: true},
+		{name: "water not entered yet", rentData: RentData{TotalBill: 1000, Electric: 1000}, valid: true},
+		{name: "electric exceeds the total", rentData: RentData{TotalBill: 1000, Electric: 1001}},
+		{name: "electric and water exceed the total", rentData: RentData{TotalBill: 1000, Electric: 600, Water: 500}},
+		{name: "negative amount", rentData: RentData{TotalBill: 1000, Electric: -1}},
+	}
+
+	for _, testCase := range testCases {
+		err := testCase.rentData.Validate()
+		if testCase.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", testCase.name, err.Error())
+		}
+		if !testCase.valid && err == nil {
+			t.Errorf("%s: expected an error", testCase.name)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SplitPolicy is how one rent component is divided between the members
+type SplitPolicy string
+
+const (
+	SplitEqual      SplitPolicy = "equal"      // same share for everyone
+	SplitWeighted   SplitPolicy = "weighted"   // by member weight (Members column Q)
+	SplitFixed      SplitPolicy = "fixed"      // fixed amounts, the rest is split equally between the others
+	SplitPercentage SplitPolicy = "percentage" // percentages that add up to 100
+	SplitRoomSize   SplitPolicy = "room"       // by room size in m²
+	SplitMetered    SplitPolicy = "metered"    // by consumption per member from room sub-meters
+)
+
+// SplitPolicies lists the policies in the order they are offered to users
+var SplitPolicies = []SplitPolicy{SplitEqual, SplitWeighted, SplitFixed, SplitPercentage, SplitRoomSize, SplitMetered}
+
+// NeedsValues reports whether the policy needs a value per member
+func (p SplitPolicy) NeedsValues() bool {
+	return p == SplitFixed || p == SplitPercentage || p == SplitRoomSize || p == SplitMetered
+}
+
+// ComponentSplit is the policy of a rent component with its per-member values (keyed by member reference)
+type ComponentSplit struct {
+	Policy SplitPolicy
+	Values map[string]float64
+}
+
+// RentSplitPolicy holds the split policy of each rent component
+type RentSplitPolicy struct {
+	Electric  ComponentSplit
+	Water     ComponentSplit
+	OtherFees ComponentSplit
+}
+
+// DefaultRentSplitPolicy splits electric and water by weight and other fees equally
+func DefaultRentSplitPolicy() RentSplitPolicy {
+	return RentSplitPolicy{
+		Electric:  ComponentSplit{Policy: SplitWeighted},
+		Water:     ComponentSplit{Policy: SplitWeighted},
+		OtherFees: ComponentSplit{Policy: SplitEqual},
+	}
+}
+
+// ForNextMonths returns the policy to keep for the next months.
+// Metered consumption only applies to the current month, so its values are dropped.
+func (p RentSplitPolicy) ForNextMonths() RentSplitPolicy {
+	for _, split := range []*ComponentSplit{&p.Electric, &p.Water, &p.OtherFees} {
+		if split.Policy == SplitMetered {
+			split.Values = nil
+		}
+	}
+	return p
+}
+
+// String encodes the component split as stored in the sheet, e.g., "percentage:111=60,@b=40"
+func (c ComponentSplit) String() string {
+	if len(c.Values) == 0 {
+		return string(c.Policy)
+	}
+	refs := make([]string, 0, len(c.Values))
+	for ref := range c.Values {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	parts := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		parts = append(parts, ref+"="+strconv.FormatFloat(c.Values[ref], 'f', -1, 64))
+	}
+	return string(c.Policy) + ":" + strings.Join(parts, ",")
+}
+
+// ParseComponentSplit decodes a component split written by ComponentSplit.String
+func ParseComponentSplit(value string) (ComponentSplit, error) {
+	name, rawValues, _ := strings.Cut(strings.TrimSpace(value), ":")
+	split := ComponentSplit{Policy: SplitPolicy(strings.ToLower(strings.TrimSpace(name)))}
+	if !isKnownSplitPolicy(split.Policy) {
+		return split, fmt.Errorf("unknown split policy %q", name)
+	}
+	if strings.TrimSpace(rawValues) == "" {
+		return split, nil
+	}
+	split.Values = make(map[string]float64)
+	for _, part := range strings.Split(rawValues, ",") {
+		ref, number, ok := strings.Cut(part, "=")
+		if !ok {
+			return split, fmt.Errorf("invalid split value %q", part)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || v < 0 {
+			return split, fmt.Errorf("invalid split value %q", part)
+		}
+		split.Values[strings.TrimSpace(ref)] = v
+	}
+	return split, nil
+}
+
+func isKnownSplitPolicy(policy SplitPolicy) bool {
+	for _, p := range SplitPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// Split divides amount between the members according to the policy.
+// Shares are returned in the order of members and always add up to amount.
+func (c ComponentSplit) Split(amount int64, members []Member) ([]int64, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no members to split between")
+	}
+
+	weights := make([]int64, len(members))
+	switch c.Policy {
+	case SplitEqual:
+		for i := range weights {
+			weights[i] = 1
+		}
+	case SplitWeighted:
+		for i, m := range members {
+			weights[i] = int64(m.Weight)
+		}
+	case SplitPercentage, SplitRoomSize, SplitMetered:
+		var total float64
+		for i, m := range members {
+			v, ok := c.memberValue(members, m)
+			if !ok {
+				return nil, fmt.Errorf("%s has no %s value", m.Username, c.Policy)
+			}
+			// Hundredths keep values such as 33.33%, 12.5 m² or 40.25 kWh exact
+			weights[i] = int64(v*100 + 0.5)
+			total += v
+		}
+		if c.Policy == SplitPercentage && (total < 99.995 || total > 100.005) {
+			return nil, fmt.Errorf("percentages add up to %s, not 100", strconv.FormatFloat(total, 'f', -1, 64))
+		}
+	case SplitFixed:
+		return c.splitFixed(amount, members)
+	default:
+		return nil, fmt.Errorf("unknown split policy %q", c.Policy)
+	}
+	return SplitByWeights(amount, weights)
+}
+
+// splitFixed charges the members with a fixed amount and splits the rest equally between the others
+func (c ComponentSplit) splitFixed(amount int64, members []Member) ([]int64, error) {
+	shares := make([]int64, len(members))
+	var fixedTotal int64
+	rest := make([]int, 0, len(members))
+	for i, m := range members {
+		if v, ok := c.memberValue(members, m); ok {
+			shares[i] = int64(v)
+			fixedTotal += shares[i]
+			continue
+		}
+		rest = append(rest, i)
+	}
+
+	remaining := amount - fixedTotal
+	if remaining < 0 {
+		return nil, fmt.Errorf("fixed amounts (%d) exceed the bill (%d)", fixedTotal, amount)
+	}
+	if len(rest) == 0 {
+		if remaining != 0 {
+			return nil, fmt.Errorf("fixed amounts (%d) do not add up to the bill (%d)", fixedTotal, amount)
+		}
+		return shares, nil
+	}
+
+	weights := make([]int64, len(rest))
+	for i := range weights {
+		weights[i] = 1
+	}
+	restShares, err := SplitByWeights(remaining, weights)
+	if err != nil {
+		return nil, err
+	}
+	for i, index := range rest {
+		shares[index] = restShares[i]
+	}
+	return shares, nil
+}
+
+// memberValue returns the value configured for the member, looked up by any reference of the member
+func (c ComponentSplit) memberValue(members []Member, member Member) (float64, bool) {
+	for ref, v := range c.Values {
+		if m := FindMemberByRef(members, ref); m != nil && m.Ref() == member.Ref() {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// SplitByWeights divides amount proportionally to weights using the largest remainder method.
+// The leftover units go to the largest fractional parts, ties to the earliest position,
+// so the result is deterministic and always adds up to amount.
+func SplitByWeights(amount int64, weights []int64) ([]int64, error) {
+	var totalWeight int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("weights cannot be negative")
+		}
+		totalWeight += w
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("weights add up to zero")
+	}
+
+	shares := make([]int64, len(weights))
+	remainders := make([]int64, len(weights))
+	var assigned int64
+	for i, w := range weights {
+		shares[i] = amount * w / totalWeight
+		remainders[i] = amount * w % totalWeight
+		assigned += shares[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := int64(0); i < amount-assigned; i++ {
+		shares[order[i]]++
+	}
+	return shares, nil
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+var splitTestMembers = []Member{
+	{ID: 1, Username: "@a", Weight: 1, UserID: 111, RefByUserID: true},
+	{ID: 2, Username: "@b", Weight: 2, UserID: 222, RefByUserID: true},
+	{ID: 3, Username: "@c", Weight: 1},
+}
+
+func sum(shares []int64) int64 {
+	var total int64
+	for _, s := range shares {
+		total += s
+	}
+	return total
+}
+
+func TestSplitByWeightsDistributesRemainder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		amount   int64
+		weights  []int64
+		expected []int64
+	}{
+		{
+			name:     "one dong left goes to the first member",
+			amount:   1000001,
+			weights:  []int64{1, 1, 1},
+			expected: []int64{333334, 333334, 333333},
+		},
+		{
+			name:     "largest fraction gets the leftover",
+			amount:   100,
+			weights:  []int64{1, 2},
+			expected: []int64{33, 67},
+		},
+		{
+			name:     "zero weight gets nothing",
+			amount:   10,
+			weights:  []int64{0, 1, 1},
+			expected: []int64{0, 5, 5},
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := SplitByWeights(testCase.amount, testCase.weights)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", testCase.name, err.Error())
+		}
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf("%s: expected %v, got %v", testCase.name, testCase.expected, actual)
+		}
+		if sum(actual) != testCase.amount {
+			t.Errorf("%s: shares add up to %d, expected %d", testCase.name, sum(actual), testCase.amount)
+		}
+	}
+
+	if _, err := SplitByWeights(10, []int64{0, 0}); err == nil {
+		t.Errorf("expected an error for zero total weight")
+	}
+}
+
+func TestComponentSplitPolicies(t *testing.T) {
+	testCases := []struct {
+		name     string
+		split    ComponentSplit
+		amount   int64
+		expected []int64
+	}{
+		{
+			name:     "equal",
+			split:    ComponentSplit{Policy: SplitEqual},
+			amount:   1000001,
+			expected: []int64{333334, 333334, 333333},
+		},
+		{
+			name:     "weighted",
+			split:    ComponentSplit{Policy: SplitWeighted},
+			amount:   1000001,
+			expected: []int64{250000, 500001, 250000},
+		},
+		{
+			name:     "fixed with rest split equally",
+			split:    ComponentSplit{Policy: SplitFixed, Values: map[string]float64{"111": 500000}},
+			amount:   1000001,
+			expected: []int64{500000, 250001, 250000},
+		},
+		{
+			name:     "fixed for everyone",
+			split:    ComponentSplit{Policy: SplitFixed, Values: map[string]float64{"111": 100, "@b": 200, "@c": 300}},
+			amount:   600,
+			expected: []int64{100, 200, 300},
+		},
+		{
+			name:     "percentage",
+			split:    ComponentSplit{Policy: SplitPercentage, Values: map[string]float64{"111": 50, "222": 25, "@c": 25}},
+			amount:   1000001,
+			expected: []int64{500001, 250000, 250000},
+		},
+		{
+			name:     "percentage with decimals",
+			split:    ComponentSplit{Policy: SplitPercentage, Values: map[string]float64{"111": 33.34, "222": 33.33, "@c": 33.33}},
+			amount:   100,
+			expected: []int64{34, 33, 33},
+		},
+		{
+			name:     "room size",
+			split:    ComponentSplit{Policy: SplitRoomSize, Values: map[string]float64{"@a": 20, "@b": 12.5, "@c": 7.5}},
+			amount:   400000,
+			expected: []int64{200000, 125000, 75000},
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := testCase.split.Split(testCase.amount, splitTestMembers)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", testCase.name, err.Error())
+		}
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf("%s: expected %v, got %v", testCase.name, testCase.expected, actual)
+		}
+		if sum(actual) != testCase.amount {
+			t.Errorf("%s: shares add up to %d, expected %d", testCase.name, sum(actual), testCase.amount)
+		}
+	}
+}
+
+func TestComponentSplitErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		split  ComponentSplit
+		amount int64
+	}{
+		{
+			name:   "fixed amounts exceed the bill",
+			split:  ComponentSplit{Policy: SplitFixed, Values: map[string]float64{"111": 700, "222": 700}},
+			amount: 1000,
+		},
+		{
+			name:   "fixed amounts for everyone do not add up",
+			split:  ComponentSplit{Policy: SplitFixed, Values: map[string]float64{"111": 100, "222": 100, "@c": 100}},
+			amount: 1000,
+		},
+		{
+			name:   "percentages do not add up to 100",
+			split:  ComponentSplit{Policy: SplitPercentage, Values: map[string]float64{"111": 50, "222": 30, "@c": 10}},
+			amount: 1000,
+		},
+		{
+			name:   "member without room size",
+			split:  ComponentSplit{Policy: SplitRoomSize, Values: map[string]float64{"111": 20, "222": 10}},
+			amount: 1000,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if _, err := testCase.split.Split(testCase.amount, splitTestMembers); err == nil {
+			t.Errorf("%s: expected an error", testCase.name)
+		}
+	}
+}
+
+func TestComponentSplitEncoding(t *testing.T) {
+	split := ComponentSplit{Policy: SplitPercentage, Values: map[string]float64{"222": 40, "111": 60}}
+	encoded := split.String()
+	if encoded != "percentage:111=60,222=40" {
+		t.Errorf("unexpected encoding %q", encoded)
+	}
+
+	decoded, err := ParseComponentSplit(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(decoded, split) {
+		t.Errorf("expected %+v, got %+v", split, decoded)
+	}
+
+	if decoded, err := ParseComponentSplit("Weighted"); err != nil || decoded.Policy != SplitWeighted {
+		t.Errorf("expected weighted policy, got %+v (%v)", decoded, err)
+	}
+	if _, err := ParseComponentSplit("random"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
+
+func TestCalculateMemberShares(t *testing.T) {
+	rentData := RentData{TotalBill: 3000001, Electric: 1000001, Water: 1000000}
+	rentData.CalculateOtherFees()
+
+	if err := rentData.CalculateMemberShares(splitTestMembers, DefaultRentSplitPolicy()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var total int64
+	for _, share := range rentData.MemberShares {
+		if share.TotalShare != share.ElectricShare+share.WaterShare+share.OtherShare {
+			t.Errorf("%s: total share does not add up", share.Username)
+		}
+		total += share.TotalShare
+	}
+	if total != rentData.TotalBill {
+		t.Errorf("member shares add up to %d, expected %d", total, rentData.TotalBill)
+	}
+}
+
+func TestRentSplitPolicyForNextMonths(t *testing.T) {
+	policy := RentSplitPolicy{
+		Electric:  ComponentSplit{Policy: SplitMetered, Values: map[string]float64{"111": 60}},
+		Water:     ComponentSplit{Policy: SplitRoomSize, Values: map[string]float64{"111": 20}},
+		OtherFees: ComponentSplit{Policy: SplitEqual},
+	}
+
+	next := policy.ForNextMonths()
+	if next.Electric.Values != nil || next.Electric.Policy != SplitMetered {
+		t.Errorf("expected metered values to be dropped, got %+v", next.Electric)
+	}
+	if len(next.Water.Values) != 1 {
+		t.Errorf("expected room sizes to be kept, got %+v", next.Water)
+	}
+	if policy.Electric.Values == nil {
+		t.Errorf("expected the original policy to be unchanged")
+	}
+}
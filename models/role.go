@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is what a user may do in a chat; a higher role may do everything a lower one may
+type Role int
+
+const (
+	RoleNone Role = iota
+	// RoleViewer sees lists and reports but changes nothing
+	RoleViewer
+	// RoleMember adds expenses, rent, readings and chores, and edits the expenses they paid
+	RoleMember
+	// RoleAdmin also manages members, month sheets, other members' expenses and the member and viewer roles
+	RoleAdmin
+	// RoleOwner also grants the admin and owner roles
+	RoleOwner
+)
+
+var roleNames = map[Role]string{
+	RoleViewer: "viewer",
+	RoleMember: "member",
+	RoleAdmin:  "admin",
+	RoleOwner:  "owner",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+// ParseRole parses a role name such as "admin", ignoring case
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if strings.EqualFold(strings.TrimSpace(name), roleName) {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q, use owner, admin, member or viewer", name)
+}
+
+// CanAssign reports whether a user with role r may change the role of a user from current to target.
+// Owners assign any role; admins move users below admin between member and viewer.
+func (r Role) CanAssign(current Role, target Role) bool {
+	switch r {
+	case RoleOwner:
+		return true
+	case RoleAdmin:
+		return current < RoleAdmin && target < RoleAdmin
+	default:
+		return false
+	}
+}
+
+// RoleAssignment is a row of the Roles sheet: the role of a user in a chat
+type RoleAssignment struct {
+	ChatID    int64
+	UserID    int64
+	Role      Role
+	UpdatedBy string
+	UpdatedAt string
+}
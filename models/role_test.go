@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestParseRole(t *testing.T) {
+	for _, name := range []string{"owner", "Admin", " member ", "VIEWER"} {
+		role, err := ParseRole(name)
+		if err != nil {
+			t.Errorf("ParseRole(%q) failed: %s", name, err)
+			continue
+		}
+		if got, _ := ParseRole(role.String()); got != role {
+			t.Errorf("ParseRole(%q) does not round-trip: %s", name, role)
+		}
+	}
+	if _, err := ParseRole("superuser"); err == nil {
+		t.Error("ParseRole(superuser) should fail")
+	}
+}
+
+func TestRoleCanAssign(t *testing.T) {
+	tests := []struct {
+		assigner Role
+		current  Role
+		target   Role
+		want     bool
+	}{
+		{RoleOwner, RoleAdmin, RoleOwner, true},
+		{RoleOwner, RoleOwner, RoleViewer, true},
+		{RoleAdmin, RoleMember, RoleViewer, true},
+		{RoleAdmin, RoleViewer, RoleMember, true},
+		{RoleAdmin, RoleMember, RoleAdmin, false},
+		{RoleAdmin, RoleAdmin, RoleMember, false},
+		{RoleMember, RoleViewer, RoleMember, false},
+		{RoleViewer, RoleViewer, RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.assigner.CanAssign(tt.current, tt.target); got != tt.want {
+			t.Errorf("%s.CanAssign(%s, %s) = %v, want %v", tt.assigner, tt.current, tt.target, got, tt.want)
+		}
+	}
+}
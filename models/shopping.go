@@ -0,0 +1,10 @@
+package models
+
+// ShoppingItem is an item of the shared shopping list
+type ShoppingItem struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	EstimatedPrice int64  `json:"estimated_price"` // 0 if unknown
+	AddedBy        string `json:"added_by"`
+	Checked        bool   `json:"checked"` // Bought, waiting for checkout
+}
@@ -0,0 +1,31 @@
+package models
+
+// Task history event types
+const (
+	TaskEventDone     = "done"
+	TaskEventHandover = "handover" // A single turn was handed over to another member
+	TaskEventSwap     = "swap"     // The assignees of two tasks were swapped
+)
+
+// TaskHistory is a single entry of the task history log
+type TaskHistory struct {
+	Timestamp string `json:"timestamp"` // DD/MM/YYYY HH:mm in the house timezone
+	TaskID    int    `json:"task_id"`
+	TaskName  string `json:"task_name"`
+	Event     string `json:"event"`
+	Doer      string `json:"doer"`     // Who performed the event
+	Assignee  string `json:"assignee"` // Who was assigned at the time of the event
+	DueDate   string `json:"due_date"` // NextDue of the task at the time of the event
+	Note      string `json:"note"`
+}
+
+// HouseworkStats holds the fairness statistics of a single member
+type HouseworkStats struct {
+	Username      string
+	WeekDone      int            // Completions in the current week (Monday-based)
+	MonthDone     int            // Completions in the current month
+	Streak        int            // Consecutive own turns completed on time without being covered
+	Overdue       int            // Tasks currently overdue and assigned to the member
+	LateThisMonth int            // Own turns completed after the due date this month
+	CoveredFor    map[string]int // map[assignee]count of turns done for others this month
+}
@@ -0,0 +1,143 @@
+// Package archive writes and reads the archives of /export and /import: a ZIP file with export.json, which imports
+// read, and a CSV file per table for spreadsheets and scripts.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"housematee-tgbot/models"
+)
+
+// JSONName is the file of the archive imports read, the CSV files are ignored
+const JSONName = "export.json"
+
+// MaxArchiveSize bounds the archives read by imports
+const MaxArchiveSize = 20 << 20
+
+// FileName is the name of the archive of a household for a period
+func FileName(chatID int64, period models.ExportPeriod) string {
+	return fmt.Sprintf("housematee_%d_%s.zip", chatID, period)
+}
+
+// Write writes the export as a ZIP file with export.json and the CSV files
+func Write(w io.Writer, e models.Export) error {
+	zw := zip.NewWriter(w)
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", JSONName, err)
+	}
+	f, err := zw.Create(JSONName)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	for _, table := range csvTables(e) {
+		f, err := zw.Create(table.name)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(f)
+		if err := cw.WriteAll(append([][]string{table.header}, table.rows...)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", table.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// Read reads an export from a ZIP file written by Write, or from its export.json alone
+func Read(data []byte) (models.Export, error) {
+	var e models.Export
+	if len(data) > MaxArchiveSize {
+		return e, fmt.Errorf("the file is larger than %d MB", MaxArchiveSize>>20)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if errors.Is(err, zip.ErrFormat) {
+		// Not a ZIP file, read it as export.json
+		return decodeJSON(bytes.NewReader(data))
+	} else if err != nil {
+		return e, err
+	}
+	for _, f := range zr.File {
+		if f.Name != JSONName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return e, err
+		}
+		defer rc.Close()
+		return decodeJSON(io.LimitReader(rc, MaxArchiveSize))
+	}
+	return e, fmt.Errorf("the archive has no %s", JSONName)
+}
+
+func decodeJSON(r io.Reader) (models.Export, error) {
+	var e models.Export
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&e); err != nil {
+		return e, fmt.Errorf("failed to read %s: %w", JSONName, err)
+	}
+	return e, e.Validate()
+}
+
+type csvTable struct {
+	name   string
+	header []string
+	rows   [][]string
+}
+
+func csvTables(e models.Export) []csvTable {
+	expenses := csvTable{name: "expenses.csv", header: []string{"sheet", "id", "name", "amount", "date", "payer", "participants", "note"}}
+	members := csvTable{name: "members.csv", header: []string{"sheet", "id", "username", "weight", "user_id", "display_name"}}
+	rent := csvTable{name: "rent.csv", header: []string{"sheet", "electric", "water", "other_fees", "total", "payer"}}
+	for _, month := range e.Months {
+		for _, x := range month.Expenses {
+			expenses.rows = append(expenses.rows, []string{
+				month.Sheet, itoa(int64(x.ID)), x.Name, x.Amount, x.Date, x.Payer, strings.Join(x.Participants, ","), x.Note,
+			})
+		}
+		for _, m := range month.Members {
+			members.rows = append(members.rows, []string{
+				month.Sheet, itoa(int64(m.ID)), m.Username, itoa(int64(m.Weight)), itoa(m.UserID), m.DisplayName,
+			})
+		}
+		if r := month.Rent; r != nil {
+			rent.rows = append(rent.rows, []string{month.Sheet, itoa(r.Electric), itoa(r.Water), itoa(r.OtherFees), itoa(r.Total), r.Payer})
+		}
+	}
+
+	tasks := csvTable{name: "tasks.csv", header: []string{"id", "name", "frequency", "last_done", "next_due", "assignee", "turns_remaining", "channel_id", "note", "requires_proof", "handover_from"}}
+	for _, t := range e.Tasks {
+		tasks.rows = append(tasks.rows, []string{
+			itoa(int64(t.ID)), t.Name, itoa(int64(t.Frequency)), t.LastDone, t.NextDue, t.Assignee,
+			itoa(int64(t.TurnsRemaining)), itoa(t.ChannelId), t.Note, strconv.FormatBool(t.RequiresProof), t.HandoverFrom,
+		})
+	}
+	history := csvTable{name: "task_history.csv", header: []string{"timestamp", "task_id", "task_name", "event", "doer", "assignee", "due_date", "note"}}
+	for _, h := range e.TaskHistory {
+		history.rows = append(history.rows, []string{h.Timestamp, itoa(int64(h.TaskID)), h.TaskName, h.Event, h.Doer, h.Assignee, h.DueDate, h.Note})
+	}
+	audit := csvTable{name: "audit.csv", header: []string{"timestamp", "source", "sheet", "record_id", "entry"}}
+	for _, a := range e.Audit {
+		audit.rows = append(audit.rows, []string{a.Timestamp, a.Source, a.Sheet, itoa(int64(a.RecordID)), a.Entry})
+	}
+	return []csvTable{expenses, members, rent, tasks, history, audit}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"housematee-tgbot/models"
+)
+
+func sampleExport() models.Export {
+	return models.Export{
+		Format: models.ExportFormat,
+		Period: "2026_10",
+		Months: []models.MonthData{{
+			Sheet:    "2026_10",
+			Members:  []models.Member{{ID: 1, Username: "@alice", Weight: 1}},
+			Expenses: []models.Expense{{ID: 1, Name: "Milk", Amount: "30000", Participants: []string{"@alice"}}},
+			Rent:     &models.RentCells{Total: 5000000, Payer: "111"},
+		}},
+		Tasks: []models.Task{{ID: 1, Name: "Trash", Frequency: 2}},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	e := sampleExport()
+	var buf bytes.Buffer
+	if err := Write(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, name := range []string{JSONName, "expenses.csv", "members.csv", "rent.csv", "tasks.csv", "task_history.csv", "audit.csv"} {
+		if !names[name] {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+
+	got, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Months, e.Months) || !reflect.DeepEqual(got.Tasks, e.Tasks) {
+		t.Errorf("Read = %+v, want %+v", got, e)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	data, err := json.Marshal(sampleExport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(data); err != nil {
+		t.Errorf("bare JSON should be accepted: %v", err)
+	}
+	if _, err := Read([]byte(`{"format": 1, "unknown": true}`)); err == nil {
+		t.Error("unknown fields should be refused")
+	}
+}
+
+func TestReadWithoutJSON(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("expenses.csv")
+	f.Write([]byte("ID,Name\n1,Milk\n"))
+	zw.Close()
+
+	if _, err := Read(buf.Bytes()); err == nil {
+		t.Errorf("an archive without %s should be refused", JSONName)
+	}
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+)
+
+// maxCacheEntries bounds the cache, expired entries are dropped when it is reached
+const maxCacheEntries = 1000
+
+// CacheRule sets the TTL of the ranges starting with Prefix, e.g., "Database!"
+type CacheRule struct {
+	Prefix string
+	TTL    time.Duration
+}
+
+// CacheOptions configures CachedGSheets
+type CacheOptions struct {
+	DefaultTTL  time.Duration // TTL of the ranges without a rule, 0 does not cache them
+	Rules       []CacheRule   // the first rule whose prefix matches the range wins
+	MetadataTTL time.Duration // TTL of the spreadsheet metadata (list of sheets)
+}
+
+// CacheStats counts the cache lookups and invalidations
+type CacheStats struct {
+	Hits            uint64
+	Misses          uint64
+	Invalidations   uint64 // entries dropped after our own writes
+	ExternalChanges uint64 // entries found changed by someone else
+}
+
+// HitRate returns the share of lookups answered from the cache, between 0 and 1
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type cacheEntry struct {
+	spreadsheetId string
+	readRange     string
+	value         *sheets.ValueRange
+	hash          [sha256.Size]byte
+	ttl           time.Duration
+	expires       time.Time
+}
+
+type metadataEntry struct {
+	value   *sheets.Spreadsheet
+	expires time.Time
+}
+
+// CachedGSheets is a read-through cache in front of IGSheets.
+// Reads are cached per range with a TTL, writes drop the cached ranges of the sheets they touch,
+// and CheckForChanges detects edits made outside the bot.
+type CachedGSheets struct {
+	next IGSheets
+	opts CacheOptions
+	now  func() time.Time
+
+	mu       sync.Mutex
+	values   map[string]*cacheEntry
+	metadata map[string]*metadataEntry
+	// generations counts the invalidations of each sheet, keyed by spreadsheet and sheet name ("" for all the
+	// sheets), so a read that overlapped a write does not cache what it read before the write
+	generations map[string]uint64
+
+	hits            atomic.Uint64
+	misses          atomic.Uint64
+	invalidations   atomic.Uint64
+	externalChanges atomic.Uint64
+}
+
+// NewCachedGSheets wraps next with a cache
+func NewCachedGSheets(next IGSheets, opts CacheOptions) *CachedGSheets {
+	return &CachedGSheets{
+		next:        next,
+		opts:        opts,
+		now:         time.Now,
+		values:      make(map[string]*cacheEntry),
+		metadata:    make(map[string]*metadataEntry),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Stats returns the cache counters
+func (c *CachedGSheets) Stats() CacheStats {
+	return CacheStats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		Invalidations:   c.invalidations.Load(),
+		ExternalChanges: c.externalChanges.Load(),
+	}
+}
+
+func cacheKey(spreadsheetId string, readRange string) string {
+	return spreadsheetId + "\x00" + readRange
+}
+
+// ttlOf returns the TTL of a range
+func (c *CachedGSheets) ttlOf(readRange string) time.Duration {
+	for _, rule := range c.opts.Rules {
+		if strings.HasPrefix(readRange, rule.Prefix) {
+			return rule.TTL
+		}
+	}
+	return c.opts.DefaultTTL
+}
+
+func hashValues(vr *sheets.ValueRange) [sha256.Size]byte {
+	data, _ := json.Marshal(vr.Values)
+	return sha256.Sum256(data)
+}
+
+// copyValueRange copies the rows so callers cannot change the cached values
+func copyValueRange(vr *sheets.ValueRange) *sheets.ValueRange {
+	out := *vr
+	out.Values = make([][]interface{}, len(vr.Values))
+	for i, row := range vr.Values {
+		out.Values[i] = append([]interface{}(nil), row...)
+	}
+	return &out
+}
+
+// lookup returns the cached value of a range and counts the hit or miss
+func (c *CachedGSheets) lookup(spreadsheetId string, readRange string) (*sheets.ValueRange, bool) {
+	c.mu.Lock()
+	entry, ok := c.values[cacheKey(spreadsheetId, readRange)]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		c.hits.Add(1)
+		return copyValueRange(entry.value), true
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// generation returns the number of invalidations of the sheet of a range, to capture before reading it
+func (c *CachedGSheets) generation(spreadsheetId string, readRange string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generationLocked(spreadsheetId, readRange)
+}
+
+func (c *CachedGSheets) generationLocked(spreadsheetId string, readRange string) uint64 {
+	return c.generations[cacheKey(spreadsheetId, "")] + c.generations[cacheKey(spreadsheetId, sheetOfRange(readRange))]
+}
+
+// store caches the value of a range read from the next service, unless its sheet was invalidated since the
+// generation captured before the read
+func (c *CachedGSheets) store(spreadsheetId string, readRange string, vr *sheets.ValueRange, generation uint64) {
+	ttl := c.ttlOf(readRange)
+	if ttl <= 0 || vr == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generationLocked(spreadsheetId, readRange) != generation {
+		return
+	}
+	if len(c.values) >= maxCacheEntries {
+		c.dropExpiredLocked()
+	}
+	c.values[cacheKey(spreadsheetId, readRange)] = &cacheEntry{
+		spreadsheetId: spreadsheetId,
+		readRange:     readRange,
+		value:         copyValueRange(vr),
+		hash:          hashValues(vr),
+		ttl:           ttl,
+		expires:       c.now().Add(ttl),
+	}
+}
+
+func (c *CachedGSheets) dropExpiredLocked() {
+	now := c.now()
+	for key, entry := range c.values {
+		if !now.Before(entry.expires) {
+			delete(c.values, key)
+		}
+	}
+}
+
+// sheetOfRange returns the sheet name of an A1 range, e.g., "2026_10" for "'2026_10'!A4:G4".
+// It returns "" for a range without a sheet name.
+func sheetOfRange(a1Range string) string {
+	index := strings.LastIndex(a1Range, "!")
+	if index < 0 {
+		return ""
+	}
+	name := a1Range[:index]
+	if strings.HasPrefix(name, "'") && strings.HasSuffix(name, "'") && len(name) >= 2 {
+		name = strings.ReplaceAll(name[1:len(name)-1], "''", "'")
+	}
+	return name
+}
+
+// invalidate drops the cached ranges of the sheets written by writeRanges
+func (c *CachedGSheets) invalidate(spreadsheetId string, writeRanges ...string) {
+	c.invalidations.Add(uint64(c.dropSheets(spreadsheetId, writeRanges...)))
+}
+
+// dropSheets drops the cached ranges of the sheets of ranges and returns how many were dropped.
+// A range without a sheet name drops the whole spreadsheet.
+func (c *CachedGSheets) dropSheets(spreadsheetId string, ranges ...string) int {
+	sheetNames := make(map[string]bool, len(ranges))
+	for _, r := range ranges {
+		sheetNames[sheetOfRange(r)] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for sheetName := range sheetNames {
+		c.generations[cacheKey(spreadsheetId, sheetName)]++
+	}
+	dropped := 0
+	for key, entry := range c.values {
+		if entry.spreadsheetId != spreadsheetId {
+			continue
+		}
+		if sheetNames[""] || sheetNames[sheetOfRange(entry.readRange)] {
+			delete(c.values, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+func (c *CachedGSheets) Get(ctx context.Context, spreadsheetId string, readRange string) (*sheets.ValueRange, error) {
+	if vr, ok := c.lookup(spreadsheetId, readRange); ok {
+		return vr, nil
+	}
+	generation := c.generation(spreadsheetId, readRange)
+	vr, err := c.next.Get(ctx, spreadsheetId, readRange)
+	if err != nil {
+		return nil, err
+	}
+	c.store(spreadsheetId, readRange, vr, generation)
+	return vr, nil
+}
+
+// BatchGet answers the cached ranges from the cache and reads the others in one request
+func (c *CachedGSheets) BatchGet(ctx context.Context, spreadsheetId string, readRanges ...string) ([]*sheets.ValueRange, error) {
+	result := make([]*sheets.ValueRange, len(readRanges))
+	var missing []string
+	var missingIndexes []int
+	var generations []uint64
+	for i, r := range readRanges {
+		if vr, ok := c.lookup(spreadsheetId, r); ok {
+			result[i] = vr
+			continue
+		}
+		missing = append(missing, r)
+		missingIndexes = append(missingIndexes, i)
+		generations = append(generations, c.generation(spreadsheetId, r))
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	fetched, err := c.next.BatchGet(ctx, spreadsheetId, missing...)
+	if err != nil {
+		return nil, err
+	}
+	for i, vr := range fetched {
+		if i >= len(missing) {
+			break
+		}
+		c.store(spreadsheetId, missing[i], vr, generations[i])
+		result[missingIndexes[i]] = vr
+	}
+	return result, nil
+}
+
+func (c *CachedGSheets) GetValue(ctx context.Context, spreadsheetId string, readRange string) (string, error) {
+	resp, err := c.Get(ctx, spreadsheetId, readRange)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Values) == 0 || len(resp.Values[0]) == 0 {
+		return "", nil
+	}
+	return cast.ToString(resp.Values[0][0]), nil
+}
+
+func (c *CachedGSheets) Update(ctx context.Context, spreadsheetId string, writeRange string, vr *sheets.ValueRange) (*sheets.UpdateValuesResponse, error) {
+	// Drop the cache even on errors, the write may have been applied
+	defer c.invalidate(spreadsheetId, writeRange)
+	return c.next.Update(ctx, spreadsheetId, writeRange, vr)
+}
+
+func (c *CachedGSheets) BatchUpdate(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
+	writeRanges := make([]string, 0, len(data))
+	for _, vr := range data {
+		writeRanges = append(writeRanges, vr.Range)
+	}
+	defer c.invalidate(spreadsheetId, writeRanges...)
+	return c.next.BatchUpdate(ctx, spreadsheetId, data...)
+}
+
+func (c *CachedGSheets) BatchUpdateFormulas(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
+	writeRanges := make([]string, 0, len(data))
+	for _, vr := range data {
+		writeRanges = append(writeRanges, vr.Range)
+	}
+	defer c.invalidate(spreadsheetId, writeRanges...)
+	return c.next.BatchUpdateFormulas(ctx, spreadsheetId, data...)
+}
+
+func (c *CachedGSheets) Append(ctx context.Context, spreadsheetId string, appendRange string, vr *sheets.ValueRange) (*sheets.AppendValuesResponse, error) {
+	defer c.invalidate(spreadsheetId, appendRange)
+	return c.next.Append(ctx, spreadsheetId, appendRange, vr)
+}
+
+func (c *CachedGSheets) AppendInPlace(ctx context.Context, spreadsheetId string, appendRange string, vr *sheets.ValueRange) (*sheets.AppendValuesResponse, error) {
+	defer c.invalidate(spreadsheetId, appendRange)
+	return c.next.AppendInPlace(ctx, spreadsheetId, appendRange, vr)
+}
+
+// GetSpreadsheet caches the spreadsheet metadata for MetadataTTL
+func (c *CachedGSheets) GetSpreadsheet(ctx context.Context, spreadsheetId string) (*sheets.Spreadsheet, error) {
+	c.mu.Lock()
+	entry, ok := c.metadata[spreadsheetId]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		c.hits.Add(1)
+		return entry.value, nil
+	}
+	c.misses.Add(1)
+
+	spreadsheet, err := c.next.GetSpreadsheet(ctx, spreadsheetId)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.MetadataTTL > 0 {
+		c.mu.Lock()
+		c.metadata[spreadsheetId] = &metadataEntry{value: spreadsheet, expires: c.now().Add(c.opts.MetadataTTL)}
+		c.mu.Unlock()
+	}
+	return spreadsheet, nil
+}
+
+// DuplicateSheet adds a sheet and drops the cached metadata
+func (c *CachedGSheets) DuplicateSheet(ctx context.Context, spreadsheetId string, sourceSheetId int64, newTitle string) (*sheets.SheetProperties, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.metadata, spreadsheetId)
+		c.mu.Unlock()
+	}()
+	return c.next.DuplicateSheet(ctx, spreadsheetId, sourceSheetId, newTitle)
+}
+
+// AddSheet adds a sheet and drops the cached metadata
+func (c *CachedGSheets) AddSheet(ctx context.Context, spreadsheetId string, title string) (*sheets.SheetProperties, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.metadata, spreadsheetId)
+		c.mu.Unlock()
+	}()
+	return c.next.AddSheet(ctx, spreadsheetId, title)
+}
+
+// CheckForChanges reads every cached range again in one request per spreadsheet.
+// Ranges that still match are kept for another TTL; when a range changed, the cached
+// ranges of its sheet are dropped, as the sheet was edited outside the bot.
+func (c *CachedGSheets) CheckForChanges(ctx context.Context) error {
+	c.mu.Lock()
+	c.dropExpiredLocked()
+	rangesBySpreadsheet := make(map[string][]string)
+	for _, entry := range c.values {
+		rangesBySpreadsheet[entry.spreadsheetId] = append(rangesBySpreadsheet[entry.spreadsheetId], entry.readRange)
+	}
+	c.mu.Unlock()
+
+	for spreadsheetId, readRanges := range rangesBySpreadsheet {
+		fetched, err := c.next.BatchGet(ctx, spreadsheetId, readRanges...)
+		if err != nil {
+			return err
+		}
+
+		changedRanges := make([]string, 0)
+		c.mu.Lock()
+		for i, vr := range fetched {
+			if i >= len(readRanges) {
+				break
+			}
+			entry, ok := c.values[cacheKey(spreadsheetId, readRanges[i])]
+			if !ok {
+				// Dropped by a write in the meantime
+				continue
+			}
+			if hashValues(vr) != entry.hash {
+				changedRanges = append(changedRanges, readRanges[i])
+				c.externalChanges.Add(1)
+				continue
+			}
+			entry.expires = c.now().Add(entry.ttl)
+		}
+		c.mu.Unlock()
+
+		if len(changedRanges) > 0 {
+			logrus.Infof("sheets cache: %d range(s) changed outside the bot", len(changedRanges))
+			c.dropSheets(spreadsheetId, changedRanges...)
+		}
+	}
+	return nil
+}
+
+// LogStats logs the cache counters at debug level
+func (c *CachedGSheets) LogStats() {
+	stats := c.Stats()
+	logrus.WithFields(logrus.Fields{
+		"hits":             stats.Hits,
+		"misses":           stats.Misses,
+		"hit_rate":         stats.HitRate(),
+		"invalidations":    stats.Invalidations,
+		"external_changes": stats.ExternalChanges,
+	}).Debug("sheets cache stats")
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// The cache tests read single cells, so Get and BatchGet return the first cell of the range.
+
+func (f *fakeSheets) Get(_ context.Context, _ string, readRange string) (*sheets.ValueRange, error) {
+	f.mu.Lock()
+	f.reads++
+	f.mu.Unlock()
+	vr := f.valueRange(readRange)
+	if f.afterRead != nil {
+		f.afterRead()
+	}
+	return vr, nil
+}
+
+func (f *fakeSheets) BatchGet(_ context.Context, _ string, readRanges ...string) ([]*sheets.ValueRange, error) {
+	f.mu.Lock()
+	f.reads++
+	f.mu.Unlock()
+	result := make([]*sheets.ValueRange, 0, len(readRanges))
+	for _, r := range readRanges {
+		result = append(result, f.valueRange(r))
+	}
+	if f.afterRead != nil {
+		f.afterRead()
+	}
+	return result, nil
+}
+
+func (f *fakeSheets) GetSpreadsheet(_ context.Context, _ string) (*sheets.Spreadsheet, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	return &sheets.Spreadsheet{}, nil
+}
+
+func (f *fakeSheets) Update(ctx context.Context, spreadsheetId string, writeRange string, vr *sheets.ValueRange) (*sheets.UpdateValuesResponse, error) {
+	vr.Range = writeRange
+	_, err := f.BatchUpdate(ctx, spreadsheetId, vr)
+	return &sheets.UpdateValuesResponse{}, err
+}
+
+func (f *fakeSheets) valueRange(readRange string) *sheets.ValueRange {
+	value := f.get(readRange)
+	if value == nil {
+		return &sheets.ValueRange{Range: readRange}
+	}
+	return &sheets.ValueRange{Range: readRange, Values: [][]interface{}{{value}}}
+}
+
+func (f *fakeSheets) readCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+// newTestCache returns a cache over a fake sheet and a function to move its clock forward
+func newTestCache(opts CacheOptions) (*CachedGSheets, *fakeSheets, func(time.Duration)) {
+	f := newFakeSheets()
+	f.write("Database!B2", [][]interface{}{{"2026_10"}})
+	f.write("2026_10!B2", [][]interface{}{{5}})
+	f.write("2026_10!C2", [][]interface{}{{3}})
+
+	c := NewCachedGSheets(f, opts)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, f, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCachedGSheetsHitAndExpiry(t *testing.T) {
+	c, f, advance := newTestCache(CacheOptions{DefaultTTL: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		value, err := c.GetValue(ctx, "id", "2026_10!B2")
+		if err != nil || value != "5" {
+			t.Fatalf("GetValue = %q, %v; want 5", value, err)
+		}
+	}
+	if f.readCount() != 1 {
+		t.Fatalf("reads = %d, want 1", f.readCount())
+	}
+
+	advance(time.Minute)
+	if _, err := c.GetValue(ctx, "id", "2026_10!B2"); err != nil {
+		t.Fatal(err)
+	}
+	if f.readCount() != 2 {
+		t.Errorf("reads after expiry = %d, want 2", f.readCount())
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("stats = %+v, want 2 hits and 2 misses", stats)
+	}
+	if stats.HitRate() != 0.5 {
+		t.Errorf("hit rate = %v, want 0.5", stats.HitRate())
+	}
+}
+
+func TestCachedGSheetsRules(t *testing.T) {
+	c, f, advance := newTestCache(CacheOptions{
+		DefaultTTL: 0,
+		Rules:      []CacheRule{{Prefix: "Database!", TTL: 5 * time.Minute}},
+	})
+	ctx := context.Background()
+
+	c.GetValue(ctx, "id", "Database!B2")
+	c.GetValue(ctx, "id", "2026_10!B2")
+	c.GetValue(ctx, "id", "Database!B2")
+	c.GetValue(ctx, "id", "2026_10!B2")
+	// Database is cached, the monthly sheet has no TTL
+	if f.readCount() != 3 {
+		t.Fatalf("reads = %d, want 3", f.readCount())
+	}
+
+	advance(4 * time.Minute)
+	c.GetValue(ctx, "id", "Database!B2")
+	if f.readCount() != 3 {
+		t.Errorf("reads within the rule TTL = %d, want 3", f.readCount())
+	}
+}
+
+func TestCachedGSheetsWriteInvalidatesSheet(t *testing.T) {
+	c, f, _ := newTestCache(CacheOptions{DefaultTTL: time.Hour})
+	ctx := context.Background()
+
+	c.GetValue(ctx, "id", "Database!B2")
+	c.GetValue(ctx, "id", "2026_10!B2")
+	c.GetValue(ctx, "id", "2026_10!C2")
+
+	_, err := c.Update(ctx, "id", "2026_10!B2", &sheets.ValueRange{Values: [][]interface{}{{6}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Stats().Invalidations; got != 2 {
+		t.Errorf("invalidations = %d, want 2", got)
+	}
+
+	value, _ := c.GetValue(ctx, "id", "2026_10!B2")
+	if value != "6" {
+		t.Errorf("value after write = %q, want 6", value)
+	}
+	before := f.readCount()
+	// Other sheets stay cached
+	c.GetValue(ctx, "id", "Database!B2")
+	if f.readCount() != before {
+		t.Errorf("Database was read again after a write to 2026_10")
+	}
+}
+
+func TestCachedGSheetsKeepsNoValueReadBeforeAWrite(t *testing.T) {
+	c, f, _ := newTestCache(CacheOptions{DefaultTTL: time.Hour})
+	ctx := context.Background()
+
+	// A write lands while the value read before it is on its way back
+	write := func() {
+		f.afterRead = nil
+		if _, err := c.Update(ctx, "id", "2026_10!B2", &sheets.ValueRange{Values: [][]interface{}{{6}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.afterRead = write
+	if value, _ := c.GetValue(ctx, "id", "2026_10!B2"); value != "5" {
+		t.Fatalf("value read before the write = %q, want 5", value)
+	}
+	if value, _ := c.GetValue(ctx, "id", "2026_10!B2"); value != "6" {
+		t.Errorf("value after the write = %q, want 6", value)
+	}
+
+	f.afterRead = write
+	if _, err := c.BatchGet(ctx, "id", "2026_10!C2"); err != nil {
+		t.Fatal(err)
+	}
+	before := f.readCount()
+	c.BatchGet(ctx, "id", "2026_10!C2")
+	if f.readCount() == before {
+		t.Error("a range read before a write to its sheet was cached")
+	}
+}
+
+func TestCachedGSheetsBatchGetReadsOnlyMisses(t *testing.T) {
+	c, f, _ := newTestCache(CacheOptions{DefaultTTL: time.Hour})
+	ctx := context.Background()
+
+	c.GetValue(ctx, "id", "2026_10!B2")
+	result, err := c.BatchGet(ctx, "id", "2026_10!B2", "2026_10!C2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].Values[0][0] != 5 || result[1].Values[0][0] != 3 {
+		t.Fatalf("BatchGet = %+v", result)
+	}
+	if f.readCount() != 2 {
+		t.Errorf("reads = %d, want 2", f.readCount())
+	}
+
+	c.BatchGet(ctx, "id", "2026_10!B2", "2026_10!C2")
+	if f.readCount() != 2 {
+		t.Errorf("reads after a cached BatchGet = %d, want 2", f.readCount())
+	}
+}
+
+func TestCachedGSheetsReturnsCopies(t *testing.T) {
+	c, _, _ := newTestCache(CacheOptions{DefaultTTL: time.Hour})
+	ctx := context.Background()
+
+	vr, _ := c.Get(ctx, "id", "2026_10!B2")
+	vr.Values[0][0] = 42
+	value, _ := c.GetValue(ctx, "id", "2026_10!B2")
+	if value != "5" {
+		t.Errorf("cached value changed by a caller: %q", value)
+	}
+}
+
+func TestCachedGSheetsMetadata(t *testing.T) {
+	c, f, advance := newTestCache(CacheOptions{MetadataTTL: 10 * time.Minute})
+	ctx := context.Background()
+
+	c.GetSpreadsheet(ctx, "id")
+	c.GetSpreadsheet(ctx, "id")
+	if f.readCount() != 1 {
+		t.Fatalf("reads = %d, want 1", f.readCount())
+	}
+	advance(10 * time.Minute)
+	c.GetSpreadsheet(ctx, "id")
+	if f.readCount() != 2 {
+		t.Errorf("reads after expiry = %d, want 2", f.readCount())
+	}
+}
+
+func TestCachedGSheetsCheckForChanges(t *testing.T) {
+	c, f, advance := newTestCache(CacheOptions{DefaultTTL: time.Minute})
+	ctx := context.Background()
+
+	c.GetValue(ctx, "id", "Database!B2")
+	c.GetValue(ctx, "id", "2026_10!B2")
+	c.GetValue(ctx, "id", "2026_10!C2")
+
+	// Someone edits the monthly sheet directly
+	f.mu.Lock()
+	f.write("2026_10!C2", [][]interface{}{{4}})
+	f.mu.Unlock()
+
+	advance(50 * time.Second)
+	if err := c.CheckForChanges(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Stats().ExternalChanges; got != 1 {
+		t.Errorf("external changes = %d, want 1", got)
+	}
+
+	value, _ := c.GetValue(ctx, "id", "2026_10!C2")
+	if value != "4" {
+		t.Errorf("value after an external change = %q, want 4", value)
+	}
+
+	// The unchanged range was kept for another TTL
+	advance(50 * time.Second)
+	before := f.readCount()
+	c.GetValue(ctx, "id", "Database!B2")
+	if f.readCount() != before {
+		t.Errorf("unchanged range was read again after the check")
+	}
+}
+
+func TestSheetOfRange(t *testing.T) {
+	tests := map[string]string{
+		"2026_10!A4:G4": "2026_10",
+		"'2026_10'!B2":  "2026_10",
+		"'Bob''s'!A1":   "Bob's",
+		"Database!B2":   "Database",
+		"A1:B2":         "",
+		"'Sheet!1'!A1":  "Sheet!1",
+		"Tasks!A4:I":    "Tasks",
+	}
+	for a1, want := range tests {
+		if got := sheetOfRange(a1); got != want {
+			t.Errorf("sheetOfRange(%q) = %q, want %q", a1, got, want)
+		}
+	}
+}
@@ -2,22 +2,35 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
-	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
-	"housematee-tgbot/config"
 )
 
 var (
 	gSheets GSheets
+	// instrumented records the metrics of the calls made to gSheets
+	instrumented = NewInstrumentedGSheets(&gSheets)
+	// svc is the service used by the bot, the instrumented gSheets or the cache in front of it
+	svc   IGSheets = instrumented
+	cache *CachedGSheets
 )
 
 type IGSheets interface {
 	Get(ctx context.Context, spreadsheetId string, readRange string) (*sheets.ValueRange, error)
+	BatchGet(ctx context.Context, spreadsheetId string, readRanges ...string) ([]*sheets.ValueRange, error)
 	Update(ctx context.Context, spreadsheetId string, writeRange string, vr *sheets.ValueRange) (*sheets.UpdateValuesResponse, error)
+	BatchUpdate(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error)
+	BatchUpdateFormulas(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error)
 	GetValue(ctx context.Context, spreadsheetId string, readRange string) (string, error)
+	Append(ctx context.Context, spreadsheetId string, appendRange string, vr *sheets.ValueRange) (*sheets.AppendValuesResponse, error)
+	AppendInPlace(ctx context.Context, spreadsheetId string, appendRange string, vr *sheets.ValueRange) (*sheets.AppendValuesResponse, error)
+	GetSpreadsheet(ctx context.Context, spreadsheetId string) (*sheets.Spreadsheet, error)
+	DuplicateSheet(ctx context.Context, spreadsheetId string, sourceSheetId int64, newTitle string) (*sheets.SheetProperties, error)
+	AddSheet(ctx context.Context, spreadsheetId string, title string) (*sheets.SheetProperties, error)
 }
 
 type GSheets struct {
@@ -30,7 +43,14 @@ func newGSheets(svc *sheets.Service) *GSheets {
 	}
 }
 
-func InitGSheetsSvc(ctx context.Context, credential config.Credentials) (*GSheets, error) {
+// ServiceAccount is the part of the Google service account credentials used to call the Sheets API
+type ServiceAccount struct {
+	ClientEmail string
+	PrivateKey  string
+	TokenURI    string
+}
+
+func InitGSheetsSvc(ctx context.Context, credential ServiceAccount) (*GSheets, error) {
 	jwtConfig := &jwt.Config{
 		Email:      credential.ClientEmail,
 		PrivateKey: []byte(credential.PrivateKey),
@@ -42,29 +62,127 @@ func InitGSheetsSvc(ctx context.Context, credential config.Credentials) (*GSheet
 	tokenSource := jwtConfig.TokenSource(ctx)
 	_, err := tokenSource.Token()
 	if err != nil {
-		logrus.Fatalf("unable to obtain token: %v", err)
+		return nil, fmt.Errorf("unable to obtain token: %w", err)
 	}
 
 	// Create a new Sheets service with the token
 	svc, err := sheets.NewService(ctx, option.WithTokenSource(tokenSource))
 	if err != nil {
-		logrus.Fatalf("unable to create Sheets service: %v", err)
+		return nil, fmt.Errorf("unable to create Sheets service: %w", err)
 	}
 
 	gSheets = *newGSheets(svc)
 	return &gSheets, nil
 }
 
-func GetGSheetsSvc() *GSheets {
-	return &gSheets
+func GetGSheetsSvc() IGSheets {
+	return svc
+}
+
+// GetUncachedGSheetsSvc returns the service without the cache, for checks that must see the spreadsheet as it is now
+func GetUncachedGSheetsSvc() IGSheets {
+	return instrumented
+}
+
+// EnableCache puts a read-through cache in front of the service returned by GetGSheetsSvc
+func EnableCache(opts CacheOptions) *CachedGSheets {
+	cache = NewCachedGSheets(instrumented, opts)
+	svc = cache
+	return cache
+}
+
+// CheckConnection reads the spreadsheet ID directly from the API, bypassing the cache and the retries
+func CheckConnection(ctx context.Context, spreadsheetId string) error {
+	if gSheets.Svc == nil {
+		return errors.New("google sheets service is not initialised")
+	}
+	_, err := gSheets.Svc.Spreadsheets.Get(spreadsheetId).Fields("spreadsheetId").Context(ctx).Do()
+	return err
+}
+
+// GetCacheStats returns the cache counters, false when the cache is not enabled
+func GetCacheStats() (CacheStats, bool) {
+	if cache == nil {
+		return CacheStats{}, false
+	}
+	return cache.Stats(), true
+}
+
+func (g *GSheets) Get(ctx context.Context, spreadsheetId string, readRange string) (resp *sheets.ValueRange, err error) {
+	err = withRetry(ctx, "get "+readRange, func() error {
+		resp, err = g.Svc.Spreadsheets.Values.Get(spreadsheetId, readRange).Context(ctx).Do()
+		return err
+	})
+	return resp, err
+}
+
+// BatchGet reads several ranges in one request, the value ranges are returned in the order of readRanges
+func (g *GSheets) BatchGet(ctx context.Context, spreadsheetId string, readRanges ...string) ([]*sheets.ValueRange, error) {
+	var resp *sheets.BatchGetValuesResponse
+	err := withRetry(ctx, "batch get", func() (err error) {
+		resp, err = g.Svc.Spreadsheets.Values.BatchGet(spreadsheetId).Ranges(readRanges...).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.ValueRanges, nil
+}
+
+func (g *GSheets) Update(ctx context.Context, spreadsheetId string, writeRange string, valueRange *sheets.ValueRange) (resp *sheets.UpdateValuesResponse, err error) {
+	err = withRetry(ctx, "update "+writeRange, func() error {
+		resp, err = g.Svc.Spreadsheets.Values.Update(spreadsheetId, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
+		return err
+	})
+	return resp, err
+}
+
+// BatchUpdate writes several ranges in one request, so either all of them or none are written.
+// Each value range must set its Range.
+func (g *GSheets) BatchUpdate(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (resp *sheets.BatchUpdateValuesResponse, err error) {
+	request := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data:             data,
+	}
+	err = withRetry(ctx, "batch update", func() error {
+		resp, err = g.Svc.Spreadsheets.Values.BatchUpdate(spreadsheetId, request).Context(ctx).Do()
+		return err
+	})
+	return resp, err
+}
+
+// BatchUpdateFormulas is BatchUpdate for ranges of formulas: the values are parsed as if typed in the sheet, so only
+// formulas and empty cells belong in them
+func (g *GSheets) BatchUpdateFormulas(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (resp *sheets.BatchUpdateValuesResponse, err error) {
+	request := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             data,
+	}
+	err = withRetry(ctx, "batch update formulas", func() error {
+		resp, err = g.Svc.Spreadsheets.Values.BatchUpdate(spreadsheetId, request).Context(ctx).Do()
+		return err
+	})
+	return resp, err
 }
 
-func (g *GSheets) Get(ctx context.Context, spreadsheetId string, readRange string) (*sheets.ValueRange, error) {
-	return g.Svc.Spreadsheets.Values.Get(spreadsheetId, readRange).Context(ctx).Do()
+// Append adds rows after the last non-empty row of the table found in appendRange.
+// Appends are not retried on server errors: the rows may have been added already.
+func (g *GSheets) Append(ctx context.Context, spreadsheetId string, appendRange string, valueRange *sheets.ValueRange) (resp *sheets.AppendValuesResponse, err error) {
+	err = withRetryOn(ctx, "append "+appendRange, isRateLimited, func() error {
+		resp, err = g.Svc.Spreadsheets.Values.Append(spreadsheetId, appendRange, valueRange).ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+		return err
+	})
+	return resp, err
 }
 
-func (g *GSheets) Update(ctx context.Context, spreadsheetId string, writeRange string, valueRange *sheets.ValueRange) (*sheets.UpdateValuesResponse, error) {
-	return g.Svc.Spreadsheets.Values.Update(spreadsheetId, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
+// AppendInPlace writes rows into the empty rows after the table found in appendRange, without inserting rows,
+// so the other sections of the sheet do not move. Like Append, it only retries quota errors.
+func (g *GSheets) AppendInPlace(ctx context.Context, spreadsheetId string, appendRange string, valueRange *sheets.ValueRange) (resp *sheets.AppendValuesResponse, err error) {
+	err = withRetryOn(ctx, "append "+appendRange, isRateLimited, func() error {
+		resp, err = g.Svc.Spreadsheets.Values.Append(spreadsheetId, appendRange, valueRange).ValueInputOption("RAW").InsertDataOption("OVERWRITE").Context(ctx).Do()
+		return err
+	})
+	return resp, err
 }
 
 func (g *GSheets) GetValue(ctx context.Context, spreadsheetId string, readRange string) (string, error) {
@@ -79,8 +197,12 @@ func (g *GSheets) GetValue(ctx context.Context, spreadsheetId string, readRange
 }
 
 // GetSpreadsheet retrieves the spreadsheet metadata including all sheets
-func (g *GSheets) GetSpreadsheet(ctx context.Context, spreadsheetId string) (*sheets.Spreadsheet, error) {
-	return g.Svc.Spreadsheets.Get(spreadsheetId).Context(ctx).Do()
+func (g *GSheets) GetSpreadsheet(ctx context.Context, spreadsheetId string) (resp *sheets.Spreadsheet, err error) {
+	err = withRetry(ctx, "get spreadsheet", func() error {
+		resp, err = g.Svc.Spreadsheets.Get(spreadsheetId).Context(ctx).Do()
+		return err
+	})
+	return resp, err
 }
 
 // DuplicateSheet copies a sheet and renames it in a single batch operation
@@ -101,7 +223,12 @@ func (g *GSheets) DuplicateSheet(ctx context.Context, spreadsheetId string, sour
 		Requests: requests,
 	}
 
-	resp, err := g.Svc.Spreadsheets.BatchUpdate(spreadsheetId, batchUpdateRequest).Context(ctx).Do()
+	// A duplicated sheet cannot be created twice, so only quota errors are retried
+	var resp *sheets.BatchUpdateSpreadsheetResponse
+	err := withRetryOn(ctx, "duplicate sheet", isRateLimited, func() (err error) {
+		resp, err = g.Svc.Spreadsheets.BatchUpdate(spreadsheetId, batchUpdateRequest).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -113,3 +240,25 @@ func (g *GSheets) DuplicateSheet(ctx context.Context, spreadsheetId string, sour
 
 	return nil, nil
 }
+
+// AddSheet adds an empty sheet at the end of the spreadsheet and returns its properties
+func (g *GSheets) AddSheet(ctx context.Context, spreadsheetId string, title string) (*sheets.SheetProperties, error) {
+	batchUpdateRequest := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: title}}}},
+	}
+
+	// A sheet cannot be added twice, so only quota errors are retried
+	var resp *sheets.BatchUpdateSpreadsheetResponse
+	err := withRetryOn(ctx, "add sheet", isRateLimited, func() (err error) {
+		resp, err = g.Svc.Spreadsheets.BatchUpdate(spreadsheetId, batchUpdateRequest).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Replies) > 0 && resp.Replies[0].AddSheet != nil {
+		return resp.Replies[0].AddSheet.Properties, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/utilities"
+)
+
+// writeLocks serialises the ID allocations of the bot per spreadsheet
+var writeLocks utilities.KeyedMutex
+
+// IDTable is a table whose rows are numbered by an ID in the first column:
+// the row of ID n is HeaderRow + n, and NextIDCell holds the ID of the next row.
+type IDTable struct {
+	SheetName  string
+	StartCol   string
+	EndCol     string
+	HeaderRow  int
+	NextIDCell string // e.g., B2
+}
+
+func (t IDTable) cell(cell string) string {
+	return fmt.Sprintf("%s!%s", t.SheetName, cell)
+}
+
+// AppendWithID adds a row to the table and returns its ID. The first value of row is set to the ID.
+//
+// Allocations of the bot are serialised per spreadsheet. The row itself is appended after the last
+// row of the table instead of written at the expected position, so a writer that did not go through
+// the lock (another bot instance, a manual edit) is never overwritten: when the row lands elsewhere,
+// its ID is taken from the row it landed on.
+func AppendWithID(ctx context.Context, g IGSheets, spreadsheetId string, table IDTable, row []interface{}) (int, error) {
+	unlock := writeLocks.Lock(spreadsheetId)
+	defer unlock()
+
+	nextIdValue, err := g.GetValue(ctx, spreadsheetId, table.cell(table.NextIDCell))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read next id: %w", err)
+	}
+	id := cast.ToInt(nextIdValue)
+	if id < 1 {
+		id = 1
+	}
+
+	values := make([]interface{}, len(row))
+	copy(values, row)
+	values[0] = id
+	appendRange := fmt.Sprintf("%s!%s%d:%s", table.SheetName, table.StartCol, table.HeaderRow, table.EndCol)
+	resp, err := g.AppendInPlace(ctx, spreadsheetId, appendRange, &sheets.ValueRange{Values: [][]interface{}{values}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to append row: %w", err)
+	}
+	if resp.Updates == nil {
+		return 0, fmt.Errorf("append did not report the updated range")
+	}
+	landedRow, err := firstRowOfRange(resp.Updates.UpdatedRange)
+	if err != nil {
+		return 0, err
+	}
+
+	updates := make([]*sheets.ValueRange, 0, 2)
+	if landedId := landedRow - table.HeaderRow; landedId != id {
+		// The ID was already taken, the row keeps the ID of its position
+		id = landedId
+		updates = append(updates, &sheets.ValueRange{
+			Range:  table.cell(fmt.Sprintf("%s%d", table.StartCol, landedRow)),
+			Values: [][]interface{}{{id}},
+		})
+	}
+	updates = append(updates, &sheets.ValueRange{
+		Range:  table.cell(table.NextIDCell),
+		Values: [][]interface{}{{id + 1}},
+	})
+	if _, err := g.BatchUpdate(ctx, spreadsheetId, updates...); err != nil {
+		return 0, fmt.Errorf("failed to update next id: %w", err)
+	}
+	return id, nil
+}
+
+// LockIDs holds the ID allocations of the spreadsheet, for writes that place rows at the position of their own ID
+func LockIDs(spreadsheetId string) (unlock func()) {
+	return writeLocks.Lock(spreadsheetId)
+}
+
+// firstRowOfRange returns the first row number of an A1 range, e.g., 12 for 'Sheet 1'!A12:G12
+func firstRowOfRange(a1Range string) (int, error) {
+	cells := a1Range[strings.LastIndex(a1Range, "!")+1:]
+	start, _, _ := strings.Cut(cells, ":")
+	row, err := strconv.Atoi(strings.TrimLeft(start, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz$"))
+	if err != nil || row < 1 {
+		return 0, fmt.Errorf("invalid range %q", a1Range)
+	}
+	return row, nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cast"
+	"google.golang.org/api/sheets/v4"
+)
+
+// fakeSheets is an in-memory spreadsheet for the calls used by AppendWithID.
+// Other IGSheets methods are not implemented and panic when called.
+type fakeSheets struct {
+	IGSheets
+
+	mu    sync.Mutex
+	cells map[string]interface{} // keyed by "Sheet!A4"
+	// latency widens the window between the calls of concurrent writers
+	latency time.Duration
+	// beforeAppend runs before every append, e.g., to simulate another writer
+	beforeAppend func()
+	// afterRead runs after every read, before its values are returned, e.g., to simulate a concurrent write
+	afterRead func()
+	// reads counts the read requests
+	reads int
+}
+
+func newFakeSheets() *fakeSheets {
+	return &fakeSheets{cells: make(map[string]interface{})}
+}
+
+// parseCell splits "Sheet!B12:G12" into the sheet name, the column index (0 = A) and the row of its first cell
+func parseCell(a1 string) (string, int, int) {
+	sheetName, cells, _ := strings.Cut(a1, "!")
+	start, _, _ := strings.Cut(cells, ":")
+	col := 0
+	i := 0
+	for ; i < len(start) && start[i] >= 'A' && start[i] <= 'Z'; i++ {
+		col = col*26 + int(start[i]-'A'+1)
+	}
+	return sheetName, col - 1, cast.ToInt(start[i:])
+}
+
+func cellKey(sheetName string, col int, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return fmt.Sprintf("%s!%s%d", sheetName, name, row)
+}
+
+func (f *fakeSheets) wait() {
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+}
+
+func (f *fakeSheets) write(a1 string, values [][]interface{}) {
+	sheetName, col, row := parseCell(a1)
+	for i, rowValues := range values {
+		for j, value := range rowValues {
+			f.cells[cellKey(sheetName, col+j, row+i)] = value
+		}
+	}
+}
+
+func (f *fakeSheets) get(a1 string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sheetName, col, row := parseCell(a1)
+	return f.cells[cellKey(sheetName, col, row)]
+}
+
+func (f *fakeSheets) GetValue(_ context.Context, _ string, readRange string) (string, error) {
+	f.wait()
+	return cast.ToString(f.get(readRange)), nil
+}
+
+func (f *fakeSheets) BatchUpdate(_ context.Context, _ string, data ...*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
+	f.wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, vr := range data {
+		f.write(vr.Range, vr.Values)
+	}
+	return &sheets.BatchUpdateValuesResponse{}, nil
+}
+
+func (f *fakeSheets) AppendInPlace(_ context.Context, _ string, appendRange string, vr *sheets.ValueRange) (*sheets.AppendValuesResponse, error) {
+	if f.beforeAppend != nil {
+		f.beforeAppend()
+	}
+	f.wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The table ends at the first row without a value in its first column
+	sheetName, col, row := parseCell(appendRange)
+	for f.cells[cellKey(sheetName, col, row)] != nil {
+		row++
+	}
+	landed := cellKey(sheetName, col, row)
+	f.write(landed, vr.Values)
+	return &sheets.AppendValuesResponse{
+		Updates: &sheets.UpdateValuesResponse{UpdatedRange: fmt.Sprintf("'%s'!%s", sheetName, strings.TrimPrefix(landed, sheetName+"!"))},
+	}, nil
+}
+
+var testExpenseTable = IDTable{
+	SheetName:  "2026_10",
+	StartCol:   "A",
+	EndCol:     "G",
+	HeaderRow:  3,
+	NextIDCell: "B2",
+}
+
+func newExpenseSheet() *fakeSheets {
+	f := newFakeSheets()
+	f.write("2026_10!A3", [][]interface{}{{"ID", "Name", "Amount", "Date", "Payer", "Participants", "Note"}})
+	f.write("2026_10!B2", [][]interface{}{{1}})
+	return f
+}
+
+func TestAppendWithIDParallelAdds(t *testing.T) {
+	f := newExpenseSheet()
+	f.latency = time.Millisecond
+
+	const adds = 20
+	ids := make([]int, adds)
+	var wg sync.WaitGroup
+	for i := 0; i < adds; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := AppendWithID(context.Background(), f, "spreadsheet", testExpenseTable, []interface{}{nil, fmt.Sprintf("expense %d", i), 1000})
+			if err != nil {
+				t.Errorf("add %d: unexpected error: %s", i, err.Error())
+			}
+			ids[i] = id
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for i, id := range ids {
+		if seen[id] {
+			t.Errorf("id %d was given twice", id)
+		}
+		seen[id] = true
+		// Every row sits at HeaderRow + ID and keeps its own name
+		row := testExpenseTable.HeaderRow + id
+		if actual := cast.ToInt(f.get(fmt.Sprintf("2026_10!A%d", row))); actual != id {
+			t.Errorf("row %d: expected id %d, got %d", row, id, actual)
+		}
+		if actual := f.get(fmt.Sprintf("2026_10!B%d", row)); actual != fmt.Sprintf("expense %d", i) {
+			t.Errorf("row %d: expected expense %d, got %v", row, i, actual)
+		}
+	}
+	for id := 1; id <= adds; id++ {
+		if !seen[id] {
+			t.Errorf("id %d was skipped", id)
+		}
+	}
+	if next := cast.ToInt(f.get("2026_10!B2")); next != adds+1 {
+		t.Errorf("expected next id %d, got %d", adds+1, next)
+	}
+}
+
+func TestAppendWithIDSkipsTakenID(t *testing.T) {
+	f := newExpenseSheet()
+	// Another writer adds expense 1 after the next id was read, without updating the next id cell
+	f.beforeAppend = func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.write("2026_10!A4", [][]interface{}{{1, "other writer", 500}})
+		f.beforeAppend = nil
+	}
+
+	id, err := AppendWithID(context.Background(), f, "spreadsheet", testExpenseTable, []interface{}{nil, "groceries", 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if id != 2 {
+		t.Errorf("expected id 2, got %d", id)
+	}
+	if actual := f.get("2026_10!B4"); actual != "other writer" {
+		t.Errorf("expected the row of the other writer to be kept, got %v", actual)
+	}
+	if actual := cast.ToInt(f.get("2026_10!A5")); actual != 2 {
+		t.Errorf("expected row 5 to get id 2, got %d", actual)
+	}
+	if next := cast.ToInt(f.get("2026_10!B2")); next != 3 {
+		t.Errorf("expected next id 3, got %d", next)
+	}
+}
+
+func TestFirstRowOfRange(t *testing.T) {
+	testCases := map[string]int{
+		"'2026_10'!A12:G12": 12,
+		"Tasks!F5":          5,
+		"'a!b'!$A$7:$G$7":   7,
+	}
+	for a1, expected := range testCases {
+		actual, err := firstRowOfRange(a1)
+		if err != nil || actual != expected {
+			t.Errorf("%s: expected %d, got %d (%v)", a1, expected, actual, err)
+		}
+	}
+	if _, err := firstRowOfRange("Sheet!A:G"); err == nil {
+		t.Errorf("expected an error for a range without row")
+	}
+}
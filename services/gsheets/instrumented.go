@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/sheets/v4"
+
+	"housematee-tgbot/services/telemetry"
+)
+
+// InstrumentedGSheets records the count, latency and errors of the calls made to next per method.
+// It sits right in front of the API client, so reads answered by the cache are not counted.
+type InstrumentedGSheets struct {
+	next IGSheets
+}
+
+func NewInstrumentedGSheets(next IGSheets) *InstrumentedGSheets {
+	return &InstrumentedGSheets{next: next}
+}
+
+// observe records a call started at start; the hook adds the correlation ID carried by ctx to the log
+func observe(ctx context.Context, method string, start time.Time, err error) {
+	duration := time.Since(start)
+	telemetry.ObserveSheetsCall(method, err, duration)
+	entry := logrus.WithContext(ctx).WithFields(logrus.Fields{"method": method, "duration_ms": duration.Milliseconds()})
+	if err != nil {
+		entry.Debugf("sheets call failed: %s", err.Error())
+		return
+	}
+	entry.Debug("sheets call")
+}
+
+func (i *InstrumentedGSheets) Get(ctx context.Context, spreadsheetId string, readRange string) (resp *sheets.ValueRange, err error) {
+	defer func(start time.Time) { observe(ctx, "get", start, err) }(time.Now())
+	return i.next.Get(ctx, spreadsheetId, readRange)
+}
+
+func (i *InstrumentedGSheets) BatchGet(ctx context.Context, spreadsheetId string, readRanges ...string) (resp []*sheets.ValueRange, err error) {
+	defer func(start time.Time) { observe(ctx, "batch_get", start, err) }(time.Now())
+	return i.next.BatchGet(ctx, spreadsheetId, readRanges...)
+}
+
+func (i *InstrumentedGSheets) Update(ctx context.Context, spreadsheetId string, writeRange string, vr *sheets.ValueRange) (resp *sheets.UpdateValuesResponse, err error) {
+	defer func(start time.Time) { observe(ctx, "update", start, err) }(time.Now())
+	return i.next.Update(ctx, spreadsheetId, writeRange, vr)
+}
+
+func (i *InstrumentedGSheets) BatchUpdate(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (resp *sheets.BatchUpdateValuesResponse, err error) {
+	defer func(start time.Time) { observe(ctx, "batch_update", start, err) }(time.Now())
+	return i.next.BatchUpdate(ctx, spreadsheetId, data...)
+}
+
+func (i *InstrumentedGSheets) BatchUpdateFormulas(ctx context.Context, spreadsheetId string, data ...*sheets.ValueRange) (resp *sheets.BatchUpdateValuesResponse, err error) {
+	defer func(start time.Time) { observe(ctx, "batch_update_formulas", start, err) }(time.Now())
+	return i.next.BatchUpdateFormulas(ctx, spreadsheetId, data...)
+}
+
+func (i *InstrumentedGSheets) GetValue(ctx context.Context, spreadsheetId string, readRange string) (value string, err error) {
+	defer func(start time.Time) { observe(ctx, "get_value", start, err) }(time.Now())
+	return i.next.GetValue(ctx, spreadsheetId, readRange)
+}
+
+func (i *InstrumentedGSheets) Append(ctx context.Context, spreadsheetId string, appendRange string, vr *sheets.ValueRange) (resp *sheets.AppendValuesResponse, err error) {
+	defer func(start time.Time) { observe(ctx, "append", start, err) }(time.Now())
+	return i.next.Append(ctx, spreadsheetId, appendRange, vr)
+}
+
+func (i *InstrumentedGSheets) AppendInPlace(ctx context.Context, spreadsheetId string, appendRange string, vr *sheets.ValueRange) (resp *sheets.AppendValuesResponse, err error) {
+	defer func(start time.Time) { observe(ctx, "append_in_place", start, err) }(time.Now())
+	return i.next.AppendInPlace(ctx, spreadsheetId, appendRange, vr)
+}
+
+func (i *InstrumentedGSheets) GetSpreadsheet(ctx context.Context, spreadsheetId string) (resp *sheets.Spreadsheet, err error) {
+	defer func(start time.Time) { observe(ctx, "get_spreadsheet", start, err) }(time.Now())
+	return i.next.GetSpreadsheet(ctx, spreadsheetId)
+}
+
+func (i *InstrumentedGSheets) DuplicateSheet(ctx context.Context, spreadsheetId string, sourceSheetId int64, newTitle string) (resp *sheets.SheetProperties, err error) {
+	defer func(start time.Time) { observe(ctx, "duplicate_sheet", start, err) }(time.Now())
+	return i.next.DuplicateSheet(ctx, spreadsheetId, sourceSheetId, newTitle)
+}
+
+func (i *InstrumentedGSheets) AddSheet(ctx context.Context, spreadsheetId string, title string) (resp *sheets.SheetProperties, err error) {
+	defer func(start time.Time) { observe(ctx, "add_sheet", start, err) }(time.Now())
+	return i.next.AddSheet(ctx, spreadsheetId, title)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+
+	"housematee-tgbot/utilities"
+)
+
+// RequestTimeout bounds a Sheets operation, including its retries
+const RequestTimeout = 30 * time.Second
+
+// retryPolicy retries quota and server errors with exponential backoff and jitter
+var retryPolicy = utilities.RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    8 * time.Second,
+}
+
+// NewRequestContext returns the context of a Sheets operation, with a deadline of RequestTimeout.
+// It keeps the values of parent, e.g., the correlation ID of the update.
+func NewRequestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, RequestTimeout)
+}
+
+// isRateLimited reports whether the request was rejected by the Sheets API quota
+func isRateLimited(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests
+}
+
+// isTransient reports whether the request failed because of the quota or a server error
+func isTransient(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+}
+
+// withRetry calls fn again on quota and server errors
+func withRetry(ctx context.Context, operation string, fn func() error) error {
+	return withRetryOn(ctx, operation, isTransient, fn)
+}
+
+// withRetryOn calls fn again while it fails with an error accepted by retryable
+func withRetryOn(ctx context.Context, operation string, retryable func(err error) bool, fn func() error) error {
+	attempt := 0
+	return utilities.Retry(ctx, retryPolicy, retryable, func() error {
+		attempt++
+		err := fn()
+		if err != nil && retryable(err) && attempt < retryPolicy.MaxAttempts {
+			logrus.Warnf("sheets %s failed (attempt %d/%d), retrying: %s", operation, attempt, retryPolicy.MaxAttempts, err.Error())
+		}
+		return err
+	})
+}
@@ -0,0 +1,136 @@
+package household
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"housematee-tgbot/models"
+)
+
+var registry = newRegistry("")
+
+// Registry keeps the households linked with /setup in a JSON file, keyed by chat ID.
+// An empty path keeps them in memory only.
+type Registry struct {
+	path string
+
+	mu         sync.RWMutex
+	households map[int64]models.Household
+}
+
+func newRegistry(path string) *Registry {
+	return &Registry{
+		path:       path,
+		households: make(map[int64]models.Household),
+	}
+}
+
+// Open loads the registry from path, which is created on the first write when it does not exist
+func Open(path string) (*Registry, error) {
+	r := newRegistry(path)
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return r, nil
+	}
+	var households []models.Household
+	if err := json.Unmarshal(data, &households); err != nil {
+		return nil, err
+	}
+	for _, h := range households {
+		r.households[h.ChatID] = h
+	}
+	return r, nil
+}
+
+// InitRegistry opens the registry used by GetRegistry
+func InitRegistry(path string) (*Registry, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	registry = r
+	return registry, nil
+}
+
+// GetRegistry returns the registry opened by InitRegistry, or an in-memory registry before it is called
+func GetRegistry() *Registry {
+	return registry
+}
+
+// Get returns the household of a chat
+func (r *Registry) Get(chatID int64) (models.Household, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.households[chatID]
+	return h, ok
+}
+
+// Put adds or replaces the household of its chat
+func (r *Registry) Put(h models.Household) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, existed := r.households[h.ChatID]
+	r.households[h.ChatID] = h
+	if err := r.saveLocked(); err != nil {
+		// Keep the registry in line with the file
+		if existed {
+			r.households[h.ChatID] = previous
+		} else {
+			delete(r.households, h.ChatID)
+		}
+		return err
+	}
+	return nil
+}
+
+// All returns the households ordered by chat ID
+func (r *Registry) All() []models.Household {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sortedLocked()
+}
+
+func (r *Registry) sortedLocked() []models.Household {
+	households := make([]models.Household, 0, len(r.households))
+	for _, h := range r.households {
+		households = append(households, h)
+	}
+	sort.Slice(households, func(i, j int) bool {
+		return households[i].ChatID < households[j].ChatID
+	})
+	return households
+}
+
+// saveLocked writes the households to a temporary file and renames it over the registry file,
+// so a crash while writing leaves the previous content
+func (r *Registry) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.sortedLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o700); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
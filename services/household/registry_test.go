@@ -0,0 +1,71 @@
+package household
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"housematee-tgbot/models"
+)
+
+func TestRegistrySurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "households.json")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(models.Household{ChatID: -200, SpreadsheetID: "sheet-b", Timezone: "Europe/Berlin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(models.Household{ChatID: -100, SpreadsheetID: "sheet-a"}); err != nil {
+		t.Fatal(err)
+	}
+	// Linking a chat again replaces its household
+	if err := r.Put(models.Household{ChatID: -200, SpreadsheetID: "sheet-c", Name: "Flat 2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := reopened.All()
+	if len(all) != 2 || all[0].ChatID != -200 || all[1].ChatID != -100 {
+		t.Fatalf("All = %+v, want the two chats ordered by ID", all)
+	}
+	h, ok := reopened.Get(-200)
+	if !ok || h.SpreadsheetID != "sheet-c" || h.Name != "Flat 2" || h.Timezone != "" {
+		t.Errorf("Get(-200) = %+v, %v; want the last household linked", h, ok)
+	}
+	if _, ok := reopened.Get(-300); ok {
+		t.Error("Get(-300) found a household that was never linked")
+	}
+}
+
+func TestRegistryKeepsStateWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open(filepath.Join(dir, "households.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(models.Household{ChatID: -100, SpreadsheetID: "sheet-a"}); err != nil {
+		t.Fatal(err)
+	}
+	// A directory in place of the temporary file makes the write fail
+	if err := os.Mkdir(filepath.Join(dir, "households.json.tmp"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Put(models.Household{ChatID: -100, SpreadsheetID: "sheet-b"}); err == nil {
+		t.Fatal("Put succeeded although the file could not be written")
+	}
+	if err := r.Put(models.Household{ChatID: -200, SpreadsheetID: "sheet-c"}); err == nil {
+		t.Fatal("Put succeeded although the file could not be written")
+	}
+	if h, _ := r.Get(-100); h.SpreadsheetID != "sheet-a" {
+		t.Errorf("Get(-100) = %+v, want the household that was saved", h)
+	}
+	if _, ok := r.Get(-200); ok {
+		t.Error("Get(-200) found a household that was not saved")
+	}
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
+)
+
+// ConversationStorage is a conversation.Storage keeping the states of one flow in the store
+type ConversationStorage struct {
+	store       *Store
+	flow        string
+	keyStrategy conversation.KeyStrategy
+}
+
+// ConversationStorage returns the storage of the conversation states of a flow
+func (s *Store) ConversationStorage(flow string, strategy conversation.KeyStrategy) *ConversationStorage {
+	return &ConversationStorage{store: s, flow: flow, keyStrategy: strategy}
+}
+
+func (c *ConversationStorage) key(ctx *ext.Context) (string, error) {
+	key, err := conversation.StateKey(ctx, c.keyStrategy)
+	if err != nil {
+		return "", err
+	}
+	return "conversation:" + c.flow + ":" + key, nil
+}
+
+func (c *ConversationStorage) Get(ctx *ext.Context) (*conversation.State, error) {
+	key, err := c.key(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var s conversation.State
+	found, err := c.store.Get(key, &s)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, conversation.ErrKeyNotFound
+	}
+	return &s, nil
+}
+
+func (c *ConversationStorage) Set(ctx *ext.Context, s conversation.State) error {
+	key, err := c.key(ctx)
+	if err != nil {
+		return err
+	}
+	owner := Owner{Flow: c.flow}
+	if ctx.EffectiveChat != nil {
+		owner.ChatID = ctx.EffectiveChat.Id
+	}
+	if ctx.EffectiveSender != nil {
+		owner.UserID = ctx.EffectiveSender.Id()
+	}
+	return c.store.put(key, owner, s, true)
+}
+
+func (c *ConversationStorage) Delete(ctx *ext.Context) error {
+	key, err := c.key(ctx)
+	if err != nil {
+		return err
+	}
+	return c.store.Delete(key)
+}
@@ -0,0 +1,218 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var store = newStore("")
+
+// Owner is the flow and the chat a stored value belongs to.
+// UserID is set for the values of one user, 0 for the values shared by the chat.
+type Owner struct {
+	Flow   string
+	ChatID int64
+	UserID int64
+}
+
+// Expired is a conversation dropped by Expire after it was idle for too long
+type Expired struct {
+	Flow   string
+	ChatID int64
+	UserID int64
+}
+
+type record struct {
+	Owner     Owner           `json:"owner"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// Notify marks the conversation states, their expiry is reported to the user
+	Notify bool `json:"notify,omitempty"`
+}
+
+// Store keeps the conversation states and the drafts of the flows in a JSON file,
+// so a restart does not lose a flow halfway. An empty path keeps them in memory only.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	records map[string]record
+}
+
+func newStore(path string) *Store {
+	return &Store{
+		path:    path,
+		now:     time.Now,
+		records: make(map[string]record),
+	}
+}
+
+// Open loads the store from path, which is created on the first write when it does not exist
+func Open(path string) (*Store, error) {
+	s := newStore(path)
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.records); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// InitStore opens the store used by GetStore
+func InitStore(path string) (*Store, error) {
+	s, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	store = s
+	return store, nil
+}
+
+// GetStore returns the store opened by InitStore, or an in-memory store before it is called
+func GetStore() *Store {
+	return store
+}
+
+// Put stores value under key
+func (s *Store) Put(key string, owner Owner, value any) error {
+	return s.put(key, owner, value, false)
+}
+
+func (s *Store) put(key string, owner Owner, value any, notify bool) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record{Owner: owner, Value: data, UpdatedAt: s.now(), Notify: notify}
+	return s.saveLocked()
+}
+
+// Get decodes the value stored under key into out and reports whether it was found
+func (s *Store) Get(key string, out any) (bool, error) {
+	s.mu.Lock()
+	r, ok := s.records[key]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(r.Value, out)
+}
+
+// Delete removes the values stored under keys
+func (s *Store) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for _, key := range keys {
+		if _, ok := s.records[key]; ok {
+			delete(s.records, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// CountConversations returns the number of conversations in progress per flow
+func (s *Store) CountConversations() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int)
+	for _, r := range s.records {
+		if r.Notify {
+			counts[r.Owner.Flow]++
+		}
+	}
+	return counts
+}
+
+// Expire removes the values of the flows idle for longer than idle.
+// A flow of a chat stays as long as any of its values was updated recently; the conversations
+// removed with it are returned, so their users can be told.
+func (s *Store) Expire(idle time.Duration) ([]Expired, error) {
+	type flowKey struct {
+		flow   string
+		chatID int64
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastUpdate := make(map[flowKey]time.Time)
+	for _, r := range s.records {
+		k := flowKey{r.Owner.Flow, r.Owner.ChatID}
+		if r.UpdatedAt.After(lastUpdate[k]) {
+			lastUpdate[k] = r.UpdatedAt
+		}
+	}
+
+	cutoff := s.now().Add(-idle)
+	removed := 0
+	var expired []Expired
+	for key, r := range s.records {
+		if lastUpdate[flowKey{r.Owner.Flow, r.Owner.ChatID}].After(cutoff) {
+			continue
+		}
+		delete(s.records, key)
+		removed++
+		if r.Notify {
+			expired = append(expired, Expired{Flow: r.Owner.Flow, ChatID: r.Owner.ChatID, UserID: r.Owner.UserID})
+		}
+	}
+	if removed == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].ChatID != expired[j].ChatID {
+			return expired[i].ChatID < expired[j].ChatID
+		}
+		if expired[i].Flow != expired[j].Flow {
+			return expired[i].Flow < expired[j].Flow
+		}
+		return expired[i].UserID < expired[j].UserID
+	})
+	return expired, s.saveLocked()
+}
+
+// saveLocked writes the records to a temporary file and renames it over the store file,
+// so a crash while writing leaves the previous content
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,148 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
+)
+
+type testDraft struct {
+	Total int64
+	Payer string
+}
+
+// newTestStore returns a store in a temporary file and a function to move its clock forward
+func newTestStore(t *testing.T) (*Store, func(time.Duration)) {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "data", "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	s, _ := newTestStore(t)
+	owner := Owner{Flow: "rent", ChatID: -100}
+	if err := s.Put("draft:rent:-100:data", owner, testDraft{Total: 5000000, Payer: "123"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("draft:rent:-100:reviewing", owner, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("draft:rent:-100:reviewing"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var draft testDraft
+	found, err := reopened.Get("draft:rent:-100:data", &draft)
+	if err != nil || !found {
+		t.Fatalf("Get = %v, %v; want the draft", found, err)
+	}
+	if draft != (testDraft{Total: 5000000, Payer: "123"}) {
+		t.Errorf("draft = %+v", draft)
+	}
+	var reviewing bool
+	if found, _ := reopened.Get("draft:rent:-100:reviewing", &reviewing); found {
+		t.Error("deleted value found after reopening")
+	}
+}
+
+func TestStoreInMemory(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("key", Owner{Flow: "rent"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	if found, _ := s.Get("key", &value); !found || value != 1 {
+		t.Errorf("Get = %v, %d; want 1", found, value)
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	s, advance := newTestStore(t)
+	rent := Owner{Flow: "rent", ChatID: -100}
+	s.put("conversation:rent:1/7/-100", Owner{Flow: "rent", ChatID: -100, UserID: 7}, conversation.State{Key: "rent_state_review"}, true)
+	s.Put("draft:rent:-100:data", rent, testDraft{Total: 1})
+
+	advance(20 * time.Minute)
+	// The draft was updated recently, so the whole rent flow of the chat stays
+	s.Put("draft:rent:-100:data", rent, testDraft{Total: 2})
+
+	advance(20 * time.Minute)
+	s.put("conversation:shop:1/8/-100", Owner{Flow: "shop", ChatID: -100, UserID: 8}, conversation.State{Key: "shop_state_add_item"}, true)
+	expired, err := s.Expire(30 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Fatalf("expired = %+v, want none", expired)
+	}
+
+	advance(15 * time.Minute)
+	expired, err = s.Expire(30 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Expired{{Flow: "rent", ChatID: -100, UserID: 7}}
+	if !reflect.DeepEqual(expired, want) {
+		t.Errorf("expired = %+v, want %+v", expired, want)
+	}
+	var draft testDraft
+	if found, _ := s.Get("draft:rent:-100:data", &draft); found {
+		t.Error("the rent draft was not removed with its conversation")
+	}
+	var st conversation.State
+	if found, _ := s.Get("conversation:shop:1/8/-100", &st); !found {
+		t.Error("the shop conversation expired too early")
+	}
+}
+
+func TestConversationStorage(t *testing.T) {
+	s, _ := newTestStore(t)
+	storage := s.ConversationStorage("rent", conversation.KeyStrategySenderAndChat)
+	ctx := &ext.Context{
+		Bot:             gotgbot.User{Id: 1},
+		EffectiveChat:   &gotgbot.Chat{Id: -100},
+		EffectiveSender: &gotgbot.Sender{User: &gotgbot.User{Id: 7}},
+	}
+
+	if _, err := storage.Get(ctx); !errors.Is(err, conversation.ErrKeyNotFound) {
+		t.Fatalf("Get before Set = %v, want ErrKeyNotFound", err)
+	}
+	if err := storage.Set(ctx, conversation.State{Key: "rent_state_water"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart reads the state back from the file
+	reopened, err := Open(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.ConversationStorage("rent", conversation.KeyStrategySenderAndChat).Get(ctx)
+	if err != nil || got.Key != "rent_state_water" {
+		t.Fatalf("Get after reopening = %+v, %v", got, err)
+	}
+
+	if err := storage.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Get(ctx); !errors.Is(err, conversation.ErrKeyNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrKeyNotFound", err)
+	}
+}
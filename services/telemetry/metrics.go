@@ -0,0 +1,124 @@
+package telemetry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes used as the outcome label
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+	OutcomePanic = "panic"
+)
+
+const namespace = "housematee"
+
+var (
+	updatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates handled, by command or callback and outcome.",
+	}, []string{"handler", "outcome"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling a Telegram update, by command or callback.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"handler"})
+
+	sheetsRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sheets_requests_total",
+		Help:      "Google Sheets API calls, by method and outcome. Retries are part of one call.",
+	}, []string{"method", "outcome"})
+
+	sheetsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sheets_request_duration_seconds",
+		Help:      "Latency of the Google Sheets API calls including retries, by method.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"method"})
+
+	cronJobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cron_jobs_total",
+		Help:      "Scheduled job runs, by job and outcome.",
+	}, []string{"job", "outcome"})
+
+	cronJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cron_job_duration_seconds",
+		Help:      "Duration of the scheduled job runs, by job.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60},
+	}, []string{"job"})
+)
+
+// ObserveUpdate records a handled update
+func ObserveUpdate(handler string, outcome string, duration time.Duration) {
+	updatesTotal.WithLabelValues(handler, outcome).Inc()
+	handlerDuration.WithLabelValues(handler).Observe(duration.Seconds())
+	current.recordUpdate(outcome)
+}
+
+// ObserveSheetsCall records a Google Sheets API call
+func ObserveSheetsCall(method string, err error, duration time.Duration) {
+	outcome := OutcomeOK
+	if err != nil {
+		outcome = OutcomeError
+	}
+	sheetsRequestsTotal.WithLabelValues(method, outcome).Inc()
+	sheetsDuration.WithLabelValues(method).Observe(duration.Seconds())
+	current.recordSheetsCall(err, duration)
+}
+
+// ObserveCronJob records a run of a scheduled job started at start; err is the failure or the panic of the run
+func ObserveCronJob(job string, outcome string, err error, start time.Time) {
+	duration := time.Since(start)
+	cronJobsTotal.WithLabelValues(job, outcome).Inc()
+	cronJobDuration.WithLabelValues(job).Observe(duration.Seconds())
+
+	run := JobRun{Job: job, At: start, Duration: duration, Outcome: outcome}
+	if err != nil {
+		run.Err = err.Error()
+	}
+	current.recordJob(run)
+}
+
+// activeConversations reports the number of conversations in progress per flow when scraped
+type activeConversations struct {
+	desc  *prometheus.Desc
+	count func() map[string]int
+}
+
+func (c activeConversations) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c activeConversations) Collect(ch chan<- prometheus.Metric) {
+	for flow, n := range c.count() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), flow)
+	}
+}
+
+// RegisterActiveConversations reports the conversations in progress counted by count, per flow
+func RegisterActiveConversations(count func() map[string]int) {
+	prometheus.MustRegister(activeConversations{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active_conversations"),
+			"Conversations in progress, by flow.",
+			[]string{"flow"}, nil,
+		),
+		count: count,
+	})
+}
+
+// Handler serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
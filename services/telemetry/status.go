@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Version is the version of the bot, set at build time with -ldflags "-X housematee-tgbot/services/telemetry.Version=1.4.0"
+var Version = ""
+
+// recentSheetsCalls is how many Sheets call durations the latency percentiles are computed on
+const recentSheetsCalls = 100
+
+// JobRun is the last run of a scheduled job
+type JobRun struct {
+	Job      string
+	At       time.Time
+	Duration time.Duration
+	Outcome  string
+	Err      string
+}
+
+// Status is what the bot did since it started, shown by /status
+type Status struct {
+	StartedAt        time.Time
+	Version          string
+	Updates          int64
+	UpdateErrors     int64
+	UpdatePanics     int64
+	SheetsCalls      int64
+	SheetsErrors     int64
+	SheetsLatencyP50 time.Duration
+	SheetsLatencyP95 time.Duration
+	// Jobs holds the last run of each job, sorted by job name
+	Jobs []JobRun
+}
+
+// status keeps the counters of Status; the Prometheus metrics are for dashboards, this is for a quick look in the chat
+type status struct {
+	mu           sync.Mutex
+	startedAt    time.Time
+	updates      int64
+	updateErrors int64
+	updatePanics int64
+	sheetsCalls  int64
+	sheetsErrors int64
+	// sheetsDurations is a ring of the last recentSheetsCalls durations
+	sheetsDurations []time.Duration
+	next            int
+	jobs            map[string]JobRun
+}
+
+var current = newStatus(time.Now())
+
+func newStatus(startedAt time.Time) *status {
+	return &status{
+		startedAt: startedAt,
+		jobs:      make(map[string]JobRun),
+	}
+}
+
+func (s *status) recordUpdate(outcome string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates++
+	switch outcome {
+	case OutcomeError:
+		s.updateErrors++
+	case OutcomePanic:
+		s.updatePanics++
+	}
+}
+
+func (s *status) recordSheetsCall(err error, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sheetsCalls++
+	if err != nil {
+		s.sheetsErrors++
+	}
+	if len(s.sheetsDurations) < recentSheetsCalls {
+		s.sheetsDurations = append(s.sheetsDurations, duration)
+		return
+	}
+	s.sheetsDurations[s.next] = duration
+	s.next = (s.next + 1) % recentSheetsCalls
+}
+
+func (s *status) recordJob(run JobRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[run.Job] = run
+}
+
+func (s *status) snapshot() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := Status{
+		StartedAt:    s.startedAt,
+		Version:      version(),
+		Updates:      s.updates,
+		UpdateErrors: s.updateErrors,
+		UpdatePanics: s.updatePanics,
+		SheetsCalls:  s.sheetsCalls,
+		SheetsErrors: s.sheetsErrors,
+	}
+	if len(s.sheetsDurations) > 0 {
+		sorted := append([]time.Duration(nil), s.sheetsDurations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		snap.SheetsLatencyP50 = percentile(sorted, 50)
+		snap.SheetsLatencyP95 = percentile(sorted, 95)
+	}
+	for _, run := range s.jobs {
+		snap.Jobs = append(snap.Jobs, run)
+	}
+	sort.Slice(snap.Jobs, func(i, j int) bool { return snap.Jobs[i].Job < snap.Jobs[j].Job })
+	return snap
+}
+
+// percentile returns the p-th percentile of sorted with the nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// version returns Version, or the VCS revision the binary was built from, or "dev"
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+				return setting.Value[:7]
+			}
+		}
+	}
+	return "dev"
+}
+
+// CurrentStatus returns what the bot did since it started
+func CurrentStatus() Status {
+	return current.snapshot()
+}
@@ -0,0 +1,110 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCorrelationIDFollowsTheContext(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "update-1")
+	derived, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	// A goroutine spawned by the handler gets the ID with the context
+	other := make(chan string)
+	go func() { other <- CorrelationID(derived) }()
+	if got := <-other; got != "update-1" {
+		t.Errorf("CorrelationID in another goroutine = %q, want update-1", got)
+	}
+	if got := CorrelationID(context.Background()); got != "" {
+		t.Errorf("CorrelationID without one = %q, want none", got)
+	}
+}
+
+func TestLogHookAddsCorrelationID(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	logger.AddHook(LogHook{})
+
+	logger.Info("without context")
+	logger.WithContext(WithCorrelationID(context.Background(), "3f9a1c2b7e4d8a60")).Info("with context")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %q", len(lines), out.String())
+	}
+	if strings.Contains(lines[0], CorrelationIDField) {
+		t.Errorf("entry without context has a correlation ID: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], CorrelationIDField+"=3f9a1c2b7e4d8a60") {
+		t.Errorf("entry with context has no correlation ID: %s", lines[1])
+	}
+}
+
+func TestUpdateLabels(t *testing.T) {
+	labels := NewUpdateLabels([]string{"rent", "hw1"}, []string{"rent.", "splitbill."})
+	tests := []struct {
+		name   string
+		update *gotgbot.Update
+		want   string
+	}{
+		{"command", &gotgbot.Update{Message: &gotgbot.Message{Text: "/rent"}}, "/rent"},
+		{"command with bot name", &gotgbot.Update{Message: &gotgbot.Message{Text: "/hw1@housematee_bot now"}}, "/hw1"},
+		{"unknown command", &gotgbot.Update{Message: &gotgbot.Message{Text: "/whatever"}}, LabelOtherCommand},
+		{"callback", &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{Data: "rent.payer.123"}}, "callback:rent"},
+		{"unknown callback", &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{Data: "forged.42"}}, LabelOtherCallback},
+		{"message", &gotgbot.Update{Message: &gotgbot.Message{Text: "150k"}}, LabelMessage},
+		{"photo", &gotgbot.Update{Message: &gotgbot.Message{Photo: []gotgbot.PhotoSize{{FileId: "p"}}}}, LabelPhoto},
+		{"other", &gotgbot.Update{}, LabelOther},
+	}
+	for _, tt := range tests {
+		if got := labels.Of(tt.update); got != tt.want {
+			t.Errorf("%s: Of = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusSnapshot(t *testing.T) {
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	s := newStatus(start)
+	s.recordUpdate(OutcomeOK)
+	s.recordUpdate(OutcomeError)
+	s.recordUpdate(OutcomePanic)
+	// Only the last recentSheetsCalls durations count for the latency
+	for i := 0; i < recentSheetsCalls; i++ {
+		s.recordSheetsCall(nil, time.Hour)
+	}
+	for i := 1; i <= recentSheetsCalls; i++ {
+		var err error
+		if i == 1 {
+			err = errors.New("quota exceeded")
+		}
+		s.recordSheetsCall(err, time.Duration(i)*time.Millisecond)
+	}
+	s.recordJob(JobRun{Job: "notify_due_tasks", At: start, Outcome: OutcomeError, Err: "failed to get housework map"})
+	s.recordJob(JobRun{Job: "expire_drafts", At: start, Outcome: OutcomeOK})
+	s.recordJob(JobRun{Job: "expire_drafts", At: start.Add(time.Minute), Outcome: OutcomeOK})
+
+	got := s.snapshot()
+	if got.Updates != 3 || got.UpdateErrors != 1 || got.UpdatePanics != 1 {
+		t.Errorf("updates = %d/%d/%d, want 3/1/1", got.Updates, got.UpdateErrors, got.UpdatePanics)
+	}
+	if got.SheetsCalls != 2*recentSheetsCalls || got.SheetsErrors != 1 {
+		t.Errorf("sheets = %d calls, %d errors", got.SheetsCalls, got.SheetsErrors)
+	}
+	if got.SheetsLatencyP50 != 50*time.Millisecond || got.SheetsLatencyP95 != 95*time.Millisecond {
+		t.Errorf("latency p50 %s, p95 %s; want 50ms, 95ms", got.SheetsLatencyP50, got.SheetsLatencyP95)
+	}
+	if len(got.Jobs) != 2 || got.Jobs[0].Job != "expire_drafts" || !got.Jobs[0].At.Equal(start.Add(time.Minute)) {
+		t.Errorf("jobs = %+v, want the last run of each job by name", got.Jobs)
+	}
+}
@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CorrelationIDField is the log field of the correlation ID
+const CorrelationIDField = "request_id"
+
+// correlationIDKey is the context key of the correlation ID
+type correlationIDKey struct{}
+
+// NewCorrelationID returns a random ID, e.g., "3f9a1c2b7e4d8a60"
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithCorrelationID returns a context carrying the correlation ID of an update or a job.
+// The contexts derived from it, e.g., the request contexts of the Sheets calls, carry it too.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or ""
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// LogHook adds the correlation ID of the context of the log entries, set with logrus.WithContext
+type LogHook struct{}
+
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if _, ok := entry.Data[CorrelationIDField]; ok {
+		return nil
+	}
+	if id := CorrelationID(entry.Context); id != "" {
+		entry.Data[CorrelationIDField] = id
+	}
+	return nil
+}
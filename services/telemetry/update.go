@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Labels of the updates that are not a known command or callback
+const (
+	LabelOtherCommand  = "other_command"
+	LabelOtherCallback = "callback:other"
+	LabelMessage       = "message"
+	LabelPhoto         = "photo"
+	LabelOther         = "other"
+)
+
+// UpdateLabels names the updates in the handler label. Only the registered commands and
+// callback prefixes get their own label: the text and the callback data come from the
+// users, so passing them through would let anyone grow the number of series.
+type UpdateLabels struct {
+	commands  map[string]bool
+	callbacks map[string]bool
+}
+
+// NewUpdateLabels returns the labels of commands, without the slash, and of the callbacks
+// whose data starts with one of callbackPrefixes, e.g., "rent" for "rent.payer.123"
+func NewUpdateLabels(commands []string, callbackPrefixes []string) UpdateLabels {
+	labels := UpdateLabels{
+		commands:  make(map[string]bool, len(commands)),
+		callbacks: make(map[string]bool, len(callbackPrefixes)),
+	}
+	for _, command := range commands {
+		labels.commands[command] = true
+	}
+	for _, prefix := range callbackPrefixes {
+		labels.callbacks[strings.TrimSuffix(prefix, ".")] = true
+	}
+	return labels
+}
+
+// Of returns the handler label of update, e.g., "/rent", "callback:splitbill" or "message"
+func (l UpdateLabels) Of(update *gotgbot.Update) string {
+	if update == nil {
+		return LabelOther
+	}
+	if cb := update.CallbackQuery; cb != nil {
+		family, _, _ := strings.Cut(cb.Data, ".")
+		if l.callbacks[family] {
+			return "callback:" + family
+		}
+		return LabelOtherCallback
+	}
+
+	msg := update.Message
+	if msg == nil {
+		return LabelOther
+	}
+	if strings.HasPrefix(msg.Text, "/") {
+		command := strings.TrimPrefix(strings.Fields(msg.Text)[0], "/")
+		// Commands sent in groups may name the bot, e.g., "/rent@housematee_bot"
+		command, _, _ = strings.Cut(command, "@")
+		if l.commands[command] {
+			return "/" + command
+		}
+		return LabelOtherCommand
+	}
+	if len(msg.Photo) > 0 {
+		return LabelPhoto
+	}
+	return LabelMessage
+}
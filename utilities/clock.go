@@ -0,0 +1,98 @@
+package utilities
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTimezone is the house timezone used when none is configured
+const DefaultTimezone = "Asia/Ho_Chi_Minh"
+
+// Clock reports the current time.
+// The package-level clock can be replaced with SetClock so tests can freeze time.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock backed by time.Now
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock that always returns the same instant
+type FixedClock struct {
+	Time time.Time
+}
+
+func (c FixedClock) Now() time.Time {
+	return c.Time
+}
+
+var (
+	clock    Clock = systemClock{}
+	location       = loadDefaultLocation()
+	clockMux sync.RWMutex
+)
+
+func loadDefaultLocation() *time.Location {
+	loc, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// SetClock replaces the clock used by every date helper.
+// Passing nil restores the system clock.
+func SetClock(c Clock) {
+	clockMux.Lock()
+	defer clockMux.Unlock()
+	if c == nil {
+		c = systemClock{}
+	}
+	clock = c
+}
+
+// SetTimezone sets the house timezone by IANA name (e.g., Asia/Ho_Chi_Minh)
+func SetTimezone(name string) error {
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	SetLocation(loc)
+	return nil
+}
+
+// SetLocation sets the house timezone
+func SetLocation(loc *time.Location) {
+	clockMux.Lock()
+	defer clockMux.Unlock()
+	location = loc
+}
+
+// Location returns the house timezone
+func Location() *time.Location {
+	clockMux.RLock()
+	defer clockMux.RUnlock()
+	return location
+}
+
+// Now returns the current time in the house timezone
+func Now() time.Time {
+	return NowIn(Location())
+}
+
+// NowIn returns the current time in loc, the timezone of a household; nil uses the house timezone
+func NowIn(loc *time.Location) time.Time {
+	if loc == nil {
+		loc = Location()
+	}
+	clockMux.RLock()
+	defer clockMux.RUnlock()
+	return clock.Now().In(loc)
+}
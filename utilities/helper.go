@@ -5,32 +5,43 @@ import (
 	"time"
 )
 
-func GetCurrentDate() string {
-	return time.Now().Format("02/01/2006")
+const (
+	DateLayout      = "02/01/2006"
+	TimestampLayout = "02/01/2006 15:04"
+)
+
+// GetCurrentDate returns the current date in loc in DD/MM/YYYY format
+func GetCurrentDate(loc *time.Location) string {
+	return NowIn(loc).Format(DateLayout)
+}
+
+// GetCurrentTimestamp returns the current time in loc in DD/MM/YYYY HH:mm format for audit entries
+func GetCurrentTimestamp(loc *time.Location) string {
+	return NowIn(loc).Format(TimestampLayout)
 }
 
-// GetCurrentMonthSheetName returns the current month in YYYY_MM format for sheet naming
-func GetCurrentMonthSheetName() string {
-	return time.Now().Format("2006_01")
+// GetCurrentMonthSheetName returns the current month in loc in YYYY_MM format for sheet naming
+func GetCurrentMonthSheetName(loc *time.Location) string {
+	return NowIn(loc).Format("2006_01")
 }
 
-// GetCurrentMonthDisplayName returns the current month in MM/YYYY format for display in cells
-func GetCurrentMonthDisplayName() string {
-	return time.Now().Format("01/2006")
+// GetCurrentMonthDisplayName returns the current month in loc in MM/YYYY format for display in cells
+func GetCurrentMonthDisplayName(loc *time.Location) string {
+	return NowIn(loc).Format("01/2006")
 }
 
 // AddDay add day operation
 func AddDay(dateStr string, day int) (string, error) {
-	t, err := time.Parse("02/01/2006", dateStr)
+	t, err := time.Parse(DateLayout, dateStr)
 	if err != nil {
 		return "", err
 	}
 	t = t.AddDate(0, 0, day)
-	return t.Format("02/01/2006"), nil
+	return t.Format(DateLayout), nil
 }
 
 func StringToGoogleDate(dateStr string) (date.Date, error) {
-	t, err := time.Parse("02/01/2006", dateStr)
+	t, err := time.Parse(DateLayout, dateStr)
 	if err != nil {
 		return date.Date{}, err
 	}
@@ -45,21 +56,16 @@ func DateToGoogleDate(t time.Time) date.Date {
 	}
 }
 
-func IsDateDueOrOverdue(dateStr string) (bool, error) {
-	// Load the Asia/Bangkok time zone (GMT+7)
-	loc, err := time.LoadLocation("Asia/Bangkok")
-	if err != nil {
-		return false, err
-	}
-
-	// Parse the date string with the specified time zone
-	t, err := time.ParseInLocation("02/01/2006", dateStr, loc)
+// IsDateDueOrOverdue reports whether the date, in loc, is today or earlier
+func IsDateDueOrOverdue(dateStr string, loc *time.Location) (bool, error) {
+	// Parse the date string in the house timezone
+	t, err := time.ParseInLocation(DateLayout, dateStr, loc)
 	if err != nil {
 		return false, err
 	}
 
-	// Get the current date in the same time zone
-	currentDate := time.Now().In(loc)
+	// Get the current time in the same time zone
+	currentDate := NowIn(loc)
 
 	// Compare the parsed date with the current date
 	if t.Before(currentDate) || t.Equal(currentDate) {
@@ -2,9 +2,14 @@ package utilities
 
 import (
 	"testing"
+	"time"
 )
 
 func TestIsDateDueOrOverdue(t *testing.T) {
+	// 23:30 UTC on 11/09/2023 is already 12/09/2023 in the house timezone
+	SetClock(FixedClock{Time: time.Date(2023, 9, 11, 23, 30, 0, 0, time.UTC)})
+	defer SetClock(nil)
+
 	testCases := []struct {
 		name     string
 		input    string
@@ -21,6 +26,16 @@ func TestIsDateDueOrOverdue(t *testing.T) {
 			input:    "11/09/2023",
 			expected: true, // Due on or before the current date
 		},
+		{
+			name:     "due today in house timezone",
+			input:    "12/09/2023",
+			expected: true, // Already today in GMT+7 although still 11/09 in UTC
+		},
+		{
+			name:     "tomorrow",
+			input:    "13/09/2023",
+			expected: false, // Future date
+		},
 		{
 			name:     "false",
 			input:    "01/01/2099",
@@ -30,7 +45,7 @@ func TestIsDateDueOrOverdue(t *testing.T) {
 
 	for _, testCase := range testCases {
 		// Act
-		actual, err := IsDateDueOrOverdue(testCase.input)
+		actual, err := IsDateDueOrOverdue(testCase.input, Location())
 		if err != nil {
 			t.Errorf("unexpected error: %s", err.Error())
 		}
@@ -39,3 +54,37 @@ func TestIsDateDueOrOverdue(t *testing.T) {
 		}
 	}
 }
+
+func TestCurrentDateUsesHouseTimezone(t *testing.T) {
+	SetClock(FixedClock{Time: time.Date(2026, 9, 30, 17, 30, 0, 0, time.UTC)})
+	defer SetClock(nil)
+
+	if got := GetCurrentDate(Location()); got != "01/10/2026" {
+		t.Errorf("GetCurrentDate: expected 01/10/2026, got %s", got)
+	}
+	if got := GetCurrentMonthSheetName(Location()); got != "2026_10" {
+		t.Errorf("GetCurrentMonthSheetName: expected 2026_10, got %s", got)
+	}
+	if got := GetCurrentTimestamp(Location()); got != "01/10/2026 00:30" {
+		t.Errorf("GetCurrentTimestamp: expected 01/10/2026 00:30, got %s", got)
+	}
+}
+
+func TestCurrentDateUsesHouseholdTimezone(t *testing.T) {
+	SetClock(FixedClock{Time: time.Date(2026, 9, 30, 17, 30, 0, 0, time.UTC)})
+	defer SetClock(nil)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %s", err)
+	}
+	if got := GetCurrentDate(berlin); got != "30/09/2026" {
+		t.Errorf("GetCurrentDate: expected 30/09/2026, got %s", got)
+	}
+	if got := GetCurrentMonthSheetName(berlin); got != "2026_09" {
+		t.Errorf("GetCurrentMonthSheetName: expected 2026_09, got %s", got)
+	}
+	if due, _ := IsDateDueOrOverdue("01/10/2026", berlin); due {
+		t.Error("01/10/2026 is tomorrow in Berlin")
+	}
+}
@@ -0,0 +1,43 @@
+package utilities
+
+import "sync"
+
+// KeyedMutex serialises work per key, e.g., per spreadsheet.
+// The zero value is ready to use.
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// Lock locks the key and returns the function that unlocks it
+func (k *KeyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.waiters++
+	k.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		// Forget the key once nobody uses it, so the map does not grow forever
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
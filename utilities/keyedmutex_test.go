@@ -0,0 +1,36 @@
+package utilities
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestKeyedMutexSerialisesPerKey(t *testing.T) {
+	var locks KeyedMutex
+	var wg sync.WaitGroup
+	counters := map[string]*int{"a": new(int), "b": new(int)}
+
+	for i := 0; i < 50; i++ {
+		for key := range counters {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				unlock := locks.Lock(key)
+				defer unlock()
+				// Read and write in two steps, a race here loses increments
+				value := *counters[key]
+				*counters[key] = value + 1
+			}(key)
+		}
+	}
+	wg.Wait()
+
+	for key, value := range counters {
+		if *value != 50 {
+			t.Errorf("key %s: expected 50 increments, got %d", key, *value)
+		}
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("expected unused keys to be forgotten, %d left", len(locks.locks))
+	}
+}
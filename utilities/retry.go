@@ -0,0 +1,50 @@
+package utilities
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures how Retry waits between attempts
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, including the first one
+	BaseDelay   time.Duration // delay before the first retry, doubled for every next retry
+	MaxDelay    time.Duration // upper bound of the delay
+}
+
+// Backoff returns the delay before the given retry (1 for the first retry).
+// The delay grows exponentially and half of it is random, so concurrent callers do not retry together.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Retry calls fn until it succeeds, fails with an error that is not retryable,
+// runs out of attempts or ctx is done. It returns the last error of fn.
+func Retry(ctx context.Context, policy RetryPolicy, retryable func(err error) bool, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !retryable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
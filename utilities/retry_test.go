@@ -0,0 +1,84 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTemporary = errors.New("temporary")
+
+func isTemporary(err error) bool {
+	return errors.Is(err, errTemporary)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	testCases := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 1, max: 100 * time.Millisecond},
+		{retry: 2, max: 200 * time.Millisecond},
+		{retry: 3, max: 400 * time.Millisecond},
+		{retry: 5, max: time.Second}, // capped at MaxDelay
+		{retry: 10, max: time.Second},
+	}
+
+	for _, testCase := range testCases {
+		for i := 0; i < 20; i++ {
+			actual := policy.Backoff(testCase.retry)
+			if actual < testCase.max/2 || actual > testCase.max {
+				t.Fatalf("retry %d: expected a delay between %s and %s, got %s", testCase.retry, testCase.max/2, testCase.max, actual)
+			}
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	testCases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{name: "succeeds at once", errs: []error{nil}, expectedAttempts: 1},
+		{name: "succeeds after retries", errs: []error{errTemporary, errTemporary, nil}, expectedAttempts: 3},
+		{name: "runs out of attempts", errs: []error{errTemporary, errTemporary, errTemporary}, expectedAttempts: 3, expectedErr: errTemporary},
+		{name: "does not retry other errors", errs: []error{errors.New("bad request")}, expectedAttempts: 1, expectedErr: errors.New("bad request")},
+	}
+
+	for _, testCase := range testCases {
+		attempts := 0
+		err := Retry(context.Background(), policy, isTemporary, func() error {
+			err := testCase.errs[attempts]
+			attempts++
+			return err
+		})
+		if attempts != testCase.expectedAttempts {
+			t.Errorf("%s: expected %d attempts, got %d", testCase.name, testCase.expectedAttempts, attempts)
+		}
+		if (err == nil) != (testCase.expectedErr == nil) || (err != nil && err.Error() != testCase.expectedErr.Error()) {
+			t.Errorf("%s: expected error %v, got %v", testCase.name, testCase.expectedErr, err)
+		}
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	err := Retry(ctx, policy, isTemporary, func() error {
+		attempts++
+		return errTemporary
+	})
+	if attempts != 1 || !errors.Is(err, errTemporary) {
+		t.Errorf("expected one attempt with the temporary error, got %d attempts and %v", attempts, err)
+	}
+}
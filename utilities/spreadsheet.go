@@ -0,0 +1,24 @@
+package utilities
+
+import (
+	"regexp"
+	"strings"
+)
+
+// spreadsheetURLPattern extracts the spreadsheet ID from a Google Sheets URL
+var spreadsheetURLPattern = regexp.MustCompile(`/spreadsheets/d/([A-Za-z0-9_-]+)`)
+
+// spreadsheetIDPattern matches a bare spreadsheet ID
+var spreadsheetIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+
+// ParseSpreadsheetID returns the spreadsheet ID of a Google Sheets URL or a bare ID, false when text is neither
+func ParseSpreadsheetID(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if m := spreadsheetURLPattern.FindStringSubmatch(text); m != nil {
+		return m[1], true
+	}
+	if spreadsheetIDPattern.MatchString(text) {
+		return text, true
+	}
+	return "", false
+}
@@ -0,0 +1,25 @@
+package utilities
+
+import "testing"
+
+func TestParseSpreadsheetID(t *testing.T) {
+	const id = "1aBcD-efGhIjKlMnOpQrStUvWxYz_0123456789"
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"https://docs.google.com/spreadsheets/d/" + id + "/edit#gid=0", id, true},
+		{"docs.google.com/spreadsheets/d/" + id, id, true},
+		{"  " + id + "\n", id, true},
+		{"https://example.com/" + id + "/edit", "", false},
+		{"my sheet", "", false},
+		{"short", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseSpreadsheetID(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseSpreadsheetID(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}